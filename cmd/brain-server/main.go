@@ -10,11 +10,16 @@ import (
 	"time"
 
 	"github.com/mrwolf/brain-server/internal/api"
+	"github.com/mrwolf/brain-server/internal/certs"
 	"github.com/mrwolf/brain-server/internal/config"
 	"github.com/mrwolf/brain-server/internal/db"
+	"github.com/mrwolf/brain-server/internal/embeddings"
 	"github.com/mrwolf/brain-server/internal/llm"
 	"github.com/mrwolf/brain-server/internal/narrator"
+	"github.com/mrwolf/brain-server/internal/oidc"
+	"github.com/mrwolf/brain-server/internal/prompts"
 	"github.com/mrwolf/brain-server/internal/scheduler"
+	"github.com/mrwolf/brain-server/internal/search"
 	"github.com/mrwolf/brain-server/internal/vault"
 )
 
@@ -34,54 +39,135 @@ func main() {
 		log.Fatalf("Failed to open database: %v", err)
 	}
 
+	// Register the bootstrap tokens from the environment; everyone else is managed via the admin API
+	for userID, token := range cfg.BootstrapTokens() {
+		if err := database.EnsureUserToken(userID, "bootstrap", token); err != nil {
+			log.Fatalf("Failed to register bootstrap token for %s: %v", userID, err)
+		}
+	}
+	users, err := database.GetActiveUserIDs()
+	if err != nil {
+		log.Fatalf("Failed to load users: %v", err)
+	}
+	if len(users) == 0 {
+		log.Fatalf("No users: set BRAIN_TOKEN_WOLF or BRAIN_TOKEN_WIFE to create the first one")
+	}
+	log.Printf("Users: %v", users)
+
 	// Create vault
 	v := vault.NewVault(cfg.VaultPath)
 
-	// Create LLM client
-	llmClient := llm.NewClient(cfg.OllamaURL, cfg.OllamaModel, cfg.OllamaModelHeavy)
+	// Encrypt sensitive folders at rest with per-user keys
+	if len(cfg.VaultKeys) > 0 {
+		v.SetEncryption(cfg.VaultKeys, cfg.EncryptedFolders)
+		log.Printf("Vault encryption enabled for %v (keys for %v)", cfg.EncryptedFolders, cfg.VaultKeys.Actors())
+		for _, user := range users {
+			if _, ok := cfg.VaultKeys[user]; !ok {
+				log.Printf("WARNING: No vault key for %s, their notes in %v are written unencrypted", user, cfg.EncryptedFolders)
+			}
+		}
+
+		// Keep the plaintext of encrypted folders out of brain.db: capture text and
+		// cached LLM responses are sealed, and the search index, which cannot be
+		// sealed, leaves those folders out
+		if err := database.SetSealer(cfg.VaultKeys); err != nil {
+			log.Fatalf("Failed to seal capture text in the database: %v", err)
+		}
+		if err := database.SetUnindexedFolders(cfg.EncryptedFolders); err != nil {
+			log.Fatalf("Failed to remove encrypted folders from the search index: %v", err)
+		}
+		log.Printf("WARNING: Notes and captures in %v are left out of search and semantic search while they are encrypted", cfg.EncryptedFolders)
+	}
+
+	// Keep the full-text search index in step with vault writes
+	searchIndex := search.NewIndex(database)
+	searchIndex.SetReader(v.ReadFile)
+	v.SetIndexer(searchIndex)
+	go func() {
+		n, err := searchIndex.Reindex(cfg.VaultPath)
+		if err != nil {
+			log.Printf("WARNING: Search reindex failed after %d files: %v", n, err)
+			return
+		}
+		log.Printf("Search index refreshed (%d vault files)", n)
+	}()
 
-	// Validate Ollama connection at startup
-	log.Println("Validating Ollama connection...")
+	// Create LLM client for the configured provider
+	provider, err := llm.NewProvider(cfg.LLMProvider, cfg.LLMURL(), cfg.OpenAIAPIKey)
+	if err != nil {
+		log.Fatalf("Failed to create LLM provider: %v", err)
+	}
+	llmClient := llm.NewClientWithProvider(provider, cfg.OllamaModel, cfg.OllamaModelHeavy)
+	llmClient.SetEmbedModel(cfg.OllamaEmbedModel)
+	llmClient.SetRoutes(cfg.LLMRoutes)
+	llmClient.SetRecorder(database)
+	llmClient.SetCache(database)
+	llmClient.SetConcurrency(cfg.LLMParallel)
+	llmClient.SetBreaker(llm.NewBreaker(cfg.LLMBreakerThreshold, cfg.LLMBreakerCooldown))
+	llmClient.SetRedaction(cfg.Redaction)
+
+	// Embed documents for semantic search as they are indexed
+	searchIndex.SetEmbedder(embeddings.NewEmbedder(llmClient, database))
+
+	// Validate LLM connection at startup
+	log.Printf("Validating %s connection...", provider.Name())
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	if err := llmClient.HealthCheck(ctx); err != nil {
-		log.Printf("WARNING: Ollama health check failed: %v", err)
+		log.Printf("WARNING: %s health check failed: %v", provider.Name(), err)
 		log.Println("Server will start but LLM features may not work")
 	} else {
-		log.Printf("Ollama connected: %s (models: %s, %s)", cfg.OllamaURL, cfg.OllamaModel, cfg.OllamaModelHeavy)
+		log.Printf("%s connected: %s (models: %s, %s)", provider.Name(), cfg.LLMURL(), cfg.OllamaModel, cfg.OllamaModelHeavy)
 	}
 	cancel()
 
+	// Load prompt templates, overridable from the vault's _System/Prompts folder
+	promptStore := prompts.NewStore(cfg.VaultPath)
+	for _, info := range promptStore.Load() {
+		log.Printf("WARNING: Prompt override %s rejected, using the default: %s", info.Path, info.Error)
+	}
+
 	// Create narrator for journal processing
 	llmAdapter := narrator.NewBrainServerAdapter(llmClient)
 	narratorConfig := narrator.DefaultConfig(cfg.VaultPath)
+	narratorConfig.Model = llmClient.Route(llm.TaskNarrate).Model
+	narratorConfig.Prompts = promptStore
 	narr, err := narrator.New(llmAdapter, narratorConfig)
 	if err != nil {
 		log.Printf("WARNING: Failed to create narrator: %v", err)
 		log.Println("Journal narration features will not be available")
 		narr = nil
 	} else {
+		narr.SetIndexer(searchIndex)
+		narr.SetFiles(v)
 		log.Println("Narrator initialized")
 	}
 
 	// Create router
 	router, handlers := api.NewRouter(cfg, database, v, llmClient)
+	log.Printf("Rate limits: %s", cfg.RateLimits)
+	handlers.SetPrompts(promptStore)
 
-	// Create and start scheduler
-	actors := []string{}
-	if cfg.TokenWolf != "" {
-		actors = append(actors, "wolf")
-	}
-	if cfg.TokenWife != "" {
-		actors = append(actors, "wife")
+	// Optional OpenID Connect logins for the web UI and the app
+	if cfg.OIDCIssuer != "" {
+		handlers.SetOIDC(oidc.NewProvider(oidc.Config{
+			Issuer:       cfg.OIDCIssuer,
+			ClientID:     cfg.OIDCClientID,
+			ClientSecret: cfg.OIDCClientSecret,
+			RedirectURL:  cfg.OIDCRedirectURL,
+		}))
+		api.AddAuthRoutes(router, handlers)
+		log.Printf("OpenID Connect login enabled via %s", cfg.OIDCIssuer)
 	}
 
+	// Create and start scheduler (per-user jobs run for the active users)
 	sched, err := scheduler.New(database, v, llmClient, scheduler.Config{
-		Timezone: cfg.Timezone,
-		Actors:   actors,
+		Timezone:           cfg.Timezone,
+		AuditRetentionDays: cfg.AuditRetentionDays,
 	})
 	if err != nil {
 		log.Fatalf("Failed to create scheduler: %v", err)
 	}
+	sched.SetPrompts(promptStore)
 	if err := sched.Start(); err != nil {
 		log.Fatalf("Failed to start scheduler: %v", err)
 	}
@@ -97,7 +183,7 @@ func main() {
 			log.Printf("WARNING: Failed to add narrator job: %v", err)
 		}
 		// Add journal routes
-		api.AddJournalRoutes(router, handlers, cfg)
+		api.AddJournalRoutes(router, handlers)
 		log.Println("Journal routes and scheduler configured")
 	}
 
@@ -108,18 +194,58 @@ func main() {
 		Handler: router,
 	}
 
+	// Serve HTTPS when a certificate is configured, reloading it when the files change
+	// or on SIGHUP, and optionally authenticating clients by certificate
+	watchCtx, stopWatch := context.WithCancel(context.Background())
+	defer stopWatch()
+	var reloader *certs.Reloader
+	if cfg.TLSCertFile != "" {
+		reloader, err = certs.NewReloader(cfg.TLSCertFile, cfg.TLSKeyFile, cfg.TLSClientCAFile)
+		if err != nil {
+			log.Fatalf("Failed to load TLS certificate: %v", err)
+		}
+		server.TLSConfig = reloader.TLSConfig(cfg.TLSClientAuth)
+		go reloader.Watch(watchCtx, time.Minute)
+		log.Printf("TLS enabled (certificate expires %s)", reloader.Expiry().Format(time.RFC3339))
+		if cfg.TLSClientCAFile != "" {
+			log.Printf("Client certificates: %s, mapped for %d subjects", cfg.TLSClientAuth, len(cfg.TLSClientSubjects))
+		}
+	}
+
 	// Graceful shutdown
 	done := make(chan os.Signal, 1)
 	signal.Notify(done, os.Interrupt, syscall.SIGTERM)
+	reload := make(chan os.Signal, 1)
+	signal.Notify(reload, syscall.SIGHUP)
 
 	go func() {
 		log.Printf("Listening on %s", addr)
-		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		var err error
+		if reloader != nil {
+			err = server.ListenAndServeTLS("", "")
+		} else {
+			err = server.ListenAndServe()
+		}
+		if err != nil && err != http.ErrServerClosed {
 			log.Fatalf("Server error: %v", err)
 		}
 	}()
 
-	<-done
+	for waiting := true; waiting; {
+		select {
+		case <-done:
+			waiting = false
+		case <-reload:
+			if reloader == nil {
+				continue
+			}
+			if err := reloader.Reload(); err != nil {
+				log.Printf("TLS reload failed, keeping the current certificate: %v", err)
+			} else {
+				log.Printf("TLS certificate reloaded (expires %s)", reloader.Expiry().Format(time.RFC3339))
+			}
+		}
+	}
 	log.Println("Shutting down gracefully...")
 
 	// Give ongoing requests 10 seconds to complete
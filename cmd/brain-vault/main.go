@@ -0,0 +1,123 @@
+// Command brain-vault creates vault encryption keys and encrypts or decrypts the
+// files already in the vault. It reads brain-server's configuration; stop the
+// server while it runs.
+//
+//	brain-vault keygen <user>         print a key line for BRAIN_VAULT_KEYS_FILE
+//	brain-vault encrypt [folder ...]  encrypt plaintext files, by default in BRAIN_ENCRYPTED_FOLDERS and the capture log
+//	brain-vault decrypt [folder ...]  decrypt files, e.g. before removing a folder from BRAIN_ENCRYPTED_FOLDERS
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/mrwolf/brain-server/internal/config"
+	"github.com/mrwolf/brain-server/internal/vault"
+)
+
+const usage = `usage: brain-vault keygen <user>
+       brain-vault encrypt [folder ...]
+       brain-vault decrypt [folder ...]`
+
+func main() {
+	log.SetFlags(0)
+	if len(os.Args) < 2 {
+		log.Fatal(usage)
+	}
+
+	switch cmd, args := os.Args[1], os.Args[2:]; cmd {
+	case "keygen":
+		if len(args) != 1 {
+			log.Fatal(usage)
+		}
+		key, err := vault.GenerateKey()
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("%s=%s\n", args[0], key)
+	case "encrypt", "decrypt":
+		if err := convert(cmd, args); err != nil {
+			log.Fatal(err)
+		}
+	default:
+		log.Fatal(usage)
+	}
+}
+
+// convert encrypts or decrypts the markdown and JSONL files in folders
+func convert(cmd string, folders []string) error {
+	cfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("loading config: %w", err)
+	}
+	if len(cfg.VaultKeys) == 0 {
+		return fmt.Errorf("no vault keys: set BRAIN_VAULT_KEYS_FILE or BRAIN_VAULT_KEYS")
+	}
+	// The capture log holds text from every folder, so it goes with the default set
+	captureLog := len(folders) == 0
+	if captureLog {
+		folders = cfg.EncryptedFolders
+	}
+
+	v := vault.NewVault(cfg.VaultPath)
+	v.SetEncryption(cfg.VaultKeys, cfg.EncryptedFolders)
+	apply := v.EncryptFile
+	if cmd == "decrypt" {
+		apply = v.DecryptFile
+	}
+
+	changed, failed := 0, 0
+	convertFile := func(path string) {
+		ok, err := apply(path)
+		if err != nil {
+			log.Printf("%s: %v", path, err)
+			failed++
+			return
+		}
+		if ok {
+			fmt.Printf("%sed %s\n", cmd, path)
+			changed++
+		}
+	}
+	for _, folder := range folders {
+		root := filepath.Join(cfg.VaultPath, folder)
+		err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			name := d.Name()
+			if d.IsDir() {
+				// Skip state folders such as Journal/_meta, which the narrator keeps in plaintext
+				if path != root && (strings.HasPrefix(name, "_") || strings.HasPrefix(name, ".")) {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if strings.HasPrefix(name, ".") || (filepath.Ext(name) != ".md" && filepath.Ext(name) != ".jsonl") {
+				return nil
+			}
+
+			convertFile(path)
+			return nil
+		})
+		if err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("walking %s: %w", folder, err)
+		}
+	}
+	if captureLog {
+		path := filepath.Join(cfg.VaultPath, "Log", "captures.jsonl")
+		if _, err := os.Stat(path); err == nil {
+			convertFile(path)
+		}
+	}
+
+	fmt.Printf("%d files %sed\n", changed, cmd)
+	if failed > 0 {
+		return fmt.Errorf("%d files failed", failed)
+	}
+	return nil
+}
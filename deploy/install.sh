@@ -14,7 +14,7 @@ echo "Installing brain-server..."
 if [ ! -f "$PROJECT_DIR/brain-server" ]; then
     echo "Building..."
     cd "$PROJECT_DIR"
-    go build -o brain-server ./cmd/brain-server
+    go build -tags sqlite_fts5 -o brain-server ./cmd/brain-server
 fi
 
 # Create vault directory structure
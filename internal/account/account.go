@@ -0,0 +1,439 @@
+// Package account exports everything stored for a user, or deletes it.
+//
+// A user's data lives in SQLite (see db.ExportActor), in their own vault files
+// (notes, raw journal entries, letters, research and their ledger) and in their
+// lines of logs shared with other users: the capture and audit logs and the
+// narration map. Narrated journal days mix everyone's entries. A day narrated only
+// from the user's entries is theirs. A day that also has other users' entries is
+// split into the batches it was narrated in (one per journal map line): only the
+// batches written from the user's entries alone are exported, and every batch with
+// any of their entries is removed on delete.
+package account
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mrwolf/brain-server/internal/db"
+	"github.com/mrwolf/brain-server/internal/signals"
+	"github.com/mrwolf/brain-server/internal/vault"
+)
+
+// Vault logs with lines from every user, each line naming its actor
+var sharedLogs = []string{
+	filepath.Join("Log", "captures.jsonl"),
+	filepath.Join("Log", "audit.jsonl"),
+}
+
+// journalMap is the narrator's record of the raw entries each narrated day was written from
+var journalMap = filepath.Join("Journal", "_meta", "journal_map.jsonl")
+
+// Manifest describes an export
+type Manifest struct {
+	Actor      string         `json:"actor"`
+	ExportedAt time.Time      `json:"exported_at"`
+	Rows       map[string]int `json:"rows"`  // rows exported by table
+	Files      []string       `json:"files"` // vault files, under vault/
+}
+
+// Report describes a deletion
+type Report struct {
+	Actor        string         `json:"actor"`
+	Rows         map[string]int `json:"rows"`                    // rows deleted by table
+	Files        []string       `json:"files"`                   // vault files deleted
+	LogLines     map[string]int `json:"log_lines"`               // lines changed in shared logs
+	RedactedDays []string       `json:"redacted_days,omitempty"` // narrated journal days kept for other users, without the user's batches
+}
+
+// Export writes a zip of a user's data to w:
+//
+//	manifest.json
+//	database/<table>.json   their rows from each table
+//	signals.json            their trends over the past week
+//	vault/...               their vault files and log lines, decrypted
+func Export(w io.Writer, database *db.DB, v *vault.Vault, actor string) (*Manifest, error) {
+	files, err := ownedFiles(database, v, actor)
+	if err != nil {
+		return nil, err
+	}
+	journal, err := journalDays(v, files)
+	if err != nil {
+		return nil, err
+	}
+	tables, err := database.ExportActor(actor)
+	if err != nil {
+		return nil, err
+	}
+	trend, err := signals.BuildTrendData(database, actor, time.Now())
+	if err != nil {
+		return nil, fmt.Errorf("building trends: %w", err)
+	}
+	trend.Shared = nil // other users' captures
+
+	manifest := &Manifest{Actor: actor, ExportedAt: time.Now().UTC(), Rows: make(map[string]int)}
+	zw := zip.NewWriter(w)
+	for table, rows := range tables {
+		manifest.Rows[table] = len(rows)
+		if err := writeJSON(zw, "database/"+table+".json", rows); err != nil {
+			return nil, err
+		}
+	}
+	if err := writeJSON(zw, "signals.json", trend); err != nil {
+		return nil, err
+	}
+
+	addFile := func(relPath string, content []byte) error {
+		manifest.Files = append(manifest.Files, filepath.ToSlash(relPath))
+		f, err := zw.Create("vault/" + filepath.ToSlash(relPath))
+		if err != nil {
+			return err
+		}
+		_, err = f.Write(content)
+		return err
+	}
+	for _, rel := range append(files, journal.ownPaths()...) {
+		content, err := v.ReadFile(filepath.Join(v.BasePath(), rel))
+		if err != nil {
+			return nil, err
+		}
+		if err := addFile(rel, content); err != nil {
+			return nil, err
+		}
+	}
+	for _, day := range journal.mixed() {
+		content, _, err := journal.filterDay(v, day, func(b batch) bool { return b.own && !b.others })
+		if err != nil {
+			return nil, err
+		}
+		if content != nil {
+			if err := addFile(dailyPath(day), content); err != nil {
+				return nil, err
+			}
+		}
+	}
+	for _, rel := range sharedLogs {
+		lines, err := v.SelectLines(rel, vault.ByActor(actor))
+		if err != nil {
+			return nil, fmt.Errorf("reading %s: %w", rel, err)
+		}
+		if len(lines) > 0 {
+			if err := addFile(rel, lines); err != nil {
+				return nil, err
+			}
+		}
+	}
+	lines, err := v.SelectLines(journalMap, journal.hasOwnEntries)
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", journalMap, err)
+	}
+	if mapping := journal.onlyOwnEntries(lines); len(mapping) > 0 {
+		if err := addFile(journalMap, mapping); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := writeJSON(zw, "manifest.json", manifest); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, fmt.Errorf("writing export: %w", err)
+	}
+	return manifest, nil
+}
+
+func writeJSON(zw *zip.Writer, name string, v interface{}) error {
+	f, err := zw.Create(name)
+	if err != nil {
+		return fmt.Errorf("writing %s: %w", name, err)
+	}
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// Delete removes a user's vault files, their lines from shared logs, narrated days
+// written only from their entries and their batches of other narrated days, then
+// their rows in SQLite, cached LLM responses to their requests included. The
+// vault goes first so an interrupted delete can be run again.
+func Delete(database *db.DB, v *vault.Vault, actor string) (*Report, error) {
+	files, err := ownedFiles(database, v, actor)
+	if err != nil {
+		return nil, err
+	}
+	journal, err := journalDays(v, files)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &Report{Actor: actor, LogLines: make(map[string]int)}
+	for _, rel := range append(files, journal.ownPaths()...) {
+		if err := v.RemoveFile(rel); err != nil {
+			return nil, fmt.Errorf("deleting %s: %w", rel, err)
+		}
+		report.Files = append(report.Files, filepath.ToSlash(rel))
+	}
+
+	// Other users' days lose the batches with the user's entries, in the file and
+	// in the search index they were copied to
+	var dropped []string
+	for _, day := range journal.mixed() {
+		content, removed, err := journal.filterDay(v, day, func(b batch) bool { return !b.own })
+		if err != nil {
+			return nil, err
+		}
+		rel := dailyPath(day)
+		if content == nil {
+			err = v.RemoveFile(rel)
+			report.Files = append(report.Files, filepath.ToSlash(rel))
+		} else {
+			err = v.WriteFile(filepath.Join(v.BasePath(), rel), content)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("redacting %s: %w", rel, err)
+		}
+		report.RedactedDays = append(report.RedactedDays, day)
+		dropped = append(dropped, removed...)
+	}
+
+	for _, rel := range sharedLogs {
+		isActor := vault.ByActor(actor)
+		n, err := v.RewriteLines(rel, func(line []byte) []byte {
+			if isActor(line) {
+				return nil
+			}
+			return line
+		})
+		if err != nil {
+			return nil, fmt.Errorf("rewriting %s: %w", rel, err)
+		}
+		report.LogLines[filepath.ToSlash(rel)] = n
+	}
+	n, err := v.RewriteLines(journalMap, journal.withoutOwnBatches)
+	if err != nil {
+		return nil, fmt.Errorf("rewriting %s: %w", journalMap, err)
+	}
+	report.LogLines[filepath.ToSlash(journalMap)] = n
+
+	if report.Rows, err = database.DeleteActor(actor); err != nil {
+		return nil, err
+	}
+	for _, text := range dropped {
+		n, err := database.DeleteSearchDocsByBody(db.DocJournalDaily, text)
+		if err != nil {
+			return nil, fmt.Errorf("removing narrations from the search index: %w", err)
+		}
+		report.Rows["search_docs"] += n
+	}
+	return report, nil
+}
+
+// ownedFiles returns a user's vault files, their ledger included
+func ownedFiles(database *db.DB, v *vault.Vault, actor string) ([]string, error) {
+	ids, err := database.GetCaptureIDs(actor)
+	if err != nil {
+		return nil, fmt.Errorf("listing captures: %w", err)
+	}
+	captureIDs := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		captureIDs[id] = true
+	}
+	files, err := v.ActorFiles(actor, captureIDs)
+	if err != nil {
+		return nil, fmt.Errorf("listing vault files: %w", err)
+	}
+	ledger := filepath.Join("Financial", "Ledger", "transactions_"+actor+".jsonl")
+	if vault.FileExists(filepath.Join(v.BasePath(), ledger)) {
+		files = append(files, ledger)
+	}
+	return files, nil
+}
+
+// narration is a line of the journal map
+type narration struct {
+	Day      string   `json:"day"`
+	RawFiles []string `json:"raw_files"`
+}
+
+// batch is whose raw entries a batch of a narrated day was written from
+type batch struct {
+	own    bool // any of the user's
+	others bool // any of other users'
+}
+
+// days sorts narrated journal days by whose raw entries they were written from
+type days struct {
+	ownRaw  map[string]bool    // the user's raw journal files, by name
+	own     map[string]bool    // days narrated only from the user's entries
+	shared  map[string]bool    // days with the user's and other users' entries
+	batches map[string][]batch // each day's batches, in the order they were narrated
+}
+
+// journalDays reads the journal map to find the days narrated from the user's raw
+// journal entries, given their vault files
+func journalDays(v *vault.Vault, files []string) (*days, error) {
+	d := &days{ownRaw: make(map[string]bool), own: make(map[string]bool), shared: make(map[string]bool), batches: make(map[string][]batch)}
+	rawDir := filepath.Join("Journal", "Raw")
+	for _, f := range files {
+		if filepath.Dir(f) == rawDir {
+			d.ownRaw[filepath.Base(f)] = true
+		}
+	}
+	if len(d.ownRaw) == 0 {
+		return d, nil
+	}
+
+	lines, err := v.SelectLines(journalMap, func([]byte) bool { return true })
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", journalMap, err)
+	}
+	others := make(map[string]bool)
+	for _, line := range strings.Split(string(lines), "\n") {
+		var n narration
+		if json.Unmarshal([]byte(line), &n) != nil || n.Day == "" {
+			continue
+		}
+		var b batch
+		for _, f := range n.RawFiles {
+			if d.ownRaw[filepath.Base(f)] {
+				b.own = true
+				d.own[n.Day] = true
+			} else {
+				b.others = true
+				others[n.Day] = true
+			}
+		}
+		d.batches[n.Day] = append(d.batches[n.Day], b)
+	}
+	for day := range d.own {
+		if others[day] {
+			delete(d.own, day)
+			d.shared[day] = true
+		}
+	}
+	return d, nil
+}
+
+func dailyPath(day string) string {
+	return filepath.Join("Journal", "Daily", day+".md")
+}
+
+// ownPaths returns the daily files narrated only from the user's entries
+func (d *days) ownPaths() []string {
+	return dailyPaths(d.own)
+}
+
+// mixed returns the days that also have other users' entries, sorted
+func (d *days) mixed() []string {
+	return sortedKeys(d.shared)
+}
+
+func dailyPaths(set map[string]bool) []string {
+	var paths []string
+	for _, day := range sortedKeys(set) {
+		paths = append(paths, dailyPath(day))
+	}
+	return paths
+}
+
+func sortedKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for k := range set {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// hasOwnEntries matches journal map lines naming any of the user's raw files
+func (d *days) hasOwnEntries(line []byte) bool {
+	var n narration
+	if json.Unmarshal(line, &n) != nil {
+		return false
+	}
+	for _, f := range n.RawFiles {
+		if d.ownRaw[filepath.Base(f)] {
+			return true
+		}
+	}
+	return false
+}
+
+// withoutOwnBatches drops journal map lines naming any of the user's raw files,
+// whose batches are removed from the daily files
+func (d *days) withoutOwnBatches(line []byte) []byte {
+	if d.hasOwnEntries(line) {
+		return nil
+	}
+	return line
+}
+
+// onlyOwnEntries rewrites journal map lines to name only the user's raw files
+func (d *days) onlyOwnEntries(lines []byte) []byte {
+	var out []byte
+	for _, line := range bytes.Split(lines, []byte("\n")) {
+		var entry map[string]interface{}
+		var n narration
+		if json.Unmarshal(line, &entry) != nil || json.Unmarshal(line, &n) != nil {
+			continue
+		}
+		var own []string
+		for _, f := range n.RawFiles {
+			if d.ownRaw[filepath.Base(f)] {
+				own = append(own, f)
+			}
+		}
+		entry["raw_files"] = own
+		if line, err := json.Marshal(entry); err == nil {
+			out = append(append(out, line...), '\n')
+		}
+	}
+	return out
+}
+
+// batchSeparator separates the batches of a narrated day (see narrator.Writer)
+const batchSeparator = "\n\n---\n\n"
+
+// filterDay returns a narrated day's file with only the batches keep accepts, or
+// nil if there are none, and the text of the batches left out. If the file's
+// batches don't line up with the journal map, all of them are left out.
+func (d *days) filterDay(v *vault.Vault, day string, keep func(batch) bool) ([]byte, []string, error) {
+	data, err := v.ReadFile(filepath.Join(v.BasePath(), dailyPath(day)))
+	if os.IsNotExist(err) {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	content := string(data)
+	var frontmatter string
+	if strings.HasPrefix(content, "---\n") {
+		if end := strings.Index(content[4:], "\n---\n"); end >= 0 {
+			frontmatter, content = content[:4+end+5], content[4+end+5:]
+		}
+	}
+	sections := strings.Split(strings.TrimSpace(content), batchSeparator)
+	batches := d.batches[day]
+
+	var kept, dropped []string
+	for i, section := range sections {
+		section = strings.TrimSpace(section)
+		if len(sections) == len(batches) && keep(batches[i]) {
+			kept = append(kept, section)
+		} else if section != "" {
+			dropped = append(dropped, section)
+		}
+	}
+	if len(kept) == 0 {
+		return nil, dropped, nil
+	}
+	return []byte(frontmatter + "\n" + strings.Join(kept, batchSeparator) + "\n"), dropped, nil
+}
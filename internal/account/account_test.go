@@ -0,0 +1,251 @@
+package account
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mrwolf/brain-server/internal/db"
+	"github.com/mrwolf/brain-server/internal/vault"
+)
+
+// setupHousehold writes captures, notes, journal entries and logs for wolf and wife,
+// with the Journal folder encrypted. Wolf alone narrated 2024-01-15; on 2024-01-16
+// a batch of wolf's entries, a batch of both users' and one of wife's were narrated.
+func setupHousehold(t *testing.T) (*db.DB, *vault.Vault) {
+	t.Helper()
+	tmpDir := t.TempDir()
+	database, err := db.Open(filepath.Join(tmpDir, "test.db"))
+	if err != nil {
+		t.Fatalf("opening database: %v", err)
+	}
+	t.Cleanup(func() { database.Close() })
+
+	v := vault.NewVault(filepath.Join(tmpDir, "vault"))
+	var entries []string
+	for _, actor := range []string{"wolf", "wife"} {
+		key, _ := vault.GenerateKey()
+		entries = append(entries, actor+"="+key)
+	}
+	keys, err := vault.ParseKeys(strings.Join(entries, ","))
+	if err != nil {
+		t.Fatal(err)
+	}
+	v.SetEncryption(keys, []string{"Journal"})
+
+	must := func(err error) {
+		t.Helper()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	raw := make(map[string]string)
+	for i, actor := range []string{"wolf", "wife"} {
+		must(database.EnsureUserToken(actor, "bootstrap", "token_"+actor))
+		id := "cap_" + actor
+		created := time.Date(2024, 1, 15+i, 9, 0, 0, 0, time.UTC)
+		must(database.LogCapture(id, actor, "auto", actor+" idea", "Ideas", "filed", 0.9))
+		must(v.LogCapture(vault.NewCaptureLog(id, actor, "auto", actor+" idea", "Ideas", "filed", "", 0.9)))
+		_, err := v.WriteNote(vault.Note{ID: id, Created: created, Category: "Ideas", Actor: actor, Title: actor + " idea", Content: actor + " idea"})
+		must(err)
+		raw[actor], err = v.WriteRawJournalCapture(vault.Note{ID: id + "_j", Created: created, Actor: actor, Content: actor + " journal"})
+		must(err)
+	}
+	_, err = v.WriteTransaction(vault.NewTransaction("cap_tx", "wolf", "", "coffee", 3.5, "GBP", "Cafe", "food", "", 0.9))
+	must(err)
+
+	// Narrated days are written plain by the narrator
+	wolfRaw, wifeRaw := `"`+filepath.Base(raw["wolf"])+`"`, `"`+filepath.Base(raw["wife"])+`"`
+	mapLines := []string{
+		`{"day":"2024-01-15","raw_files":[` + wolfRaw + `],"model":"m"}`,
+		`{"day":"2024-01-16","raw_files":[` + wolfRaw + `],"model":"m"}`,
+		`{"day":"2024-01-16","raw_files":[` + wolfRaw + `,` + wifeRaw + `],"model":"m"}`,
+		`{"day":"2024-01-16","raw_files":[` + wifeRaw + `],"model":"m"}`,
+	}
+	daily := map[string]string{
+		"2024-01-15": "A day.",
+		"2024-01-16": "Wolf walked.\n\n---\n\nWolf and wife cooked.\n\n---\n\nWife baked.",
+	}
+	for day, text := range daily {
+		must(vault.WriteFileAtomic(filepath.Join(v.BasePath(), "Journal", "Daily", day+".md"), []byte("---\ndate: "+day+"\n---\n\n"+text+"\n")))
+	}
+	must(vault.WriteFileAtomic(filepath.Join(v.BasePath(), journalMap), []byte(strings.Join(mapLines, "\n")+"\n")))
+
+	// Narrations indexed for wife before mixed batches were kept out of the index
+	for i, text := range []string{"Wolf and wife cooked.", "Wife baked."} {
+		must(database.IndexSearchDoc(db.SearchDoc{DocID: fmt.Sprintf("daily_2024-01-16_%d", i), Kind: db.DocJournalDaily, Actor: "wife", Body: text, Created: time.Now()}))
+	}
+	must(database.PutLLMCache("key", "wolf", "classify", "m", `{"cleaned_text": "wolf idea"}`, time.Hour))
+	must(database.PutLLMCache("wife_key", "wife", "classify", "m", `{"cleaned_text": "wife idea"}`, time.Hour))
+
+	// big_wolf's letter must not be taken for wolf's
+	must(database.SaveLetter("let_2024-01-15_wolf_daily", "daily", "2024-01-15", "Letters/Daily/2024-01-15.md"))
+	must(database.SaveLetter("let_2024-W03_wolf_weekly", "weekly", "2024-W03", "Letters/Weekly/2024-W03.md"))
+	must(database.SaveLetter("let_2024-01-15_big_wolf_daily", "daily", "2024-01-15", "Letters/Daily/2024-01-15.md"))
+
+	must(database.SetSharing("cap_wife", "wife", db.Sharing{Visibility: db.VisibilityActors, With: []string{"wolf"}}))
+	_, err = database.AddComment("cap_wife", "wolf", "nice")
+	must(err)
+	_, err = database.AddComment("cap_wolf", "wife", "agreed")
+	must(err)
+	return database, v
+}
+
+func TestExport(t *testing.T) {
+	database, v := setupHousehold(t)
+
+	var buf bytes.Buffer
+	manifest, err := Export(&buf, database, v, "wolf")
+	if err != nil {
+		t.Fatalf("Export: %v", err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("reading zip: %v", err)
+	}
+	files := make(map[string]string)
+	for _, f := range zr.File {
+		rc, _ := f.Open()
+		data, _ := io.ReadAll(rc)
+		rc.Close()
+		files[f.Name] = string(data)
+	}
+
+	tests := []struct {
+		name    string
+		want    string // empty to check the file is absent
+		notWant string
+	}{
+		{"vault/Ideas/2024-01-15-wolf-idea.md", "wolf idea", ""},
+		{"vault/Ideas/2024-01-16-wife-idea.md", "", ""},
+		{"vault/Financial/Ledger/transactions_wolf.jsonl", "Cafe", ""},
+		{"vault/Journal/Daily/2024-01-15.md", "A day.", ""},
+		{"vault/Journal/Daily/2024-01-16.md", "Wolf walked.", "cooked"},
+		{"vault/Journal/Daily/2024-01-16.md", "Wolf walked.", "Wife baked."},
+		{"vault/Log/captures.jsonl", `"actor":"wolf"`, `"actor":"wife"`},
+		{"vault/Journal/_meta/journal_map.jsonl", "2024-01-16", "cap_wife"},
+		{"database/letters.json", "let_2024-W03_wolf_weekly", "big_wolf"},
+		{"database/capture_log.json", "cap_wolf", "cap_wife"},
+		{"database/capture_comments.json", `"text": "nice"`, ""},   // theirs
+		{"database/capture_comments.json", `"text": "agreed"`, ""}, // on their capture
+		{"database/api_tokens.json", "bootstrap", "token_hash"},
+		{"signals.json", "Days", ""},
+		{"manifest.json", `"actor": "wolf"`, ""},
+	}
+	for _, tt := range tests {
+		got, ok := files[tt.name]
+		if tt.want == "" {
+			if ok {
+				t.Errorf("%s exported, want it left out", tt.name)
+			}
+			continue
+		}
+		if !ok || !strings.Contains(got, tt.want) || (tt.notWant != "" && strings.Contains(got, tt.notWant)) {
+			t.Errorf("%s = %q, want %q and not %q", tt.name, got, tt.want, tt.notWant)
+		}
+	}
+
+	// Raw journal entries are decrypted
+	for name, content := range files {
+		if strings.HasPrefix(name, "vault/Journal/Raw/") && !strings.Contains(content, "wolf journal") {
+			t.Errorf("%s = %q, want the decrypted entry", name, content)
+		}
+	}
+	if manifest.Rows["capture_log"] != 1 || manifest.Rows["users"] != 1 || manifest.Rows["letters"] != 2 {
+		t.Errorf("manifest rows = %v, want 1 capture, 2 letters and 1 user", manifest.Rows)
+	}
+}
+
+func TestDelete(t *testing.T) {
+	database, v := setupHousehold(t)
+
+	report, err := Delete(database, v, "wolf")
+	if err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if len(report.RedactedDays) != 1 || report.RedactedDays[0] != "2024-01-16" {
+		t.Errorf("redacted days = %v, want [2024-01-16]", report.RedactedDays)
+	}
+	if report.Rows["users"] != 1 || report.Rows["capture_comments"] != 2 || report.Rows["letters"] != 2 || report.Rows["llm_cache"] != 1 || report.LogLines["Log/captures.jsonl"] != 1 {
+		t.Errorf("report = %+v", report)
+	}
+
+	base := v.BasePath()
+	files := []struct {
+		path   string
+		exists bool
+	}{
+		{"Ideas/2024-01-15-wolf-idea.md", false},
+		{"Ideas/2024-01-16-wife-idea.md", true},
+		{"Financial/Ledger/transactions_wolf.jsonl", false},
+		{"Journal/Daily/2024-01-15.md", false},
+		{"Journal/Daily/2024-01-16.md", true},
+	}
+	for _, f := range files {
+		if got := vault.FileExists(filepath.Join(base, f.path)); got != f.exists {
+			t.Errorf("%s exists = %v, want %v", f.path, got, f.exists)
+		}
+	}
+	if _, ok, _ := database.GetLLMCache("wife_key"); !ok {
+		t.Error("wife's cached response was deleted with wolf")
+	}
+	day, _ := v.ReadFile(filepath.Join(base, "Journal", "Daily", "2024-01-16.md"))
+	if strings.Contains(string(day), "Wolf") || !strings.Contains(string(day), "Wife baked.") {
+		t.Errorf("2024-01-16 = %q, want only wife's batch", day)
+	}
+	for i, indexed := range []bool{false, true} {
+		if doc, _ := database.GetSearchDoc(fmt.Sprintf("daily_2024-01-16_%d", i), db.DocJournalDaily); (doc != nil) != indexed {
+			t.Errorf("wife's narration %d indexed = %v, want %v", i, doc != nil, indexed)
+		}
+	}
+	if letters, _ := database.GetLetters("", "all", nil); len(letters) != 1 || letters[0].LetterID != "let_2024-01-15_big_wolf_daily" {
+		t.Errorf("letters left = %+v, want big_wolf's", letters)
+	}
+
+	raw, _ := os.ReadDir(filepath.Join(base, "Journal", "Raw"))
+	if len(raw) != 1 || !strings.Contains(raw[0].Name(), "cap_wife") {
+		t.Errorf("raw journal files left = %v, want only wife's", raw)
+	}
+
+	captures, _ := v.SelectLines("Log/captures.jsonl", func([]byte) bool { return true })
+	if strings.Contains(string(captures), "wolf") || !strings.Contains(string(captures), "wife") {
+		t.Errorf("capture log = %q, want only wife's lines", captures)
+	}
+	mapLines, _ := v.SelectLines(journalMap, func([]byte) bool { return true })
+	var lines []narration
+	for _, line := range strings.Split(strings.TrimSpace(string(mapLines)), "\n") {
+		var n narration
+		json.Unmarshal([]byte(line), &n)
+		lines = append(lines, n)
+	}
+	if len(lines) != 1 || lines[0].Day != "2024-01-16" || len(lines[0].RawFiles) != 1 || !strings.Contains(lines[0].RawFiles[0], "cap_wife") {
+		t.Errorf("journal map = %+v, want 2024-01-16 with only wife's entry", lines)
+	}
+
+	if user, _ := database.GetUser("wolf"); user != nil {
+		t.Errorf("wolf still exists: %+v", user)
+	}
+	if ids, _ := database.GetCaptureIDs("wolf"); len(ids) != 0 {
+		t.Errorf("wolf's captures left: %v", ids)
+	}
+	share, _ := database.GetSharing("cap_wife")
+	if share == nil || share.Visibility != db.VisibilityPrivate || len(share.With) != 0 {
+		t.Errorf("wife's capture sharing = %+v, want private", share)
+	}
+	if comments, _ := database.GetComments("cap_wife"); len(comments) != 0 {
+		t.Errorf("wolf's comments left: %+v", comments)
+	}
+
+	// Running it again finds nothing more
+	again, err := Delete(database, v, "wolf")
+	if err != nil || len(again.Files) != 0 || again.Rows["capture_log"] != 0 {
+		t.Errorf("second Delete = %+v, %v; want nothing deleted", again, err)
+	}
+}
@@ -0,0 +1,105 @@
+package api
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/mrwolf/brain-server/internal/db"
+	"github.com/mrwolf/brain-server/internal/prompts"
+)
+
+// LLMStats handles GET /admin/llm-stats?days=N - per-task LLM latency and failure rates
+func (h *Handlers) LLMStats(w http.ResponseWriter, r *http.Request) {
+	days := 7
+	if s := r.URL.Query().Get("days"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 || n > 90 {
+			writeError(w, http.StatusBadRequest, "days must be between 1 and 90", "INVALID_DAYS")
+			return
+		}
+		days = n
+	}
+
+	since := time.Now().AddDate(0, 0, -days)
+	stats, err := h.db.GetLLMStats(since)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "database error", "DB_ERROR")
+		return
+	}
+	if stats == nil {
+		stats = []db.LLMTaskStats{}
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"since": since.UTC().Format(time.RFC3339),
+		"tasks": stats,
+	})
+}
+
+// LLMCacheStats handles GET /admin/llm-cache - cached LLM responses per task
+func (h *Handlers) LLMCacheStats(w http.ResponseWriter, r *http.Request) {
+	stats, err := h.db.GetLLMCacheStats()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "database error", "DB_ERROR")
+		return
+	}
+	if stats == nil {
+		stats = []db.LLMCacheStats{}
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"tasks": stats,
+	})
+}
+
+// PurgeLLMCache handles DELETE /admin/llm-cache?task=X&expired=true - removes cached responses
+// for one task (or all), optionally only expired ones
+func (h *Handlers) PurgeLLMCache(w http.ResponseWriter, r *http.Request) {
+	task := r.URL.Query().Get("task")
+	expiredOnly := false
+	if s := r.URL.Query().Get("expired"); s != "" {
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "expired must be true or false", "INVALID_PARAM")
+			return
+		}
+		expiredOnly = b
+	}
+
+	purged, err := h.db.PurgeLLMCache(task, expiredOnly)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "database error", "DB_ERROR")
+		return
+	}
+	log.Printf("Purged %d LLM cache entries (task=%q, expired only=%v)", purged, task, expiredOnly)
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"purged": purged,
+	})
+}
+
+// LLMQueue handles GET /admin/llm-queue - LLM concurrency limit, queue depth and waits per priority
+func (h *Handlers) LLMQueue(w http.ResponseWriter, r *http.Request) {
+	if h.llm == nil {
+		writeError(w, http.StatusServiceUnavailable, "LLM not configured", "NOT_CONFIGURED")
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(h.llm.QueueStats())
+}
+
+// Prompts handles GET /admin/prompts - the template in use for each prompt, and rejected overrides
+func (h *Handlers) Prompts(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"dir":     prompts.Dir,
+		"prompts": h.prompts.List(),
+	})
+}
@@ -0,0 +1,66 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/mrwolf/brain-server/internal/models"
+)
+
+// maxQuestionLength keeps questions to a sensible size for the prompt
+const maxQuestionLength = 500
+
+// Ask handles POST /ask - answers a question from the caller's own captures, notes and journal
+func (h *Handlers) Ask(w http.ResponseWriter, r *http.Request) {
+	var req models.AskRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body", "INVALID_BODY")
+		return
+	}
+
+	req.Question = strings.TrimSpace(req.Question)
+	if req.Question == "" {
+		writeError(w, http.StatusBadRequest, "question is required", "MISSING_QUESTION")
+		return
+	}
+	if len(req.Question) > maxQuestionLength {
+		writeError(w, http.StatusBadRequest, "question is too long", "QUESTION_TOO_LONG")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 3*time.Minute)
+	defer cancel()
+
+	actor := GetActor(r)
+	answer, err := h.asker.Ask(ctx, actor, req.Question, hiddenCategories(r)...)
+	if err != nil {
+		log.Printf("Ask failed for %s: %v", actor, err)
+		writeError(w, http.StatusInternalServerError, "failed to answer question", "GENERATION_FAILED")
+		return
+	}
+
+	citations := make([]models.AskCitation, 0, len(answer.Citations))
+	for _, c := range answer.Citations {
+		citations = append(citations, models.AskCitation{
+			ID:        c.ID,
+			Kind:      c.Kind,
+			Category:  c.Category,
+			Title:     c.Title,
+			Path:      c.Path,
+			CreatedTS: c.Created.Format(time.RFC3339),
+			Quotes:    c.Quotes,
+		})
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(models.AskResponse{
+		Question:  answer.Question,
+		Answer:    answer.Text,
+		Verified:  answer.Verified,
+		Citations: citations,
+	})
+}
@@ -0,0 +1,171 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/mrwolf/brain-server/internal/db"
+	"github.com/mrwolf/brain-server/internal/vault"
+)
+
+// auditKey holds the *auditRecord handlers add targets to
+const auditKey contextKey = "audit"
+
+// auditRecord collects what a handler acted on while the request runs
+type auditRecord struct {
+	actor    string // set by AuthMiddleware; empty when authentication failed
+	targets  []string
+	deviceID string
+}
+
+// AuditMiddleware records every action, meaning any request that changes state,
+// streams model output or reads admin data, and every request refused for its
+// credentials, to the audit log in SQLite and the vault (use before AuthMiddleware,
+// scope checks and rate limits, so refusals are recorded).
+// Targets are the route's URL parameters plus the IDs handlers add with auditTarget.
+func AuditMiddleware(database *db.DB, v *vault.Vault) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			rec := &auditRecord{}
+			wrapped := &responseWriter{ResponseWriter: w, status: http.StatusOK}
+			next.ServeHTTP(wrapped, r.WithContext(context.WithValue(r.Context(), auditKey, rec)))
+			if !auditable(r, wrapped.status) {
+				return
+			}
+
+			entry := db.AuditEntry{
+				TS:       time.Now().UTC(),
+				Actor:    rec.actor,
+				DeviceID: rec.deviceID,
+				Method:   r.Method,
+				Route:    r.URL.Path,
+				Status:   wrapped.status,
+				Outcome:  db.AuditOutcome(wrapped.status),
+				IP:       clientIP(r),
+			}
+			if rctx := chi.RouteContext(r.Context()); rctx != nil {
+				// Requests refused before routing only have their mount's pattern
+				if pattern := rctx.RoutePattern(); pattern != "" && !strings.HasSuffix(pattern, "/*") {
+					entry.Route = pattern
+				}
+				entry.Targets = append(entry.Targets, rctx.URLParams.Values...)
+			}
+			entry.Targets = append(entry.Targets, rec.targets...)
+
+			// Fail closed: a failed audit write is logged, the response has been sent
+			if err := database.LogAudit(entry); err != nil {
+				log.Printf("Failed to write audit entry for %s %s: %v", entry.Method, entry.Route, err)
+			}
+			if err := v.LogAudit(vault.AuditLog{
+				TS:       entry.TS.Format(time.RFC3339),
+				Actor:    entry.Actor,
+				DeviceID: entry.DeviceID,
+				Method:   entry.Method,
+				Route:    entry.Route,
+				Targets:  entry.Targets,
+				Status:   entry.Status,
+				Outcome:  entry.Outcome,
+				IP:       entry.IP,
+			}); err != nil {
+				log.Printf("Failed to write audit entry for %s %s to vault: %v", entry.Method, entry.Route, err)
+			}
+		})
+	}
+}
+
+// auditable reports whether a request is an action worth recording, given the
+// status it was answered with
+func auditable(r *http.Request, status int) bool {
+	if status == http.StatusUnauthorized {
+		return true
+	}
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return strings.Contains(r.URL.Path, "/stream/") || strings.Contains(r.URL.Path, "/admin/")
+	}
+	return true
+}
+
+// auditActor records who a request was authenticated as
+func auditActor(r *http.Request, token *db.APIToken) {
+	if rec, ok := r.Context().Value(auditKey).(*auditRecord); ok {
+		rec.actor = token.UserID
+		rec.deviceID = token.DeviceID
+	}
+}
+
+// auditTarget records IDs the request acted on beyond its URL parameters
+func auditTarget(r *http.Request, ids ...string) {
+	if rec, ok := r.Context().Value(auditKey).(*auditRecord); ok {
+		for _, id := range ids {
+			if id != "" {
+				rec.targets = append(rec.targets, id)
+			}
+		}
+	}
+}
+
+// auditDevice records the device a request came from when the token is not bound to one
+func auditDevice(r *http.Request, deviceID string) {
+	if rec, ok := r.Context().Value(auditKey).(*auditRecord); ok && rec.deviceID == "" {
+		rec.deviceID = deviceID
+	}
+}
+
+// clientIP returns the client address, as set by RealIP, without the port
+func clientIP(r *http.Request) string {
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+	return r.RemoteAddr
+}
+
+// AuditLog handles GET /admin/audit?actor=&route=&target=&since=&until=&limit=
+func (h *Handlers) AuditLog(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	query := db.AuditQuery{
+		Actor:  params.Get("actor"),
+		Route:  params.Get("route"),
+		Target: params.Get("target"),
+		Limit:  100,
+	}
+
+	var err error
+	if query.Since, err = h.parseSearchTime(params.Get("since"), false); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid since format, use RFC3339 or YYYY-MM-DD", "INVALID_DATE")
+		return
+	}
+	if query.Until, err = h.parseSearchTime(params.Get("until"), true); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid until format, use RFC3339 or YYYY-MM-DD", "INVALID_DATE")
+		return
+	}
+	if s := params.Get("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 || n > 1000 {
+			writeError(w, http.StatusBadRequest, "limit must be between 1 and 1000", "INVALID_LIMIT")
+			return
+		}
+		query.Limit = n
+	}
+
+	entries, err := h.db.QueryAudit(query)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "database error", "DB_ERROR")
+		return
+	}
+	if entries == nil {
+		entries = []db.AuditEntry{}
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"entries": entries,
+	})
+}
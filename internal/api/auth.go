@@ -0,0 +1,248 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mrwolf/brain-server/internal/db"
+	"github.com/mrwolf/brain-server/internal/models"
+	"github.com/mrwolf/brain-server/internal/oidc"
+)
+
+// Session lifetimes
+const (
+	browserSessionTTL = 7 * 24 * time.Hour
+	appAccessTTL      = time.Hour
+	appRefreshTTL     = 90 * 24 * time.Hour
+	loginTimeout      = 10 * time.Minute // from /auth/login to the provider's callback
+)
+
+// Cookies set by the login flow
+const (
+	sessionCookie = "brain_session"
+	loginCookie   = "brain_login" // ties the callback to the browser that started the login
+)
+
+// pendingLogin is a login waiting for the provider's callback
+type pendingLogin struct {
+	nonce    string
+	verifier string
+	app      bool
+	returnTo string
+	expires  time.Time
+}
+
+// loginStore holds pending logins by state
+type loginStore struct {
+	mu      sync.Mutex
+	pending map[string]pendingLogin
+}
+
+func (s *loginStore) add(state string, login pendingLogin) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	for k, l := range s.pending {
+		if now.After(l.expires) {
+			delete(s.pending, k)
+		}
+	}
+	s.pending[state] = login
+}
+
+// take removes and returns the login for state if it has not expired
+func (s *loginStore) take(state string) (pendingLogin, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	login, ok := s.pending[state]
+	delete(s.pending, state)
+	if !ok || time.Now().After(login.expires) {
+		return pendingLogin{}, false
+	}
+	return login, true
+}
+
+// SetOIDC enables OpenID Connect logins (call before AddAuthRoutes)
+func (h *Handlers) SetOIDC(provider *oidc.Provider) {
+	h.oidc = provider
+	h.logins = &loginStore{pending: make(map[string]pendingLogin)}
+}
+
+// Login handles GET /auth/login?client=app&return_to=/path
+// Redirects to the provider; the browser comes back to Callback.
+func (h *Handlers) Login(w http.ResponseWriter, r *http.Request) {
+	app := r.URL.Query().Get("client") == "app"
+	if app && h.cfg.OIDCAppRedirect == "" {
+		writeError(w, http.StatusBadRequest, "app login is not configured", "APP_LOGIN_DISABLED")
+		return
+	}
+	returnTo := r.URL.Query().Get("return_to")
+	if !localPath(returnTo) {
+		returnTo = "/"
+	}
+
+	state, nonce, verifier := oidc.RandomString(), oidc.RandomString(), oidc.RandomString()
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+	authURL, err := h.oidc.AuthCodeURL(ctx, state, nonce, verifier)
+	if err != nil {
+		log.Printf("Starting login: %v", err)
+		writeError(w, http.StatusBadGateway, "identity provider unavailable", "PROVIDER_UNAVAILABLE")
+		return
+	}
+
+	h.logins.add(state, pendingLogin{
+		nonce:    nonce,
+		verifier: verifier,
+		app:      app,
+		returnTo: returnTo,
+		expires:  time.Now().Add(loginTimeout),
+	})
+	http.SetCookie(w, h.cookie(loginCookie, state, loginTimeout))
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+// Callback handles GET /auth/callback, the provider's redirect after login.
+// Browsers get a session cookie; the app is redirected to its URL with tokens in the fragment.
+func (h *Handlers) Callback(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	state := q.Get("state")
+	cookie, err := r.Cookie(loginCookie)
+	if err != nil || state == "" || cookie.Value != state {
+		writeError(w, http.StatusBadRequest, "login was not started from this browser", "INVALID_STATE")
+		return
+	}
+	http.SetCookie(w, h.cookie(loginCookie, "", -1))
+	login, ok := h.logins.take(state)
+	if !ok {
+		writeError(w, http.StatusBadRequest, "login expired, try again", "INVALID_STATE")
+		return
+	}
+	if e := q.Get("error"); e != "" {
+		writeError(w, http.StatusUnauthorized, "login failed: "+e, "LOGIN_FAILED")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+	claims, err := h.oidc.Exchange(ctx, q.Get("code"), login.verifier, login.nonce)
+	if err != nil {
+		log.Printf("Login failed: %v", err)
+		writeError(w, http.StatusUnauthorized, "login failed", "LOGIN_FAILED")
+		return
+	}
+
+	email := ""
+	if claims.EmailVerified {
+		email = claims.Email
+	}
+	identity, err := h.db.ResolveIdentity(h.oidc.Issuer(), claims.Subject, email)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "database error", "DB_ERROR")
+		return
+	}
+	if identity == nil {
+		log.Printf("Login by unlinked identity %s (%s)", claims.Subject, claims.Email)
+		writeError(w, http.StatusForbidden, "this account is not linked to a user", "NOT_LINKED")
+		return
+	}
+
+	if login.app {
+		access, refresh, session, err := h.db.CreateSession(identity, db.SessionApp, appAccessTTL, appRefreshTTL)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "database error", "DB_ERROR")
+			return
+		}
+		log.Printf("App login for %s via %s", session.UserID, claims.Subject)
+		fragment := url.Values{
+			"access_token":  {access},
+			"refresh_token": {refresh},
+			"token_type":    {"Bearer"},
+			"expires_in":    {strconv.Itoa(int(appAccessTTL.Seconds()))},
+		}
+		http.Redirect(w, r, h.cfg.OIDCAppRedirect+"#"+fragment.Encode(), http.StatusFound)
+		return
+	}
+
+	access, _, session, err := h.db.CreateSession(identity, db.SessionBrowser, browserSessionTTL, 0)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "database error", "DB_ERROR")
+		return
+	}
+	log.Printf("Browser login for %s via %s", session.UserID, claims.Subject)
+	http.SetCookie(w, h.cookie(sessionCookie, access, browserSessionTTL))
+	http.Redirect(w, r, login.returnTo, http.StatusFound)
+}
+
+// Refresh handles POST /auth/refresh, exchanging an app refresh token for new tokens
+func (h *Handlers) Refresh(w http.ResponseWriter, r *http.Request) {
+	var req models.RefreshRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body", "INVALID_BODY")
+		return
+	}
+
+	access, refresh, session, err := h.db.RefreshSession(req.RefreshToken, appAccessTTL, appRefreshTTL)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "database error", "DB_ERROR")
+		return
+	}
+	if session == nil {
+		writeError(w, http.StatusUnauthorized, "invalid refresh token", "INVALID_REFRESH_TOKEN")
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(models.TokenResponse{
+		AccessToken:  access,
+		RefreshToken: refresh,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(appAccessTTL.Seconds()),
+	})
+}
+
+// Logout handles POST /auth/logout, ending the caller's session
+func (h *Handlers) Logout(w http.ResponseWriter, r *http.Request) {
+	session := GetSession(r)
+	if session == nil {
+		writeError(w, http.StatusBadRequest, "not a login session; revoke API tokens through the admin API", "NOT_A_SESSION")
+		return
+	}
+	if err := h.db.RevokeSession(session.ID); err != nil {
+		writeError(w, http.StatusInternalServerError, "database error", "DB_ERROR")
+		return
+	}
+	http.SetCookie(w, h.cookie(sessionCookie, "", -1))
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+}
+
+// cookie returns an HTTP-only cookie; a negative maxAge deletes it
+func (h *Handlers) cookie(name, value string, maxAge time.Duration) *http.Cookie {
+	c := &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     "/",
+		HttpOnly: true,
+		Secure:   strings.HasPrefix(h.cfg.OIDCRedirectURL, "https://"),
+		SameSite: http.SameSiteLaxMode,
+		MaxAge:   int(maxAge.Seconds()),
+	}
+	if maxAge < 0 {
+		c.MaxAge = -1
+	}
+	return c
+}
+
+// localPath reports whether p is a path on this server, so it is safe to redirect to
+func localPath(p string) bool {
+	return strings.HasPrefix(p, "/") && !strings.HasPrefix(p, "//") && !strings.HasPrefix(p, "/\\")
+}
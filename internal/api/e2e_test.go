@@ -0,0 +1,264 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mrwolf/brain-server/internal/config"
+	"github.com/mrwolf/brain-server/internal/db"
+	"github.com/mrwolf/brain-server/internal/llm/llmtest"
+	"github.com/mrwolf/brain-server/internal/narrator"
+	"github.com/mrwolf/brain-server/internal/prompts"
+	"github.com/mrwolf/brain-server/internal/scheduler"
+	"github.com/mrwolf/brain-server/internal/search"
+	"github.com/mrwolf/brain-server/internal/vault"
+)
+
+// e2eEnv is the whole server wired as in main, backed by a scripted LLM
+type e2eEnv struct {
+	server    *httptest.Server
+	fake      *llmtest.Server
+	db        *db.DB
+	vaultPath string
+}
+
+func setupE2E(t *testing.T, fake *llmtest.Server) *e2eEnv {
+	t.Helper()
+
+	tmpDir := t.TempDir()
+	cfg := &config.Config{
+		Port:             "0",
+		VaultPath:        filepath.Join(tmpDir, "vault"),
+		DBPath:           filepath.Join(tmpDir, "test.db"),
+		OllamaURL:        fake.URL,
+		OllamaModel:      "fake",
+		OllamaModelHeavy: "fake-heavy",
+		TokenWolf:        "test_wolf_token",
+		Timezone:         "UTC",
+	}
+	os.MkdirAll(cfg.VaultPath, 0755)
+
+	database, err := db.Open(cfg.DBPath)
+	if err != nil {
+		t.Fatalf("opening database: %v", err)
+	}
+	t.Cleanup(func() { database.Close() })
+	for userID, token := range cfg.BootstrapTokens() {
+		if err := database.EnsureUserToken(userID, "bootstrap", token); err != nil {
+			t.Fatalf("registering token: %v", err)
+		}
+	}
+
+	v := vault.NewVault(cfg.VaultPath)
+	v.SetIndexer(search.NewIndex(database))
+	llmClient := fake.LLM()
+	promptStore := prompts.NewStore(cfg.VaultPath)
+
+	narratorConfig := narrator.DefaultConfig(cfg.VaultPath)
+	narratorConfig.Prompts = promptStore
+	narr, err := narrator.New(narrator.NewBrainServerAdapter(llmClient), narratorConfig)
+	if err != nil {
+		t.Fatalf("creating narrator: %v", err)
+	}
+	sched, err := scheduler.New(database, v, llmClient, scheduler.Config{Timezone: cfg.Timezone})
+	if err != nil {
+		t.Fatalf("creating scheduler: %v", err)
+	}
+	sched.SetNarrator(narr)
+	sched.SetPrompts(promptStore)
+
+	router, handlers := NewRouter(cfg, database, v, llmClient)
+	handlers.SetPrompts(promptStore)
+	handlers.SetLetterGenerator(sched)
+	handlers.SetNarrator(narr)
+	AddJournalRoutes(router, handlers)
+
+	server := httptest.NewServer(router)
+	t.Cleanup(server.Close)
+
+	return &e2eEnv{server: server, fake: fake, db: database, vaultPath: cfg.VaultPath}
+}
+
+func (e *e2eEnv) do(t *testing.T, method, path, body string) map[string]interface{} {
+	t.Helper()
+	req, _ := http.NewRequest(method, e.server.URL+path, bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer test_wolf_token")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("%s %s: %v", method, path, err)
+	}
+	defer resp.Body.Close()
+
+	var out map[string]interface{}
+	json.NewDecoder(resp.Body).Decode(&out)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("%s %s: status %d: %v", method, path, resp.StatusCode, out)
+	}
+	return out
+}
+
+func (e *e2eEnv) capture(t *testing.T, text string) map[string]interface{} {
+	t.Helper()
+	payload, _ := json.Marshal(map[string]string{
+		"text":      text,
+		"mode":      "note",
+		"device_id": "e2e",
+		"ts_local":  time.Now().UTC().Format(time.RFC3339),
+		"version":   "1",
+	})
+	return e.do(t, "POST", "/api/v1/capture", string(payload))
+}
+
+// waitForFile polls until a vault file matching pattern exists and returns its content
+func (e *e2eEnv) waitForFile(t *testing.T, pattern string) string {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if matches, _ := filepath.Glob(filepath.Join(e.vaultPath, pattern)); len(matches) > 0 {
+			data, err := os.ReadFile(matches[0])
+			if err == nil {
+				return string(data)
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("no vault file matching %s", pattern)
+	return ""
+}
+
+func classification(category, title string, confidence float64) string {
+	out, _ := json.Marshal(map[string]interface{}{
+		"category":     category,
+		"confidence":   confidence,
+		"title":        title,
+		"cleaned_text": title,
+		"tags":         []string{strings.ToLower(category)},
+	})
+	return string(out)
+}
+
+func TestEndToEnd(t *testing.T) {
+	fake := llmtest.NewServer(t).
+		On(`(?s)personal note classifier.*solar`, classification("Ideas", "Solar powered bike lights", 0.95)).
+		On(`(?s)personal note classifier.*garden`, classification("Ideas", "Garden watering sensor", 0.9)).
+		On(`(?s)personal note classifier.*(?i:today i)`, classification("Journal", "Morning walk", 0.92)).
+		On(`personal note classifier`, classification("Life", "Something else", 0.4)).
+		On(`Expand on this idea`, "## Questions\n\n- How bright do the lights need to be?").
+		On(`Score the mood`, `{"valence": 7, "energy": 6}`).
+		On(`precise fact extractor`, `{"claims": [{"fact": "Walked to the river before work", "quote": "walked to the river"}]}`).
+		On(`skilled journal narrator`, "I walked to the river before work and watched the herons.").
+		On(`fact-checker`, `{"passed": true}`).
+		On(`daily report`, "INSIGHT: Solar and garden ideas keep coming back.\nACTION: Sketch the bike light circuit tonight.")
+	env := setupE2E(t, fake)
+
+	// Capture -> classify -> file
+	resp := env.capture(t, "What if bike lights were solar powered")
+	if resp["status"] != "received" {
+		t.Fatalf("idea capture = %v, want received", resp)
+	}
+	note := env.waitForFile(t, "Ideas/*.md")
+	if !strings.Contains(note, "Solar powered bike lights") {
+		t.Errorf("filed note does not contain the classified title:\n%s", note)
+	}
+
+	// Ideas are expanded in the background
+	research := env.waitForFile(t, "Research/Ideas/*-research.md")
+	if !strings.Contains(research, "How bright") {
+		t.Errorf("research file does not contain the expansion:\n%s", research)
+	}
+	if !strings.Contains(research, "prompt: idea_expander@default-") {
+		t.Errorf("research frontmatter lacks the prompt version:\n%s", research)
+	}
+
+	// Low-confidence captures wait for clarification instead of being filed
+	resp = env.capture(t, "Not sure where this goes")
+	if resp["status"] != "needs_review" {
+		t.Errorf("low-confidence capture = %v, want needs_review", resp)
+	}
+
+	env.capture(t, "A soil sensor for the garden that texts me")
+
+	// Filed captures boost signals
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		sig, err := env.db.GetSignal("cat:Ideas")
+		if err != nil {
+			t.Fatalf("GetSignal: %v", err)
+		}
+		if sig != nil && sig.Weight > 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("filing ideas did not boost the Ideas category signal")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// Journal captures are narrated into the daily file
+	env.capture(t, "Today I walked to the river before work")
+	env.waitForFile(t, "Journal/Raw/*.md")
+	daily := env.waitForFile(t, "Journal/Daily/*.md")
+	if !strings.Contains(daily, "watched the herons") {
+		t.Errorf("daily journal does not contain the narration:\n%s", daily)
+	}
+	if !strings.Contains(daily, "prompts: [claim_extraction@default-") {
+		t.Errorf("daily journal frontmatter lacks the prompt versions:\n%s", daily)
+	}
+	if len(fake.CallsMatching(`fact-checker`)) == 0 {
+		t.Error("narration was not verified")
+	}
+
+	// Daily letter from the captures and signals above
+	env.do(t, "POST", "/api/v1/test/daily?actor=wolf", "")
+	prompts := fake.CallsMatching(`daily report`)
+	if len(prompts) != 1 {
+		t.Fatalf("daily letter prompts = %d, want 1", len(prompts))
+	}
+	if !strings.Contains(prompts[0].Prompt, "Ideas") {
+		t.Errorf("daily letter prompt lacks the week's categories:\n%s", prompts[0].Prompt)
+	}
+
+	letters := env.do(t, "GET", "/api/v1/letters?type=daily", "")
+	body, _ := json.Marshal(letters)
+	if !strings.Contains(string(body), "Sketch the bike light circuit") {
+		t.Errorf("letters = %s, want the generated daily letter", body)
+	}
+}
+
+func TestEndToEndPromptOverride(t *testing.T) {
+	fake := llmtest.NewServer(t).
+		On(`Sort this capture`, classification("Projects", "Fix the fence", 0.9))
+	env := setupE2E(t, fake)
+
+	dir := filepath.Join(env.vaultPath, prompts.Dir)
+	os.MkdirAll(dir, 0755)
+	override := "---\nversion: e2e\n---\nSort this capture from {{.Actor}}: {{.Text}}\n"
+	if err := os.WriteFile(filepath.Join(dir, "classifier.md"), []byte(override), 0644); err != nil {
+		t.Fatalf("writing override: %v", err)
+	}
+
+	env.capture(t, "The fence needs new posts")
+	note := env.waitForFile(t, "Projects/*.md")
+	if !strings.Contains(note, "prompt: classifier@e2e") {
+		t.Errorf("note frontmatter lacks the prompt version:\n%s", note)
+	}
+	calls := fake.CallsMatching(`Sort this capture from wolf: The fence needs new posts`)
+	if len(calls) != 1 {
+		t.Errorf("override prompt calls = %d, want 1", len(calls))
+	}
+
+	list := env.do(t, "GET", "/api/v1/admin/prompts", "")
+	body, _ := json.Marshal(list)
+	if !strings.Contains(string(body), `"source":"vault","version":"e2e"`) {
+		t.Errorf("admin prompts = %s, want the classifier override listed", body)
+	}
+}
@@ -3,22 +3,28 @@ package api
 import (
 	"context"
 	"encoding/json"
-	"fmt"
+	"errors"
 	"log"
 	"net/http"
 	"os"
-	"strings"
 	"time"
 
+	"github.com/mrwolf/brain-server/internal/ask"
 	"github.com/mrwolf/brain-server/internal/classifier"
 	"github.com/mrwolf/brain-server/internal/config"
 	"github.com/mrwolf/brain-server/internal/db"
+	"github.com/mrwolf/brain-server/internal/embeddings"
 	"github.com/mrwolf/brain-server/internal/llm"
+	"github.com/mrwolf/brain-server/internal/medication"
 	"github.com/mrwolf/brain-server/internal/models"
+	"github.com/mrwolf/brain-server/internal/mood"
+	"github.com/mrwolf/brain-server/internal/oidc"
+	"github.com/mrwolf/brain-server/internal/ratelimit"
 	"github.com/mrwolf/brain-server/internal/scheduler"
 	"github.com/mrwolf/brain-server/internal/signals"
 	"github.com/mrwolf/brain-server/internal/vault"
 	"github.com/mrwolf/brain-server/internal/narrator"
+	"github.com/mrwolf/brain-server/internal/prompts"
 )
 
 // ErrorResponse is the standard error response format
@@ -36,10 +42,11 @@ func writeError(w http.ResponseWriter, status int, message, code string) {
 	})
 }
 
-// LetterGenerator interface for test endpoints
+// LetterGenerator interface for test and streaming endpoints
 type LetterGenerator interface {
 	GenerateDailyNow(actor string) error
 	GenerateWeeklyNow(actor string) error
+	StreamDailyLetter(ctx context.Context, actor string, onChunk func(string) error) (string, error)
 }
 
 type Handlers struct {
@@ -51,9 +58,27 @@ type Handlers struct {
 	ideaExpander *scheduler.IdeaExpander
 	letterGen    LetterGenerator
 	narratorTyped *narrator.Narrator // optional, for test endpoints
+	meds         *medication.Tracker
+	mood         *mood.Scorer
+	location     *time.Location
+	embedder     *embeddings.Embedder
+	asker        *ask.Answerer
+	prompts      *prompts.Store
+	oidc         *oidc.Provider // optional, enables /auth logins
+	logins       *loginStore
+	limiter      *ratelimit.Limiter
 }
 
 func NewHandlers(cfg *config.Config, database *db.DB, v *vault.Vault, llmClient *llm.Client) *Handlers {
+	tz, err := time.LoadLocation(cfg.Timezone)
+	if err != nil {
+		tz = time.UTC
+	}
+	embedder := embeddings.NewEmbedder(llmClient, database)
+	limits := cfg.RateLimits
+	if limits == nil {
+		limits = ratelimit.DefaultLimits()
+	}
 	return &Handlers{
 		cfg:          cfg,
 		db:           database,
@@ -61,23 +86,41 @@ func NewHandlers(cfg *config.Config, database *db.DB, v *vault.Vault, llmClient
 		llm:          llmClient,
 		classifier:   classifier.NewClassifier(llmClient, 0.6), // 0.6 threshold per spec
 		ideaExpander: scheduler.NewIdeaExpander(llmClient, v),
+		meds:         medication.NewTracker(database, tz),
+		mood:         mood.NewScorer(llmClient, database),
+		location:     tz,
+		embedder:     embedder,
+		asker:        ask.NewAnswerer(llmClient, database, embedder),
+		prompts:      prompts.Defaults(),
+		limiter:      ratelimit.New(limits),
 	}
 }
 
 // Health handles GET /health
 func (h *Handlers) Health(w http.ResponseWriter, r *http.Request) {
 	resp := models.HealthResponse{
-		Status:  "ok",
-		Ollama:  h.checkOllama(),
-		Vault:   h.checkVault(),
-		Version: "1.0.0",
+		Status:      "ok",
+		Ollama:      h.checkLLM(),
+		Vault:       h.checkVault(),
+		Version:     "1.0.0",
+	}
+	if h.llm != nil {
+		resp.LLMProvider = h.llm.ProviderName()
+		// Read after checkLLM, whose health check feeds the breaker
+		resp.LLMCircuit = string(h.llm.BreakerStats().State)
+		if resp.LLMCircuit != string(llm.BreakerClosed) {
+			resp.Status = "degraded"
+		}
+	}
+	if n, err := h.db.CountPostponedJobs(); err == nil {
+		resp.PostponedJobs = n
 	}
 
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(resp)
 }
 
-func (h *Handlers) checkOllama() string {
+func (h *Handlers) checkLLM() string {
 	if h.llm == nil {
 		return "not configured"
 	}
@@ -118,8 +161,33 @@ func (h *Handlers) Capture(w http.ResponseWriter, r *http.Request) {
 		req.Mode = "note"
 	}
 
+	// A device-bound token can only capture as its own device
+	if token := GetToken(r); token != nil && token.DeviceID != "" {
+		if req.DeviceID == "" {
+			req.DeviceID = token.DeviceID
+		} else if req.DeviceID != token.DeviceID {
+			writeError(w, http.StatusForbidden, "token is bound to another device", "DEVICE_MISMATCH")
+			return
+		}
+	}
+
 	actor := GetActor(r)
+	sharing, err := h.requestedSharing(actor, req.Visibility, req.ShareWith)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error(), "INVALID_SHARING")
+		return
+	}
+
 	captureID := generateID("cap")
+	auditTarget(r, captureID)
+	auditDevice(r, req.DeviceID)
+
+	// Explicit sharing is recorded up front, so it also holds if the capture is clarified
+	if sharing != nil {
+		if err := h.db.SetSharing(captureID, actor, *sharing); err != nil {
+			log.Printf("Failed to record sharing for %s: %v", captureID, err)
+		}
+	}
 
 	// Use client-provided timestamp if available, otherwise use server time
 	var timestamp time.Time
@@ -144,6 +212,13 @@ func (h *Handlers) Capture(w http.ResponseWriter, r *http.Request) {
 	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
 	defer cancel()
 
+	// Skip the classifier entirely while the LLM backend is down
+	if h.llm != nil && !h.llm.Available() {
+		log.Printf("LLM unavailable, deferring classification of %s", captureID)
+		h.handleClassificationFailure(w, captureID, actor, req, timestamp)
+		return
+	}
+
 	result, err := h.classifier.Classify(ctx, req.Text, actor, timestamp)
 	if err != nil {
 		log.Printf("Classification failed for %s: %v", captureID, err)
@@ -199,6 +274,7 @@ func (h *Handlers) Capture(w http.ResponseWriter, r *http.Request) {
 		Tags:       result.Tags,
 		Title:      result.Title,
 		Content:    result.CleanedText,
+		Prompt:     result.Prompt,
 	}
 
 	// Route Journal to Raw/ for narrator processing
@@ -206,6 +282,7 @@ func (h *Handlers) Capture(w http.ResponseWriter, r *http.Request) {
 	if result.Category == models.CategoryJournal {
 		_, writeErr = h.vault.WriteRawJournalCapture(note)
 	} else {
+		note.Related = h.relatedNotes(ctx, actor, note.Title+"\n\n"+note.Content)
 		_, writeErr = h.vault.WriteNote(note)
 	}
 	if writeErr != nil {
@@ -214,16 +291,28 @@ func (h *Handlers) Capture(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	h.shareByRule(captureID, actor, result.Category)
+
 	// Boost signals asynchronously (fail closed - doesn't affect capture)
 	go h.boostSignals(req.Text, result.Category)
 
+	// Match Health captures against the medication schedule
+	if result.Category == models.CategoryHealth {
+		go h.trackMedication(actor, captureID, req.Text, timestamp)
+	}
+
+	// Score mood for Life and Journal captures
+	if result.Category == models.CategoryLife || result.Category == models.CategoryJournal {
+		go h.scoreMood(captureID, actor, result.Category, req.Text, timestamp)
+	}
+
 	// Trigger journal narration asynchronously for Journal category
 	if result.Category == models.CategoryJournal && h.narratorTyped != nil {
 		go h.narrateJournal()
 	}
 	// Trigger idea expansion asynchronously for Ideas category
 	if result.Category == models.CategoryIdeas {
-		go h.expandIdea(captureID, result.Title, result.CleanedText, result.Tags)
+		go h.expandIdea(captureID, actor, result.Title, result.CleanedText, result.Tags)
 	}
 
 	resp := models.CaptureResponse{
@@ -236,31 +325,36 @@ func (h *Handlers) Capture(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(resp)
 }
 
-func (h *Handlers) expandIdea(ideaID, title, content string, tags []string) {
+func (h *Handlers) expandIdea(ideaID, actor, title, content string, tags []string) {
+	// While the LLM backend is down, expand once it recovers
+	if h.llm != nil && !h.llm.Available() {
+		h.postponeIdea(ideaID, actor, title, content, tags)
+		return
+	}
+
 	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
 	defer cancel()
 
-	// Build context from tags and category
-	categoryContext := "Ideas"
-	if len(tags) > 0 {
-		categoryContext = fmt.Sprintf("Ideas (tags: %s)", strings.Join(tags, ", "))
-	}
-
-	research, err := h.ideaExpander.ExpandIdea(ctx, content, title, categoryContext)
-	if err != nil {
-		log.Printf("Failed to expand idea %s: %v", ideaID, err)
+	path, err := h.ideaExpander.ExpandAndSave(ctx, ideaID, actor, title, content, tags)
+	if errors.Is(err, llm.ErrCircuitOpen) {
+		h.postponeIdea(ideaID, actor, title, content, tags)
 		return
 	}
-
-	path, err := h.ideaExpander.WriteResearchFile(ideaID, title, research)
 	if err != nil {
-		log.Printf("Failed to write research for %s: %v", ideaID, err)
+		log.Printf("Failed to expand idea %s: %v", ideaID, err)
 		return
 	}
 
 	log.Printf("Generated research for idea %s: %s", ideaID, path)
 }
 
+func (h *Handlers) postponeIdea(ideaID, actor, title, content string, tags []string) {
+	log.Printf("LLM unavailable, postponing expansion of idea %s", ideaID)
+	if err := scheduler.PostponeIdeaExpansion(h.db, ideaID, actor, title, content, tags); err != nil {
+		log.Printf("Failed to postpone idea %s: %v", ideaID, err)
+	}
+}
+
 func (h *Handlers) handlePurchase(w http.ResponseWriter, captureID, actor string, req models.Capture) {
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
@@ -335,6 +429,7 @@ func (h *Handlers) handlePurchase(w http.ResponseWriter, captureID, actor string
 	h.db.LogCapture(captureID, actor, req.Mode, req.Text, models.CategoryFinancial, models.StatusFiled, result.Confidence)
 	logEntry := vault.NewCaptureLog(captureID, actor, req.Mode, req.Text, models.CategoryFinancial, models.StatusFiled, req.DeviceID, result.Confidence)
 	h.vault.LogCapture(logEntry)
+	h.shareByRule(captureID, actor, models.CategoryFinancial)
 
 	resp := models.CaptureResponse{
 		CaptureID: captureID,
@@ -374,6 +469,7 @@ func (h *Handlers) Clarify(w http.ResponseWriter, r *http.Request) {
 		writeError(w, http.StatusBadRequest, "invalid request body", "INVALID_BODY")
 		return
 	}
+	auditTarget(r, req.CaptureID)
 
 	pending, err := h.db.GetPendingByID(req.CaptureID)
 	if err != nil {
@@ -431,14 +527,23 @@ func (h *Handlers) Clarify(w http.ResponseWriter, r *http.Request) {
 	if req.Destination == models.CategoryJournal {
 		_, clarifyWriteErr = h.vault.WriteRawJournalCapture(note)
 	} else {
+		note.Related = h.relatedNotes(r.Context(), pending.Actor, note.Content)
 		_, clarifyWriteErr = h.vault.WriteNote(note)
 	}
 	if clarifyWriteErr != nil {
 		writeError(w, http.StatusInternalServerError, "failed to write note", "WRITE_ERROR")
 		return
 	}
+	h.shareByRule(pending.CaptureID, pending.Actor, req.Destination)
+
 	// Boost signals asynchronously (fail closed - doesn't affect clarify)
 	go h.boostSignals(pending.RawText, req.Destination)
+	if req.Destination == models.CategoryHealth {
+		go h.trackMedication(pending.Actor, pending.CaptureID, pending.RawText, created)
+	}
+	if req.Destination == models.CategoryLife || req.Destination == models.CategoryJournal {
+		go h.scoreMood(pending.CaptureID, pending.Actor, req.Destination, pending.RawText, created)
+	}
 	// Trigger journal narration asynchronously for Journal category
 	if req.Destination == models.CategoryJournal && h.narratorTyped != nil {
 		go h.narrateJournal()
@@ -623,7 +728,7 @@ func (h *Handlers) TestGenerateDaily(w http.ResponseWriter, r *http.Request) {
 
 	actor := r.URL.Query().Get("actor")
 	if actor == "" {
-		actor = "wolf" // default
+		actor = GetActor(r)
 	}
 
 	log.Printf("Test: generating daily letter for actor %s", actor)
@@ -649,7 +754,7 @@ func (h *Handlers) TestGenerateWeekly(w http.ResponseWriter, r *http.Request) {
 
 	actor := r.URL.Query().Get("actor")
 	if actor == "" {
-		actor = "wolf" // default
+		actor = GetActor(r)
 	}
 
 	log.Printf("Test: generating weekly letter for actor %s", actor)
@@ -712,6 +817,14 @@ func (h *Handlers) SetNarrator(n *narrator.Narrator) {
 	h.narratorTyped = n
 }
 
+// SetPrompts sets where the classifier, idea expansion and answer verification prompts are loaded from
+func (h *Handlers) SetPrompts(store *prompts.Store) {
+	h.prompts = store
+	h.classifier.SetPrompts(store)
+	h.ideaExpander.SetPrompts(store)
+	h.asker.SetPrompts(store)
+}
+
 // JournalUpdate handles POST /api/v1/journal/update
 func (h *Handlers) JournalUpdate(w http.ResponseWriter, r *http.Request) {
 	if h.narratorTyped == nil {
@@ -751,10 +864,25 @@ func (h *Handlers) JournalStatus(w http.ResponseWriter, r *http.Request) {
 
 // narrateJournal triggers async journal narration (fail closed)
 func (h *Handlers) narrateJournal() {
+	// While the LLM backend is down, narrate once it recovers
+	if h.llm != nil && !h.llm.Available() {
+		log.Println("LLM unavailable, postponing journal narration")
+		if err := scheduler.PostponeNarration(h.db); err != nil {
+			log.Printf("Failed to postpone journal narration: %v", err)
+		}
+		return
+	}
+
 	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
 	defer cancel()
 
 	result, err := h.narratorTyped.Update(ctx)
+	if errors.Is(err, llm.ErrCircuitOpen) {
+		if err := scheduler.PostponeNarration(h.db); err != nil {
+			log.Printf("Failed to postpone journal narration: %v", err)
+		}
+		return
+	}
 	if err != nil {
 		log.Printf("Journal narration failed: %v", err)
 		return
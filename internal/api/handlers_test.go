@@ -1,21 +1,42 @@
 package api
 
 import (
+	"archive/zip"
 	"bytes"
+	"crypto/tls"
 	"encoding/json"
+	"fmt"
+	"io"
+	"net"
 	"net/http"
+	"net/http/cookiejar"
 	"net/http/httptest"
+	"net/url"
 	"os"
+	"sort"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/mrwolf/brain-server/internal/certs"
+	"github.com/mrwolf/brain-server/internal/certs/certstest"
 	"github.com/mrwolf/brain-server/internal/config"
 	"github.com/mrwolf/brain-server/internal/db"
 	"github.com/mrwolf/brain-server/internal/llm"
+	"github.com/mrwolf/brain-server/internal/oidc"
+	"github.com/mrwolf/brain-server/internal/oidc/oidctest"
+	"github.com/mrwolf/brain-server/internal/ratelimit"
 	"github.com/mrwolf/brain-server/internal/vault"
 )
 
 func setupTestServer(t *testing.T) (*httptest.Server, func()) {
 	t.Helper()
+	return setupTestServerWithLLM(t, nil)
+}
+
+// setupTestServerWithLLM is setupTestServer with the LLM client built by newLLM (nil for the default)
+func setupTestServerWithLLM(t *testing.T, newLLM func(cfg *config.Config) *llm.Client) (*httptest.Server, func()) {
+	t.Helper()
 
 	// Create temp directories
 	tmpDir, err := os.MkdirTemp("", "brain-test-*")
@@ -45,9 +66,17 @@ func setupTestServer(t *testing.T) (*httptest.Server, func()) {
 		os.RemoveAll(tmpDir)
 		t.Fatalf("opening database: %v", err)
 	}
+	for userID, token := range cfg.BootstrapTokens() {
+		if err := database.EnsureUserToken(userID, "bootstrap", token); err != nil {
+			t.Fatalf("registering token: %v", err)
+		}
+	}
 
 	v := vault.NewVault(vaultPath)
 	llmClient := llm.NewClient(cfg.OllamaURL, cfg.OllamaModel, cfg.OllamaModelHeavy)
+	if newLLM != nil {
+		llmClient = newLLM(cfg)
+	}
 
 	router, _ := NewRouter(cfg, database, v, llmClient)
 	server := httptest.NewServer(router)
@@ -130,6 +159,50 @@ func TestCaptureWithAuth(t *testing.T) {
 	}
 }
 
+func TestDegradedMode(t *testing.T) {
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "model runner crashed", http.StatusInternalServerError)
+	}))
+	defer down.Close()
+
+	server, cleanup := setupTestServerWithLLM(t, func(cfg *config.Config) *llm.Client {
+		client := llm.NewClient(down.URL, cfg.OllamaModel, cfg.OllamaModelHeavy)
+		client.SetBreaker(llm.NewBreaker(3, time.Hour))
+		return client
+	})
+	defer cleanup()
+
+	resp, err := http.Get(server.URL + "/health")
+	if err != nil {
+		t.Fatalf("GET /health: %v", err)
+	}
+	var health map[string]interface{}
+	json.NewDecoder(resp.Body).Decode(&health)
+	resp.Body.Close()
+
+	if health["status"] != "degraded" || health["llm_circuit"] != "open" {
+		t.Errorf("health = %v, want degraded with open circuit", health)
+	}
+
+	// Captures skip the classifier and wait for clarification
+	payload := `{"text":"an idea for later","mode":"note","device_id":"test","ts_local":"2024-01-15T09:00:00Z","version":"1"}`
+	req, _ := http.NewRequest("POST", server.URL+"/api/v1/capture", bytes.NewBufferString(payload))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer test_wolf_token")
+
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("POST /capture: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var body map[string]interface{}
+	json.NewDecoder(resp.Body).Decode(&body)
+	if body["status"] != "needs_review" {
+		t.Errorf("capture status = %v, want needs_review", body["status"])
+	}
+}
+
 func TestPendingEndpoint(t *testing.T) {
 	server, cleanup := setupTestServer(t)
 	defer cleanup()
@@ -327,3 +400,977 @@ func TestLettersEndpointWithSince(t *testing.T) {
 		t.Errorf("expected status 400 with invalid since, got %d", resp3.StatusCode)
 	}
 }
+
+func TestSearchEndpoint(t *testing.T) {
+	server, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	tests := []struct {
+		query      string
+		wantStatus int
+	}{
+		{"?q=garden", http.StatusOK},
+		{"?q=garden&since=2024-01-01&until=2024-12-31", http.StatusOK},
+		{"", http.StatusBadRequest},
+		{"?q=garden&since=yesterday", http.StatusBadRequest},
+		{"?q=garden&limit=0", http.StatusBadRequest},
+	}
+
+	client := &http.Client{}
+	for _, tt := range tests {
+		req, _ := http.NewRequest("GET", server.URL+"/api/v1/search"+tt.query, nil)
+		req.Header.Set("Authorization", "Bearer test_wolf_token")
+
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("GET /search%s: %v", tt.query, err)
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode != tt.wantStatus {
+			t.Errorf("GET /search%s: expected status %d, got %d", tt.query, tt.wantStatus, resp.StatusCode)
+		}
+	}
+}
+
+func TestSemanticEndpointsValidation(t *testing.T) {
+	server, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	tests := []struct {
+		path       string
+		wantStatus int
+	}{
+		{"/api/v1/search/semantic", http.StatusBadRequest},
+		{"/api/v1/search/semantic?q=cardio&limit=500", http.StatusBadRequest},
+		{"/api/v1/captures/cap_missing/related", http.StatusNotFound},
+	}
+
+	client := &http.Client{}
+	for _, tt := range tests {
+		req, _ := http.NewRequest("GET", server.URL+tt.path, nil)
+		req.Header.Set("Authorization", "Bearer test_wolf_token")
+
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("GET %s: %v", tt.path, err)
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode != tt.wantStatus {
+			t.Errorf("GET %s: expected status %d, got %d", tt.path, tt.wantStatus, resp.StatusCode)
+		}
+	}
+}
+
+func TestLLMStatsEndpoint(t *testing.T) {
+	server, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	tests := []struct {
+		path       string
+		wantStatus int
+	}{
+		{"/api/v1/admin/llm-stats", http.StatusOK},
+		{"/api/v1/admin/llm-stats?days=30", http.StatusOK},
+		{"/api/v1/admin/llm-stats?days=0", http.StatusBadRequest},
+		{"/api/v1/admin/llm-stats?days=abc", http.StatusBadRequest},
+	}
+
+	client := &http.Client{}
+	for _, tt := range tests {
+		req, _ := http.NewRequest("GET", server.URL+tt.path, nil)
+		req.Header.Set("Authorization", "Bearer test_wolf_token")
+
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("GET %s: %v", tt.path, err)
+		}
+
+		if resp.StatusCode != tt.wantStatus {
+			t.Errorf("GET %s: expected status %d, got %d", tt.path, tt.wantStatus, resp.StatusCode)
+		}
+		if resp.StatusCode == http.StatusOK {
+			var body struct {
+				Tasks []map[string]interface{} `json:"tasks"`
+			}
+			if err := json.NewDecoder(resp.Body).Decode(&body); err != nil || body.Tasks == nil {
+				t.Errorf("GET %s: expected tasks array, got %v (%v)", tt.path, body.Tasks, err)
+			}
+		}
+		resp.Body.Close()
+	}
+}
+
+func TestStreamEndpointsValidation(t *testing.T) {
+	server, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	tests := []struct {
+		path       string
+		wantStatus int
+	}{
+		{"/api/v1/stream/letters/daily", http.StatusServiceUnavailable}, // no letter generator in tests
+		{"/api/v1/stream/ideas/cap_missing", http.StatusNotFound},
+	}
+
+	client := &http.Client{}
+	for _, tt := range tests {
+		req, _ := http.NewRequest("GET", server.URL+tt.path, nil)
+		req.Header.Set("Authorization", "Bearer test_wolf_token")
+
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("GET %s: %v", tt.path, err)
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode != tt.wantStatus {
+			t.Errorf("GET %s: expected status %d, got %d", tt.path, tt.wantStatus, resp.StatusCode)
+		}
+	}
+}
+
+func TestLLMCacheEndpoints(t *testing.T) {
+	server, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	tests := []struct {
+		method     string
+		path       string
+		wantStatus int
+	}{
+		{"GET", "/api/v1/admin/llm-cache", http.StatusOK},
+		{"DELETE", "/api/v1/admin/llm-cache", http.StatusOK},
+		{"DELETE", "/api/v1/admin/llm-cache?task=classify&expired=true", http.StatusOK},
+		{"DELETE", "/api/v1/admin/llm-cache?expired=maybe", http.StatusBadRequest},
+	}
+
+	client := &http.Client{}
+	for _, tt := range tests {
+		req, _ := http.NewRequest(tt.method, server.URL+tt.path, nil)
+		req.Header.Set("Authorization", "Bearer test_wolf_token")
+
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("%s %s: %v", tt.method, tt.path, err)
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode != tt.wantStatus {
+			t.Errorf("%s %s: expected status %d, got %d", tt.method, tt.path, tt.wantStatus, resp.StatusCode)
+		}
+	}
+}
+
+func TestLLMQueueEndpoint(t *testing.T) {
+	server, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	req, _ := http.NewRequest("GET", server.URL+"/api/v1/admin/llm-queue", nil)
+	req.Header.Set("Authorization", "Bearer test_wolf_token")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", resp.StatusCode)
+	}
+
+	var stats llm.QueueStats
+	if err := json.NewDecoder(resp.Body).Decode(&stats); err != nil {
+		t.Fatalf("decoding response: %v", err)
+	}
+	if stats.Limit != 0 || stats.Queued != 0 {
+		t.Errorf("stats = %+v, want an unlimited, empty queue", stats)
+	}
+}
+
+func TestAskValidation(t *testing.T) {
+	server, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	tests := []struct {
+		payload    string
+		wantStatus int
+	}{
+		{`{"question": "   "}`, http.StatusBadRequest},
+		{`not json`, http.StatusBadRequest},
+		{`{"question": "` + strings.Repeat("why ", 200) + `"}`, http.StatusBadRequest},
+	}
+
+	client := &http.Client{}
+	for _, tt := range tests {
+		req, _ := http.NewRequest("POST", server.URL+"/api/v1/ask", bytes.NewBufferString(tt.payload))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer test_wolf_token")
+
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("POST /ask: %v", err)
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode != tt.wantStatus {
+			t.Errorf("POST /ask %.20q: expected status %d, got %d", tt.payload, tt.wantStatus, resp.StatusCode)
+		}
+	}
+}
+
+func TestUserAdminEndpoints(t *testing.T) {
+	server, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	do := func(method, path, token, body string) (int, map[string]interface{}) {
+		t.Helper()
+		req, _ := http.NewRequest(method, server.URL+path, bytes.NewBufferString(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("%s %s: %v", method, path, err)
+		}
+		defer resp.Body.Close()
+		var out map[string]interface{}
+		json.NewDecoder(resp.Body).Decode(&out)
+		return resp.StatusCode, out
+	}
+
+	tests := []struct {
+		method     string
+		path       string
+		body       string
+		wantStatus int
+	}{
+		{"POST", "/api/v1/admin/users", `{"id": "kid", "name": "Kid"}`, http.StatusCreated},
+		{"POST", "/api/v1/admin/users", `{"id": "kid"}`, http.StatusConflict},
+		{"POST", "/api/v1/admin/users", `{"id": "Bad Name"}`, http.StatusBadRequest},
+		{"POST", "/api/v1/admin/users/nobody/tokens", `{"label": "phone", "scopes": ["capture:write"]}`, http.StatusNotFound},
+		{"POST", "/api/v1/admin/users/kid/tokens", `{"label": "phone"}`, http.StatusBadRequest},
+		{"POST", "/api/v1/admin/users/kid/tokens", `{"label": "phone", "scopes": ["root"]}`, http.StatusBadRequest},
+		{"GET", "/api/v1/admin/users/nobody/tokens", "", http.StatusNotFound},
+		{"DELETE", "/api/v1/admin/users/kid/tokens/abc", "", http.StatusBadRequest},
+		{"DELETE", "/api/v1/admin/users/kid/tokens/999", "", http.StatusNotFound},
+		{"DELETE", "/api/v1/admin/users/wolf", "", http.StatusBadRequest},
+		{"DELETE", "/api/v1/admin/users/nobody", "", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		if status, out := do(tt.method, tt.path, "test_wolf_token", tt.body); status != tt.wantStatus {
+			t.Errorf("%s %s: status %d (%v), want %d", tt.method, tt.path, status, out, tt.wantStatus)
+		}
+	}
+
+	// A new token works for the new user until revoked
+	status, created := do("POST", "/api/v1/admin/users/kid/tokens", "test_wolf_token", `{"label": "tablet", "scopes": ["capture:write"]}`)
+	if status != http.StatusCreated {
+		t.Fatalf("create token: status %d (%v)", status, created)
+	}
+	token, _ := created["token"].(string)
+	if token == "" || created["label"] != "tablet" {
+		t.Fatalf("create token response = %v", created)
+	}
+	if status, _ := do("GET", "/api/v1/pending", token, ""); status != http.StatusOK {
+		t.Errorf("new token: status %d, want 200", status)
+	}
+
+	tokenID := int64(created["id"].(float64))
+	if status, _ := do("DELETE", fmt.Sprintf("/api/v1/admin/users/kid/tokens/%d", tokenID), "test_wolf_token", ""); status != http.StatusOK {
+		t.Errorf("revoke token: status %d, want 200", status)
+	}
+	if status, _ := do("GET", "/api/v1/pending", token, ""); status != http.StatusUnauthorized {
+		t.Errorf("revoked token: status %d, want 401", status)
+	}
+
+	// Disabling a user removes them from the active users
+	if status, _ := do("DELETE", "/api/v1/admin/users/wife", "test_wolf_token", ""); status != http.StatusOK {
+		t.Errorf("disable wife: status %d, want 200", status)
+	}
+	if status, _ := do("GET", "/api/v1/pending", "test_wife_token", ""); status != http.StatusUnauthorized {
+		t.Errorf("disabled user's token: status %d, want 401", status)
+	}
+	_, list := do("GET", "/api/v1/admin/users", "test_wolf_token", "")
+	if users, _ := list["users"].([]interface{}); len(users) != 3 {
+		t.Errorf("users = %v, want kid, wife and wolf", list)
+	}
+}
+
+func TestTokenScopes(t *testing.T) {
+	server, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	do := func(method, path, token, body string) (int, map[string]interface{}) {
+		t.Helper()
+		req, _ := http.NewRequest(method, server.URL+path, bytes.NewBufferString(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("%s %s: %v", method, path, err)
+		}
+		defer resp.Body.Close()
+		var out map[string]interface{}
+		json.NewDecoder(resp.Body).Decode(&out)
+		return resp.StatusCode, out
+	}
+	issue := func(body string) string {
+		t.Helper()
+		status, created := do("POST", "/api/v1/admin/users/wolf/tokens", "test_wolf_token", body)
+		if status != http.StatusCreated {
+			t.Fatalf("create token: status %d (%v)", status, created)
+		}
+		return created["token"].(string)
+	}
+
+	phone := issue(`{"label": "phone", "device_id": "pixel", "scopes": ["capture:write", "letters:read"]}`)
+	watch := issue(`{"label": "watch", "device_id": "pixel", "scopes": ["capture:write"]}`)
+
+	tests := []struct {
+		method     string
+		path       string
+		body       string
+		wantStatus int
+	}{
+		{"GET", "/api/v1/pending", "", http.StatusOK},
+		{"GET", "/api/v1/letters", "", http.StatusOK},
+		{"POST", "/api/v1/capture", `{"text": "test", "device_id": "ipad"}`, http.StatusForbidden},
+		{"POST", "/api/v1/test/daily", "", http.StatusForbidden},
+		{"GET", "/api/v1/admin/users", "", http.StatusForbidden},
+		{"GET", "/api/v1/search?q=test", "", http.StatusForbidden},
+		{"GET", "/api/v1/medications", "", http.StatusForbidden},
+		{"POST", "/api/v1/medications", `{}`, http.StatusForbidden},
+		{"GET", "/api/v1/mood", "", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		status, out := do(tt.method, tt.path, phone, tt.body)
+		if status != tt.wantStatus {
+			t.Errorf("%s %s: status %d (%v), want %d", tt.method, tt.path, status, out, tt.wantStatus)
+		}
+		if status == http.StatusForbidden && tt.body == "" && out["code"] != "INSUFFICIENT_SCOPE" {
+			t.Errorf("%s %s: code %v, want INSUFFICIENT_SCOPE", tt.method, tt.path, out["code"])
+		}
+	}
+
+	// A lost phone: revoking the device revokes both of its tokens
+	if status, out := do("DELETE", "/api/v1/admin/users/wolf/devices/pixel", "test_wolf_token", ""); status != http.StatusOK || out["revoked"] != float64(2) {
+		t.Fatalf("revoke device: status %d (%v), want 2 revoked", status, out)
+	}
+	for _, token := range []string{phone, watch} {
+		if status, _ := do("GET", "/api/v1/pending", token, ""); status != http.StatusUnauthorized {
+			t.Errorf("token for revoked device: status %d, want 401", status)
+		}
+	}
+	if status, _ := do("DELETE", "/api/v1/admin/users/wolf/devices/pixel", "test_wolf_token", ""); status != http.StatusNotFound {
+		t.Errorf("revoke device again: status %d, want 404", status)
+	}
+	if status, _ := do("GET", "/api/v1/pending", "test_wolf_token", ""); status != http.StatusOK {
+		t.Errorf("bootstrap token after device revoke: status %d, want 200", status)
+	}
+}
+
+func TestOIDCLogin(t *testing.T) {
+	issuer := oidctest.NewServer(t)
+	tmpDir := t.TempDir()
+	cfg := &config.Config{
+		VaultPath:        tmpDir,
+		Timezone:         "UTC",
+		OIDCIssuer:       issuer.URL,
+		OIDCClientID:     oidctest.ClientID,
+		OIDCClientSecret: oidctest.ClientSecret,
+		OIDCAppRedirect:  "brain://auth",
+	}
+	database, err := db.Open(tmpDir + "/test.db")
+	if err != nil {
+		t.Fatalf("opening database: %v", err)
+	}
+	t.Cleanup(func() { database.Close() })
+	database.EnsureUserToken("wolf", "bootstrap", "test_wolf_token")
+
+	router, handlers := NewRouter(cfg, database, vault.NewVault(tmpDir), llm.NewClient("http://localhost:1", "m", "m"))
+	server := httptest.NewServer(router)
+	t.Cleanup(server.Close)
+	cfg.OIDCRedirectURL = server.URL + "/auth/callback"
+	handlers.SetOIDC(oidc.NewProvider(oidc.Config{
+		Issuer:       cfg.OIDCIssuer,
+		ClientID:     cfg.OIDCClientID,
+		ClientSecret: cfg.OIDCClientSecret,
+		RedirectURL:  cfg.OIDCRedirectURL,
+	}))
+	AddAuthRoutes(router, handlers)
+
+	// A browser that follows redirects until it leaves the login flow
+	newBrowser := func() *http.Client {
+		jar, _ := cookiejar.New(nil)
+		return &http.Client{Jar: jar, CheckRedirect: func(req *http.Request, _ []*http.Request) error {
+			if req.URL.Scheme == "brain" || req.URL.Path == "/home" {
+				return http.ErrUseLastResponse
+			}
+			return nil
+		}}
+	}
+	do := func(client *http.Client, method, path, bearer, body string, header ...string) (int, map[string]interface{}) {
+		t.Helper()
+		req, _ := http.NewRequest(method, server.URL+path, bytes.NewBufferString(body))
+		if bearer != "" {
+			req.Header.Set("Authorization", "Bearer "+bearer)
+		}
+		for i := 0; i+1 < len(header); i += 2 {
+			req.Header.Set(header[i], header[i+1])
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("%s %s: %v", method, path, err)
+		}
+		defer resp.Body.Close()
+		out := map[string]interface{}{"location": resp.Header.Get("Location")}
+		json.NewDecoder(resp.Body).Decode(&out)
+		return resp.StatusCode, out
+	}
+
+	status, linked := do(http.DefaultClient, "POST", "/api/v1/admin/users/wolf/identities", "test_wolf_token",
+		`{"email": "wolf@example.com", "scopes": ["capture:write", "letters:read"]}`)
+	if status != http.StatusCreated || linked["issuer"] != issuer.URL {
+		t.Fatalf("link identity: status %d (%v)", status, linked)
+	}
+
+	// An unlinked account is turned away
+	issuer.Login("sub-stranger", "stranger@example.com")
+	if status, out := do(newBrowser(), "GET", "/auth/login", "", ""); status != http.StatusForbidden || out["code"] != "NOT_LINKED" {
+		t.Errorf("unlinked login: status %d (%v), want 403 NOT_LINKED", status, out)
+	}
+
+	// Browser login sets a session cookie limited to the identity's scopes
+	issuer.Login("sub-wolf", "wolf@example.com")
+	browser := newBrowser()
+	if status, out := do(browser, "GET", "/auth/login?return_to=/home", "", ""); status != http.StatusFound || out["location"] != "/home" {
+		t.Fatalf("browser login: status %d (%v), want a redirect to /home", status, out)
+	}
+	if status, _ := do(browser, "GET", "/api/v1/pending", "", ""); status != http.StatusOK {
+		t.Errorf("pending with session cookie: status %d, want 200", status)
+	}
+	if status, _ := do(browser, "GET", "/api/v1/admin/users", "", ""); status != http.StatusForbidden {
+		t.Errorf("admin with session cookie: status %d, want 403", status)
+	}
+	if status, _ := do(browser, "POST", "/api/v1/clarify", "", `{}`, "Origin", "https://evil.example"); status != http.StatusForbidden {
+		t.Errorf("cross-site POST with session cookie: status %d, want 403", status)
+	}
+	if status, _ := do(browser, "POST", "/auth/logout", "", "", "Origin", server.URL); status != http.StatusOK {
+		t.Errorf("logout: status %d, want 200", status)
+	}
+	if status, _ := do(browser, "GET", "/api/v1/pending", "", ""); status != http.StatusUnauthorized {
+		t.Errorf("pending after logout: status %d, want 401", status)
+	}
+
+	// App login hands tokens to the app URL; refresh rotates them
+	status, out := do(newBrowser(), "GET", "/auth/login?client=app", "", "")
+	location, _ := url.Parse(out["location"].(string))
+	if status != http.StatusFound || location.Scheme != "brain" {
+		t.Fatalf("app login: status %d (%v), want a redirect to brain://auth", status, out)
+	}
+	tokens, _ := url.ParseQuery(location.Fragment)
+	access, refresh := tokens.Get("access_token"), tokens.Get("refresh_token")
+	if status, _ := do(http.DefaultClient, "GET", "/api/v1/letters", access, ""); status != http.StatusOK {
+		t.Errorf("letters with app access token: status %d, want 200", status)
+	}
+
+	status, refreshed := do(http.DefaultClient, "POST", "/auth/refresh", "", `{"refresh_token": "`+refresh+`"}`)
+	if status != http.StatusOK || refreshed["access_token"] == "" || refreshed["refresh_token"] == refresh {
+		t.Fatalf("refresh: status %d (%v)", status, refreshed)
+	}
+	if status, _ := do(http.DefaultClient, "GET", "/api/v1/letters", access, ""); status != http.StatusUnauthorized {
+		t.Errorf("old access token after refresh: status %d, want 401", status)
+	}
+	if status, _ := do(http.DefaultClient, "GET", "/api/v1/letters", refreshed["access_token"].(string), ""); status != http.StatusOK {
+		t.Errorf("new access token: status %d, want 200", status)
+	}
+	if status, _ := do(http.DefaultClient, "POST", "/auth/refresh", "", `{"refresh_token": "`+refresh+`"}`); status != http.StatusUnauthorized {
+		t.Errorf("reused refresh token: status %d, want 401", status)
+	}
+
+	// A callback the browser did not start is rejected
+	if status, _ := do(newBrowser(), "GET", "/auth/callback?state=forged&code=x", "", ""); status != http.StatusBadRequest {
+		t.Errorf("forged callback: status %d, want 400", status)
+	}
+}
+
+func TestRateLimits(t *testing.T) {
+	tmpDir := t.TempDir()
+	cfg := &config.Config{
+		VaultPath: tmpDir,
+		Timezone:  "UTC",
+		RateLimits: ratelimit.Limits{
+			ratelimit.GroupDefault: {Limit: 3, Per: time.Minute},
+			ratelimit.GroupLLM:     {Limit: 1, Per: time.Hour},
+		},
+	}
+	database, err := db.Open(tmpDir + "/test.db")
+	if err != nil {
+		t.Fatalf("opening database: %v", err)
+	}
+	t.Cleanup(func() { database.Close() })
+	database.EnsureUserToken("wolf", "bootstrap", "test_wolf_token")
+	database.EnsureUserToken("wife", "bootstrap", "test_wife_token")
+
+	router, _ := NewRouter(cfg, database, vault.NewVault(tmpDir), llm.NewClient("http://localhost:1", "m", "m"))
+	server := httptest.NewServer(router)
+	t.Cleanup(server.Close)
+
+	do := func(method, path, token string) *http.Response {
+		t.Helper()
+		req, _ := http.NewRequest(method, server.URL+path, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("%s %s: %v", method, path, err)
+		}
+		resp.Body.Close()
+		return resp
+	}
+
+	tests := []struct {
+		method        string
+		path          string
+		wantStatus    int
+		wantLimit     string
+		wantRemaining string
+		wantRetry     string
+	}{
+		{"GET", "/api/v1/pending", http.StatusOK, "3", "2", ""},
+		// The LLM budget is taken on top of the default one, and reported instead of it
+		{"POST", "/api/v1/test/daily", http.StatusServiceUnavailable, "1", "0", ""},
+		{"POST", "/api/v1/test/daily", http.StatusTooManyRequests, "1", "0", "3600"},
+		{"GET", "/api/v1/pending", http.StatusTooManyRequests, "3", "0", "20"},
+	}
+	for i, tt := range tests {
+		resp := do(tt.method, tt.path, "test_wolf_token")
+		if resp.StatusCode != tt.wantStatus {
+			t.Errorf("request %d %s %s: status %d, want %d", i+1, tt.method, tt.path, resp.StatusCode, tt.wantStatus)
+		}
+		h := resp.Header
+		if h.Get("X-RateLimit-Limit") != tt.wantLimit || h.Get("X-RateLimit-Remaining") != tt.wantRemaining || h.Get("Retry-After") != tt.wantRetry {
+			t.Errorf("request %d %s %s: limit %q remaining %q retry %q, want %q %q %q", i+1, tt.method, tt.path,
+				h.Get("X-RateLimit-Limit"), h.Get("X-RateLimit-Remaining"), h.Get("Retry-After"),
+				tt.wantLimit, tt.wantRemaining, tt.wantRetry)
+		}
+	}
+
+	// Budgets are per actor
+	if resp := do("GET", "/api/v1/pending", "test_wife_token"); resp.StatusCode != http.StatusOK {
+		t.Errorf("wife: status %d, want 200", resp.StatusCode)
+	}
+}
+
+func TestRateLimitsBeforeAuth(t *testing.T) {
+	tmpDir := t.TempDir()
+	cfg := &config.Config{
+		VaultPath:  tmpDir,
+		Timezone:   "UTC",
+		RateLimits: ratelimit.Limits{ratelimit.GroupClient: {Limit: 2, Per: time.Minute}},
+	}
+	database, err := db.Open(tmpDir + "/test.db")
+	if err != nil {
+		t.Fatalf("opening database: %v", err)
+	}
+	t.Cleanup(func() { database.Close() })
+	database.EnsureUserToken("wolf", "bootstrap", "test_wolf_token")
+
+	router, _ := NewRouter(cfg, database, vault.NewVault(tmpDir), llm.NewClient("http://localhost:1", "m", "m"))
+	server := httptest.NewServer(router)
+	t.Cleanup(server.Close)
+
+	// Guessed tokens use up the address's budget, so guessing cannot go on unlimited,
+	// and forwarding headers from a client that is not a trusted proxy don't reset it
+	for i, want := range []int{http.StatusUnauthorized, http.StatusUnauthorized, http.StatusTooManyRequests} {
+		req, _ := http.NewRequest("GET", server.URL+"/api/v1/pending", nil)
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer guess_%d", i))
+		req.Header.Set("X-Forwarded-For", fmt.Sprintf("203.0.113.%d", i))
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != want {
+			t.Errorf("guess %d: status %d, want %d", i+1, resp.StatusCode, want)
+		}
+	}
+}
+
+func TestRealIP(t *testing.T) {
+	_, proxies, _ := net.ParseCIDR("10.0.0.0/8")
+	trusted := []*net.IPNet{proxies}
+
+	tests := []struct {
+		name         string
+		remoteAddr   string
+		forwardedFor string
+		realIP       string
+		want         string
+	}{
+		{"direct client", "198.51.100.7:4000", "", "", "198.51.100.7:4000"},
+		{"spoofed by a client", "198.51.100.7:4000", "203.0.113.1", "203.0.113.2", "198.51.100.7:4000"},
+		{"trusted proxy", "10.0.0.2:4000", "203.0.113.1", "", "203.0.113.1"},
+		{"client prepends a spoofed hop", "10.0.0.2:4000", "192.0.2.9, 203.0.113.1, 10.0.0.3", "", "203.0.113.1"},
+		{"real ip from a trusted proxy", "10.0.0.2:4000", "", "203.0.113.2", "203.0.113.2"},
+		{"garbage", "10.0.0.2:4000", "not-an-ip", "", "10.0.0.2:4000"},
+	}
+	for _, tt := range tests {
+		var got string
+		handler := RealIP(trusted)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			got = r.RemoteAddr
+		}))
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = tt.remoteAddr
+		if tt.forwardedFor != "" {
+			req.Header.Set("X-Forwarded-For", tt.forwardedFor)
+		}
+		if tt.realIP != "" {
+			req.Header.Set("X-Real-IP", tt.realIP)
+		}
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+		if got != tt.want {
+			t.Errorf("%s: remote address %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestAuditLog(t *testing.T) {
+	server, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	do := func(method, path, token, body string) (int, map[string]interface{}) {
+		t.Helper()
+		req, _ := http.NewRequest(method, server.URL+path, bytes.NewBufferString(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("%s %s: %v", method, path, err)
+		}
+		defer resp.Body.Close()
+		var out map[string]interface{}
+		json.NewDecoder(resp.Body).Decode(&out)
+		return resp.StatusCode, out
+	}
+
+	_, captured := do("POST", "/api/v1/capture", "test_wolf_token", `{"text": "an idea for later", "device_id": "pixel"}`)
+	captureID, _ := captured["capture_id"].(string)
+	if captureID == "" {
+		t.Fatalf("capture: %v", captured)
+	}
+	if status, out := do("POST", "/api/v1/clarify", "test_wolf_token", `{"capture_id": "`+captureID+`", "destination": "Ideas"}`); status != http.StatusOK {
+		t.Fatalf("clarify: status %d (%v)", status, out)
+	}
+	do("GET", "/api/v1/pending", "test_wolf_token", "")
+	_, created := do("POST", "/api/v1/admin/users/wife/tokens", "test_wolf_token", `{"label": "watch", "device_id": "watch", "scopes": ["capture:write"]}`)
+	watch, _ := created["token"].(string)
+	if status, _ := do("POST", "/api/v1/test/daily", watch, ""); status != http.StatusForbidden {
+		t.Errorf("test/daily with a capture token: status %d, want 403", status)
+	}
+	if status, _ := do("GET", "/api/v1/pending", "guessed_token", ""); status != http.StatusUnauthorized {
+		t.Errorf("pending with a bad token: status %d, want 401", status)
+	}
+	if status, _ := do("GET", "/api/v1/admin/users/wife/export", "test_wolf_token", ""); status != http.StatusOK {
+		t.Errorf("export: status %d, want 200", status)
+	}
+
+	status, out := do("GET", "/api/v1/admin/audit", "test_wolf_token", "")
+	if status != http.StatusOK {
+		t.Fatalf("audit: status %d (%v)", status, out)
+	}
+	entries, _ := out["entries"].([]interface{})
+	var got []string
+	for _, e := range entries {
+		entry := e.(map[string]interface{})
+		targets, _ := entry["targets"].([]interface{})
+		got = append(got, fmt.Sprintf("%v %v %v %v %v %v", entry["actor"], entry["device_id"], entry["route"], len(targets), entry["outcome"], entry["ip"]))
+	}
+	want := []string{
+		"wolf <nil> /api/v1/admin/users/{userID}/export 1 ok 127.0.0.1",
+		" <nil> /api/v1/pending 0 denied 127.0.0.1", // no actor: the token was refused
+		"wife watch /api/v1/test/daily 0 denied 127.0.0.1",
+		"wolf <nil> /api/v1/admin/users/{userID}/tokens 1 ok 127.0.0.1",
+		"wolf <nil> /api/v1/clarify 1 ok 127.0.0.1",
+		"wolf pixel /api/v1/capture 1 ok 127.0.0.1",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("audit entries:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	// Both actions on the capture are found by its ID
+	_, out = do("GET", "/api/v1/admin/audit?target="+captureID, "test_wolf_token", "")
+	if entries, _ := out["entries"].([]interface{}); len(entries) != 2 {
+		t.Errorf("entries for %s = %v, want capture and clarify", captureID, out["entries"])
+	}
+
+	tests := []struct {
+		query      string
+		wantStatus int
+	}{
+		{"?actor=wife&since=2024-01-01", http.StatusOK},
+		{"?since=yesterday", http.StatusBadRequest},
+		{"?limit=0", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		if status, out := do("GET", "/api/v1/admin/audit"+tt.query, "test_wolf_token", ""); status != tt.wantStatus {
+			t.Errorf("audit%s: status %d (%v), want %d", tt.query, status, out, tt.wantStatus)
+		}
+	}
+	if status, _ := do("GET", "/api/v1/admin/audit", watch, ""); status != http.StatusForbidden {
+		t.Errorf("audit with a capture token: status %d, want 403", status)
+	}
+}
+
+func TestSharing(t *testing.T) {
+	server, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	do := func(method, path, token, body string) (int, map[string]interface{}) {
+		t.Helper()
+		req, _ := http.NewRequest(method, server.URL+path, bytes.NewBufferString(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("%s %s: %v", method, path, err)
+		}
+		defer resp.Body.Close()
+		var out map[string]interface{}
+		json.NewDecoder(resp.Body).Decode(&out)
+		return resp.StatusCode, out
+	}
+	file := func(body string) string {
+		t.Helper()
+		status, captured := do("POST", "/api/v1/capture", "test_wolf_token", body)
+		captureID, _ := captured["capture_id"].(string)
+		if status != http.StatusOK || captureID == "" {
+			t.Fatalf("capture %s: status %d (%v)", body, status, captured)
+		}
+		if status, out := do("POST", "/api/v1/clarify", "test_wolf_token", `{"capture_id": "`+captureID+`", "destination": "Ideas"}`); status != http.StatusOK {
+			t.Fatalf("clarify: status %d (%v)", status, out)
+		}
+		return captureID
+	}
+	shared := file(`{"text": "garden party on Saturday", "visibility": "household"}`)
+	private := file(`{"text": "garden surprise for the anniversary"}`)
+
+	if status, _ := do("POST", "/api/v1/capture", "test_wolf_token", `{"text": "x", "visibility": "public"}`); status != http.StatusBadRequest {
+		t.Errorf("capture with an unknown visibility: status %d, want 400", status)
+	}
+	if status, _ := do("POST", "/api/v1/capture", "test_wolf_token", `{"text": "x", "share_with": ["nobody"]}`); status != http.StatusBadRequest {
+		t.Errorf("capture shared with an unknown user: status %d, want 400", status)
+	}
+
+	searchIDs := func(token, query string) string {
+		t.Helper()
+		_, out := do("GET", "/api/v1/search?q=garden"+query, token, "")
+		results, _ := out["results"].([]interface{})
+		seen := map[string]bool{}
+		var ids []string
+		for _, r := range results {
+			id := r.(map[string]interface{})["doc_id"].(string)
+			if !seen[id] {
+				seen[id] = true
+				ids = append(ids, id)
+			}
+		}
+		sort.Strings(ids)
+		return strings.Join(ids, ",")
+	}
+	for _, query := range []string{"", "&actor=all", "&actor=wolf"} {
+		if got := searchIDs("test_wife_token", query); got != shared {
+			t.Errorf("wife's search%s = %q, want only the shared capture %s", query, got, shared)
+		}
+	}
+	if got := searchIDs("test_wolf_token", ""); !strings.Contains(got, shared) || !strings.Contains(got, private) {
+		t.Errorf("wolf's search = %q, want both captures", got)
+	}
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		token      string
+		body       string
+		wantStatus int
+	}{
+		{"comment on a shared capture", "POST", "/api/v1/captures/" + shared + "/comments", "test_wife_token", `{"text": "I'll bring the cake"}`, http.StatusCreated},
+		{"empty comment", "POST", "/api/v1/captures/" + shared + "/comments", "test_wife_token", `{"text": " "}`, http.StatusBadRequest},
+		{"comment on a private capture", "POST", "/api/v1/captures/" + private + "/comments", "test_wife_token", `{"text": "hi"}`, http.StatusNotFound},
+		{"read private comments", "GET", "/api/v1/captures/" + private + "/comments", "test_wife_token", "", http.StatusNotFound},
+		{"change someone else's sharing", "PUT", "/api/v1/captures/" + shared + "/sharing", "test_wife_token", `{"visibility": "private"}`, http.StatusForbidden},
+		{"invalid sharing", "PUT", "/api/v1/captures/" + private + "/sharing", "test_wolf_token", `{"visibility": "everyone"}`, http.StatusBadRequest},
+		{"share with wife", "PUT", "/api/v1/captures/" + private + "/sharing", "test_wolf_token", `{"visibility": "actors", "share_with": ["wife"]}`, http.StatusOK},
+		{"read newly shared comments", "GET", "/api/v1/captures/" + private + "/comments", "test_wife_token", "", http.StatusOK},
+		{"unknown capture", "GET", "/api/v1/captures/cap_missing/sharing", "test_wolf_token", "", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		if status, out := do(tt.method, tt.path, tt.token, tt.body); status != tt.wantStatus {
+			t.Errorf("%s: status %d (%v), want %d", tt.name, status, out, tt.wantStatus)
+		}
+	}
+
+	_, out := do("GET", "/api/v1/captures/"+shared+"/comments", "test_wolf_token", "")
+	if comments, _ := out["comments"].([]interface{}); len(comments) != 1 {
+		t.Errorf("comments on the shared capture = %v, want the cake", out["comments"])
+	}
+	_, out = do("GET", "/api/v1/captures/"+private+"/sharing", "test_wife_token", "")
+	if out["visibility"] != "actors" || out["owner"] != "wolf" {
+		t.Errorf("sharing after update = %v", out)
+	}
+}
+
+func TestClientCertAuth(t *testing.T) {
+	tmpDir := t.TempDir()
+	cfg := &config.Config{
+		VaultPath:         tmpDir,
+		Timezone:          "UTC",
+		TLSClientSubjects: certs.Subjects{"wolf-pixel": "wolf", "ghost-laptop": "ghost"},
+	}
+	database, err := db.Open(tmpDir + "/test.db")
+	if err != nil {
+		t.Fatalf("opening database: %v", err)
+	}
+	t.Cleanup(func() { database.Close() })
+	database.EnsureUserToken("wolf", "bootstrap", "test_wolf_token")
+
+	ca := certstest.NewCA(t)
+	certFile, keyFile := ca.Issue(t, "localhost")
+	reloader, err := certs.NewReloader(certFile, keyFile, ca.CAFile)
+	if err != nil {
+		t.Fatalf("loading certificate: %v", err)
+	}
+
+	router, _ := NewRouter(cfg, database, vault.NewVault(tmpDir), llm.NewClient("http://localhost:1", "m", "m"))
+	server := httptest.NewUnstartedServer(router)
+	server.TLS = reloader.TLSConfig(tls.VerifyClientCertIfGiven)
+	server.StartTLS()
+	t.Cleanup(server.Close)
+
+	clientWith := func(certificates ...tls.Certificate) *http.Client {
+		return &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{
+			RootCAs:      ca.Pool,
+			Certificates: certificates,
+		}}}
+	}
+	otherCA := certstest.NewCA(t)
+
+	tests := []struct {
+		name       string
+		client     *http.Client
+		path       string
+		token      string
+		wantStatus int
+	}{
+		{"mapped certificate", clientWith(ca.ClientCert(t, "wolf-pixel")), "/api/v1/pending", "", http.StatusOK},
+		{"no admin scope", clientWith(ca.ClientCert(t, "wolf-pixel")), "/api/v1/admin/users", "", http.StatusForbidden},
+		{"unmapped certificate", clientWith(ca.ClientCert(t, "someone")), "/api/v1/pending", "", http.StatusUnauthorized},
+		{"unknown user", clientWith(ca.ClientCert(t, "ghost-laptop")), "/api/v1/pending", "", http.StatusUnauthorized},
+		{"no certificate", clientWith(), "/api/v1/pending", "", http.StatusUnauthorized},
+		{"token without certificate", clientWith(), "/api/v1/pending", "test_wolf_token", http.StatusOK},
+		// A token takes precedence, so a bad one is not rescued by the certificate
+		{"bad token with certificate", clientWith(ca.ClientCert(t, "wolf-pixel")), "/api/v1/pending", "wrong", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		req, _ := http.NewRequest("GET", server.URL+tt.path, nil)
+		if tt.token != "" {
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+		}
+		resp, err := tt.client.Do(req)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		resp.Body.Close()
+		if resp.StatusCode != tt.wantStatus {
+			t.Errorf("%s: status %d, want %d", tt.name, resp.StatusCode, tt.wantStatus)
+		}
+	}
+
+	// Browsers send client certificates with requests other sites make, like cookies
+	for _, tt := range []struct {
+		origin        string
+		wantForbidden bool
+	}{
+		{"https://evil.example", true},
+		{"", false},
+	} {
+		req, _ := http.NewRequest("POST", server.URL+"/api/v1/capture", strings.NewReader(`{"text": "hello"}`))
+		if tt.origin != "" {
+			req.Header.Set("Origin", tt.origin)
+		}
+		resp, err := clientWith(ca.ClientCert(t, "wolf-pixel")).Do(req)
+		if err != nil {
+			t.Fatalf("origin %q: %v", tt.origin, err)
+		}
+		resp.Body.Close()
+		if (resp.StatusCode == http.StatusForbidden) != tt.wantForbidden {
+			t.Errorf("POST with a certificate from origin %q: status %d, want forbidden %v", tt.origin, resp.StatusCode, tt.wantForbidden)
+		}
+	}
+
+	// Certificates from an untrusted CA fail the handshake
+	if _, err := clientWith(otherCA.ClientCert(t, "wolf-pixel")).Get(server.URL + "/api/v1/pending"); err == nil {
+		t.Error("certificate from another CA: want handshake error")
+	}
+}
+
+func TestUserExportAndDelete(t *testing.T) {
+	server, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	do := func(method, path, token, body string) (*http.Response, []byte) {
+		t.Helper()
+		req, _ := http.NewRequest(method, server.URL+path, bytes.NewBufferString(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("%s %s: %v", method, path, err)
+		}
+		defer resp.Body.Close()
+		data, _ := io.ReadAll(resp.Body)
+		return resp, data
+	}
+
+	if resp, _ := do("POST", "/api/v1/capture", "test_wife_token", `{"text": "paint the shed green", "mode": "auto"}`); resp.StatusCode >= 300 {
+		t.Fatalf("capture: status %d", resp.StatusCode)
+	}
+
+	// The export is a zip with the user's rows
+	resp, data := do("GET", "/api/v1/admin/users/wife/export", "test_wolf_token", "")
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "application/zip" {
+		t.Fatalf("export: status %d, content type %q", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("reading export: %v", err)
+	}
+	found := false
+	for _, f := range zr.File {
+		if f.Name == "database/capture_log.json" {
+			rc, _ := f.Open()
+			rows, _ := io.ReadAll(rc)
+			rc.Close()
+			found = strings.Contains(string(rows), "paint the shed green")
+		}
+	}
+	if !found {
+		t.Error("export has no capture_log rows with the capture")
+	}
+
+	tests := []struct {
+		method     string
+		path       string
+		token      string
+		wantStatus int
+	}{
+		{"GET", "/api/v1/admin/users/nobody/export", "test_wolf_token", http.StatusNotFound},
+		{"DELETE", "/api/v1/admin/users/wife/data", "test_wolf_token", http.StatusConflict}, // still active
+		{"DELETE", "/api/v1/admin/users/wife", "test_wolf_token", http.StatusOK},
+		{"DELETE", "/api/v1/admin/users/wife/data", "test_wolf_token", http.StatusOK},
+		{"GET", "/api/v1/admin/users/wife/export", "test_wolf_token", http.StatusNotFound},
+		{"DELETE", "/api/v1/admin/users/wife/data", "test_wolf_token", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		if resp, body := do(tt.method, tt.path, tt.token, ""); resp.StatusCode != tt.wantStatus {
+			t.Errorf("%s %s: status %d (%s), want %d", tt.method, tt.path, resp.StatusCode, body, tt.wantStatus)
+		}
+	}
+}
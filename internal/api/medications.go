@@ -0,0 +1,133 @@
+package api
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/mrwolf/brain-server/internal/medication"
+	"github.com/mrwolf/brain-server/internal/models"
+)
+
+// Medications handles GET /medications
+func (h *Handlers) Medications(w http.ResponseWriter, r *http.Request) {
+	actor := GetActor(r)
+
+	meds, err := h.db.GetMedications(actor)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "database error", "DB_ERROR")
+		return
+	}
+
+	items := make([]models.Medication, 0, len(meds))
+	for _, m := range meds {
+		items = append(items, models.Medication{
+			MedID:     m.MedID,
+			Name:      m.Name,
+			Dose:      m.Dose,
+			Times:     m.Times,
+			CreatedTS: m.CreatedAt.Format(time.RFC3339),
+		})
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(models.MedicationsResponse{Medications: items})
+}
+
+// AddMedication handles POST /medications
+func (h *Handlers) AddMedication(w http.ResponseWriter, r *http.Request) {
+	var req models.MedicationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body", "INVALID_BODY")
+		return
+	}
+
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		writeError(w, http.StatusBadRequest, "name is required", "MISSING_NAME")
+		return
+	}
+	if err := medication.ValidateTimes(req.Times); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error(), "INVALID_TIMES")
+		return
+	}
+
+	actor := GetActor(r)
+	medID := generateID("med")
+	if err := h.db.AddMedication(medID, actor, req.Name, req.Dose, req.Times); err != nil {
+		log.Printf("Failed to add medication for %s: %v", actor, err)
+		writeError(w, http.StatusInternalServerError, "database error", "DB_ERROR")
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(models.Medication{
+		MedID:     medID,
+		Name:      req.Name,
+		Dose:      req.Dose,
+		Times:     req.Times,
+		CreatedTS: time.Now().UTC().Format(time.RFC3339),
+	})
+}
+
+// DeleteMedication handles DELETE /medications/{medID}
+// History is kept; the medication simply stops being tracked.
+func (h *Handlers) DeleteMedication(w http.ResponseWriter, r *http.Request) {
+	medID := chi.URLParam(r, "medID")
+
+	removed, err := h.db.DeactivateMedication(GetActor(r), medID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "database error", "DB_ERROR")
+		return
+	}
+	if !removed {
+		writeError(w, http.StatusNotFound, "medication not found", "NOT_FOUND")
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{
+		"status": "ok",
+		"med_id": medID,
+	})
+}
+
+// MedicationAdherence handles GET /medications/adherence?weeks=N
+func (h *Handlers) MedicationAdherence(w http.ResponseWriter, r *http.Request) {
+	weeks := 4
+	if s := r.URL.Query().Get("weeks"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 || n > 52 {
+			writeError(w, http.StatusBadRequest, "weeks must be between 1 and 52", "INVALID_WEEKS")
+			return
+		}
+		weeks = n
+	}
+
+	adherence, err := h.meds.Adherence(GetActor(r), weeks, time.Now())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "database error", "DB_ERROR")
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"weeks": adherence,
+	})
+}
+
+// trackMedication records taken/missed doses mentioned in a Health capture (fail closed)
+func (h *Handlers) trackMedication(actor, captureID, text string, ts time.Time) {
+	matches, err := h.meds.RecordCapture(actor, captureID, text, ts)
+	if err != nil {
+		log.Printf("Failed to track medication for %s: %v", captureID, err)
+		return
+	}
+	for _, m := range matches {
+		log.Printf("Medication %s %s for %s (%s)", m.Medication.Name, m.Status, actor, captureID)
+	}
+}
@@ -3,53 +3,232 @@ package api
 import (
 	"context"
 	"log"
+	"net"
 	"net/http"
+	"net/url"
+	"strconv"
 	"strings"
-	"sync"
 	"time"
 
-	"github.com/mrwolf/brain-server/internal/config"
+	"github.com/mrwolf/brain-server/internal/certs"
+	"github.com/mrwolf/brain-server/internal/db"
+	"github.com/mrwolf/brain-server/internal/models"
+	"github.com/mrwolf/brain-server/internal/ratelimit"
 )
 
 type contextKey string
 
 const ActorKey contextKey = "actor"
 
-// AuthMiddleware validates bearer tokens and sets the actor in context
-func AuthMiddleware(cfg *config.Config) func(http.Handler) http.Handler {
+// TokenKey holds the authenticated *db.APIToken
+const TokenKey contextKey = "token"
+
+// SessionKey holds the *db.Session when the request was authenticated by a login session
+const SessionKey contextKey = "session"
+
+// AuthMiddleware authenticates a bearer API token or login session access token, a
+// browser session cookie, or a verified client certificate mapped in subjects, and sets
+// the actor in context. Sessions are checked as tokens carrying their identity's scopes,
+// certificates as tokens with clientCertScopes.
+func AuthMiddleware(database *db.DB, subjects certs.Subjects) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			auth := r.Header.Get("Authorization")
-			if auth == "" {
+			var credential string
+			fromCookie, fromCert := false, false
+			certActor, certName := subjects.Actor(r.TLS)
+			if auth := r.Header.Get("Authorization"); auth != "" {
+				parts := strings.SplitN(auth, " ", 2)
+				if len(parts) != 2 || strings.ToLower(parts[0]) != "bearer" {
+					http.Error(w, `{"error":"invalid authorization format"}`, http.StatusUnauthorized)
+					return
+				}
+				credential = parts[1]
+			} else if c, err := r.Cookie(sessionCookie); err == nil {
+				credential = c.Value
+				fromCookie = true
+			} else if certName != "" {
+				fromCert = true
+			} else {
 				http.Error(w, `{"error":"missing authorization header"}`, http.StatusUnauthorized)
 				return
 			}
 
-			parts := strings.SplitN(auth, " ", 2)
-			if len(parts) != 2 || strings.ToLower(parts[0]) != "bearer" {
-				http.Error(w, `{"error":"invalid authorization format"}`, http.StatusUnauthorized)
+			var token *db.APIToken
+			var session *db.Session
+			var err error
+			switch {
+			case fromCert:
+				token, err = clientCertToken(database, certActor, certName)
+			case !fromCookie:
+				token, err = database.AuthenticateToken(credential)
+			}
+			if err == nil && token == nil && !fromCert {
+				session, err = database.AuthenticateSession(credential)
+				if session != nil {
+					token = session.Token()
+				}
+			}
+			if err != nil {
+				log.Printf("Authenticating token: %v", err)
+				http.Error(w, `{"error":"database error"}`, http.StatusInternalServerError)
 				return
 			}
-
-			token := parts[1]
-			actor, valid := cfg.ActorFromToken(token)
-			if !valid {
+			if token == nil && fromCert {
+				http.Error(w, `{"error":"client certificate is not mapped to an active user"}`, http.StatusUnauthorized)
+				return
+			}
+			if token == nil {
 				http.Error(w, `{"error":"invalid token"}`, http.StatusUnauthorized)
 				return
 			}
+			auditActor(r, token)
+			if (fromCookie || fromCert) && crossSite(r) {
+				http.Error(w, `{"error":"cross-site request"}`, http.StatusForbidden)
+				return
+			}
 
-			ctx := context.WithValue(r.Context(), ActorKey, actor)
+			ctx := context.WithValue(r.Context(), ActorKey, token.UserID)
+			ctx = context.WithValue(ctx, TokenKey, token)
+			if session != nil {
+				ctx = context.WithValue(ctx, SessionKey, session)
+			}
 			next.ServeHTTP(w, r.WithContext(ctx))
 		})
 	}
 }
 
+// clientCertScopes are granted to requests authenticated by a client certificate;
+// admin needs an API token
+var clientCertScopes = func() []string {
+	var scopes []string
+	for _, s := range db.AllScopes {
+		if s != db.ScopeAdmin {
+			scopes = append(scopes, s)
+		}
+	}
+	return scopes
+}()
+
+// clientCertToken returns a token for a request authenticated by a client certificate,
+// or nil if it is not mapped to a user or the user is unknown or disabled
+func clientCertToken(database *db.DB, actor, name string) (*db.APIToken, error) {
+	if actor == "" {
+		return nil, nil
+	}
+	user, err := database.GetUser(actor)
+	if err != nil || user == nil || user.DisabledAt != nil {
+		return nil, err
+	}
+	return &db.APIToken{UserID: user.ID, Label: "client certificate " + name, Scopes: clientCertScopes, CreatedAt: user.CreatedAt}, nil
+}
+
+// crossSite reports whether a request that changes state came from another site,
+// which a cookie or client certificate alone must not authorise: browsers send
+// both with requests other sites make
+func crossSite(r *http.Request) bool {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return false
+	}
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return r.Header.Get("Sec-Fetch-Site") == "cross-site"
+	}
+	u, err := url.Parse(origin)
+	return err != nil || u.Host != r.Host
+}
+
+// RealIP sets a request's remote address from its X-Forwarded-For or X-Real-IP
+// header when it comes from one of trusted. Anyone else could set them to spoof
+// the audit log or dodge the per-address rate limit, so they are ignored.
+func RealIP(trusted []*net.IPNet) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if ip := forwardedFor(r, trusted); ip != "" {
+				r.RemoteAddr = ip
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// forwardedFor returns the client address a trusted proxy forwarded the request
+// for: the last address in X-Forwarded-For that is not a trusted proxy itself,
+// or X-Real-IP. Empty if the request is not from a trusted proxy.
+func forwardedFor(r *http.Request, trusted []*net.IPNet) string {
+	if !isTrusted(net.ParseIP(clientIP(r)), trusted) {
+		return ""
+	}
+	if header := r.Header.Get("X-Forwarded-For"); header != "" {
+		hops := strings.Split(header, ",")
+		for i := len(hops) - 1; i >= 0; i-- {
+			ip := net.ParseIP(strings.TrimSpace(hops[i]))
+			if ip == nil {
+				return ""
+			}
+			if i == 0 || !isTrusted(ip, trusted) {
+				return ip.String()
+			}
+		}
+	}
+	if ip := net.ParseIP(strings.TrimSpace(r.Header.Get("X-Real-IP"))); ip != nil {
+		return ip.String()
+	}
+	return ""
+}
+
+// isTrusted reports whether ip is in one of the trusted networks
+func isTrusted(ip net.IP, trusted []*net.IPNet) bool {
+	if ip == nil {
+		return false
+	}
+	for _, network := range trusted {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// RequireScope rejects requests whose token lacks scope (use after AuthMiddleware)
+func RequireScope(scope string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if token := GetToken(r); token == nil || !token.HasScope(scope) {
+				writeError(w, http.StatusForbidden, "token lacks the "+scope+" scope", "INSUFFICIENT_SCOPE")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// hiddenCategories returns the categories the request's token may not read
+func hiddenCategories(r *http.Request) []string {
+	if token := GetToken(r); token != nil && token.HasScope(db.ScopeFinanceRead) {
+		return nil
+	}
+	return []string{models.CategoryFinancial}
+}
+
 // GetActor retrieves the actor from the request context
 func GetActor(r *http.Request) string {
 	actor, _ := r.Context().Value(ActorKey).(string)
 	return actor
 }
 
+// GetSession retrieves the login session from the request context, or nil for API tokens
+func GetSession(r *http.Request) *db.Session {
+	session, _ := r.Context().Value(SessionKey).(*db.Session)
+	return session
+}
+
+// GetToken retrieves the authenticated API token from the request context
+func GetToken(r *http.Request) *db.APIToken {
+	token, _ := r.Context().Value(TokenKey).(*db.APIToken)
+	return token
+}
+
 // LoggingMiddleware logs HTTP requests
 func LoggingMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -70,6 +249,13 @@ func (rw *responseWriter) WriteHeader(code int) {
 	rw.ResponseWriter.WriteHeader(code)
 }
 
+// Flush implements http.Flusher so streamed responses pass through
+func (rw *responseWriter) Flush() {
+	if f, ok := rw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
 // JSONContentType sets the Content-Type header to application/json
 func JSONContentType(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -78,64 +264,25 @@ func JSONContentType(next http.Handler) http.Handler {
 	})
 }
 
-// RateLimiter provides simple in-memory rate limiting per actor
-type RateLimiter struct {
-	mu       sync.Mutex
-	requests map[string][]time.Time
-	limit    int           // max requests per window
-	window   time.Duration // time window
-}
-
-// NewRateLimiter creates a new rate limiter
-func NewRateLimiter(limit int, window time.Duration) *RateLimiter {
-	return &RateLimiter{
-		requests: make(map[string][]time.Time),
-		limit:    limit,
-		window:   window,
-	}
-}
-
-// Allow checks if a request from the given key should be allowed
-func (rl *RateLimiter) Allow(key string) bool {
-	rl.mu.Lock()
-	defer rl.mu.Unlock()
-
-	now := time.Now()
-	cutoff := now.Add(-rl.window)
-
-	// Filter out old requests
-	var recent []time.Time
-	for _, t := range rl.requests[key] {
-		if t.After(cutoff) {
-			recent = append(recent, t)
-		}
-	}
-
-	// Check limit
-	if len(recent) >= rl.limit {
-		rl.requests[key] = recent
-		return false
-	}
-
-	// Allow and record
-	rl.requests[key] = append(recent, now)
-	return true
-}
-
-// RateLimitMiddleware limits requests per actor
-// Default: 60 requests per minute
-func RateLimitMiddleware(limiter *RateLimiter) func(http.Handler) http.Handler {
+// RateLimitMiddleware takes a request from the group's budget for the actor, or for the
+// client address on routes without authentication, and reports the budget in X-RateLimit-* headers
+func RateLimitMiddleware(limiter *ratelimit.Limiter, group string) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			actor := GetActor(r)
-			if actor == "" {
-				// No actor, use IP as fallback
-				actor = r.RemoteAddr
+			key := GetActor(r)
+			if key == "" {
+				key = clientIP(r)
 			}
 
-			if !limiter.Allow(actor) {
-				w.Header().Set("Retry-After", "60")
-				http.Error(w, `{"error":"rate limit exceeded","code":"RATE_LIMIT"}`, http.StatusTooManyRequests)
+			d := limiter.Allow(group, key)
+			if d.Limit > 0 {
+				w.Header().Set("X-RateLimit-Limit", strconv.Itoa(d.Limit))
+				w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(d.Remaining))
+				w.Header().Set("X-RateLimit-Reset", strconv.Itoa(ceilSeconds(d.Reset)))
+			}
+			if !d.Allowed {
+				w.Header().Set("Retry-After", strconv.Itoa(ceilSeconds(d.RetryAfter)))
+				writeError(w, http.StatusTooManyRequests, "rate limit exceeded", "RATE_LIMIT")
 				return
 			}
 
@@ -143,3 +290,7 @@ func RateLimitMiddleware(limiter *RateLimiter) func(http.Handler) http.Handler {
 		})
 	}
 }
+
+func ceilSeconds(d time.Duration) int {
+	return int((d + time.Second - 1) / time.Second)
+}
@@ -0,0 +1,50 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/mrwolf/brain-server/internal/db"
+)
+
+// Mood handles GET /mood?days=N - daily mood averages, oldest first
+func (h *Handlers) Mood(w http.ResponseWriter, r *http.Request) {
+	days := 30
+	if s := r.URL.Query().Get("days"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 || n > 365 {
+			writeError(w, http.StatusBadRequest, "days must be between 1 and 365", "INVALID_DAYS")
+			return
+		}
+		days = n
+	}
+
+	now := time.Now()
+	series, err := h.db.GetMoodDaily(GetActor(r), now.AddDate(0, 0, -days), now.Add(time.Minute), h.location)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "database error", "DB_ERROR")
+		return
+	}
+	if series == nil {
+		series = []db.MoodDay{}
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"days": series,
+	})
+}
+
+// scoreMood scores a Life or Journal capture into the mood time series (fail closed)
+func (h *Handlers) scoreMood(captureID, actor, category, text string, ts time.Time) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	if err := h.mood.Record(ctx, captureID, actor, category, text, ts); err != nil {
+		log.Printf("Failed to score mood for %s: %v", captureID, err)
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"github.com/mrwolf/brain-server/internal/config"
 	"github.com/mrwolf/brain-server/internal/db"
 	"github.com/mrwolf/brain-server/internal/llm"
+	"github.com/mrwolf/brain-server/internal/ratelimit"
 	"github.com/mrwolf/brain-server/internal/vault"
 )
 
@@ -14,38 +15,125 @@ func NewRouter(cfg *config.Config, database *db.DB, v *vault.Vault, llmClient *l
 
 	// Global middleware
 	r.Use(middleware.Recoverer)
-	r.Use(middleware.RealIP)
+	r.Use(RealIP(cfg.TrustedProxies))
 	r.Use(LoggingMiddleware)
 
 	handlers := NewHandlers(cfg, database, v, llmClient)
+	llmBudget := RateLimitMiddleware(handlers.limiter, ratelimit.GroupLLM)
 
 	// Public endpoints
 	r.Get("/health", handlers.Health)
 
 	// API v1 routes (authenticated)
 	r.Route("/api/v1", func(r chi.Router) {
-		r.Use(AuthMiddleware(cfg))
+		r.Use(RateLimitMiddleware(handlers.limiter, ratelimit.GroupClient)) // before auth, so failed tokens count too
+		r.Use(AuditMiddleware(database, v))                                 // before auth, so failed logins are recorded
+		r.Use(AuthMiddleware(database, cfg.TLSClientSubjects))
 		r.Use(JSONContentType)
+		r.Use(RateLimitMiddleware(handlers.limiter, ratelimit.GroupDefault))
 
-		r.Post("/capture", handlers.Capture)
-		r.Post("/clarify", handlers.Clarify)
-		r.Get("/pending", handlers.Pending)
-		r.Get("/letters", handlers.Letters)
+		r.Group(func(r chi.Router) {
+			r.Use(RequireScope(db.ScopeCaptureWrite))
+			r.Post("/capture", handlers.Capture)
+			r.Post("/clarify", handlers.Clarify)
+			r.Get("/pending", handlers.Pending)
 
-		// Test endpoints for manual letter generation
-		r.Post("/test/daily", handlers.TestGenerateDaily)
-		r.Post("/test/weekly", handlers.TestGenerateWeekly)
+			// Sharing captures with other users, and commenting on shared ones
+			r.Put("/captures/{captureID}/sharing", handlers.SetSharing)
+			r.Post("/captures/{captureID}/comments", handlers.AddComment)
+		})
+
+		r.Group(func(r chi.Router) {
+			r.Use(RequireScope(db.ScopeLettersRead))
+			r.Get("/letters", handlers.Letters)
+			r.With(llmBudget).Get("/stream/letters/daily", handlers.StreamDailyLetter)
+		})
+
+		// Medication schedules and adherence, mood time series
+		r.Group(func(r chi.Router) {
+			r.Use(RequireScope(db.ScopeHealthRead))
+			r.Get("/medications", handlers.Medications)
+			r.Get("/medications/adherence", handlers.MedicationAdherence)
+			r.Get("/mood", handlers.Mood)
+		})
+		r.Group(func(r chi.Router) {
+			r.Use(RequireScope(db.ScopeHealthWrite))
+			r.Post("/medications", handlers.AddMedication)
+			r.Delete("/medications/{medID}", handlers.DeleteMedication)
+		})
+
+		// Full-text and semantic search, comments, question answering and streamed idea
+		// expansion (Financial notes need finance:read as well)
+		r.Group(func(r chi.Router) {
+			r.Use(RequireScope(db.ScopeNotesRead))
+			r.Get("/search", handlers.Search)
+			r.Get("/search/semantic", handlers.SemanticSearch)
+			r.Get("/captures/{captureID}/related", handlers.RelatedNotes)
+			r.Get("/captures/{captureID}/sharing", handlers.Sharing)
+			r.Get("/captures/{captureID}/comments", handlers.Comments)
+			r.With(llmBudget).Post("/ask", handlers.Ask)
+			r.With(llmBudget).Get("/stream/ideas/{captureID}", handlers.StreamIdeaExpansion)
+		})
+
+		r.Group(func(r chi.Router) {
+			r.Use(RequireScope(db.ScopeAdmin))
+
+			// LLM call ledger and response cache
+			r.Get("/admin/llm-stats", handlers.LLMStats)
+			r.Get("/admin/llm-cache", handlers.LLMCacheStats)
+			r.Delete("/admin/llm-cache", handlers.PurgeLLMCache)
+			r.Get("/admin/llm-queue", handlers.LLMQueue)
+			r.Get("/admin/prompts", handlers.Prompts)
+
+			// Who did what
+			r.Get("/admin/audit", handlers.AuditLog)
+
+			// Users, their API tokens, devices and login identities, and export or deletion
+			// of everything stored for them
+			r.Get("/admin/users", handlers.Users)
+			r.Post("/admin/users", handlers.CreateUser)
+			r.Delete("/admin/users/{userID}", handlers.DisableUser)
+			r.Get("/admin/users/{userID}/export", handlers.ExportUser)
+			r.Delete("/admin/users/{userID}/data", handlers.DeleteUserData)
+			r.Get("/admin/users/{userID}/tokens", handlers.UserTokens)
+			r.Post("/admin/users/{userID}/tokens", handlers.CreateUserToken)
+			r.Delete("/admin/users/{userID}/tokens/{tokenID}", handlers.RevokeUserToken)
+			r.Delete("/admin/users/{userID}/devices/{deviceID}", handlers.RevokeDevice)
+			r.Get("/admin/users/{userID}/identities", handlers.UserIdentities)
+			r.Post("/admin/users/{userID}/identities", handlers.LinkIdentity)
+			r.Delete("/admin/users/{userID}/identities/{identityID}", handlers.UnlinkIdentity)
+
+			// Test endpoints for manual letter generation
+			r.With(llmBudget).Post("/test/daily", handlers.TestGenerateDaily)
+			r.With(llmBudget).Post("/test/weekly", handlers.TestGenerateWeekly)
+		})
 	})
 
 	return r, handlers
 }
 
+// AddAuthRoutes adds the OpenID Connect login routes (call after SetOIDC)
+func AddAuthRoutes(r *chi.Mux, h *Handlers) {
+	r.Route("/auth", func(r chi.Router) {
+		r.Use(JSONContentType)
+		r.Use(RateLimitMiddleware(h.limiter, ratelimit.GroupAuth))
+		r.Get("/login", h.Login)
+		r.Get("/callback", h.Callback)
+		r.Post("/refresh", h.Refresh)
+		r.With(AuthMiddleware(h.db, h.cfg.TLSClientSubjects)).Post("/logout", h.Logout)
+	})
+}
+
 // AddJournalRoutes adds journal-related routes (call after narrator is set)
-func AddJournalRoutes(r *chi.Mux, h *Handlers, cfg *config.Config) {
+func AddJournalRoutes(r *chi.Mux, h *Handlers) {
 	r.Route("/api/v1/journal", func(r chi.Router) {
-		r.Use(AuthMiddleware(cfg))
+		r.Use(RateLimitMiddleware(h.limiter, ratelimit.GroupClient))
+		r.Use(AuditMiddleware(h.db, h.vault))
+		r.Use(AuthMiddleware(h.db, h.cfg.TLSClientSubjects))
 		r.Use(JSONContentType)
-		r.Post("/update", h.JournalUpdate)
+		r.Use(RequireScope(db.ScopeJournalWrite))
+		r.Use(RateLimitMiddleware(h.limiter, ratelimit.GroupDefault))
+		r.With(RateLimitMiddleware(h.limiter, ratelimit.GroupLLM)).Post("/update", h.JournalUpdate)
 		r.Get("/status", h.JournalStatus)
 	})
 }
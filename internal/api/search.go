@@ -0,0 +1,107 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mrwolf/brain-server/internal/db"
+	"github.com/mrwolf/brain-server/internal/models"
+)
+
+// Search handles GET /search?q=...&category=&kind=&actor=&since=&until=&limit=
+// Results cover the caller's documents and those other users shared with them;
+// actor narrows them to one owner.
+// since/until accept RFC3339 or YYYY-MM-DD (until is inclusive for dates).
+func (h *Handlers) Search(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+
+	text := strings.TrimSpace(params.Get("q"))
+	if text == "" {
+		writeError(w, http.StatusBadRequest, "q is required", "MISSING_QUERY")
+		return
+	}
+
+	query := db.SearchQuery{
+		Text:     text,
+		Actor:    params.Get("actor"),
+		Reader:   GetActor(r),
+		Category: params.Get("category"),
+		Kind:     params.Get("kind"),
+		Limit:    20,
+		Exclude:  hiddenCategories(r),
+	}
+	if query.Actor == "all" {
+		query.Actor = ""
+	}
+
+	if s := params.Get("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 || n > 100 {
+			writeError(w, http.StatusBadRequest, "limit must be between 1 and 100", "INVALID_LIMIT")
+			return
+		}
+		query.Limit = n
+	}
+
+	var err error
+	if query.Since, err = h.parseSearchTime(params.Get("since"), false); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid since format, use RFC3339 or YYYY-MM-DD", "INVALID_DATE")
+		return
+	}
+	if query.Until, err = h.parseSearchTime(params.Get("until"), true); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid until format, use RFC3339 or YYYY-MM-DD", "INVALID_DATE")
+		return
+	}
+
+	hits, err := h.db.Search(query)
+	if err != nil {
+		log.Printf("Search failed for %q: %v", text, err)
+		writeError(w, http.StatusInternalServerError, "database error", "DB_ERROR")
+		return
+	}
+
+	results := make([]models.SearchResult, 0, len(hits))
+	for _, hit := range hits {
+		results = append(results, models.SearchResult{
+			DocID:     hit.DocID,
+			Kind:      hit.Kind,
+			Actor:     hit.Actor,
+			Category:  hit.Category,
+			Title:     hit.Title,
+			Snippet:   hit.Snippet,
+			Path:      hit.Path,
+			CreatedTS: hit.Created.Format(time.RFC3339),
+			Score:     hit.Score,
+		})
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(models.SearchResponse{
+		Query:   text,
+		Results: results,
+	})
+}
+
+// parseSearchTime parses an RFC3339 timestamp or a YYYY-MM-DD date in the server timezone.
+// With endOfDay a bare date covers the whole day.
+func (h *Handlers) parseSearchTime(s string, endOfDay bool) (*time.Time, error) {
+	if s == "" {
+		return nil, nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return &t, nil
+	}
+	t, err := time.ParseInLocation("2006-01-02", s, h.location)
+	if err != nil {
+		return nil, fmt.Errorf("expected RFC3339 or YYYY-MM-DD")
+	}
+	if endOfDay {
+		t = t.AddDate(0, 0, 1)
+	}
+	return &t, nil
+}
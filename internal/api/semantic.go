@@ -0,0 +1,175 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/mrwolf/brain-server/internal/db"
+	"github.com/mrwolf/brain-server/internal/embeddings"
+	"github.com/mrwolf/brain-server/internal/llm"
+	"github.com/mrwolf/brain-server/internal/models"
+)
+
+// maxRelatedNotes is how many related notes are linked from a new note
+const maxRelatedNotes = 5
+
+// SemanticSearch handles GET /search/semantic?q=...&kind=&limit=
+// Like Search, it covers the caller's documents and those shared with them.
+func (h *Handlers) SemanticSearch(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+
+	text := strings.TrimSpace(params.Get("q"))
+	if text == "" {
+		writeError(w, http.StatusBadRequest, "q is required", "MISSING_QUERY")
+		return
+	}
+
+	limit := 10
+	if s := params.Get("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 || n > 100 {
+			writeError(w, http.StatusBadRequest, "limit must be between 1 and 100", "INVALID_LIMIT")
+			return
+		}
+		limit = n
+	}
+
+	var kinds []string
+	if kind := params.Get("kind"); kind != "" {
+		kinds = append(kinds, kind)
+	}
+
+	ctx, cancel := context.WithTimeout(llm.WithPriority(r.Context(), llm.PriorityInteractive), 30*time.Second)
+	defer cancel()
+
+	matches, err := h.embedder.SearchVisible(ctx, GetActor(r), text, limit, kinds...)
+	if err != nil {
+		log.Printf("Semantic search failed for %q: %v", text, err)
+		writeError(w, http.StatusServiceUnavailable, "embedding failed", "EMBEDDING_FAILED")
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(models.SearchResponse{
+		Query:   text,
+		Results: matchResults(visibleMatches(r, matches)),
+	})
+}
+
+// RelatedNotes handles GET /captures/{captureID}/related
+func (h *Handlers) RelatedNotes(w http.ResponseWriter, r *http.Request) {
+	captureID := chi.URLParam(r, "captureID")
+	actor := GetActor(r)
+
+	// A capture is indexed as a note once filed, and as a raw capture from the start
+	var doc *db.SearchDoc
+	for _, kind := range []string{db.DocNote, db.DocJournal, db.DocCapture} {
+		d, err := h.db.GetSearchDoc(captureID, kind)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "database error", "DB_ERROR")
+			return
+		}
+		if d != nil {
+			doc = d
+			break
+		}
+	}
+	if doc == nil || containsFold(hiddenCategories(r), doc.Category) {
+		writeError(w, http.StatusNotFound, "capture not found", "NOT_FOUND")
+		return
+	}
+	// The caller's notes related to one shared with them
+	if visible, err := h.db.VisibleTo(actor, doc.Actor, doc.DocID); err != nil {
+		writeError(w, http.StatusInternalServerError, "database error", "DB_ERROR")
+		return
+	} else if !visible {
+		writeError(w, http.StatusNotFound, "capture not found", "NOT_FOUND")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+	defer cancel()
+
+	matches, err := h.embedder.Related(ctx, actor, doc.DocID, doc.Kind, maxRelatedNotes)
+	if err != nil {
+		log.Printf("Related lookup failed for %s: %v", captureID, err)
+		writeError(w, http.StatusServiceUnavailable, "embedding failed", "EMBEDDING_FAILED")
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(models.RelatedResponse{
+		CaptureID: captureID,
+		Related:   matchResults(visibleMatches(r, matches)),
+	})
+}
+
+// relatedNotes returns vault paths of existing notes similar to a new capture
+// (fail closed - a slow or missing embedding model just means no related section)
+func (h *Handlers) relatedNotes(ctx context.Context, actor, text string) []string {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	vector, err := h.embedder.EmbedText(ctx, text)
+	if err != nil {
+		log.Printf("Skipping related notes for %s: %v", actor, err)
+		return nil
+	}
+	matches, err := h.embedder.Nearest(actor, vector, maxRelatedNotes, embeddings.MinRelatedScore, "", embeddings.RelatedKinds...)
+	if err != nil {
+		log.Printf("Skipping related notes for %s: %v", actor, err)
+		return nil
+	}
+
+	var paths []string
+	for _, m := range matches {
+		if m.Path != "" {
+			paths = append(paths, m.Path)
+		}
+	}
+	return paths
+}
+
+// visibleMatches drops matches in categories the request's token may not read
+func visibleMatches(r *http.Request, matches []embeddings.Match) []embeddings.Match {
+	hidden := hiddenCategories(r)
+	visible := matches[:0]
+	for _, m := range matches {
+		if !containsFold(hidden, m.Category) {
+			visible = append(visible, m)
+		}
+	}
+	return visible
+}
+
+func containsFold(list []string, s string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, s) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchResults(matches []embeddings.Match) []models.SearchResult {
+	results := make([]models.SearchResult, 0, len(matches))
+	for _, m := range matches {
+		results = append(results, models.SearchResult{
+			DocID:     m.DocID,
+			Kind:      m.Kind,
+			Actor:     m.Actor,
+			Category:  m.Category,
+			Title:     m.Title,
+			Path:      m.Path,
+			CreatedTS: m.Created.Format(time.RFC3339),
+			Score:     m.Score,
+		})
+	}
+	return results
+}
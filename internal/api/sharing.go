@@ -0,0 +1,188 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/mrwolf/brain-server/internal/db"
+	"github.com/mrwolf/brain-server/internal/models"
+)
+
+// maxCommentLength caps a comment's text
+const maxCommentLength = 4000
+
+// requestedSharing returns the sharing a capture asks for, or nil to leave it to the
+// category's rule
+func (h *Handlers) requestedSharing(owner, visibility string, with []string) (*db.Sharing, error) {
+	if visibility == "" && len(with) == 0 {
+		return nil, nil
+	}
+	s, err := db.Sharing{Visibility: visibility, With: with}.Normalize(owner)
+	if err != nil {
+		return nil, err
+	}
+	for _, u := range s.With {
+		user, err := h.db.GetUser(u)
+		if err != nil {
+			return nil, err
+		}
+		if user == nil {
+			return nil, fmt.Errorf("unknown user %q", u)
+		}
+	}
+	return &s, nil
+}
+
+// shareByRule applies the sharing rule for the category a capture was filed to,
+// unless the capture already has its own (fail closed - the capture stays private)
+func (h *Handlers) shareByRule(captureID, owner, category string) {
+	rule := h.cfg.SharingRules.For(category)
+	if rule.Visibility == db.VisibilityPrivate {
+		return
+	}
+	existing, err := h.db.GetSharing(captureID)
+	if err == nil && existing == nil {
+		err = h.db.SetSharing(captureID, owner, rule)
+	}
+	if err != nil {
+		log.Printf("Failed to share %s by rule for %s: %v", captureID, category, err)
+	}
+}
+
+// visibleCapture returns the capture in the URL if the caller can see it, or writes
+// a 404 and returns nil. Other users' private captures look the same as missing ones.
+func (h *Handlers) visibleCapture(w http.ResponseWriter, r *http.Request) *db.CaptureRecord {
+	capture, err := h.db.GetCapture(chi.URLParam(r, "captureID"))
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "database error", "DB_ERROR")
+		return nil
+	}
+	visible := capture != nil && !containsFold(hiddenCategories(r), capture.RoutedTo)
+	if visible {
+		if visible, err = h.db.VisibleTo(GetActor(r), capture.Actor, capture.CaptureID); err != nil {
+			writeError(w, http.StatusInternalServerError, "database error", "DB_ERROR")
+			return nil
+		}
+	}
+	if !visible {
+		writeError(w, http.StatusNotFound, "capture not found", "NOT_FOUND")
+		return nil
+	}
+	return capture
+}
+
+// Sharing handles GET /captures/{captureID}/sharing
+func (h *Handlers) Sharing(w http.ResponseWriter, r *http.Request) {
+	capture := h.visibleCapture(w, r)
+	if capture == nil {
+		return
+	}
+	share, err := h.db.GetSharing(capture.CaptureID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "database error", "DB_ERROR")
+		return
+	}
+	if share == nil {
+		share = &db.Share{CaptureID: capture.CaptureID, Owner: capture.Actor, Sharing: db.Sharing{Visibility: db.VisibilityPrivate}}
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(share)
+}
+
+// SetSharing handles PUT /captures/{captureID}/sharing (owner only)
+func (h *Handlers) SetSharing(w http.ResponseWriter, r *http.Request) {
+	capture := h.visibleCapture(w, r)
+	if capture == nil {
+		return
+	}
+	if capture.Actor != GetActor(r) {
+		writeError(w, http.StatusForbidden, "only the owner can change sharing", "NOT_OWNER")
+		return
+	}
+
+	var req models.SharingRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body", "INVALID_BODY")
+		return
+	}
+	if req.Visibility == "" && len(req.ShareWith) == 0 {
+		writeError(w, http.StatusBadRequest, "visibility is required", "INVALID_SHARING")
+		return
+	}
+	sharing, err := h.requestedSharing(capture.Actor, req.Visibility, req.ShareWith)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error(), "INVALID_SHARING")
+		return
+	}
+	if err := h.db.SetSharing(capture.CaptureID, capture.Actor, *sharing); err != nil {
+		if errors.Is(err, db.ErrUserNotFound) {
+			writeError(w, http.StatusBadRequest, err.Error(), "INVALID_SHARING")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "database error", "DB_ERROR")
+		return
+	}
+
+	h.Sharing(w, r)
+}
+
+// Comments handles GET /captures/{captureID}/comments
+func (h *Handlers) Comments(w http.ResponseWriter, r *http.Request) {
+	capture := h.visibleCapture(w, r)
+	if capture == nil {
+		return
+	}
+	comments, err := h.db.GetComments(capture.CaptureID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "database error", "DB_ERROR")
+		return
+	}
+	if comments == nil {
+		comments = []db.Comment{}
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"capture_id": capture.CaptureID,
+		"comments":   comments,
+	})
+}
+
+// AddComment handles POST /captures/{captureID}/comments, by the owner or anyone
+// the capture is shared with
+func (h *Handlers) AddComment(w http.ResponseWriter, r *http.Request) {
+	capture := h.visibleCapture(w, r)
+	if capture == nil {
+		return
+	}
+
+	var req models.CommentRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body", "INVALID_BODY")
+		return
+	}
+	text := strings.TrimSpace(req.Text)
+	if text == "" {
+		writeError(w, http.StatusBadRequest, "text is required", "MISSING_TEXT")
+		return
+	}
+	if len(text) > maxCommentLength {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("text must be at most %d characters", maxCommentLength), "TEXT_TOO_LONG")
+		return
+	}
+
+	comment, err := h.db.AddComment(capture.CaptureID, GetActor(r), text)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "database error", "DB_ERROR")
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(comment)
+}
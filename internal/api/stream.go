@@ -0,0 +1,141 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/mrwolf/brain-server/internal/db"
+	"github.com/mrwolf/brain-server/internal/llm"
+	"github.com/mrwolf/brain-server/internal/models"
+)
+
+// streamTimeout bounds an on-demand streamed generation
+const streamTimeout = 5 * time.Minute
+
+// sseWriter writes server-sent events, flushing each one to the client
+type sseWriter struct {
+	w       http.ResponseWriter
+	flusher http.Flusher
+}
+
+// startSSE switches the response to an event stream; false if the writer cannot flush
+func startSSE(w http.ResponseWriter) (*sseWriter, bool) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		return nil, false
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no") // disable proxy buffering (nginx)
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+	return &sseWriter{w: w, flusher: flusher}, true
+}
+
+// send writes one event with a JSON payload
+func (s *sseWriter) send(event string, data interface{}) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(s.w, "event: %s\ndata: %s\n\n", event, payload); err != nil {
+		return err
+	}
+	s.flusher.Flush()
+	return nil
+}
+
+// chunk sends a piece of generated text
+func (s *sseWriter) chunk(text string) error {
+	return s.send("chunk", models.StreamChunk{Text: text})
+}
+
+// fail sends a terminal error event
+func (s *sseWriter) fail(message, code string) {
+	s.send("error", ErrorResponse{Error: message, Code: code})
+}
+
+// StreamDailyLetter handles GET /stream/letters/daily - generates today's daily letter
+// on demand and streams it as server-sent events. Disconnecting cancels generation.
+func (h *Handlers) StreamDailyLetter(w http.ResponseWriter, r *http.Request) {
+	if h.letterGen == nil {
+		writeError(w, http.StatusServiceUnavailable, "letter generator not configured", "NOT_CONFIGURED")
+		return
+	}
+	actor := GetActor(r)
+
+	sse, ok := startSSE(w)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "streaming not supported", "STREAM_UNSUPPORTED")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(llm.WithPriority(r.Context(), llm.PriorityInteractive), streamTimeout)
+	defer cancel()
+
+	letter, err := h.letterGen.StreamDailyLetter(ctx, actor, sse.chunk)
+	if err != nil {
+		if r.Context().Err() != nil {
+			log.Printf("Daily letter stream for %s cancelled by client", actor)
+			return
+		}
+		log.Printf("Daily letter stream for %s failed: %v", actor, err)
+		sse.fail("generation failed", "GENERATION_FAILED")
+		return
+	}
+
+	sse.send("done", models.StreamDone{Text: letter})
+}
+
+// StreamIdeaExpansion handles GET /stream/ideas/{captureID} - expands a filed idea and
+// streams the research as server-sent events, then writes it to the vault.
+// Disconnecting cancels generation and nothing is written.
+func (h *Handlers) StreamIdeaExpansion(w http.ResponseWriter, r *http.Request) {
+	captureID := chi.URLParam(r, "captureID")
+	actor := GetActor(r)
+
+	doc, err := h.db.GetSearchDoc(captureID, db.DocNote)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "database error", "DB_ERROR")
+		return
+	}
+	if doc == nil || doc.Actor != actor || doc.Category != models.CategoryIdeas {
+		writeError(w, http.StatusNotFound, "idea not found", "NOT_FOUND")
+		return
+	}
+
+	sse, ok := startSSE(w)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "streaming not supported", "STREAM_UNSUPPORTED")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(llm.WithPriority(r.Context(), llm.PriorityInteractive), streamTimeout)
+	defer cancel()
+	ctx = llm.WithActor(ctx, actor)
+
+	research, err := h.ideaExpander.StreamExpandIdea(ctx, doc.Body, doc.Title, models.CategoryIdeas, sse.chunk)
+	if err != nil {
+		if r.Context().Err() != nil {
+			log.Printf("Idea expansion stream for %s cancelled by client", captureID)
+			return
+		}
+		log.Printf("Idea expansion stream for %s failed: %v", captureID, err)
+		sse.fail("generation failed", "GENERATION_FAILED")
+		return
+	}
+
+	path, err := h.ideaExpander.WriteResearchFile(captureID, actor, doc.Title, research)
+	if err != nil {
+		log.Printf("Failed to write research for %s: %v", captureID, err)
+		sse.fail("failed to write research", "WRITE_ERROR")
+		return
+	}
+
+	sse.send("done", models.StreamDone{Text: research.Text, Path: path})
+}
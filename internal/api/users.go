@@ -0,0 +1,376 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/mrwolf/brain-server/internal/account"
+	"github.com/mrwolf/brain-server/internal/db"
+	"github.com/mrwolf/brain-server/internal/models"
+)
+
+// Users handles GET /admin/users
+func (h *Handlers) Users(w http.ResponseWriter, r *http.Request) {
+	users, err := h.db.GetUsers()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "database error", "DB_ERROR")
+		return
+	}
+	if users == nil {
+		users = []db.User{}
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"users": users,
+	})
+}
+
+// CreateUser handles POST /admin/users
+func (h *Handlers) CreateUser(w http.ResponseWriter, r *http.Request) {
+	var req models.CreateUserRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body", "INVALID_BODY")
+		return
+	}
+
+	req.ID = strings.TrimSpace(req.ID)
+	if !db.ValidUserID(req.ID) {
+		writeError(w, http.StatusBadRequest, "id must be lowercase letters, digits, - and _ (max 32)", "INVALID_USER_ID")
+		return
+	}
+
+	user, err := h.db.CreateUser(req.ID, strings.TrimSpace(req.Name))
+	if errors.Is(err, db.ErrUserExists) {
+		writeError(w, http.StatusConflict, "user already exists", "USER_EXISTS")
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to create user %s: %v", req.ID, err)
+		writeError(w, http.StatusInternalServerError, "database error", "DB_ERROR")
+		return
+	}
+
+	log.Printf("User %s created by %s", user.ID, GetActor(r))
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(user)
+}
+
+// DisableUser handles DELETE /admin/users/{userID}
+// The user's captures stay in the vault; their tokens stop working and scheduled jobs skip them.
+func (h *Handlers) DisableUser(w http.ResponseWriter, r *http.Request) {
+	userID := chi.URLParam(r, "userID")
+	if userID == GetActor(r) {
+		writeError(w, http.StatusBadRequest, "cannot disable yourself", "SELF_DISABLE")
+		return
+	}
+
+	disabled, err := h.db.DisableUser(userID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "database error", "DB_ERROR")
+		return
+	}
+	if !disabled {
+		writeError(w, http.StatusNotFound, "user not found", "NOT_FOUND")
+		return
+	}
+
+	log.Printf("User %s disabled by %s", userID, GetActor(r))
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{
+		"status":  "ok",
+		"user_id": userID,
+	})
+}
+
+// ExportUser handles GET /admin/users/{userID}/export
+// Responds with a zip of everything stored for the user (see account.Export).
+func (h *Handlers) ExportUser(w http.ResponseWriter, r *http.Request) {
+	user := h.adminUser(w, r)
+	if user == nil {
+		return
+	}
+
+	var buf bytes.Buffer
+	manifest, err := account.Export(&buf, h.db, h.vault, user.ID)
+	if err != nil {
+		log.Printf("Failed to export user %s: %v", user.ID, err)
+		writeError(w, http.StatusInternalServerError, "export failed", "EXPORT_FAILED")
+		return
+	}
+
+	log.Printf("User %s exported by %s (%d vault files)", user.ID, GetActor(r), len(manifest.Files))
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="brain-%s-%s.zip"`, user.ID, manifest.ExportedAt.Format("2006-01-02")))
+	w.WriteHeader(http.StatusOK)
+	w.Write(buf.Bytes())
+}
+
+// DeleteUserData handles DELETE /admin/users/{userID}/data
+// Purges a disabled user and all their data (see account.Delete). A user with a
+// bootstrap token in the environment is registered again at the next start.
+func (h *Handlers) DeleteUserData(w http.ResponseWriter, r *http.Request) {
+	user := h.adminUser(w, r)
+	if user == nil {
+		return
+	}
+	if user.DisabledAt == nil {
+		writeError(w, http.StatusConflict, "disable the user before deleting their data", "USER_ACTIVE")
+		return
+	}
+
+	report, err := account.Delete(h.db, h.vault, user.ID)
+	if err != nil {
+		log.Printf("Failed to delete user %s: %v", user.ID, err)
+		writeError(w, http.StatusInternalServerError, "delete failed", "DELETE_FAILED")
+		return
+	}
+
+	log.Printf("User %s and their data deleted by %s (%d vault files)", user.ID, GetActor(r), len(report.Files))
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(report)
+}
+
+// adminUser returns the user in the URL, or writes a 404 and returns nil
+func (h *Handlers) adminUser(w http.ResponseWriter, r *http.Request) *db.User {
+	user, err := h.db.GetUser(chi.URLParam(r, "userID"))
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "database error", "DB_ERROR")
+		return nil
+	}
+	if user == nil {
+		writeError(w, http.StatusNotFound, "user not found", "NOT_FOUND")
+		return nil
+	}
+	return user
+}
+
+// UserTokens handles GET /admin/users/{userID}/tokens
+func (h *Handlers) UserTokens(w http.ResponseWriter, r *http.Request) {
+	userID := chi.URLParam(r, "userID")
+	user, err := h.db.GetUser(userID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "database error", "DB_ERROR")
+		return
+	}
+	if user == nil {
+		writeError(w, http.StatusNotFound, "user not found", "NOT_FOUND")
+		return
+	}
+
+	tokens, err := h.db.GetAPITokens(userID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "database error", "DB_ERROR")
+		return
+	}
+	if tokens == nil {
+		tokens = []db.APIToken{}
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"user_id": userID,
+		"tokens":  tokens,
+	})
+}
+
+// CreateUserToken handles POST /admin/users/{userID}/tokens
+// The token is only ever shown in this response.
+func (h *Handlers) CreateUserToken(w http.ResponseWriter, r *http.Request) {
+	userID := chi.URLParam(r, "userID")
+
+	var req models.CreateTokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body", "INVALID_BODY")
+		return
+	}
+
+	if len(req.Scopes) == 0 {
+		writeError(w, http.StatusBadRequest, "scopes are required", "MISSING_SCOPES")
+		return
+	}
+	for _, scope := range req.Scopes {
+		if !db.ValidScope(scope) {
+			writeError(w, http.StatusBadRequest, "unknown scope: "+scope, "INVALID_SCOPE")
+			return
+		}
+	}
+
+	token, stored, err := h.db.CreateAPIToken(userID, strings.TrimSpace(req.Label), strings.TrimSpace(req.DeviceID), req.Scopes)
+	if errors.Is(err, db.ErrUserNotFound) {
+		writeError(w, http.StatusNotFound, "user not found", "NOT_FOUND")
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to create token for %s: %v", userID, err)
+		writeError(w, http.StatusInternalServerError, "database error", "DB_ERROR")
+		return
+	}
+
+	log.Printf("Token %d (%s) issued to %s by %s with scopes %v", stored.ID, stored.Label, userID, GetActor(r), stored.Scopes)
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(struct {
+		*db.APIToken
+		Token string `json:"token"`
+	}{stored, token})
+}
+
+// RevokeUserToken handles DELETE /admin/users/{userID}/tokens/{tokenID}
+func (h *Handlers) RevokeUserToken(w http.ResponseWriter, r *http.Request) {
+	userID := chi.URLParam(r, "userID")
+	tokenID, err := strconv.ParseInt(chi.URLParam(r, "tokenID"), 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid token id", "INVALID_TOKEN_ID")
+		return
+	}
+
+	revoked, err := h.db.RevokeAPIToken(userID, tokenID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "database error", "DB_ERROR")
+		return
+	}
+	if !revoked {
+		writeError(w, http.StatusNotFound, "token not found", "NOT_FOUND")
+		return
+	}
+
+	log.Printf("Token %d of %s revoked by %s", tokenID, userID, GetActor(r))
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":   "ok",
+		"user_id":  userID,
+		"token_id": tokenID,
+	})
+}
+
+// RevokeDevice handles DELETE /admin/users/{userID}/devices/{deviceID}
+// Revokes every token bound to the device, e.g. when a phone is lost.
+func (h *Handlers) RevokeDevice(w http.ResponseWriter, r *http.Request) {
+	userID := chi.URLParam(r, "userID")
+	deviceID := chi.URLParam(r, "deviceID")
+
+	revoked, err := h.db.RevokeDeviceTokens(userID, deviceID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "database error", "DB_ERROR")
+		return
+	}
+	if revoked == 0 {
+		writeError(w, http.StatusNotFound, "no active tokens for device", "NOT_FOUND")
+		return
+	}
+
+	log.Printf("%d token(s) for device %s of %s revoked by %s", revoked, deviceID, userID, GetActor(r))
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":    "ok",
+		"user_id":   userID,
+		"device_id": deviceID,
+		"revoked":   revoked,
+	})
+}
+
+// UserIdentities handles GET /admin/users/{userID}/identities
+func (h *Handlers) UserIdentities(w http.ResponseWriter, r *http.Request) {
+	userID := chi.URLParam(r, "userID")
+	identities, err := h.db.GetIdentities(userID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "database error", "DB_ERROR")
+		return
+	}
+	if identities == nil {
+		identities = []db.Identity{}
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"user_id":    userID,
+		"identities": identities,
+	})
+}
+
+// LinkIdentity handles POST /admin/users/{userID}/identities
+// Links an account at the configured OpenID Connect provider so it can log in as the user.
+func (h *Handlers) LinkIdentity(w http.ResponseWriter, r *http.Request) {
+	if h.oidc == nil {
+		writeError(w, http.StatusServiceUnavailable, "OpenID Connect is not configured", "NOT_CONFIGURED")
+		return
+	}
+	userID := chi.URLParam(r, "userID")
+
+	var req models.LinkIdentityRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body", "INVALID_BODY")
+		return
+	}
+	req.Subject = strings.TrimSpace(req.Subject)
+	req.Email = strings.TrimSpace(req.Email)
+	if req.Subject == "" && req.Email == "" {
+		writeError(w, http.StatusBadRequest, "subject or email is required", "MISSING_IDENTITY")
+		return
+	}
+	if len(req.Scopes) == 0 {
+		writeError(w, http.StatusBadRequest, "scopes are required", "MISSING_SCOPES")
+		return
+	}
+	for _, scope := range req.Scopes {
+		if !db.ValidScope(scope) {
+			writeError(w, http.StatusBadRequest, "unknown scope: "+scope, "INVALID_SCOPE")
+			return
+		}
+	}
+
+	identity, err := h.db.LinkIdentity(userID, h.oidc.Issuer(), req.Subject, req.Email, req.Scopes)
+	if errors.Is(err, db.ErrUserNotFound) {
+		writeError(w, http.StatusNotFound, "user not found", "NOT_FOUND")
+		return
+	}
+	if errors.Is(err, db.ErrIdentityExists) {
+		writeError(w, http.StatusConflict, "identity already linked", "IDENTITY_EXISTS")
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to link identity for %s: %v", userID, err)
+		writeError(w, http.StatusInternalServerError, "database error", "DB_ERROR")
+		return
+	}
+
+	log.Printf("Identity %d linked to %s by %s with scopes %v", identity.ID, userID, GetActor(r), identity.Scopes)
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(identity)
+}
+
+// UnlinkIdentity handles DELETE /admin/users/{userID}/identities/{identityID}
+// Its login sessions end immediately.
+func (h *Handlers) UnlinkIdentity(w http.ResponseWriter, r *http.Request) {
+	userID := chi.URLParam(r, "userID")
+	identityID, err := strconv.ParseInt(chi.URLParam(r, "identityID"), 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid identity id", "INVALID_IDENTITY_ID")
+		return
+	}
+
+	unlinked, err := h.db.UnlinkIdentity(userID, identityID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "database error", "DB_ERROR")
+		return
+	}
+	if !unlinked {
+		writeError(w, http.StatusNotFound, "identity not found", "NOT_FOUND")
+		return
+	}
+
+	log.Printf("Identity %d of %s unlinked by %s", identityID, userID, GetActor(r))
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":      "ok",
+		"user_id":     userID,
+		"identity_id": identityID,
+	})
+}
@@ -0,0 +1,359 @@
+package ask
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/mrwolf/brain-server/internal/db"
+	"github.com/mrwolf/brain-server/internal/embeddings"
+	"github.com/mrwolf/brain-server/internal/llm"
+	"github.com/mrwolf/brain-server/internal/narrator"
+	"github.com/mrwolf/brain-server/internal/prompts"
+)
+
+const claimsPrompt = `You answer questions about a person's own notes. Extract the facts from the sources below that help answer the question.
+
+QUESTION: %s
+
+SOURCES:
+%s
+
+RULES:
+1. Extract only facts explicitly stated in a source
+2. Each claim must quote the source text exactly and give the source ID (e.g. cap_abc123)
+3. Skip sources that are not relevant to the question
+4. If nothing answers the question, return an empty list
+
+OUTPUT FORMAT (JSON):
+{
+  "claims": [
+    {"fact": "The fact", "quote": "Exact quote from the source", "source": "cap_abc123"}
+  ]
+}`
+
+const answerPrompt = `Answer the question using ONLY the claims below. Write in second person ("you"), 1-3 short sentences.
+After each statement cite its source ID in square brackets, e.g. [cap_abc123].
+Do not add anything that is not in the claims. If the claims only partly answer the question, say so.
+
+QUESTION: %s
+
+CLAIMS:
+%s
+%s
+OUTPUT FORMAT (JSON):
+{"answer": "..."}`
+
+const answerSchema = `{
+  "type": "object",
+  "properties": {"answer": {"type": "string"}},
+  "required": ["answer"]
+}`
+
+// answerResult is the generated answer
+type answerResult struct {
+	Answer string `json:"answer"`
+}
+
+// Validate implements llm.Validator
+func (r *answerResult) Validate() error {
+	if strings.TrimSpace(r.Answer) == "" {
+		return fmt.Errorf("empty answer")
+	}
+	return nil
+}
+
+const (
+	// maxSources is how many retrieved documents go into the prompt
+	maxSources = 8
+	// maxSourceChars caps each document's text in the prompt
+	maxSourceChars = 1500
+	// maxAttempts bounds answer generation; later attempts get the verifier's feedback
+	maxAttempts = 2
+)
+
+// NoAnswer is returned when nothing in the vault supports an answer
+const NoAnswer = "I couldn't find anything in your notes about that."
+
+var citationPattern = regexp.MustCompile(`\[([A-Za-z0-9_\-]+)\]`)
+
+// stopWords are dropped from questions before keyword retrieval
+var stopWords = map[string]bool{
+	"a": true, "an": true, "and": true, "are": true, "about": true, "at": true, "did": true, "do": true,
+	"does": true, "for": true, "have": true, "had": true, "how": true, "i": true, "in": true, "is": true,
+	"it": true, "me": true, "my": true, "of": true, "on": true, "or": true, "start": true, "the": true,
+	"to": true, "was": true, "what": true, "when": true, "where": true, "which": true, "who": true,
+	"why": true, "with": true,
+}
+
+// Source is a retrieved document that can be cited
+type Source struct {
+	ID       string
+	Kind     string
+	Category string
+	Title    string
+	Path     string
+	Created  time.Time
+	Text     string
+}
+
+// Citation links a statement in the answer to its source
+type Citation struct {
+	Source
+	Quotes []string
+}
+
+// Answer is a grounded answer to a question
+type Answer struct {
+	Question  string
+	Text      string
+	Citations []Citation
+	Verified  bool // false when the verifier rejected the generated answer and the claims were returned instead
+}
+
+// Answerer answers questions from an actor's captures, notes and journal
+type Answerer struct {
+	llm      *llm.Client
+	db       *db.DB
+	embedder *embeddings.Embedder // optional, adds semantic matches to keyword retrieval
+	verifier *narrator.Pipeline
+}
+
+// NewAnswerer creates a new answerer; embedder may be nil
+func NewAnswerer(client *llm.Client, database *db.DB, embedder *embeddings.Embedder) *Answerer {
+	return &Answerer{
+		llm:      client,
+		db:       database,
+		embedder: embedder,
+		verifier: narrator.NewPipeline(narrator.NewBrainServerAdapter(client), 0),
+	}
+}
+
+// SetPrompts sets where the answer verifier's prompt templates are loaded from
+func (a *Answerer) SetPrompts(store *prompts.Store) {
+	a.verifier.SetPrompts(store)
+}
+
+// Ask answers a question for an actor, citing the documents it is drawn from.
+// Documents in the excluded categories are never used.
+func (a *Answerer) Ask(ctx context.Context, actor, question string, exclude ...string) (*Answer, error) {
+	ctx = llm.WithActor(ctx, actor)
+	answer := &Answer{Question: question}
+
+	sources, err := a.Retrieve(ctx, actor, question, exclude...)
+	if err != nil {
+		return nil, fmt.Errorf("retrieving sources: %w", err)
+	}
+	if len(sources) == 0 {
+		answer.Text = NoAnswer
+		answer.Verified = true
+		return answer, nil
+	}
+
+	claims, err := a.extractClaims(ctx, question, sources)
+	if err != nil {
+		return nil, fmt.Errorf("extracting claims: %w", err)
+	}
+	if len(claims.Claims) == 0 {
+		answer.Text = NoAnswer
+		answer.Verified = true
+		return answer, nil
+	}
+
+	feedback := ""
+	for attempt := 1; attempt <= maxAttempts; attempt++ {
+		text, err := a.generateAnswer(ctx, question, claims, feedback)
+		if err != nil {
+			return nil, fmt.Errorf("generating answer: %w", err)
+		}
+
+		result, err := a.verifier.Verify(ctx, claims, text)
+		if err != nil {
+			return nil, fmt.Errorf("verifying answer: %w", err)
+		}
+		if result.Passed {
+			answer.Text = text
+			answer.Verified = true
+			break
+		}
+
+		log.Printf("ask: answer rejected (attempt %d): %s", attempt, result.Feedback)
+		feedback = result.Feedback
+		if len(result.UnsupportedClaims) > 0 {
+			feedback += "\nUnsupported statements: " + strings.Join(result.UnsupportedClaims, "; ")
+		}
+	}
+
+	// Never return an unverified answer - fall back to the claims themselves
+	if !answer.Verified {
+		answer.Text = claimsAnswer(claims)
+	}
+
+	answer.Citations = citations(answer.Text, claims, sources)
+	return answer, nil
+}
+
+// Retrieve finds an actor's documents relevant to a question: keyword matches first,
+// then semantic matches when embeddings are available
+func (a *Answerer) Retrieve(ctx context.Context, actor, question string, exclude ...string) ([]Source, error) {
+	var sources []Source
+	seen := make(map[string]bool)
+
+	add := func(docID, kind string) error {
+		if seen[docID] || len(sources) >= maxSources {
+			return nil
+		}
+		doc, err := a.db.GetSearchDoc(docID, kind)
+		if err != nil || doc == nil {
+			return err
+		}
+		for _, category := range exclude {
+			if strings.EqualFold(doc.Category, category) {
+				return nil
+			}
+		}
+		seen[docID] = true
+		text := doc.Body
+		if len(text) > maxSourceChars {
+			text = text[:maxSourceChars] + "…"
+		}
+		sources = append(sources, Source{
+			ID:       doc.DocID,
+			Kind:     doc.Kind,
+			Category: doc.Category,
+			Title:    doc.Title,
+			Path:     doc.Path,
+			Created:  doc.Created,
+			Text:     text,
+		})
+		return nil
+	}
+
+	if keywords := Keywords(question); keywords != "" {
+		hits, err := a.db.Search(db.SearchQuery{Text: keywords, Actor: actor, AnyTerm: true, Limit: maxSources, Exclude: exclude})
+		if err != nil {
+			return nil, err
+		}
+		for _, h := range hits {
+			if err := add(h.DocID, h.Kind); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if a.embedder != nil && len(sources) < maxSources {
+		matches, err := a.embedder.Search(ctx, actor, question, maxSources)
+		if err != nil {
+			// Keyword results are still useful without the embedding model
+			log.Printf("ask: semantic retrieval unavailable: %v", err)
+		}
+		for _, m := range matches {
+			if err := add(m.DocID, m.Kind); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return sources, nil
+}
+
+// Keywords strips question words so keyword retrieval matches on content
+func Keywords(question string) string {
+	var words []string
+	for _, w := range strings.Fields(strings.ToLower(question)) {
+		w = strings.Trim(w, `?!.,;:"'()`)
+		if len(w) < 2 || stopWords[w] {
+			continue
+		}
+		words = append(words, w)
+	}
+	return strings.Join(words, " ")
+}
+
+func (a *Answerer) extractClaims(ctx context.Context, question string, sources []Source) (narrator.ClaimSet, error) {
+	var sb strings.Builder
+	for _, s := range sources {
+		sb.WriteString(fmt.Sprintf("[%s] (%s, %s)\n%s\n\n", s.ID, s.Kind, s.Created.Format("2006-01-02"), s.Text))
+	}
+
+	var claims narrator.ClaimSet
+	prompt := fmt.Sprintf(claimsPrompt, question, sb.String())
+	if err := a.llm.GenerateJSON(ctx, llm.TaskAsk, "", prompt, json.RawMessage(narrator.ClaimsSchema), &claims); err != nil {
+		return narrator.ClaimSet{}, err
+	}
+
+	// Keep only claims that quote a retrieved source - anything else is invented
+	byID := make(map[string]Source, len(sources))
+	for _, s := range sources {
+		byID[s.ID] = s
+	}
+	var grounded []narrator.Claim
+	for _, c := range claims.Claims {
+		c.Source = strings.Trim(c.Source, "[] ")
+		src, ok := byID[c.Source]
+		if !ok || c.Fact == "" {
+			continue
+		}
+		if c.Quote != "" && !strings.Contains(strings.ToLower(src.Text), strings.ToLower(c.Quote)) {
+			continue
+		}
+		grounded = append(grounded, c)
+	}
+	claims.Claims = grounded
+	return claims, nil
+}
+
+func (a *Answerer) generateAnswer(ctx context.Context, question string, claims narrator.ClaimSet, feedback string) (string, error) {
+	var lines []string
+	for i, c := range claims.Claims {
+		lines = append(lines, fmt.Sprintf("%d. %s [%s]", i+1, c.Fact, c.Source))
+	}
+	retry := ""
+	if feedback != "" {
+		retry = "\nPREVIOUS ANSWER FAILED VERIFICATION. Issues found:\n" + feedback + "\n"
+	}
+
+	var parsed answerResult
+	prompt := fmt.Sprintf(answerPrompt, question, strings.Join(lines, "\n"), retry)
+	if err := a.llm.GenerateJSON(ctx, llm.TaskAsk, "", prompt, json.RawMessage(answerSchema), &parsed); err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(parsed.Answer), nil
+}
+
+// claimsAnswer lists the grounded claims when no generated answer passed verification
+func claimsAnswer(claims narrator.ClaimSet) string {
+	var sb strings.Builder
+	sb.WriteString("Here is what your notes say:")
+	for _, c := range claims.Claims {
+		sb.WriteString(fmt.Sprintf("\n- %s [%s]", c.Fact, c.Source))
+	}
+	return sb.String()
+}
+
+// citations returns the sources cited in the answer, with their supporting quotes
+func citations(text string, claims narrator.ClaimSet, sources []Source) []Citation {
+	cited := make(map[string]bool)
+	for _, m := range citationPattern.FindAllStringSubmatch(text, -1) {
+		cited[m[1]] = true
+	}
+
+	var result []Citation
+	for _, s := range sources {
+		if !cited[s.ID] {
+			continue
+		}
+		c := Citation{Source: s}
+		for _, claim := range claims.Claims {
+			if claim.Source == s.ID && claim.Quote != "" {
+				c.Quotes = append(c.Quotes, claim.Quote)
+			}
+		}
+		result = append(result, c)
+	}
+	return result
+}
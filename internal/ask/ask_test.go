@@ -0,0 +1,170 @@
+package ask
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mrwolf/brain-server/internal/db"
+	"github.com/mrwolf/brain-server/internal/llm"
+)
+
+func setupTestDB(t *testing.T) (*db.DB, func()) {
+	t.Helper()
+
+	tmpFile, err := os.CreateTemp("", "brain-ask-test-*.db")
+	if err != nil {
+		t.Fatalf("creating temp file: %v", err)
+	}
+	tmpFile.Close()
+
+	database, err := db.Open(tmpFile.Name())
+	if err != nil {
+		os.Remove(tmpFile.Name())
+		t.Fatalf("opening database: %v", err)
+	}
+
+	cleanup := func() {
+		database.Close()
+		os.Remove(tmpFile.Name())
+	}
+
+	return database, cleanup
+}
+
+// stubOllama answers each pipeline step by recognising its prompt
+func stubOllama(t *testing.T, claims, answer string, verified bool) *httptest.Server {
+	t.Helper()
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req llm.GenerateRequest
+		json.NewDecoder(r.Body).Decode(&req)
+
+		var response string
+		switch {
+		case strings.Contains(req.Prompt, "Extract the facts"):
+			response = claims
+		case strings.Contains(req.Prompt, "Answer the question"):
+			response = answer
+		case strings.Contains(req.Prompt, "fact-checker"):
+			if verified {
+				response = `{"passed": true}`
+			} else {
+				response = `{"passed": false, "unsupported_claims": ["It was a skiing injury"], "feedback": "invented cause"}`
+			}
+		default:
+			t.Errorf("unexpected prompt: %.80s", req.Prompt)
+		}
+		json.NewEncoder(w).Encode(llm.GenerateResponse{Response: response, Done: true})
+	}))
+}
+
+func seed(t *testing.T, database *db.DB) {
+	t.Helper()
+	docs := []db.SearchDoc{
+		{DocID: "cap_knee", Kind: db.DocNote, Actor: "wolf", Category: "Health", Title: "Knee pain", Body: "My left knee started hurting after the long run on Saturday", Created: time.Date(2024, 3, 2, 10, 0, 0, 0, time.UTC)},
+		{DocID: "cap_beds", Kind: db.DocNote, Actor: "wolf", Category: "Ideas", Title: "Raised beds", Body: "Build cedar raised beds for the garden", Created: time.Now()},
+		{DocID: "cap_wife", Kind: db.DocNote, Actor: "wife", Category: "Health", Title: "Knee brace", Body: "Ordered a knee brace", Created: time.Now()},
+	}
+	for _, d := range docs {
+		if err := database.IndexSearchDoc(d); err != nil {
+			t.Fatalf("indexing %s: %v", d.DocID, err)
+		}
+	}
+}
+
+const kneeClaims = `{"claims": [
+	{"fact": "Left knee started hurting after a long run on Saturday", "quote": "left knee started hurting after the long run", "source": "cap_knee"},
+	{"fact": "Knee surgery was booked", "quote": "booked knee surgery", "source": "cap_knee"},
+	{"fact": "Bought a knee brace", "quote": "Ordered a knee brace", "source": "cap_wife"}
+]}`
+
+func TestAskGroundedAnswer(t *testing.T) {
+	database, cleanup := setupTestDB(t)
+	defer cleanup()
+	seed(t, database)
+
+	server := stubOllama(t, kneeClaims, `{"answer": "Your left knee started hurting after a long run on Saturday [cap_knee]."}`, true)
+	defer server.Close()
+
+	answerer := NewAnswerer(llm.NewClient(server.URL, "test", "test"), database, nil)
+	answer, err := answerer.Ask(context.Background(), "wolf", "When did my knee start hurting?")
+	if err != nil {
+		t.Fatalf("ask: %v", err)
+	}
+
+	if !answer.Verified {
+		t.Error("expected verified answer")
+	}
+	if len(answer.Citations) != 1 || answer.Citations[0].ID != "cap_knee" {
+		t.Fatalf("expected one citation to cap_knee, got %+v", answer.Citations)
+	}
+	// The misquoted claim and the other actor's claim must not survive
+	if len(answer.Citations[0].Quotes) != 1 {
+		t.Errorf("expected only the grounded quote, got %v", answer.Citations[0].Quotes)
+	}
+}
+
+func TestAskRejectsUnverifiedAnswer(t *testing.T) {
+	database, cleanup := setupTestDB(t)
+	defer cleanup()
+	seed(t, database)
+
+	server := stubOllama(t, kneeClaims, `{"answer": "You hurt your knee skiing [cap_knee]."}`, false)
+	defer server.Close()
+
+	answerer := NewAnswerer(llm.NewClient(server.URL, "test", "test"), database, nil)
+	answer, err := answerer.Ask(context.Background(), "wolf", "When did my knee start hurting?")
+	if err != nil {
+		t.Fatalf("ask: %v", err)
+	}
+
+	if answer.Verified {
+		t.Error("expected unverified answer")
+	}
+	if strings.Contains(answer.Text, "skiing") {
+		t.Errorf("unsupported statement leaked into answer: %q", answer.Text)
+	}
+	if !strings.Contains(answer.Text, "long run on Saturday [cap_knee]") {
+		t.Errorf("expected fallback to grounded claims, got %q", answer.Text)
+	}
+}
+
+func TestAskNothingFound(t *testing.T) {
+	database, cleanup := setupTestDB(t)
+	defer cleanup()
+	seed(t, database)
+
+	server := stubOllama(t, `{"claims": []}`, "", true)
+	defer server.Close()
+
+	answerer := NewAnswerer(llm.NewClient(server.URL, "test", "test"), database, nil)
+	answer, err := answerer.Ask(context.Background(), "wolf", "What did I say about the boat?")
+	if err != nil {
+		t.Fatalf("ask: %v", err)
+	}
+	if answer.Text != NoAnswer || len(answer.Citations) != 0 {
+		t.Errorf("expected no answer, got %+v", answer)
+	}
+}
+
+func TestKeywords(t *testing.T) {
+	tests := []struct {
+		question string
+		want     string
+	}{
+		{"When did my knee start hurting?", "knee hurting"},
+		{"What ideas did I have about the garden?", "ideas garden"},
+		{"?", ""},
+	}
+
+	for _, tt := range tests {
+		if got := Keywords(tt.question); got != tt.want {
+			t.Errorf("Keywords(%q) = %q, want %q", tt.question, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,200 @@
+// Package certs serves the server's TLS certificate and trusted client CAs from
+// files, reloading them when the files change, and maps verified client
+// certificates to users for mutual TLS.
+//
+// A failed reload (say a certificate written before its key) keeps serving the
+// previous certificate and is retried on the next check.
+package certs
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Client certificate modes
+const (
+	ClientAuthOff      = "off"      // no client certificates
+	ClientAuthOptional = "optional" // verified if presented; requests without one use tokens
+	ClientAuthRequire  = "require"  // every connection needs a certificate from a trusted CA
+)
+
+// ParseClientAuth reads a client certificate mode
+func ParseClientAuth(s string) (tls.ClientAuthType, error) {
+	switch s {
+	case ClientAuthOff:
+		return tls.NoClientCert, nil
+	case ClientAuthOptional:
+		return tls.VerifyClientCertIfGiven, nil
+	case ClientAuthRequire:
+		return tls.RequireAndVerifyClientCert, nil
+	}
+	return tls.NoClientCert, fmt.Errorf("client auth must be %s, %s or %s", ClientAuthOff, ClientAuthOptional, ClientAuthRequire)
+}
+
+// Reloader holds a certificate and client CA pool loaded from files
+type Reloader struct {
+	certFile, keyFile, caFile string
+
+	mu        sync.RWMutex
+	cert      *tls.Certificate
+	clientCAs *x509.CertPool
+	stamp     string // modification times of the files last loaded
+}
+
+// NewReloader loads the certificate and key, and the client CAs if caFile is set
+func NewReloader(certFile, keyFile, caFile string) (*Reloader, error) {
+	r := &Reloader{certFile: certFile, keyFile: keyFile, caFile: caFile}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Reload reads the files again; on error the previous certificate stays in use
+func (r *Reloader) Reload() error {
+	stamp := r.fileStamp()
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("loading certificate: %w", err)
+	}
+	var pool *x509.CertPool
+	if r.caFile != "" {
+		pem, err := os.ReadFile(r.caFile)
+		if err != nil {
+			return fmt.Errorf("reading client CA file: %w", err)
+		}
+		pool = x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("no certificates in client CA file %s", r.caFile)
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cert = &cert
+	r.clientCAs = pool
+	r.stamp = stamp
+	return nil
+}
+
+// Changed reports whether any of the files changed since they were last loaded
+func (r *Reloader) Changed() bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.fileStamp() != r.stamp
+}
+
+// Watch reloads the files when they change, checking every interval until ctx is done
+func (r *Reloader) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if !r.Changed() {
+				continue
+			}
+			if err := r.Reload(); err != nil {
+				log.Printf("TLS reload failed, keeping the current certificate: %v", err)
+				continue
+			}
+			log.Printf("TLS certificate reloaded (expires %s)", r.Expiry().Format(time.RFC3339))
+		}
+	}
+}
+
+// Expiry returns when the current certificate expires
+func (r *Reloader) Expiry() time.Time {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if r.cert.Leaf != nil {
+		return r.cert.Leaf.NotAfter
+	}
+	if leaf, err := x509.ParseCertificate(r.cert.Certificate[0]); err == nil {
+		return leaf.NotAfter
+	}
+	return time.Time{}
+}
+
+// TLSConfig returns a server configuration that uses the current certificate and
+// client CAs for each new connection
+func (r *Reloader) TLSConfig(clientAuth tls.ClientAuthType) *tls.Config {
+	return &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: r.getCertificate,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			r.mu.RLock()
+			defer r.mu.RUnlock()
+			return &tls.Config{
+				MinVersion:   tls.VersionTLS12,
+				Certificates: []tls.Certificate{*r.cert},
+				ClientAuth:   clientAuth,
+				ClientCAs:    r.clientCAs,
+				NextProtos:   []string{"h2", "http/1.1"},
+			}, nil
+		},
+	}
+}
+
+func (r *Reloader) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert, nil
+}
+
+// fileStamp summarises the files' modification times and sizes
+func (r *Reloader) fileStamp() string {
+	var sb strings.Builder
+	for _, f := range []string{r.certFile, r.keyFile, r.caFile} {
+		if f == "" {
+			continue
+		}
+		if info, err := os.Stat(f); err == nil {
+			fmt.Fprintf(&sb, "%d/%d;", info.ModTime().UnixNano(), info.Size())
+		} else {
+			sb.WriteString("missing;")
+		}
+	}
+	return sb.String()
+}
+
+// Subjects maps client certificate common names to user IDs
+type Subjects map[string]string
+
+// ParseSubjects reads comma-separated mappings, e.g. "wolf-pixel=wolf,wife-ipad=wife"
+func ParseSubjects(s string) (Subjects, error) {
+	subjects := make(Subjects)
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		cn, actor, ok := strings.Cut(part, "=")
+		cn, actor = strings.TrimSpace(cn), strings.TrimSpace(actor)
+		if !ok || cn == "" || actor == "" {
+			return nil, fmt.Errorf("invalid mapping %q: want common-name=user", part)
+		}
+		subjects[cn] = actor
+	}
+	return subjects, nil
+}
+
+// Actor returns the user a connection's verified client certificate maps to, and
+// the certificate's common name. The actor is empty if there is no verified
+// certificate or its name is not mapped.
+func (s Subjects) Actor(state *tls.ConnectionState) (string, string) {
+	if state == nil || len(state.VerifiedChains) == 0 || len(state.PeerCertificates) == 0 {
+		return "", ""
+	}
+	cn := state.PeerCertificates[0].Subject.CommonName
+	return s[cn], cn
+}
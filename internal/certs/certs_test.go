@@ -0,0 +1,149 @@
+package certs_test
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"os"
+	"testing"
+
+	"github.com/mrwolf/brain-server/internal/certs"
+	"github.com/mrwolf/brain-server/internal/certs/certstest"
+)
+
+func TestParseClientAuth(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    tls.ClientAuthType
+		wantErr bool
+	}{
+		{"off", tls.NoClientCert, false},
+		{"optional", tls.VerifyClientCertIfGiven, false},
+		{"require", tls.RequireAndVerifyClientCert, false},
+		{"", tls.NoClientCert, true},
+		{"Require", tls.NoClientCert, true},
+	}
+	for _, tt := range tests {
+		got, err := certs.ParseClientAuth(tt.in)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParseClientAuth(%q) = %v, %v; want %v, error %v", tt.in, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestParseSubjects(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    certs.Subjects
+		wantErr bool
+	}{
+		{"", certs.Subjects{}, false},
+		{"wolf-pixel=wolf, wife-ipad = wife,", certs.Subjects{"wolf-pixel": "wolf", "wife-ipad": "wife"}, false},
+		{"wolf-pixel", nil, true},
+		{"=wolf", nil, true},
+		{"wolf-pixel=", nil, true},
+	}
+	for _, tt := range tests {
+		got, err := certs.ParseSubjects(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseSubjects(%q) error = %v, want error %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if len(got) != len(tt.want) {
+			t.Errorf("ParseSubjects(%q) = %v, want %v", tt.in, got, tt.want)
+			continue
+		}
+		for cn, actor := range tt.want {
+			if got[cn] != actor {
+				t.Errorf("ParseSubjects(%q)[%q] = %q, want %q", tt.in, cn, got[cn], actor)
+			}
+		}
+	}
+}
+
+func TestSubjectsActor(t *testing.T) {
+	ca := certstest.NewCA(t)
+	leaf := func(cn string) *x509.Certificate {
+		c := ca.ClientCert(t, cn)
+		cert, err := x509.ParseCertificate(c.Certificate[0])
+		if err != nil {
+			t.Fatalf("parsing certificate: %v", err)
+		}
+		return cert
+	}
+	subjects := certs.Subjects{"wolf-pixel": "wolf"}
+	wolf, other := leaf("wolf-pixel"), leaf("someone")
+
+	tests := []struct {
+		name      string
+		state     *tls.ConnectionState
+		wantActor string
+		wantCN    string
+	}{
+		{"no TLS", nil, "", ""},
+		{"no certificate", &tls.ConnectionState{}, "", ""},
+		{"unverified", &tls.ConnectionState{PeerCertificates: []*x509.Certificate{wolf}}, "", ""},
+		{"mapped", &tls.ConnectionState{PeerCertificates: []*x509.Certificate{wolf}, VerifiedChains: [][]*x509.Certificate{{wolf, ca.Cert}}}, "wolf", "wolf-pixel"},
+		{"unmapped", &tls.ConnectionState{PeerCertificates: []*x509.Certificate{other}, VerifiedChains: [][]*x509.Certificate{{other, ca.Cert}}}, "", "someone"},
+	}
+	for _, tt := range tests {
+		actor, cn := subjects.Actor(tt.state)
+		if actor != tt.wantActor || cn != tt.wantCN {
+			t.Errorf("%s: Actor() = %q, %q; want %q, %q", tt.name, actor, cn, tt.wantActor, tt.wantCN)
+		}
+	}
+}
+
+func TestReloader(t *testing.T) {
+	ca := certstest.NewCA(t)
+	certFile, keyFile := ca.Issue(t, "localhost")
+
+	r, err := certs.NewReloader(certFile, keyFile, ca.CAFile)
+	if err != nil {
+		t.Fatalf("NewReloader: %v", err)
+	}
+	first := r.Expiry()
+	if first.IsZero() {
+		t.Fatal("Expiry() is zero")
+	}
+	if r.Changed() {
+		t.Error("Changed() right after loading")
+	}
+
+	// A renewed certificate is picked up by new connections
+	ca.Issue(t, "localhost")
+	if !r.Changed() {
+		t.Fatal("Changed() = false after the files were rewritten")
+	}
+	if err := r.Reload(); err != nil {
+		t.Fatalf("Reload: %v", err)
+	}
+	renewed := r.Expiry()
+	if !renewed.After(first) {
+		t.Errorf("Expiry() after reload = %v, want later than %v", renewed, first)
+	}
+	config, err := r.TLSConfig(tls.VerifyClientCertIfGiven).GetConfigForClient(&tls.ClientHelloInfo{})
+	if err != nil {
+		t.Fatalf("GetConfigForClient: %v", err)
+	}
+	leaf, _ := x509.ParseCertificate(config.Certificates[0].Certificate[0])
+	if !leaf.NotAfter.Equal(renewed) {
+		t.Errorf("served certificate expires %v, want %v", leaf.NotAfter, renewed)
+	}
+	if config.ClientCAs == nil || config.ClientAuth != tls.VerifyClientCertIfGiven {
+		t.Errorf("client auth = %v with CAs %v, want optional with the CA", config.ClientAuth, config.ClientCAs)
+	}
+
+	// A broken key keeps the previous certificate
+	if err := os.WriteFile(keyFile, []byte("not a key"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Reload(); err == nil {
+		t.Error("Reload with a broken key: want error")
+	}
+	if got := r.Expiry(); !got.Equal(renewed) {
+		t.Errorf("Expiry() after failed reload = %v, want %v", got, renewed)
+	}
+	if !r.Changed() {
+		t.Error("Changed() = false after a failed reload, want it retried")
+	}
+}
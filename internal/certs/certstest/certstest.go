@@ -0,0 +1,116 @@
+// Package certstest issues certificates from a throwaway CA for tests.
+//
+//	ca := certstest.NewCA(t)
+//	certFile, keyFile := ca.Issue(t, "localhost")  // server certificate for 127.0.0.1
+//	client := ca.ClientCert(t, "wolf-pixel")      // tls.Certificate for a client
+package certstest
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// CA is a self-signed certificate authority
+type CA struct {
+	Cert   *x509.Certificate
+	key    *ecdsa.PrivateKey
+	CAFile string // the CA certificate as PEM, to trust it
+	Pool   *x509.CertPool
+	dir    string
+	serial int64
+}
+
+// NewCA creates a CA whose files are removed when the test ends
+func NewCA(t testing.TB) *CA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generating CA key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "brain test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("creating CA certificate: %v", err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+
+	ca := &CA{Cert: cert, key: key, Pool: x509.NewCertPool(), dir: t.TempDir(), serial: 1}
+	ca.Pool.AddCert(cert)
+	ca.CAFile = filepath.Join(ca.dir, "ca.pem")
+	writePEM(t, ca.CAFile, "CERTIFICATE", der)
+	return ca
+}
+
+// Issue writes a server certificate for 127.0.0.1 and localhost with the given
+// common name, returning its certificate and key files
+func (ca *CA) Issue(t testing.TB, cn string) (string, string) {
+	t.Helper()
+	der, key := ca.sign(t, cn, x509.ExtKeyUsageServerAuth)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("encoding key: %v", err)
+	}
+	certFile := filepath.Join(ca.dir, cn+".pem")
+	keyFile := filepath.Join(ca.dir, cn+"-key.pem")
+	writePEM(t, certFile, "CERTIFICATE", der)
+	writePEM(t, keyFile, "EC PRIVATE KEY", keyDER)
+	return certFile, keyFile
+}
+
+// ClientCert returns a client certificate with the given common name
+func (ca *CA) ClientCert(t testing.TB, cn string) tls.Certificate {
+	t.Helper()
+	der, key := ca.sign(t, cn, x509.ExtKeyUsageClientAuth)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+func (ca *CA) sign(t testing.TB, cn string, usage x509.ExtKeyUsage) ([]byte, *ecdsa.PrivateKey) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generating key: %v", err)
+	}
+	ca.serial++
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(ca.serial),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Duration(ca.serial) * time.Hour), // later certificates expire later
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.Cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatalf("signing certificate for %s: %v", cn, err)
+	}
+	return der, key
+}
+
+func writePEM(t testing.TB, path, blockType string, der []byte) {
+	t.Helper()
+	data := pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der})
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatalf("writing %s: %v", path, err)
+	}
+}
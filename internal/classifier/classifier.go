@@ -3,6 +3,7 @@ package classifier
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"strings"
@@ -10,77 +11,41 @@ import (
 
 	"github.com/mrwolf/brain-server/internal/llm"
 	"github.com/mrwolf/brain-server/internal/models"
+	"github.com/mrwolf/brain-server/internal/prompts"
 )
 
-const classifierPrompt = `You are a personal note classifier. Classify the following capture into exactly one category.
-
-Categories:
-- Ideas: Creative thoughts, concepts, "what if" musings, inventions, possibilities
-- Projects: Personal goals requiring multiple steps (home improvement, learning skills, hobbies, creative endeavors - NOT fitness/health)
-- Financial: Money, transactions, purchases, bills, expenses, income
-- Health: Physical symptoms, medical matters, fitness activities, exercise routines, diet, nutrition, sleep, mental health, wellness
-- Life: Emotions, relationships, events, daily reflections, personal growth, state of being
-- Journal: Personal reflections, diary entries, daily thoughts, stream of consciousness (trigger words: journal, dear diary, journaling)
-- Spirituality: Spiritual practices, meditation, prayer, faith, meaning, philosophy
-- Tasks: To-do items, reminders, things to remember, action items (starts with: todo, remember to, I have to, I need to, dont forget, must, should do)
-
-Examples:
-- "I should start using the exercise bike" → Health (fitness activity)
-- "My back hurts" → Health (symptom)
-- "What if we could travel faster than light?" → Ideas
-- "I want to learn woodworking" → Projects (skill development)
-- "Spent £45 at Tesco" → Financial
-- "Feeling grateful today" → Life
-- "Journal: today was a good day" → Journal (starts with journal)
-- "Dear diary, I had a weird dream" → Journal
-- "Spent - "Feeling grateful today" → Life/Journal on bananas" → Financial (purchase)
-- "Need to meditate more" → Spirituality
-- "Remember to call mom" → Tasks (to-do item)
-- "I have to pick up the dry cleaning" → Tasks (action item)
-- "Todo fix the leaky faucet" → Tasks (todo)
-- "Need to buy milk" → Tasks (shopping to-do)
-- "I need to get new shoes" → Tasks (purchase to-do)
-
-Capture: "%s"
-Actor: %s
-Timestamp: %s
-
-Confidence guidelines:
-- 0.9-1.0: Clear, unambiguous fit for exactly one category
-- 0.7-0.9: Good fit but could possibly be another category
-- 0.5-0.7: Ambiguous, could reasonably fit 2+ categories
-- Below 0.5: Gibberish, unintelligible, or too vague to classify
-
-Respond in JSON:
-{
-  "category": "Ideas|Projects|Financial|Health|Life|Journal|Spirituality|Tasks",
-  "confidence": 0.0-1.0,
-  "title": "short descriptive title",
-  "cleaned_text": "the capture, cleaned up and formatted",
-  "tags": ["optional", "tags"]
+// classifierSchema constrains the classifier's JSON output (models.ClassifierResult)
+const classifierSchema = `{
+  "type": "object",
+  "properties": {
+    "category": {"type": "string", "enum": ["Ideas", "Projects", "Financial", "Health", "Life", "Journal", "Spirituality", "Tasks"]},
+    "confidence": {"type": "number", "minimum": 0, "maximum": 1},
+    "title": {"type": "string"},
+    "cleaned_text": {"type": "string"},
+    "tags": {"type": "array", "items": {"type": "string"}}
+  },
+  "required": ["category", "confidence", "title", "cleaned_text", "tags"]
 }`
 
-const transactionPrompt = `Parse this purchase/transaction from natural speech.
-
-Input: "%s"
-Actor: %s
-
-Extract:
-{
-  "amount": number,
-  "currency": "GBP|USD|EUR",
-  "merchant": "store/vendor name",
-  "label": "category like groceries, transport, etc",
-  "notes": "any additional context",
-  "confidence": 0.0-1.0
-}
-
-If you can't parse it reliably, set confidence below 0.5.`
+// transactionSchema constrains the transaction parser's JSON output (models.TransactionResult)
+const transactionSchema = `{
+  "type": "object",
+  "properties": {
+    "amount": {"type": "number"},
+    "currency": {"type": "string"},
+    "merchant": {"type": "string"},
+    "label": {"type": "string"},
+    "notes": {"type": "string"},
+    "confidence": {"type": "number", "minimum": 0, "maximum": 1}
+  },
+  "required": ["amount", "currency", "merchant", "label", "notes", "confidence"]
+}`
 
 // Classifier routes captures using LLM
 type Classifier struct {
 	client             *llm.Client
 	confidenceThreshold float64
+	prompts            *prompts.Store
 }
 
 // NewClassifier creates a new classifier
@@ -88,9 +53,15 @@ func NewClassifier(client *llm.Client, threshold float64) *Classifier {
 	return &Classifier{
 		client:             client,
 		confidenceThreshold: threshold,
+		prompts:            prompts.Defaults(),
 	}
 }
 
+// SetPrompts sets where prompt templates are loaded from (the embedded defaults until set)
+func (c *Classifier) SetPrompts(store *prompts.Store) {
+	c.prompts = store
+}
+
 // Result is the classification result
 type Result struct {
 	Category    string
@@ -100,25 +71,31 @@ type Result struct {
 	Tags        []string
 	NeedsReview bool
 	Choices     []string
-	ParseError  bool // True if LLM response couldn't be parsed
+	ParseError  bool   // True if LLM response couldn't be parsed
+	Prompt      string // template reference (prompts.Prompt.Ref) for the output's frontmatter
 }
 
 // Classify classifies a capture text
 func (c *Classifier) Classify(ctx context.Context, text, actor string, timestamp time.Time) (*Result, error) {
-	prompt := fmt.Sprintf(classifierPrompt, text, actor, timestamp.Format(time.RFC3339))
-
-	response, err := c.client.Generate(ctx, prompt, false)
+	prompt, err := c.prompts.Render(prompts.Classifier, prompts.ClassifierData{
+		Text:      text,
+		Actor:     actor,
+		Timestamp: timestamp.Format(time.RFC3339),
+	})
 	if err != nil {
-		return nil, fmt.Errorf("generating classification: %w", err)
+		return nil, err
 	}
 
-	// DEBUG: Log the raw LLM response
+	// DEBUG: Log the capture being classified
 	log.Printf("[CLASSIFIER DEBUG] Text: %q", text)
-	log.Printf("[CLASSIFIER DEBUG] LLM Response: %s", response)
 
-	// Parse response
+	// Output is schema-constrained and validated, with one repair attempt
 	var parsed models.ClassifierResult
-	if err := json.Unmarshal([]byte(response), &parsed); err != nil {
+	// Redacted values go back into the note's text only, not its title
+	ctx = llm.WithRestore(llm.WithActor(ctx, actor), "cleaned_text")
+	err = c.client.GenerateJSON(ctx, llm.TaskClassify, "", prompt.Text, json.RawMessage(classifierSchema), &parsed)
+	var schemaErr *llm.SchemaError
+	if errors.As(err, &schemaErr) {
 		log.Printf("[CLASSIFIER DEBUG] Parse error: %v", err)
 		// Return a parse error result instead of failing completely
 		return &Result{
@@ -127,6 +104,9 @@ func (c *Classifier) Classify(ctx context.Context, text, actor string, timestamp
 			Choices:     suggestChoices(""),
 		}, nil
 	}
+	if err != nil {
+		return nil, fmt.Errorf("generating classification: %w", err)
+	}
 
 	// Validate category
 	validCategory := validateCategory(parsed.Category)
@@ -148,6 +128,7 @@ func (c *Classifier) Classify(ctx context.Context, text, actor string, timestamp
 		Title:       parsed.Title,
 		CleanedText: parsed.CleanedText,
 		Tags:        parsed.Tags,
+		Prompt:      prompt.Ref(),
 	}
 
 	// Check if confidence is below threshold
@@ -172,16 +153,20 @@ type TransactionResult struct {
 
 // ParseTransaction parses a purchase/transaction text
 func (c *Classifier) ParseTransaction(ctx context.Context, text, actor string) (*TransactionResult, error) {
-	prompt := fmt.Sprintf(transactionPrompt, text, actor)
-
-	response, err := c.client.Generate(ctx, prompt, false)
+	prompt, err := c.prompts.Render(prompts.Transaction, prompts.TransactionData{Text: text, Actor: actor})
 	if err != nil {
-		return nil, fmt.Errorf("generating transaction parse: %w", err)
+		return nil, err
 	}
 
 	var parsed models.TransactionResult
-	if err := json.Unmarshal([]byte(response), &parsed); err != nil {
-		return nil, fmt.Errorf("parsing transaction response: %w (response: %s)", err, response)
+	ctx = llm.WithRestore(llm.WithActor(ctx, actor), "merchant", "notes") // filed in their own ledger
+	err = c.client.GenerateJSON(ctx, llm.TaskParseTransaction, "", prompt.Text, json.RawMessage(transactionSchema), &parsed)
+	var schemaErr *llm.SchemaError
+	if errors.As(err, &schemaErr) {
+		return nil, fmt.Errorf("parsing transaction response: %w", err)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("generating transaction parse: %w", err)
 	}
 
 	return &TransactionResult{
@@ -1,8 +1,14 @@
 package classifier
 
 import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
 	"testing"
+	"time"
 
+	"github.com/mrwolf/brain-server/internal/llm"
 	"github.com/mrwolf/brain-server/internal/models"
 )
 
@@ -114,3 +120,43 @@ func TestSuggestChoicesIncludesAllCategories(t *testing.T) {
 		t.Errorf("suggestChoices(\"\") should include Financial in choices: got %v", choices)
 	}
 }
+
+func TestClassifyStructuredOutput(t *testing.T) {
+	tests := []struct {
+		name         string
+		responses    []string
+		wantCategory string
+		wantParseErr bool
+	}{
+		{"valid", []string{`{"category": "Health", "confidence": 0.9, "title": "Bike", "cleaned_text": "Use the bike", "tags": []}`}, models.CategoryHealth, false},
+		{"repaired", []string{`{"category": "Fitness", "confidence": 0.9}`, `{"category": "Health", "confidence": 0.9, "title": "Bike", "cleaned_text": "Use the bike", "tags": []}`}, models.CategoryHealth, false},
+		{"still invalid", []string{`not json`, `{"category": "Fitness"}`}, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				response := tt.responses[calls%len(tt.responses)]
+				calls++
+				json.NewEncoder(w).Encode(llm.GenerateResponse{Response: response, Done: true})
+			}))
+			defer server.Close()
+
+			c := NewClassifier(llm.NewClient(server.URL, "test", "test"), 0.6)
+			result, err := c.Classify(context.Background(), "I should use the exercise bike", "wolf", time.Now())
+			if err != nil {
+				t.Fatalf("Classify: %v", err)
+			}
+			if result.ParseError != tt.wantParseErr {
+				t.Errorf("ParseError = %v, want %v", result.ParseError, tt.wantParseErr)
+			}
+			if result.Category != tt.wantCategory {
+				t.Errorf("Category = %q, want %q", result.Category, tt.wantCategory)
+			}
+			if calls > 2 {
+				t.Errorf("calls = %d, want at most one repair", calls)
+			}
+		})
+	}
+}
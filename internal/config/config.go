@@ -1,8 +1,19 @@
 package config
 
 import (
+	"crypto/tls"
 	"fmt"
+	"net"
 	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mrwolf/brain-server/internal/certs"
+	"github.com/mrwolf/brain-server/internal/db"
+	"github.com/mrwolf/brain-server/internal/llm"
+	"github.com/mrwolf/brain-server/internal/ratelimit"
+	"github.com/mrwolf/brain-server/internal/vault"
 )
 
 type Config struct {
@@ -12,8 +23,35 @@ type Config struct {
 	OllamaURL       string
 	OllamaModel     string
 	OllamaModelHeavy string
-	TokenWolf       string
-	TokenWife       string
+	OllamaEmbedModel string
+	LLMProvider     string // "ollama" or "openai" (any OpenAI-compatible server)
+	OpenAIURL       string
+	OpenAIAPIKey    string
+	LLMRoutesFile   string     // optional JSON routing table, see llm.LoadRoutes
+	LLMRoutes       llm.Routes // per-task overrides loaded from LLMRoutesFile
+	LLMParallel     int        // concurrent LLM calls; the rest queue by priority
+	LLMBreakerThreshold int           // consecutive failures that open the circuit breaker
+	LLMBreakerCooldown  time.Duration // how long the breaker stays open before a probe call
+	RateLimits          ratelimit.Limits // request budgets per route group, see ratelimit.ParseLimits
+	AuditRetentionDays  int              // days the audit log is kept; 0 keeps it forever
+	VaultKeysFile       string        // optional file of actor=<base64 key> lines
+	VaultKeys           vault.Keyring // per-actor keys from VaultKeysFile and BRAIN_VAULT_KEYS
+	EncryptedFolders    []string      // vault folders encrypted at rest when there are keys
+	SharingRules        db.SharingRules // who sees captures filed to a category unless the capture says
+	TLSCertFile         string             // serve HTTPS with this certificate and key, reloaded when they change
+	TLSKeyFile          string
+	TLSClientCAFile     string             // CAs trusted to issue client certificates
+	TLSClientAuth       tls.ClientAuthType // from BRAIN_TLS_CLIENT_AUTH, see certs.ParseClientAuth
+	TLSClientSubjects   certs.Subjects     // client certificate common names to user IDs
+	TrustedProxies      []*net.IPNet       // proxies whose X-Forwarded-For and X-Real-IP headers are believed
+	Redaction           llm.RedactionPolicy // what is replaced with placeholders in text sent to the LLM
+	TokenWolf       string // bootstrap token, registers the "wolf" user at startup
+	TokenWife       string // bootstrap token, registers the "wife" user at startup
+	OIDCIssuer       string // optional OpenID Connect provider for browser and app logins
+	OIDCClientID     string
+	OIDCClientSecret string
+	OIDCRedirectURL  string // this server's /auth/callback as registered with the provider
+	OIDCAppRedirect  string // app URL that receives tokens after an app login, e.g. brain://auth
 	Timezone        string
 }
 
@@ -25,8 +63,22 @@ func Load() (*Config, error) {
 		OllamaURL:       getEnv("BRAIN_OLLAMA_URL", "http://localhost:11434"),
 		OllamaModel:     getEnv("BRAIN_OLLAMA_MODEL", "qwen2.5:14b-instruct"),
 		OllamaModelHeavy: getEnv("BRAIN_OLLAMA_MODEL_HEAVY", "qwen2.5:14b-instruct"),
+		OllamaEmbedModel: getEnv("BRAIN_OLLAMA_EMBED_MODEL", "nomic-embed-text"),
+		LLMProvider:     getEnv("BRAIN_LLM_PROVIDER", "ollama"),
+		OpenAIURL:       getEnv("BRAIN_OPENAI_URL", ""),
+		OpenAIAPIKey:    getEnv("BRAIN_OPENAI_API_KEY", ""),
+		LLMRoutesFile:   getEnv("BRAIN_LLM_ROUTES_FILE", ""),
 		TokenWolf:       getEnv("BRAIN_TOKEN_WOLF", ""),
 		TokenWife:       getEnv("BRAIN_TOKEN_WIFE", ""),
+		OIDCIssuer:       getEnv("BRAIN_OIDC_ISSUER", ""),
+		OIDCClientID:     getEnv("BRAIN_OIDC_CLIENT_ID", ""),
+		OIDCClientSecret: getEnv("BRAIN_OIDC_CLIENT_SECRET", ""),
+		OIDCRedirectURL:  getEnv("BRAIN_OIDC_REDIRECT_URL", ""),
+		OIDCAppRedirect:  getEnv("BRAIN_OIDC_APP_REDIRECT", ""),
+		VaultKeysFile:    getEnv("BRAIN_VAULT_KEYS_FILE", ""),
+		TLSCertFile:      getEnv("BRAIN_TLS_CERT_FILE", ""),
+		TLSKeyFile:       getEnv("BRAIN_TLS_KEY_FILE", ""),
+		TLSClientCAFile:  getEnv("BRAIN_TLS_CLIENT_CA_FILE", ""),
 		Timezone:        getEnv("BRAIN_TIMEZONE", "Europe/London"),
 	}
 
@@ -34,6 +86,102 @@ func Load() (*Config, error) {
 		return nil, err
 	}
 
+	parallel, err := strconv.Atoi(getEnv("BRAIN_LLM_PARALLEL", "1"))
+	if err != nil || parallel < 1 {
+		return nil, fmt.Errorf("BRAIN_LLM_PARALLEL must be a positive integer")
+	}
+	cfg.LLMParallel = parallel
+
+	threshold, err := strconv.Atoi(getEnv("BRAIN_LLM_BREAKER_THRESHOLD", "3"))
+	if err != nil || threshold < 1 {
+		return nil, fmt.Errorf("BRAIN_LLM_BREAKER_THRESHOLD must be a positive integer")
+	}
+	cfg.LLMBreakerThreshold = threshold
+
+	cooldown, err := time.ParseDuration(getEnv("BRAIN_LLM_BREAKER_COOLDOWN", "1m"))
+	if err != nil || cooldown <= 0 {
+		return nil, fmt.Errorf("BRAIN_LLM_BREAKER_COOLDOWN must be a positive duration, e.g. 1m")
+	}
+	cfg.LLMBreakerCooldown = cooldown
+
+	limits, err := ratelimit.ParseLimits(getEnv("BRAIN_RATE_LIMITS", ""))
+	if err != nil {
+		return nil, fmt.Errorf("BRAIN_RATE_LIMITS: %w", err)
+	}
+	cfg.RateLimits = ratelimit.DefaultLimits().Merge(limits)
+
+	retention, err := strconv.Atoi(getEnv("BRAIN_AUDIT_RETENTION_DAYS", "365"))
+	if err != nil || retention < 0 {
+		return nil, fmt.Errorf("BRAIN_AUDIT_RETENTION_DAYS must be a whole number of days, or 0 to keep forever")
+	}
+	cfg.AuditRetentionDays = retention
+
+	cfg.VaultKeys = vault.Keyring{}
+	if cfg.VaultKeysFile != "" {
+		if cfg.VaultKeys, err = vault.LoadKeyFile(cfg.VaultKeysFile); err != nil {
+			return nil, fmt.Errorf("BRAIN_VAULT_KEYS_FILE: %w", err)
+		}
+	}
+	keys, err := vault.ParseKeys(getEnv("BRAIN_VAULT_KEYS", ""))
+	if err != nil {
+		return nil, fmt.Errorf("BRAIN_VAULT_KEYS: %w", err)
+	}
+	cfg.VaultKeys = cfg.VaultKeys.Merge(keys)
+
+	for _, folder := range strings.Split(getEnv("BRAIN_ENCRYPTED_FOLDERS", "Health,Journal,Financial"), ",") {
+		folder = strings.TrimSpace(folder)
+		if folder == "" {
+			continue
+		}
+		if strings.ContainsAny(folder, `/\`) || strings.HasPrefix(folder, ".") {
+			return nil, fmt.Errorf("BRAIN_ENCRYPTED_FOLDERS: %q is not a top-level vault folder", folder)
+		}
+		cfg.EncryptedFolders = append(cfg.EncryptedFolders, folder)
+	}
+
+	if cfg.SharingRules, err = db.ParseSharingRules(getEnv("BRAIN_SHARING_RULES", "")); err != nil {
+		return nil, fmt.Errorf("BRAIN_SHARING_RULES: %w", err)
+	}
+
+	defaultClientAuth := certs.ClientAuthOff
+	if cfg.TLSClientCAFile != "" {
+		defaultClientAuth = certs.ClientAuthOptional
+	}
+	if cfg.TLSClientAuth, err = certs.ParseClientAuth(getEnv("BRAIN_TLS_CLIENT_AUTH", defaultClientAuth)); err != nil {
+		return nil, fmt.Errorf("BRAIN_TLS_CLIENT_AUTH: %w", err)
+	}
+	if cfg.TLSClientAuth != tls.NoClientCert && cfg.TLSClientCAFile == "" {
+		return nil, fmt.Errorf("BRAIN_TLS_CLIENT_CA_FILE is required with BRAIN_TLS_CLIENT_AUTH")
+	}
+	if cfg.TLSClientSubjects, err = certs.ParseSubjects(getEnv("BRAIN_TLS_CLIENT_SUBJECTS", "")); err != nil {
+		return nil, fmt.Errorf("BRAIN_TLS_CLIENT_SUBJECTS: %w", err)
+	}
+
+	if cfg.TrustedProxies, err = parseNetworks(getEnv("BRAIN_TRUSTED_PROXIES", "")); err != nil {
+		return nil, fmt.Errorf("BRAIN_TRUSTED_PROXIES: %w", err)
+	}
+
+	if cfg.LLMRoutesFile != "" {
+		routes, err := llm.LoadRoutes(cfg.LLMRoutesFile)
+		if err != nil {
+			return nil, fmt.Errorf("BRAIN_LLM_ROUTES_FILE: %w", err)
+		}
+		cfg.LLMRoutes = routes
+	}
+
+	cfg.Redaction.Kinds = llm.ParseRedactKinds(getEnv("BRAIN_REDACT", "card,iban,phone,email"))
+	if cfg.Redaction.Actors, err = llm.ParseRedactActors(getEnv("BRAIN_REDACT_ACTORS", "")); err != nil {
+		return nil, fmt.Errorf("BRAIN_REDACT_ACTORS: %w", err)
+	}
+	if path := getEnv("BRAIN_REDACT_PATTERNS_FILE", ""); path != "" {
+		if cfg.Redaction.Patterns, err = llm.LoadRedactPatterns(path); err != nil {
+			return nil, fmt.Errorf("BRAIN_REDACT_PATTERNS_FILE: %w", err)
+		}
+	}
+	if err := cfg.Redaction.Validate(); err != nil {
+		return nil, fmt.Errorf("BRAIN_REDACT: %w", err)
+	}
+
 	return cfg, nil
 }
 
@@ -44,24 +192,77 @@ func (c *Config) validate() error {
 	if c.DBPath == "" {
 		return fmt.Errorf("BRAIN_DB_PATH is required")
 	}
-	if c.TokenWolf == "" && c.TokenWife == "" {
-		return fmt.Errorf("at least one of BRAIN_TOKEN_WOLF or BRAIN_TOKEN_WIFE is required")
+	switch c.LLMProvider {
+	case "ollama":
+	case "openai":
+		if c.OpenAIURL == "" {
+			return fmt.Errorf("BRAIN_OPENAI_URL is required when BRAIN_LLM_PROVIDER=openai")
+		}
+	default:
+		return fmt.Errorf("BRAIN_LLM_PROVIDER must be ollama or openai, got %q", c.LLMProvider)
+	}
+	if (c.TLSCertFile == "") != (c.TLSKeyFile == "") {
+		return fmt.Errorf("BRAIN_TLS_CERT_FILE and BRAIN_TLS_KEY_FILE must be set together")
+	}
+	if c.TLSClientCAFile != "" && c.TLSCertFile == "" {
+		return fmt.Errorf("BRAIN_TLS_CLIENT_CA_FILE needs BRAIN_TLS_CERT_FILE and BRAIN_TLS_KEY_FILE")
+	}
+	if c.OIDCIssuer != "" && (c.OIDCClientID == "" || c.OIDCRedirectURL == "") {
+		return fmt.Errorf("BRAIN_OIDC_CLIENT_ID and BRAIN_OIDC_REDIRECT_URL are required with BRAIN_OIDC_ISSUER")
 	}
 	return nil
 }
 
-func (c *Config) ActorFromToken(token string) (string, bool) {
-	switch token {
-	case c.TokenWolf:
-		if c.TokenWolf != "" {
-			return "wolf", true
+// LLMURL returns the base URL of the configured LLM provider
+func (c *Config) LLMURL() string {
+	if c.LLMProvider == "openai" {
+		return c.OpenAIURL
+	}
+	return c.OllamaURL
+}
+
+// BootstrapTokens returns the tokens from the environment by user ID. They are
+// registered in the users table at startup so a fresh install has someone who can
+// manage users; further users and tokens are added through the admin API.
+func (c *Config) BootstrapTokens() map[string]string {
+	tokens := make(map[string]string)
+	if c.TokenWolf != "" {
+		tokens["wolf"] = c.TokenWolf
+	}
+	if c.TokenWife != "" {
+		tokens["wife"] = c.TokenWife
+	}
+	return tokens
+}
+
+// parseNetworks reads comma-separated addresses and CIDR ranges, e.g.
+// "127.0.0.1,10.0.0.0/8"
+func parseNetworks(s string) ([]*net.IPNet, error) {
+	var networks []*net.IPNet
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if !strings.Contains(entry, "/") {
+			ip := net.ParseIP(entry)
+			if ip == nil {
+				return nil, fmt.Errorf("%q is not an address or CIDR range", entry)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
 		}
-	case c.TokenWife:
-		if c.TokenWife != "" {
-			return "wife", true
+		_, network, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not an address or CIDR range", entry)
 		}
+		networks = append(networks, network)
 	}
-	return "", false
+	return networks, nil
 }
 
 func getEnv(key, defaultVal string) string {
@@ -1,8 +1,16 @@
 package config
 
 import (
+	"crypto/tls"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/mrwolf/brain-server/internal/llm"
+	"github.com/mrwolf/brain-server/internal/ratelimit"
+	"github.com/mrwolf/brain-server/internal/vault"
 )
 
 func TestLoadConfig(t *testing.T) {
@@ -47,28 +55,27 @@ func TestLoadConfigMissingRequired(t *testing.T) {
 	}
 }
 
-func TestActorFromToken(t *testing.T) {
-	cfg := &Config{
-		TokenWolf: "wolf_secret",
-		TokenWife: "wife_secret",
-	}
-
+func TestBootstrapTokens(t *testing.T) {
 	tests := []struct {
-		token      string
-		wantActor  string
-		wantValid  bool
+		name string
+		cfg  Config
+		want map[string]string
 	}{
-		{"wolf_secret", "wolf", true},
-		{"wife_secret", "wife", true},
-		{"invalid", "", false},
-		{"", "", false},
+		{"both", Config{TokenWolf: "wolf_secret", TokenWife: "wife_secret"}, map[string]string{"wolf": "wolf_secret", "wife": "wife_secret"}},
+		{"wolf only", Config{TokenWolf: "wolf_secret"}, map[string]string{"wolf": "wolf_secret"}},
+		{"none", Config{}, map[string]string{}},
 	}
 
 	for _, tc := range tests {
-		actor, valid := cfg.ActorFromToken(tc.token)
-		if actor != tc.wantActor || valid != tc.wantValid {
-			t.Errorf("ActorFromToken(%q) = (%q, %v), want (%q, %v)",
-				tc.token, actor, valid, tc.wantActor, tc.wantValid)
+		got := tc.cfg.BootstrapTokens()
+		if len(got) != len(tc.want) {
+			t.Errorf("%s: BootstrapTokens() = %v, want %v", tc.name, got, tc.want)
+			continue
+		}
+		for user, token := range tc.want {
+			if got[user] != token {
+				t.Errorf("%s: BootstrapTokens()[%q] = %q, want %q", tc.name, user, got[user], token)
+			}
 		}
 	}
 }
@@ -96,3 +103,411 @@ func TestConfigDefaults(t *testing.T) {
 		t.Errorf("default timezone should be Europe/London")
 	}
 }
+
+func TestLLMProviderConfig(t *testing.T) {
+	os.Setenv("BRAIN_VAULT_PATH", "/tmp/v")
+	os.Setenv("BRAIN_DB_PATH", "/tmp/d")
+	os.Setenv("BRAIN_TOKEN_WOLF", "t")
+	defer func() {
+		os.Unsetenv("BRAIN_VAULT_PATH")
+		os.Unsetenv("BRAIN_DB_PATH")
+		os.Unsetenv("BRAIN_TOKEN_WOLF")
+		os.Unsetenv("BRAIN_LLM_PROVIDER")
+		os.Unsetenv("BRAIN_OPENAI_URL")
+	}()
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("loading config: %v", err)
+	}
+	if cfg.LLMProvider != "ollama" || cfg.LLMURL() != cfg.OllamaURL {
+		t.Errorf("expected ollama by default, got %q at %q", cfg.LLMProvider, cfg.LLMURL())
+	}
+
+	os.Setenv("BRAIN_LLM_PROVIDER", "openai")
+	if _, err := Load(); err == nil {
+		t.Error("expected error when openai provider has no URL")
+	}
+
+	os.Setenv("BRAIN_OPENAI_URL", "http://localhost:8000/v1")
+	cfg, err = Load()
+	if err != nil {
+		t.Fatalf("loading config: %v", err)
+	}
+	if cfg.LLMURL() != "http://localhost:8000/v1" {
+		t.Errorf("LLMURL() = %q, want the openai URL", cfg.LLMURL())
+	}
+
+	os.Setenv("BRAIN_LLM_PROVIDER", "bogus")
+	if _, err := Load(); err == nil {
+		t.Error("expected error for unknown provider")
+	}
+}
+
+func TestLLMRoutesFile(t *testing.T) {
+	os.Setenv("BRAIN_VAULT_PATH", "/tmp/v")
+	os.Setenv("BRAIN_DB_PATH", "/tmp/d")
+	os.Setenv("BRAIN_TOKEN_WOLF", "t")
+	defer func() {
+		os.Unsetenv("BRAIN_VAULT_PATH")
+		os.Unsetenv("BRAIN_DB_PATH")
+		os.Unsetenv("BRAIN_TOKEN_WOLF")
+		os.Unsetenv("BRAIN_LLM_ROUTES_FILE")
+	}()
+
+	path := filepath.Join(t.TempDir(), "routes.json")
+	os.WriteFile(path, []byte(`{"narrate": {"model": "writer", "timeout": "5m"}}`), 0644)
+	os.Setenv("BRAIN_LLM_ROUTES_FILE", path)
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("loading config: %v", err)
+	}
+	if cfg.LLMRoutes[llm.TaskNarrate].Model != "writer" {
+		t.Errorf("narrate route = %+v, want model writer", cfg.LLMRoutes[llm.TaskNarrate])
+	}
+
+	os.WriteFile(path, []byte(`{"narate": {"model": "writer"}}`), 0644)
+	if _, err := Load(); err == nil {
+		t.Error("expected error for unknown task in routes file")
+	}
+}
+
+func TestLLMParallel(t *testing.T) {
+	os.Setenv("BRAIN_VAULT_PATH", "/tmp/v")
+	os.Setenv("BRAIN_DB_PATH", "/tmp/d")
+	os.Setenv("BRAIN_TOKEN_WOLF", "t")
+	defer func() {
+		os.Unsetenv("BRAIN_VAULT_PATH")
+		os.Unsetenv("BRAIN_DB_PATH")
+		os.Unsetenv("BRAIN_TOKEN_WOLF")
+		os.Unsetenv("BRAIN_LLM_PARALLEL")
+	}()
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("loading config: %v", err)
+	}
+	if cfg.LLMParallel != 1 {
+		t.Errorf("default LLMParallel = %d, want 1", cfg.LLMParallel)
+	}
+
+	os.Setenv("BRAIN_LLM_PARALLEL", "3")
+	if cfg, err = Load(); err != nil || cfg.LLMParallel != 3 {
+		t.Errorf("LLMParallel = %v (err %v), want 3", cfg, err)
+	}
+
+	os.Setenv("BRAIN_LLM_PARALLEL", "0")
+	if _, err := Load(); err == nil {
+		t.Error("expected error for BRAIN_LLM_PARALLEL=0")
+	}
+}
+
+func TestLLMBreakerConfig(t *testing.T) {
+	os.Setenv("BRAIN_VAULT_PATH", "/tmp/v")
+	os.Setenv("BRAIN_DB_PATH", "/tmp/d")
+	os.Setenv("BRAIN_TOKEN_WOLF", "t")
+	defer func() {
+		os.Unsetenv("BRAIN_VAULT_PATH")
+		os.Unsetenv("BRAIN_DB_PATH")
+		os.Unsetenv("BRAIN_TOKEN_WOLF")
+		os.Unsetenv("BRAIN_LLM_BREAKER_THRESHOLD")
+		os.Unsetenv("BRAIN_LLM_BREAKER_COOLDOWN")
+	}()
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("loading config: %v", err)
+	}
+	if cfg.LLMBreakerThreshold != 3 || cfg.LLMBreakerCooldown != time.Minute {
+		t.Errorf("breaker = %d/%v, want defaults 3/1m", cfg.LLMBreakerThreshold, cfg.LLMBreakerCooldown)
+	}
+
+	os.Setenv("BRAIN_LLM_BREAKER_COOLDOWN", "soon")
+	if _, err := Load(); err == nil {
+		t.Error("expected error for invalid BRAIN_LLM_BREAKER_COOLDOWN")
+	}
+	os.Unsetenv("BRAIN_LLM_BREAKER_COOLDOWN")
+
+	os.Setenv("BRAIN_LLM_BREAKER_THRESHOLD", "0")
+	if _, err := Load(); err == nil {
+		t.Error("expected error for BRAIN_LLM_BREAKER_THRESHOLD=0")
+	}
+}
+
+func TestOIDCConfig(t *testing.T) {
+	os.Setenv("BRAIN_VAULT_PATH", "/tmp/v")
+	os.Setenv("BRAIN_DB_PATH", "/tmp/d")
+	defer func() {
+		os.Unsetenv("BRAIN_VAULT_PATH")
+		os.Unsetenv("BRAIN_DB_PATH")
+		os.Unsetenv("BRAIN_OIDC_ISSUER")
+		os.Unsetenv("BRAIN_OIDC_CLIENT_ID")
+		os.Unsetenv("BRAIN_OIDC_REDIRECT_URL")
+	}()
+
+	os.Setenv("BRAIN_OIDC_ISSUER", "https://accounts.example.com")
+	if _, err := Load(); err == nil {
+		t.Error("expected error when the OIDC issuer has no client ID")
+	}
+
+	os.Setenv("BRAIN_OIDC_CLIENT_ID", "brain")
+	os.Setenv("BRAIN_OIDC_REDIRECT_URL", "https://brain.example.com/auth/callback")
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("loading config: %v", err)
+	}
+	if cfg.OIDCIssuer != "https://accounts.example.com" || cfg.OIDCClientID != "brain" {
+		t.Errorf("OIDC config = %q, %q", cfg.OIDCIssuer, cfg.OIDCClientID)
+	}
+}
+
+func TestRateLimitsConfig(t *testing.T) {
+	os.Setenv("BRAIN_VAULT_PATH", "/tmp/v")
+	os.Setenv("BRAIN_DB_PATH", "/tmp/d")
+	defer func() {
+		os.Unsetenv("BRAIN_VAULT_PATH")
+		os.Unsetenv("BRAIN_DB_PATH")
+		os.Unsetenv("BRAIN_RATE_LIMITS")
+	}()
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("loading config: %v", err)
+	}
+	if cfg.RateLimits.String() != ratelimit.DefaultLimits().String() {
+		t.Errorf("RateLimits = %s, want the defaults", cfg.RateLimits)
+	}
+
+	os.Setenv("BRAIN_RATE_LIMITS", "llm=5/h,llm@kid=1/h")
+	cfg, err = Load()
+	if err != nil {
+		t.Fatalf("loading config: %v", err)
+	}
+	if got := cfg.RateLimits.String(); got != "auth=20/m,client=300/m,default=120/m,llm=5/h,llm@kid=1/h" {
+		t.Errorf("RateLimits = %s, want overrides merged onto the defaults", got)
+	}
+
+	os.Setenv("BRAIN_RATE_LIMITS", "llm=lots")
+	if _, err := Load(); err == nil {
+		t.Error("expected error for an invalid budget")
+	}
+}
+
+func TestAuditRetentionConfig(t *testing.T) {
+	os.Setenv("BRAIN_VAULT_PATH", "/tmp/v")
+	os.Setenv("BRAIN_DB_PATH", "/tmp/d")
+	defer func() {
+		os.Unsetenv("BRAIN_VAULT_PATH")
+		os.Unsetenv("BRAIN_DB_PATH")
+		os.Unsetenv("BRAIN_AUDIT_RETENTION_DAYS")
+	}()
+
+	tests := []struct {
+		value   string
+		want    int
+		wantErr bool
+	}{
+		{"", 365, false},
+		{"30", 30, false},
+		{"0", 0, false},
+		{"-1", 0, true},
+		{"a year", 0, true},
+	}
+	for _, tt := range tests {
+		os.Setenv("BRAIN_AUDIT_RETENTION_DAYS", tt.value)
+		cfg, err := Load()
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("BRAIN_AUDIT_RETENTION_DAYS=%q: expected error", tt.value)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("BRAIN_AUDIT_RETENTION_DAYS=%q: %v", tt.value, err)
+		}
+		if cfg.AuditRetentionDays != tt.want {
+			t.Errorf("BRAIN_AUDIT_RETENTION_DAYS=%q: got %d, want %d", tt.value, cfg.AuditRetentionDays, tt.want)
+		}
+	}
+}
+
+func TestVaultKeysConfig(t *testing.T) {
+	os.Setenv("BRAIN_VAULT_PATH", "/tmp/v")
+	os.Setenv("BRAIN_DB_PATH", "/tmp/d")
+	defer func() {
+		os.Unsetenv("BRAIN_VAULT_PATH")
+		os.Unsetenv("BRAIN_DB_PATH")
+		os.Unsetenv("BRAIN_VAULT_KEYS")
+		os.Unsetenv("BRAIN_VAULT_KEYS_FILE")
+		os.Unsetenv("BRAIN_ENCRYPTED_FOLDERS")
+	}()
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("loading config: %v", err)
+	}
+	if len(cfg.VaultKeys) != 0 || strings.Join(cfg.EncryptedFolders, ",") != "Health,Journal,Financial" {
+		t.Errorf("keys %v, folders %v; want none and the defaults", cfg.VaultKeys.Actors(), cfg.EncryptedFolders)
+	}
+
+	wolfKey, _ := vault.GenerateKey()
+	wifeKey, _ := vault.GenerateKey()
+	keyFile := filepath.Join(t.TempDir(), "vault.keys")
+	os.WriteFile(keyFile, []byte("# household keys\nwolf="+wolfKey+"\n\nwife="+wolfKey+"\n"), 0600)
+	os.Setenv("BRAIN_VAULT_KEYS_FILE", keyFile)
+	os.Setenv("BRAIN_VAULT_KEYS", "wife="+wifeKey)
+	os.Setenv("BRAIN_ENCRYPTED_FOLDERS", "Health, Letters")
+	cfg, err = Load()
+	if err != nil {
+		t.Fatalf("loading config: %v", err)
+	}
+	if strings.Join(cfg.VaultKeys.Actors(), ",") != "wife,wolf" || strings.Join(cfg.EncryptedFolders, ",") != "Health,Letters" {
+		t.Errorf("keys %v, folders %v", cfg.VaultKeys.Actors(), cfg.EncryptedFolders)
+	}
+	if want, _ := vault.ParseKeys("wife=" + wifeKey); string(cfg.VaultKeys["wife"]) != string(want["wife"]) {
+		t.Error("BRAIN_VAULT_KEYS should override the key file")
+	}
+
+	tests := []struct {
+		env, value string
+	}{
+		{"BRAIN_VAULT_KEYS", "wolf=short"},
+		{"BRAIN_VAULT_KEYS_FILE", "/nonexistent/vault.keys"},
+		{"BRAIN_ENCRYPTED_FOLDERS", "Journal/Raw"},
+	}
+	for _, tt := range tests {
+		old := os.Getenv(tt.env)
+		os.Setenv(tt.env, tt.value)
+		if _, err := Load(); err == nil {
+			t.Errorf("%s=%s: expected error", tt.env, tt.value)
+		}
+		os.Setenv(tt.env, old)
+	}
+}
+
+func TestTLSConfig(t *testing.T) {
+	os.Setenv("BRAIN_VAULT_PATH", "/tmp/v")
+	os.Setenv("BRAIN_DB_PATH", "/tmp/d")
+	envs := []string{"BRAIN_TLS_CERT_FILE", "BRAIN_TLS_KEY_FILE", "BRAIN_TLS_CLIENT_CA_FILE", "BRAIN_TLS_CLIENT_AUTH", "BRAIN_TLS_CLIENT_SUBJECTS"}
+	defer func() {
+		os.Unsetenv("BRAIN_VAULT_PATH")
+		os.Unsetenv("BRAIN_DB_PATH")
+		for _, env := range envs {
+			os.Unsetenv(env)
+		}
+	}()
+
+	tests := []struct {
+		name     string
+		values   []string // in the order of envs
+		wantAuth tls.ClientAuthType
+		wantErr  bool
+	}{
+		{"plain HTTP", []string{"", "", "", "", ""}, tls.NoClientCert, false},
+		{"TLS", []string{"c.pem", "k.pem", "", "", ""}, tls.NoClientCert, false},
+		{"client CA defaults to optional", []string{"c.pem", "k.pem", "ca.pem", "", "wolf-pixel=wolf"}, tls.VerifyClientCertIfGiven, false},
+		{"required client certificates", []string{"c.pem", "k.pem", "ca.pem", "require", ""}, tls.RequireAndVerifyClientCert, false},
+		{"cert without key", []string{"c.pem", "", "", "", ""}, 0, true},
+		{"client CA without TLS", []string{"", "", "ca.pem", "", ""}, 0, true},
+		{"client auth without CA", []string{"c.pem", "k.pem", "", "require", ""}, 0, true},
+		{"unknown client auth", []string{"c.pem", "k.pem", "ca.pem", "sometimes", ""}, 0, true},
+		{"bad subject mapping", []string{"c.pem", "k.pem", "ca.pem", "", "wolf-pixel"}, 0, true},
+	}
+	for _, tt := range tests {
+		for i, env := range envs {
+			os.Setenv(env, tt.values[i])
+		}
+		cfg, err := Load()
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: error = %v, wantErr %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if err == nil && cfg.TLSClientAuth != tt.wantAuth {
+			t.Errorf("%s: client auth = %v, want %v", tt.name, cfg.TLSClientAuth, tt.wantAuth)
+		}
+	}
+}
+
+func TestTrustedProxiesConfig(t *testing.T) {
+	os.Setenv("BRAIN_VAULT_PATH", "/tmp/v")
+	os.Setenv("BRAIN_DB_PATH", "/tmp/d")
+	defer func() {
+		os.Unsetenv("BRAIN_VAULT_PATH")
+		os.Unsetenv("BRAIN_DB_PATH")
+		os.Unsetenv("BRAIN_TRUSTED_PROXIES")
+	}()
+
+	tests := []struct {
+		value   string
+		want    []string
+		wantErr bool
+	}{
+		{"", nil, false},
+		{"127.0.0.1, 10.0.0.0/8", []string{"127.0.0.1/32", "10.0.0.0/8"}, false},
+		{"::1,fd00::/8", []string{"::1/128", "fd00::/8"}, false},
+		{"proxy.lan", nil, true},
+		{"10.0.0.0/33", nil, true},
+	}
+	for _, tt := range tests {
+		os.Setenv("BRAIN_TRUSTED_PROXIES", tt.value)
+		cfg, err := Load()
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%q: error = %v, wantErr %v", tt.value, err, tt.wantErr)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		var got []string
+		for _, network := range cfg.TrustedProxies {
+			got = append(got, network.String())
+		}
+		if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("%q: trusted proxies = %v, want %v", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestRedactionConfig(t *testing.T) {
+	os.Setenv("BRAIN_VAULT_PATH", "/tmp/v")
+	os.Setenv("BRAIN_DB_PATH", "/tmp/d")
+	envs := []string{"BRAIN_REDACT", "BRAIN_REDACT_ACTORS", "BRAIN_REDACT_PATTERNS_FILE"}
+	defer func() {
+		os.Unsetenv("BRAIN_VAULT_PATH")
+		os.Unsetenv("BRAIN_DB_PATH")
+		for _, env := range envs {
+			os.Unsetenv(env)
+		}
+	}()
+	patterns := filepath.Join(t.TempDir(), "patterns.txt")
+	os.WriteFile(patterns, []byte("plate=\\b[A-Z]{2}\\d{2} ?[A-Z]{3}\\b\n"), 0600)
+
+	tests := []struct {
+		name      string
+		values    []string // in the order of envs
+		wantKinds int
+		wantErr   bool
+	}{
+		{"defaults", []string{"", "", ""}, 4, false},
+		{"off", []string{"off", "", ""}, 0, false},
+		{"per user with custom kind", []string{"card", "wife=card+plate", patterns}, 1, false},
+		{"unknown kind", []string{"card,passport", "", ""}, 0, true},
+		{"custom kind without file", []string{"", "wife=plate", ""}, 0, true},
+		{"bad user entry", []string{"", "wife", ""}, 0, true},
+		{"missing file", []string{"", "", "/nonexistent/patterns.txt"}, 0, true},
+	}
+	for _, tt := range tests {
+		for i, env := range envs {
+			os.Setenv(env, tt.values[i])
+		}
+		cfg, err := Load()
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: error = %v, wantErr %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if err == nil && len(cfg.Redaction.Kinds) != tt.wantKinds {
+			t.Errorf("%s: kinds = %v, want %d", tt.name, cfg.Redaction.Kinds, tt.wantKinds)
+		}
+	}
+}
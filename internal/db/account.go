@@ -0,0 +1,177 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// actorTables are the tables holding a user's rows, in the order they are deleted.
+// where selects the user's rows, with the user ID for each placeholder.
+var actorTables = []struct {
+	table   string
+	where   string
+	omit    []string // columns left out of exports (secrets, vectors)
+	derived bool     // rebuilt from the rest, so not exported
+}{
+	{table: "capture_comments", where: `actor = ? OR capture_id IN (SELECT capture_id FROM capture_log WHERE actor = ?)`},
+	{table: "capture_shares", where: `owner = ?`},
+	{table: "pending_clarifications", where: `actor = ?`},
+	{table: "capture_log", where: `actor = ?`},
+	{table: "transactions", where: `actor = ?`},
+	{table: "letters", where: `letter_id = 'let_' || for_date || '_' || ? || '_' || type`}, // IDs are let_<date>_<actor>_<type>
+	{table: "medication_doses", where: `actor = ?`},
+	{table: "medications", where: `actor = ?`},
+	{table: "mood_scores", where: `actor = ?`},
+	{table: "scheduler_runs", where: `actor = ?`},
+	{table: "postponed_jobs", where: `actor = ?`},
+	{table: "audit_log", where: `actor = ?`},
+	{table: "search_docs", where: `actor = ?`, derived: true},
+	{table: "embeddings", where: `actor = ?`, omit: []string{"vector"}, derived: true},
+	// Responses to requests for everyone may quote captures the user shared
+	{table: "llm_cache", where: `actor = ? OR actor = ''`, derived: true},
+	{table: "sessions", where: `user_id = ?`, omit: []string{"access_hash", "refresh_hash"}},
+	{table: "user_identities", where: `user_id = ?`},
+	{table: "api_tokens", where: `user_id = ?`, omit: []string{"token_hash"}},
+	{table: "users", where: `id = ?`},
+}
+
+// actorArgs repeats the user ID for each placeholder in where
+func actorArgs(where, actor string) []interface{} {
+	args := make([]interface{}, strings.Count(where, "?"))
+	for i := range args {
+		args[i] = actor
+	}
+	return args
+}
+
+// ExportActor returns a user's rows from every table, by table, oldest first, with
+// sealed text opened. Search index, embedding and LLM cache rows are derived from
+// the rest and left out, as are token and session hashes. Signals and LLM call
+// records are not per user.
+func (db *DB) ExportActor(actor string) (map[string][]map[string]interface{}, error) {
+	export := make(map[string][]map[string]interface{})
+	for _, t := range actorTables {
+		if t.derived {
+			continue
+		}
+		rows, err := db.conn.Query(`SELECT * FROM `+t.table+` WHERE `+t.where+` ORDER BY rowid`, actorArgs(t.where, actor)...)
+		if err != nil {
+			return nil, fmt.Errorf("exporting %s: %w", t.table, err)
+		}
+		records, err := scanRecords(rows, t.omit)
+		if err != nil {
+			return nil, fmt.Errorf("exporting %s: %w", t.table, err)
+		}
+		for _, record := range records {
+			if text, ok := record["raw_text"].(string); ok {
+				if record["raw_text"], err = db.openText(text); err != nil {
+					return nil, fmt.Errorf("exporting %s: %w", t.table, err)
+				}
+			}
+		}
+		export[t.table] = records
+	}
+	return export, nil
+}
+
+// scanRecords reads rows into maps by column name, closing them
+func scanRecords(rows *sql.Rows, omit []string) ([]map[string]interface{}, error) {
+	defer rows.Close()
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+
+	records := []map[string]interface{}{}
+	for rows.Next() {
+		values := make([]interface{}, len(columns))
+		ptrs := make([]interface{}, len(columns))
+		for i := range values {
+			ptrs[i] = &values[i]
+		}
+		if err := rows.Scan(ptrs...); err != nil {
+			return nil, err
+		}
+		record := make(map[string]interface{}, len(columns))
+		for i, c := range columns {
+			if containsString(omit, c) {
+				continue
+			}
+			if b, ok := values[i].([]byte); ok {
+				values[i] = string(b)
+			}
+			record[c] = values[i]
+		}
+		records = append(records, record)
+	}
+	return records, rows.Err()
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// DeleteActor removes a user and everything stored for them in one transaction:
+// their rows in every table, other users' comments on their captures, and their
+// place in the sharing of other users' captures. Returns the rows deleted by table.
+func (db *DB) DeleteActor(actor string) (map[string]int, error) {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	deleted := make(map[string]int)
+	for _, t := range actorTables {
+		res, err := tx.Exec(`DELETE FROM `+t.table+` WHERE `+t.where, actorArgs(t.where, actor)...)
+		if err != nil {
+			return nil, fmt.Errorf("deleting from %s: %w", t.table, err)
+		}
+		n, _ := res.RowsAffected()
+		deleted[t.table] = int(n)
+	}
+
+	// Unshare the user's view of other users' captures; those now shared with
+	// nobody else become private
+	if _, err := tx.Exec(`
+		UPDATE capture_shares SET shared_with = trim(replace(' ' || shared_with || ' ', ?, ' '))
+		WHERE visibility = 'actors' AND `+sharedWithReader,
+		" "+actor+" ", " "+actor+" "); err != nil {
+		return nil, fmt.Errorf("unsharing: %w", err)
+	}
+	if _, err := tx.Exec(`
+		UPDATE capture_shares SET visibility = 'private' WHERE visibility = 'actors' AND shared_with = ''
+	`); err != nil {
+		return nil, fmt.Errorf("unsharing: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return deleted, nil
+}
+
+// GetCaptureIDs returns the IDs of all of a user's captures
+func (db *DB) GetCaptureIDs(actor string) ([]string, error) {
+	rows, err := db.conn.Query(`SELECT capture_id FROM capture_log WHERE actor = ? ORDER BY id`, actor)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
@@ -0,0 +1,125 @@
+package db
+
+import (
+	"strings"
+	"time"
+)
+
+// Audit outcomes
+const (
+	AuditOK          = "ok"
+	AuditRejected    = "rejected" // invalid request
+	AuditDenied      = "denied"   // missing scope or wrong device
+	AuditRateLimited = "rate_limited"
+	AuditError       = "error"
+)
+
+// AuditEntry is one recorded API action
+type AuditEntry struct {
+	ID       int64     `json:"id"`
+	TS       time.Time `json:"ts"`
+	Actor    string    `json:"actor"`
+	DeviceID string    `json:"device_id,omitempty"`
+	Method   string    `json:"method"`
+	Route    string    `json:"route"`
+	Targets  []string  `json:"targets,omitempty"`
+	Status   int       `json:"status"`
+	Outcome  string    `json:"outcome"`
+	IP       string    `json:"ip,omitempty"`
+}
+
+// AuditQuery filters the audit log; zero fields match everything
+type AuditQuery struct {
+	Actor  string
+	Route  string // exact route pattern
+	Target string // entries acting on this ID
+	Since  *time.Time
+	Until  *time.Time
+	Limit  int
+}
+
+// AuditOutcome classifies a response status
+func AuditOutcome(status int) string {
+	switch {
+	case status == 429:
+		return AuditRateLimited
+	case status == 401 || status == 403:
+		return AuditDenied
+	case status >= 500:
+		return AuditError
+	case status >= 400:
+		return AuditRejected
+	default:
+		return AuditOK
+	}
+}
+
+// LogAudit appends an entry to the audit log
+func (db *DB) LogAudit(e AuditEntry) error {
+	_, err := db.conn.Exec(`
+		INSERT INTO audit_log (ts, actor, device_id, method, route, targets, status, outcome, ip)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, e.TS.UTC().Format(time.RFC3339), e.Actor, e.DeviceID, e.Method, e.Route,
+		strings.Join(e.Targets, " "), e.Status, e.Outcome, e.IP)
+	return err
+}
+
+// QueryAudit returns matching audit entries, newest first
+func (db *DB) QueryAudit(q AuditQuery) ([]AuditEntry, error) {
+	query := `SELECT id, ts, actor, device_id, method, route, targets, status, outcome, ip FROM audit_log WHERE 1 = 1`
+	var args []interface{}
+	if q.Actor != "" {
+		query += ` AND actor = ?`
+		args = append(args, q.Actor)
+	}
+	if q.Route != "" {
+		query += ` AND route = ?`
+		args = append(args, q.Route)
+	}
+	if q.Target != "" {
+		query += ` AND instr(' ' || targets || ' ', ?) > 0`
+		args = append(args, " "+q.Target+" ")
+	}
+	if q.Since != nil {
+		query += ` AND ts >= ?`
+		args = append(args, q.Since.UTC().Format(time.RFC3339))
+	}
+	if q.Until != nil {
+		query += ` AND ts < ?`
+		args = append(args, q.Until.UTC().Format(time.RFC3339))
+	}
+	query += ` ORDER BY ts DESC, id DESC`
+	if q.Limit > 0 {
+		query += ` LIMIT ?`
+		args = append(args, q.Limit)
+	}
+
+	rows, err := db.conn.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []AuditEntry
+	for rows.Next() {
+		var e AuditEntry
+		var ts, targets string
+		if err := rows.Scan(&e.ID, &ts, &e.Actor, &e.DeviceID, &e.Method, &e.Route, &targets, &e.Status, &e.Outcome, &e.IP); err != nil {
+			return nil, err
+		}
+		e.TS, _ = time.Parse(time.RFC3339, ts)
+		e.Targets = strings.Fields(targets)
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+// PruneAudit deletes audit entries older than before, returning how many went
+func (db *DB) PruneAudit(before time.Time) (int, error) {
+	res, err := db.conn.Exec(`DELETE FROM audit_log WHERE ts < ?`, before.UTC().Format(time.RFC3339))
+	if err != nil {
+		return 0, err
+	}
+	n, _ := res.RowsAffected()
+	return int(n), nil
+}
@@ -84,6 +84,186 @@ CREATE TABLE IF NOT EXISTS signals (
     ever_dominant INTEGER DEFAULT 0 -- floor flag for PROJECTS ONLY
 );
 
+-- Medication and supplement schedules per actor
+CREATE TABLE IF NOT EXISTS medications (
+    med_id TEXT PRIMARY KEY,
+    actor TEXT NOT NULL,
+    name TEXT NOT NULL,
+    dose TEXT,
+    times TEXT NOT NULL,            -- JSON array of "HH:MM" slots
+    active INTEGER NOT NULL DEFAULT 1,
+    created_at TEXT NOT NULL
+);
+
+-- Dose events matched from Health captures or marked missed by the scheduler
+CREATE TABLE IF NOT EXISTS medication_doses (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    med_id TEXT NOT NULL,
+    actor TEXT NOT NULL,
+    scheduled_for TEXT NOT NULL,    -- slot the dose belongs to (RFC3339)
+    status TEXT NOT NULL,           -- "taken" or "missed"
+    capture_id TEXT,
+    recorded_at TEXT NOT NULL,
+    UNIQUE(med_id, scheduled_for)
+);
+
+-- Mood time series scored from Life and Journal captures
+CREATE TABLE IF NOT EXISTS mood_scores (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    capture_id TEXT UNIQUE NOT NULL,
+    actor TEXT NOT NULL,
+    category TEXT NOT NULL,
+    valence REAL,                   -- 1 (very negative) to 10 (very positive), LLM scored
+    energy REAL,                    -- 1 (drained) to 10 (energised), LLM scored
+    rating INTEGER,                 -- explicit "mood 7" rating, 1-10
+    created_at TEXT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS embeddings (
+    doc_id TEXT NOT NULL,
+    kind TEXT NOT NULL,             -- same kinds as the search index
+    actor TEXT NOT NULL,
+    category TEXT NOT NULL DEFAULT '',
+    title TEXT NOT NULL DEFAULT '',
+    path TEXT NOT NULL DEFAULT '',
+    created TEXT NOT NULL,
+    model TEXT NOT NULL,            -- embedding model; rows from other models are re-embedded
+    dims INTEGER NOT NULL,
+    vector BLOB NOT NULL,           -- little-endian float32, L2-normalised
+    updated_at TEXT NOT NULL,
+    PRIMARY KEY (doc_id, kind)
+);
+
+-- LLM call ledger: one row per client call, retries included
+CREATE TABLE IF NOT EXISTS llm_calls (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    task TEXT NOT NULL,
+    provider TEXT NOT NULL,
+    model TEXT NOT NULL,
+    prompt_hash TEXT NOT NULL,      -- sha256 of system + prompt; prompt text is never stored
+    started_at TEXT NOT NULL,
+    duration_ms INTEGER NOT NULL,   -- wall time across attempts
+    attempts INTEGER NOT NULL,
+    error TEXT,                     -- NULL on success
+    prompt_eval_count INTEGER NOT NULL DEFAULT 0,
+    eval_count INTEGER NOT NULL DEFAULT 0,
+    total_duration_ms INTEGER NOT NULL DEFAULT 0,  -- as reported by the provider
+    load_duration_ms INTEGER NOT NULL DEFAULT 0,
+    prompt_eval_duration_ms INTEGER NOT NULL DEFAULT 0,
+    eval_duration_ms INTEGER NOT NULL DEFAULT 0
+);
+
+-- LLM response cache for tasks that opt in (see llm.TaskSettings.CacheTTL)
+CREATE TABLE IF NOT EXISTS llm_cache (
+    cache_key TEXT PRIMARY KEY,     -- sha256 of provider, model, prompt and options
+    actor TEXT NOT NULL DEFAULT '', -- user whose request the response was for
+    task TEXT NOT NULL,
+    model TEXT NOT NULL,
+    response TEXT NOT NULL,
+    created_at TEXT NOT NULL,
+    expires_at TEXT NOT NULL,
+    hits INTEGER NOT NULL DEFAULT 0,
+    last_hit_at TEXT
+);
+
+-- LLM work postponed while the backend was unavailable, resumed once it recovers
+CREATE TABLE IF NOT EXISTS postponed_jobs (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    kind TEXT NOT NULL,             -- "idea_expand", "narrate"
+    ref_id TEXT NOT NULL,           -- capture ID, or a fixed key for jobs that only need to run once
+    actor TEXT NOT NULL DEFAULT '',
+    payload TEXT NOT NULL DEFAULT '{}',
+    created_at TEXT NOT NULL,
+    UNIQUE(kind, ref_id)
+);
+
+-- Family members who can use the server; the ID is the actor name
+CREATE TABLE IF NOT EXISTS users (
+    id TEXT PRIMARY KEY,
+    name TEXT NOT NULL DEFAULT '',
+    created_at TEXT NOT NULL,
+    disabled_at TEXT
+);
+
+-- API tokens, stored as SHA-256 hashes; a user can have several, usually one per device
+CREATE TABLE IF NOT EXISTS api_tokens (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id TEXT NOT NULL REFERENCES users(id),
+    token_hash TEXT UNIQUE NOT NULL,
+    label TEXT NOT NULL DEFAULT '',
+    created_at TEXT NOT NULL,
+    last_used_at TEXT,
+    revoked_at TEXT,
+    device_id TEXT NOT NULL DEFAULT '', -- empty for tokens not bound to a device
+    scopes TEXT NOT NULL DEFAULT ''     -- space-separated, see db.AllScopes
+);
+
+-- OpenID Connect identities that log in as a user, linked by subject, or by
+-- verified email until the first login records the subject
+CREATE TABLE IF NOT EXISTS user_identities (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id TEXT NOT NULL REFERENCES users(id),
+    issuer TEXT NOT NULL,
+    subject TEXT NOT NULL DEFAULT '',
+    email TEXT NOT NULL DEFAULT '',
+    scopes TEXT NOT NULL DEFAULT '',    -- granted to sessions from this identity
+    created_at TEXT NOT NULL,
+    last_login_at TEXT
+);
+
+-- Login sessions: a browser cookie, or an app access token with a rotating refresh token
+CREATE TABLE IF NOT EXISTS sessions (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id TEXT NOT NULL REFERENCES users(id),
+    identity_id INTEGER NOT NULL REFERENCES user_identities(id),
+    kind TEXT NOT NULL,                 -- "browser", "app"
+    scopes TEXT NOT NULL DEFAULT '',
+    access_hash TEXT UNIQUE NOT NULL,
+    access_expires_at TEXT NOT NULL,
+    refresh_hash TEXT UNIQUE,           -- app sessions only
+    refresh_expires_at TEXT,
+    created_at TEXT NOT NULL,
+    revoked_at TEXT
+);
+
+-- Append-only record of API actions; rows are only ever removed by the retention policy
+CREATE TABLE IF NOT EXISTS audit_log (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    ts TEXT NOT NULL,
+    actor TEXT NOT NULL DEFAULT '',
+    device_id TEXT NOT NULL DEFAULT '',
+    method TEXT NOT NULL,
+    route TEXT NOT NULL,                -- route pattern, e.g. /api/v1/users/{userID}
+    targets TEXT NOT NULL DEFAULT '',   -- space-separated IDs acted on
+    status INTEGER NOT NULL,
+    outcome TEXT NOT NULL,              -- "ok", "rejected", "denied", "rate_limited", "error"
+    ip TEXT NOT NULL DEFAULT ''
+);
+
+CREATE TRIGGER IF NOT EXISTS audit_log_append_only BEFORE UPDATE ON audit_log
+BEGIN
+    SELECT RAISE(ABORT, 'audit log is append-only');
+END;
+
+-- Who besides its owner can see a capture and the notes filed from it; captures
+-- without a row are private
+CREATE TABLE IF NOT EXISTS capture_shares (
+    capture_id TEXT PRIMARY KEY,
+    owner TEXT NOT NULL,
+    visibility TEXT NOT NULL,             -- "private", "household" or "actors"
+    shared_with TEXT NOT NULL DEFAULT '', -- space-separated user IDs, for "actors"
+    updated_at TEXT NOT NULL
+);
+
+-- Comments on captures, by their owner or anyone they are shared with
+CREATE TABLE IF NOT EXISTS capture_comments (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    capture_id TEXT NOT NULL,
+    actor TEXT NOT NULL,
+    text TEXT NOT NULL,
+    created_at TEXT NOT NULL
+);
+
 CREATE INDEX IF NOT EXISTS idx_pending_actor ON pending_clarifications(actor);
 CREATE INDEX IF NOT EXISTS idx_pending_expires ON pending_clarifications(expires_at);
 CREATE INDEX IF NOT EXISTS idx_letters_date ON letters(for_date);
@@ -91,10 +271,26 @@ CREATE INDEX IF NOT EXISTS idx_transactions_actor ON transactions(actor);
 CREATE INDEX IF NOT EXISTS idx_transactions_date ON transactions(created_at);
 CREATE INDEX IF NOT EXISTS idx_scheduler_actor ON scheduler_runs(actor, job_type);
 CREATE INDEX IF NOT EXISTS idx_signals_type_weight ON signals(type, weight DESC);
+CREATE INDEX IF NOT EXISTS idx_medications_actor ON medications(actor, active);
+CREATE INDEX IF NOT EXISTS idx_medication_doses_actor ON medication_doses(actor, scheduled_for);
+CREATE INDEX IF NOT EXISTS idx_mood_actor_date ON mood_scores(actor, created_at);
+CREATE INDEX IF NOT EXISTS idx_embeddings_actor_model ON embeddings(actor, model);
+CREATE INDEX IF NOT EXISTS idx_llm_calls_started ON llm_calls(started_at);
+CREATE INDEX IF NOT EXISTS idx_llm_cache_task ON llm_cache(task, expires_at);
+CREATE INDEX IF NOT EXISTS idx_api_tokens_user ON api_tokens(user_id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_identities_subject ON user_identities(issuer, subject) WHERE subject != '';
+CREATE INDEX IF NOT EXISTS idx_identities_user ON user_identities(user_id);
+CREATE INDEX IF NOT EXISTS idx_sessions_user ON sessions(user_id);
+CREATE INDEX IF NOT EXISTS idx_audit_ts ON audit_log(ts);
+CREATE INDEX IF NOT EXISTS idx_audit_actor ON audit_log(actor, ts);
+CREATE INDEX IF NOT EXISTS idx_comments_capture ON capture_comments(capture_id, created_at);
 `
 
 type DB struct {
-	conn *sql.DB
+	conn       *sql.DB
+	ftsVersion int             // 5 or 4, whichever the search index was created with
+	unindexed  map[string]bool // vault folders kept out of the search index
+	sealer     Sealer          // seals raw text at rest, nil when the vault is not encrypted
 }
 
 func Open(path string) (*DB, error) {
@@ -120,30 +316,55 @@ func (db *DB) migrate() error {
 	if err != nil {
 		return fmt.Errorf("executing migration: %w", err)
 	}
-	return nil
+	if err := db.migrateLLMCacheActor(); err != nil {
+		return fmt.Errorf("migrating llm cache: %w", err)
+	}
+	if err := db.migrateTokenScopes(); err != nil {
+		return fmt.Errorf("migrating api tokens: %w", err)
+	}
+	return db.migrateSearch()
 }
 
 func (db *DB) Close() error {
 	return db.conn.Close()
 }
 
-// LogCapture logs a capture to the database
+// LogCapture logs a capture to the database and adds it to the search index
 func (db *DB) LogCapture(captureID, actor, mode, rawText, routedTo, status string, confidence float64) error {
-	_, err := db.conn.Exec(`
+	now := time.Now().UTC()
+	stored, err := db.sealText(rawText, actor)
+	if err != nil {
+		return err
+	}
+	_, err = db.conn.Exec(`
 		INSERT INTO capture_log (capture_id, actor, mode, raw_text, routed_to, confidence, status, created_at)
 		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
-	`, captureID, actor, mode, rawText, routedTo, confidence, status, time.Now().UTC().Format(time.RFC3339))
-	return err
+	`, captureID, actor, mode, stored, routedTo, confidence, status, now.Format(time.RFC3339))
+	if err != nil {
+		return err
+	}
+	return db.IndexSearchDoc(SearchDoc{
+		DocID:    captureID,
+		Kind:     DocCapture,
+		Actor:    actor,
+		Category: routedTo,
+		Created:  now,
+		Body:     rawText,
+	})
 }
 
 // AddPending adds a capture to the pending clarifications queue
 func (db *DB) AddPending(captureID, actor, rawText, choices, originalTS, deviceID string) error {
 	now := time.Now().UTC()
 	expires := now.Add(24 * time.Hour)
-	_, err := db.conn.Exec(`
+	stored, err := db.sealText(rawText, actor)
+	if err != nil {
+		return err
+	}
+	_, err = db.conn.Exec(`
 		INSERT INTO pending_clarifications (capture_id, actor, raw_text, choices, created_at, expires_at, original_ts, device_id)
 		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
-	`, captureID, actor, rawText, choices, now.Format(time.RFC3339), expires.Format(time.RFC3339), originalTS, deviceID)
+	`, captureID, actor, stored, choices, now.Format(time.RFC3339), expires.Format(time.RFC3339), originalTS, deviceID)
 	return err
 }
 
@@ -167,13 +388,17 @@ func (db *DB) GetPending(actor string) ([]PendingClarification, error) {
 		if err := rows.Scan(&p.CaptureID, &p.RawText, &p.Choices, &expiresStr); err != nil {
 			return nil, err
 		}
+		if p.RawText, err = db.openText(p.RawText); err != nil {
+			return nil, err
+		}
 		p.ExpiresAt, _ = time.Parse(time.RFC3339, expiresStr)
 		pending = append(pending, p)
 	}
 	return pending, rows.Err()
 }
 
-// ResolvePending marks a pending clarification as resolved
+// ResolvePending marks a pending clarification as resolved. A capture resolved to
+// an unindexed folder is removed from the search index.
 func (db *DB) ResolvePending(captureID, destination string) (bool, error) {
 	result, err := db.conn.Exec(`
 		UPDATE pending_clarifications
@@ -184,6 +409,9 @@ func (db *DB) ResolvePending(captureID, destination string) (bool, error) {
 		return false, err
 	}
 	affected, err := result.RowsAffected()
+	if err == nil && affected > 0 && db.Unindexed(destination, "") {
+		err = db.DeleteSearchDoc(captureID, DocCapture)
+	}
 	return affected > 0, err
 }
 
@@ -203,6 +431,9 @@ func (db *DB) GetPendingByID(captureID string) (*PendingClarification, error) {
 	if err != nil {
 		return nil, err
 	}
+	if p.RawText, err = db.openText(p.RawText); err != nil {
+		return nil, err
+	}
 	p.ExpiresAt, _ = time.Parse(time.RFC3339, expiresStr)
 	if originalTSStr.Valid {
 		p.OriginalTS, _ = time.Parse(time.RFC3339, originalTSStr.String)
@@ -241,6 +472,9 @@ func (db *DB) ExpirePending() ([]ExpiredCapture, error) {
 		if err := rows.Scan(&e.CaptureID, &e.Actor, &e.RawText); err != nil {
 			return nil, err
 		}
+		if e.RawText, err = db.openText(e.RawText); err != nil {
+			return nil, err
+		}
 		expired = append(expired, e)
 	}
 	if err := rows.Err(); err != nil {
@@ -359,6 +593,9 @@ func (db *DB) GetRecentCaptures(actor string, since time.Time) ([]CaptureRecord,
 		if err := rows.Scan(&c.CaptureID, &c.Actor, &c.Mode, &c.RawText, &routedTo, &c.Confidence, &c.Status, &createdStr); err != nil {
 			return nil, err
 		}
+		if c.RawText, err = db.openText(c.RawText); err != nil {
+			return nil, err
+		}
 		c.RoutedTo = routedTo.String
 		c.CreatedAt, _ = time.Parse(time.RFC3339, createdStr)
 		captures = append(captures, c)
@@ -384,10 +621,14 @@ type TransactionRecord struct {
 
 // LogTransaction logs a transaction to the database
 func (db *DB) LogTransaction(txnID, captureID, actor string, amount float64, currency, merchant, label, notes string, confidence float64, rawText, deviceID string) error {
-	_, err := db.conn.Exec(`
+	stored, err := db.sealText(rawText, actor)
+	if err != nil {
+		return err
+	}
+	_, err = db.conn.Exec(`
 		INSERT INTO transactions (txn_id, capture_id, actor, amount, currency, merchant, label, notes, confidence, raw_text, device_id, created_at)
 		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
-	`, txnID, captureID, actor, amount, currency, merchant, label, notes, confidence, rawText, deviceID, time.Now().UTC().Format(time.RFC3339))
+	`, txnID, captureID, actor, amount, currency, merchant, label, notes, confidence, stored, deviceID, time.Now().UTC().Format(time.RFC3339))
 	return err
 }
 
@@ -423,7 +664,9 @@ func (db *DB) GetTransactions(actor string, since *time.Time, limit int) ([]Tran
 		t.CaptureID = captureID.String
 		t.Label = label.String
 		t.Notes = notes.String
-		t.RawText = rawText.String
+		if t.RawText, err = db.openText(rawText.String); err != nil {
+			return nil, err
+		}
 		t.DeviceID = deviceID.String
 		t.CreatedAt, _ = time.Parse(time.RFC3339, createdStr)
 		transactions = append(transactions, t)
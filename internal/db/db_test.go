@@ -1,9 +1,15 @@
 package db
 
 import (
+	"errors"
 	"os"
+	"path/filepath"
+	"sort"
+	"strings"
 	"testing"
 	"time"
+
+	"github.com/mrwolf/brain-server/internal/llm"
 )
 
 func setupTestDB(t *testing.T) (*DB, func()) {
@@ -171,3 +177,866 @@ func TestDuplicateCaptureID(t *testing.T) {
 		t.Error("expected error on duplicate capture_id")
 	}
 }
+
+func TestMoodDaily(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	now := time.Now().UTC()
+	six, eight := 6.0, 8.0
+	rating := 7
+
+	if err := db.SaveMoodScore(MoodScore{CaptureID: "cap_m1", Actor: "wolf", Category: "Life", Valence: &six, Energy: &eight, CreatedAt: now}); err != nil {
+		t.Fatalf("saving mood: %v", err)
+	}
+	if err := db.SaveMoodScore(MoodScore{CaptureID: "cap_m2", Actor: "wolf", Category: "Journal", Valence: &eight, Energy: &six, Rating: &rating, CreatedAt: now}); err != nil {
+		t.Fatalf("saving mood: %v", err)
+	}
+
+	days, err := db.GetMoodDaily("wolf", now.Add(-time.Hour), now.Add(time.Hour), time.UTC)
+	if err != nil {
+		t.Fatalf("getting mood: %v", err)
+	}
+	if len(days) != 1 {
+		t.Fatalf("expected 1 day, got %d", len(days))
+	}
+	if days[0].Count != 2 || days[0].Valence == nil || *days[0].Valence != 7 {
+		t.Errorf("unexpected daily average: %+v", days[0])
+	}
+	if days[0].Rating == nil || *days[0].Rating != 7 {
+		t.Errorf("expected rating average 7, got %v", days[0].Rating)
+	}
+}
+
+func TestMoodDailyTimezone(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	eastern := time.FixedZone("EST", -5*3600)
+	five, seven := 5.0, 7.0
+	scores := []MoodScore{
+		{CaptureID: "cap_morning", Actor: "wolf", Category: "Life", Valence: &five, CreatedAt: time.Date(2024, 3, 10, 9, 0, 0, 0, eastern)},
+		{CaptureID: "cap_evening", Actor: "wolf", Category: "Life", Valence: &seven, CreatedAt: time.Date(2024, 3, 10, 21, 0, 0, 0, eastern)}, // 02:00 UTC on the 11th
+	}
+	for _, score := range scores {
+		if err := db.SaveMoodScore(score); err != nil {
+			t.Fatalf("saving mood: %v", err)
+		}
+	}
+
+	since := time.Date(2024, 3, 9, 0, 0, 0, 0, eastern)
+	days, err := db.GetMoodDaily("wolf", since, since.AddDate(0, 0, 3), eastern)
+	if err != nil {
+		t.Fatalf("getting mood: %v", err)
+	}
+	if len(days) != 1 || days[0].Date != "2024-03-10" || days[0].Count != 2 || *days[0].Valence != 6 {
+		t.Errorf("days = %+v, want both entries on 2024-03-10", days)
+	}
+}
+
+func TestLLMStats(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	now := time.Now()
+	for i := 1; i <= 20; i++ {
+		rec := llm.CallRecord{
+			Task:            llm.TaskClassify,
+			Provider:        "ollama",
+			Model:           "small",
+			PromptHash:      "h",
+			StartedAt:       now,
+			Duration:        time.Duration(i*100) * time.Millisecond,
+			Attempts:        1,
+			PromptEvalCount: 100,
+			EvalCount:       20,
+		}
+		if i == 20 {
+			rec.Attempts = 3
+			rec.Error = "after 3 attempts: timeout"
+		}
+		if err := db.RecordLLMCall(rec); err != nil {
+			t.Fatalf("recording call: %v", err)
+		}
+	}
+	old := llm.CallRecord{Task: llm.TaskNarrate, Model: "big", StartedAt: now.AddDate(0, 0, -30), Duration: time.Second, Attempts: 1}
+	if err := db.RecordLLMCall(old); err != nil {
+		t.Fatalf("recording call: %v", err)
+	}
+
+	stats, err := db.GetLLMStats(now.Add(-time.Hour))
+	if err != nil {
+		t.Fatalf("getting stats: %v", err)
+	}
+	if len(stats) != 1 {
+		t.Fatalf("expected 1 task (old calls excluded), got %+v", stats)
+	}
+	s := stats[0]
+	if s.Task != "classify" || s.Calls != 20 || s.Failures != 1 || s.Retries != 2 {
+		t.Errorf("unexpected counts: %+v", s)
+	}
+	if s.FailureRate != 0.05 {
+		t.Errorf("failure rate = %v, want 0.05", s.FailureRate)
+	}
+	if s.P50Ms != 1000 || s.P95Ms != 1900 {
+		t.Errorf("p50/p95 = %d/%d, want 1000/1900", s.P50Ms, s.P95Ms)
+	}
+	if s.AvgPromptTokens != 100 || s.AvgEvalTokens != 20 {
+		t.Errorf("avg tokens = %v/%v, want 100/20", s.AvgPromptTokens, s.AvgEvalTokens)
+	}
+	if s.LastError == "" {
+		t.Error("expected last error to be reported")
+	}
+}
+
+func TestLLMCache(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	if err := db.PutLLMCache("k1", "wolf", llm.TaskClassify, "small", `{"category": "Health"}`, time.Hour); err != nil {
+		t.Fatalf("putting cache entry: %v", err)
+	}
+	if err := db.PutLLMCache("k2", "", llm.TaskNarrateExtract, "big", `{"claims": []}`, -time.Minute); err != nil {
+		t.Fatalf("putting cache entry: %v", err)
+	}
+
+	response, ok, err := db.GetLLMCache("k1")
+	if err != nil || !ok || response != `{"category": "Health"}` {
+		t.Errorf("GetLLMCache(k1) = %q, %v, %v; want cached response", response, ok, err)
+	}
+	if _, ok, _ := db.GetLLMCache("k2"); ok {
+		t.Error("expired entry should not be served")
+	}
+	if _, ok, _ := db.GetLLMCache("missing"); ok {
+		t.Error("missing entry should not be served")
+	}
+
+	stats, err := db.GetLLMCacheStats()
+	if err != nil {
+		t.Fatalf("getting cache stats: %v", err)
+	}
+	if len(stats) != 2 || stats[0].Task != "classify" || stats[0].Hits != 1 || stats[1].Expired != 1 {
+		t.Errorf("unexpected cache stats: %+v", stats)
+	}
+
+	purged, err := db.PurgeLLMCache("", true)
+	if err != nil || purged != 1 {
+		t.Errorf("purging expired = %d, %v; want 1", purged, err)
+	}
+	purged, err = db.PurgeLLMCache("classify", false)
+	if err != nil || purged != 1 {
+		t.Errorf("purging classify = %d, %v; want 1", purged, err)
+	}
+}
+
+// prefixSealer marks text as sealed for an actor without encrypting it
+type prefixSealer struct{}
+
+func (prefixSealer) SealText(text, actor string) (string, error) {
+	return "sealed:" + actor + ":" + strings.ToUpper(text), nil
+}
+
+func (prefixSealer) OpenText(text string) (string, error) {
+	rest, ok := strings.CutPrefix(text, "sealed:")
+	if !ok {
+		return text, nil
+	}
+	_, sealed, _ := strings.Cut(rest, ":")
+	return strings.ToLower(sealed), nil
+}
+
+func (prefixSealer) IsSealedText(text string) bool {
+	return strings.HasPrefix(text, "sealed:")
+}
+
+func TestSealer(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	must := func(err error) {
+		t.Helper()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	since := time.Now().Add(-time.Hour)
+	must(db.LogCapture("cap_before", "wolf", "note", "old blood pressure", "Health", "filed", 0.9))
+	must(db.PutLLMCache("k1", "wolf", llm.TaskClassify, "small", "old response", time.Hour))
+	must(db.SetUnindexedFolders([]string{"Health", "Financial"}))
+	must(db.SetSealer(prefixSealer{}))
+	must(db.LogCapture("cap_after", "wolf", "note", "new blood pressure", "Health", "filed", 0.9))
+	must(db.LogCapture("cap_pending", "wolf", "note", "maybe health", "", "pending_classification", 0))
+	must(db.AddPending("cap_pending", "wolf", "maybe health", `["Health"]`, time.Now().UTC().Format(time.RFC3339), ""))
+	must(db.LogTransaction("txn_1", "cap_txn", "wife", 12, "EUR", "pharmacy", "", "", 0.9, "pharmacy 12 eur", ""))
+	must(db.PutLLMCache("k2", "", llm.TaskNarrateExtract, "big", "new response", time.Hour))
+
+	for _, c := range sealedColumns {
+		rows, err := db.conn.Query(`SELECT actor, ` + c.column + ` FROM ` + c.table)
+		must(err)
+		for rows.Next() {
+			var actor, text string
+			must(rows.Scan(&actor, &text))
+			if !strings.HasPrefix(text, "sealed:"+actor+":") {
+				t.Errorf("%s.%s stored %q, want it sealed for %q", c.table, c.column, text, actor)
+			}
+		}
+		rows.Close()
+	}
+
+	captures, err := db.GetRecentCaptures("wolf", since)
+	var texts []string
+	for _, c := range captures {
+		texts = append(texts, c.RawText)
+	}
+	sort.Strings(texts)
+	if err != nil || strings.Join(texts, ", ") != "maybe health, new blood pressure, old blood pressure" {
+		t.Errorf("GetRecentCaptures texts = %q, %v", texts, err)
+	}
+	pending, err := db.GetPending("wolf")
+	if err != nil || len(pending) != 1 || pending[0].RawText != "maybe health" {
+		t.Errorf("GetPending = %+v, %v", pending, err)
+	}
+	txns, err := db.GetTransactions("wife", nil, 0)
+	if err != nil || len(txns) != 1 || txns[0].RawText != "pharmacy 12 eur" {
+		t.Errorf("GetTransactions = %+v, %v", txns, err)
+	}
+	if response, ok, err := db.GetLLMCache("k1"); err != nil || !ok || response != "old response" {
+		t.Errorf("GetLLMCache(k1) = %q, %v, %v", response, ok, err)
+	}
+	export, err := db.ExportActor("wolf")
+	if err != nil || len(export["capture_log"]) != 3 || export["capture_log"][0]["raw_text"] != "old blood pressure" { // oldest first
+		t.Errorf("ExportActor capture_log = %v, %v", export["capture_log"], err)
+	}
+
+	// A pending capture clarified into an unindexed folder leaves the search index
+	resolved, err := db.ResolvePending("cap_pending", "Health")
+	must(err)
+	if !resolved {
+		t.Fatal("pending capture not resolved")
+	}
+	var indexed int
+	must(db.conn.QueryRow(`SELECT COUNT(*) FROM search_docs WHERE doc_id LIKE 'cap_%'`).Scan(&indexed))
+	if indexed != 0 {
+		t.Errorf("%d captures in the search index, want none", indexed)
+	}
+}
+
+func TestOpenDropsSharedNarrations(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+	db, err := Open(path)
+	if err != nil {
+		t.Fatalf("opening database: %v", err)
+	}
+	mixed := "I watched the herons and baked bread."
+	docs := []SearchDoc{
+		{DocID: "daily_2024-01-16_cap_1", Kind: DocJournalDaily, Actor: "wolf", Body: mixed},
+		{DocID: "daily_2024-01-16_cap_2", Kind: DocJournalDaily, Actor: "wife", Body: mixed},
+		{DocID: "daily_2024-01-15_cap_0", Kind: DocJournalDaily, Actor: "wolf", Body: "I watched the herons."},
+	}
+	for _, doc := range docs {
+		if err := db.IndexSearchDoc(doc); err != nil {
+			t.Fatalf("indexing %s: %v", doc.DocID, err)
+		}
+	}
+	db.Close()
+
+	db, err = Open(path)
+	if err != nil {
+		t.Fatalf("reopening database: %v", err)
+	}
+	defer db.Close()
+	for _, doc := range docs {
+		got, _ := db.GetSearchDoc(doc.DocID, doc.Kind)
+		if want := doc.Body != mixed; (got != nil) != want {
+			t.Errorf("%s kept = %v, want %v", doc.DocID, got != nil, want)
+		}
+	}
+}
+
+func TestSearch(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	db.LogCapture("cap_s1", "wolf", "note", "Bought a new exercise bike for cardio", "Health", "filed", 0.9)
+	db.LogCapture("cap_s2", "wolf", "note", "Garden ideas: raised beds", "Ideas", "filed", 0.9)
+	db.LogCapture("cap_s3", "wife", "note", "Exercise class on Thursday", "Life", "filed", 0.9)
+	if err := db.IndexSearchDoc(SearchDoc{DocID: "note_1", Kind: DocNote, Actor: "wolf", Category: "Health", Title: "Exercise plan", Body: "Three rides a week", Created: time.Now()}); err != nil {
+		t.Fatalf("indexing note: %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		query SearchQuery
+		want  []string
+	}{
+		{"title match ranks first", SearchQuery{Text: "exercise", Actor: "wolf"}, []string{"note_1", "cap_s1"}},
+		{"prefix on last word", SearchQuery{Text: "exer", Actor: "wolf"}, []string{"note_1", "cap_s1"}},
+		{"actor scoped", SearchQuery{Text: "exercise", Actor: "wife"}, []string{"cap_s3"}},
+		{"kind filter", SearchQuery{Text: "exercise", Actor: "wolf", Kind: DocCapture}, []string{"cap_s1"}},
+		{"category filter", SearchQuery{Text: "raised", Category: "ideas"}, []string{"cap_s2"}},
+		{"excluded category", SearchQuery{Text: "exercise", Actor: "wolf", Exclude: []string{"health"}}, nil},
+		{"operators are literal", SearchQuery{Text: "OR NOT", Actor: "wolf"}, nil},
+		{"any term", SearchQuery{Text: "raised bike cardio", AnyTerm: true, Actor: "wolf"}, []string{"cap_s1", "cap_s2"}},
+		{"empty query", SearchQuery{Text: "  ", Actor: "wolf"}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hits, err := db.Search(tt.query)
+			if err != nil {
+				t.Fatalf("search: %v", err)
+			}
+			var got []string
+			for _, h := range hits {
+				got = append(got, h.DocID)
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("Search(%+v) = %v, want %v", tt.query, got, tt.want)
+			}
+		})
+	}
+
+	// Re-indexing replaces rather than duplicates
+	db.IndexSearchDoc(SearchDoc{DocID: "note_1", Kind: DocNote, Actor: "wolf", Title: "Cycling plan", Created: time.Now()})
+	if n, _ := db.CountSearchDocs(DocNote); n != 1 {
+		t.Errorf("expected 1 note after re-index, got %d", n)
+	}
+}
+
+func TestPostponedJobs(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	if err := db.PostponeJob("idea_expand", "cap_1", "wolf", `{"title":"a"}`); err != nil {
+		t.Fatalf("PostponeJob: %v", err)
+	}
+	db.PostponeJob("narrate", "journal", "", "{}")
+	db.PostponeJob("narrate", "journal", "", "{}") // stored once
+
+	count, err := db.CountPostponedJobs()
+	if err != nil {
+		t.Fatalf("CountPostponedJobs: %v", err)
+	}
+	if count != 2 {
+		t.Errorf("count = %d, want 2", count)
+	}
+
+	jobs, err := db.GetPostponedJobs(10)
+	if err != nil {
+		t.Fatalf("GetPostponedJobs: %v", err)
+	}
+	if len(jobs) != 2 || jobs[0].RefID != "cap_1" || jobs[0].Actor != "wolf" || jobs[0].Payload != `{"title":"a"}` {
+		t.Fatalf("jobs = %+v, want the idea first", jobs)
+	}
+
+	if err := db.DeletePostponedJob(jobs[0].ID); err != nil {
+		t.Fatalf("DeletePostponedJob: %v", err)
+	}
+	if count, _ := db.CountPostponedJobs(); count != 1 {
+		t.Errorf("count after delete = %d, want 1", count)
+	}
+}
+
+func TestUsersAndTokens(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	if _, err := db.CreateUser("kid", "Kid"); err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	if _, err := db.CreateUser("kid", "Again"); err != ErrUserExists {
+		t.Errorf("duplicate CreateUser error = %v, want ErrUserExists", err)
+	}
+	if _, err := db.CreateUser("Not Valid", ""); err == nil {
+		t.Error("CreateUser accepted an invalid ID")
+	}
+	if err := db.EnsureUserToken("wolf", "bootstrap", "wolf_secret"); err != nil {
+		t.Fatalf("EnsureUserToken: %v", err)
+	}
+	if err := db.EnsureUserToken("wolf", "bootstrap", "wolf_secret"); err != nil {
+		t.Fatalf("EnsureUserToken again: %v", err)
+	}
+	if err := db.EnsureUserToken("kid", "bootstrap", "wolf_secret"); err == nil {
+		t.Error("EnsureUserToken registered another user's token")
+	}
+
+	phone, stored, err := db.CreateAPIToken("kid", "phone", "", []string{ScopeCaptureWrite})
+	if err != nil {
+		t.Fatalf("CreateAPIToken: %v", err)
+	}
+	if !strings.HasPrefix(phone, "brn_") || stored.Label != "phone" {
+		t.Errorf("CreateAPIToken = %q, %+v", phone, stored)
+	}
+	if _, _, err := db.CreateAPIToken("nobody", "phone", "", nil); err != ErrUserNotFound {
+		t.Errorf("CreateAPIToken for unknown user error = %v, want ErrUserNotFound", err)
+	}
+
+	// Valid tokens resolve to their user and record their use
+	tok, err := db.AuthenticateToken(phone)
+	if err != nil || tok == nil || tok.UserID != "kid" || tok.LastUsedAt == nil {
+		t.Fatalf("AuthenticateToken = %+v, %v; want kid's token, used", tok, err)
+	}
+	for _, bad := range []string{"", "brn_nope", HashToken(phone)} {
+		if tok, _ := db.AuthenticateToken(bad); tok != nil {
+			t.Errorf("AuthenticateToken(%q) = %+v, want nil", bad, tok)
+		}
+	}
+
+	// Only the hash is stored
+	var hashes int
+	db.conn.QueryRow(`SELECT COUNT(*) FROM api_tokens WHERE token_hash = ?`, phone).Scan(&hashes)
+	if hashes != 0 {
+		t.Error("token stored in plain text")
+	}
+
+	// Revocation is per token and per user
+	laptop, _, _ := db.CreateAPIToken("kid", "laptop", "", []string{ScopeCaptureWrite})
+	if ok, _ := db.RevokeAPIToken("wolf", stored.ID); ok {
+		t.Error("revoked kid's token as wolf")
+	}
+	if ok, err := db.RevokeAPIToken("kid", stored.ID); !ok || err != nil {
+		t.Fatalf("RevokeAPIToken = %v, %v", ok, err)
+	}
+	if tok, _ := db.AuthenticateToken(phone); tok != nil {
+		t.Error("revoked token still authenticates")
+	}
+	if tok, _ := db.AuthenticateToken(laptop); tok == nil {
+		t.Error("revoking one token revoked the other")
+	}
+	tokens, _ := db.GetAPITokens("kid")
+	if len(tokens) != 2 || tokens[0].RevokedAt == nil || tokens[1].RevokedAt != nil {
+		t.Errorf("GetAPITokens = %+v", tokens)
+	}
+
+	// Disabled users drop out of the active list and can't authenticate
+	if ids, _ := db.GetActiveUserIDs(); strings.Join(ids, ",") != "kid,wolf" {
+		t.Errorf("active users = %v, want [kid wolf]", ids)
+	}
+	if ok, err := db.DisableUser("kid"); !ok || err != nil {
+		t.Fatalf("DisableUser = %v, %v", ok, err)
+	}
+	if ok, _ := db.DisableUser("kid"); ok {
+		t.Error("disabled kid twice")
+	}
+	if tok, _ := db.AuthenticateToken(laptop); tok != nil {
+		t.Error("disabled user's token still authenticates")
+	}
+	if ids, _ := db.GetActiveUserIDs(); strings.Join(ids, ",") != "wolf" {
+		t.Errorf("active users = %v, want [wolf]", ids)
+	}
+	users, _ := db.GetUsers()
+	if len(users) != 2 || users[0].DisabledAt == nil {
+		t.Errorf("GetUsers = %+v, want both users with kid disabled", users)
+	}
+}
+
+func TestTokenScopesAndDevices(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	if err := db.EnsureUserToken("wolf", "bootstrap", "wolf_secret"); err != nil {
+		t.Fatalf("EnsureUserToken: %v", err)
+	}
+	if tok, _ := db.AuthenticateToken("wolf_secret"); tok == nil || len(tok.Scopes) != len(AllScopes) || tok.DeviceID != "" {
+		t.Errorf("bootstrap token = %+v, want every scope and no device", tok)
+	}
+
+	if _, _, err := db.CreateAPIToken("wolf", "phone", "pixel", []string{"capture:everything"}); err == nil {
+		t.Error("CreateAPIToken accepted an unknown scope")
+	}
+	phone, _, err := db.CreateAPIToken("wolf", "phone", "pixel", []string{ScopeCaptureWrite, ScopeLettersRead})
+	if err != nil {
+		t.Fatalf("CreateAPIToken: %v", err)
+	}
+	watch, _, _ := db.CreateAPIToken("wolf", "watch", "pixel", []string{ScopeCaptureWrite})
+	laptop, _, _ := db.CreateAPIToken("wolf", "laptop", "thinkpad", []string{ScopeAdmin})
+
+	tok, err := db.AuthenticateToken(phone)
+	if err != nil || tok == nil {
+		t.Fatalf("AuthenticateToken = %+v, %v", tok, err)
+	}
+	if tok.DeviceID != "pixel" || !tok.HasScope(ScopeLettersRead) || tok.HasScope(ScopeAdmin) {
+		t.Errorf("phone token = %+v, want pixel with capture:write and letters:read", tok)
+	}
+
+	// Revoking a device revokes all of its tokens and nothing else
+	if n, _ := db.RevokeDeviceTokens("kid", "pixel"); n != 0 {
+		t.Errorf("revoked %d of wolf's tokens as kid", n)
+	}
+	if n, err := db.RevokeDeviceTokens("wolf", "pixel"); n != 2 || err != nil {
+		t.Fatalf("RevokeDeviceTokens = %d, %v; want 2", n, err)
+	}
+	for _, revoked := range []string{phone, watch} {
+		if tok, _ := db.AuthenticateToken(revoked); tok != nil {
+			t.Errorf("token %s still authenticates after its device was revoked", tok.Label)
+		}
+	}
+	for _, kept := range []string{laptop, "wolf_secret"} {
+		if tok, _ := db.AuthenticateToken(kept); tok == nil {
+			t.Error("revoking a device revoked a token for another device")
+		}
+	}
+	if n, _ := db.RevokeDeviceTokens("wolf", ""); n != 0 {
+		t.Errorf("revoking the empty device revoked %d unbound tokens", n)
+	}
+}
+
+func TestMigrateTokenScopes(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	// An api_tokens table from before devices and scopes
+	for _, stmt := range []string{
+		`DROP TABLE api_tokens`,
+		`CREATE TABLE api_tokens (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			user_id TEXT NOT NULL REFERENCES users(id),
+			token_hash TEXT NOT NULL UNIQUE,
+			label TEXT NOT NULL DEFAULT '',
+			created_at TEXT NOT NULL,
+			last_used_at TEXT,
+			revoked_at TEXT
+		)`,
+		`INSERT INTO users (id, name, created_at) VALUES ('wolf', '', '2024-01-15T00:00:00Z')`,
+		`INSERT INTO api_tokens (user_id, token_hash, created_at) VALUES ('wolf', '` + HashToken("old_token") + `', '2024-01-15T00:00:00Z')`,
+	} {
+		if _, err := db.conn.Exec(stmt); err != nil {
+			t.Fatalf("setting up old table: %v", err)
+		}
+	}
+
+	if err := db.migrateTokenScopes(); err != nil {
+		t.Fatalf("migrateTokenScopes: %v", err)
+	}
+	if err := db.migrateTokenScopes(); err != nil {
+		t.Fatalf("migrateTokenScopes again: %v", err)
+	}
+
+	tok, err := db.AuthenticateToken("old_token")
+	if err != nil || tok == nil {
+		t.Fatalf("AuthenticateToken = %+v, %v", tok, err)
+	}
+	if len(tok.Scopes) != len(AllScopes) || tok.DeviceID != "" {
+		t.Errorf("migrated token = %+v, want every scope and no device", tok)
+	}
+}
+
+func TestIdentitiesAndSessions(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	const issuer = "https://id.example.com"
+	db.CreateUser("wolf", "")
+	db.CreateUser("kid", "")
+
+	if _, err := db.LinkIdentity("nobody", issuer, "sub-1", "", []string{ScopeCaptureWrite}); err != ErrUserNotFound {
+		t.Errorf("LinkIdentity for unknown user error = %v, want ErrUserNotFound", err)
+	}
+	bySubject, err := db.LinkIdentity("wolf", issuer, "sub-wolf", "", []string{ScopeCaptureWrite, ScopeNotesRead})
+	if err != nil {
+		t.Fatalf("LinkIdentity: %v", err)
+	}
+	if _, err := db.LinkIdentity("kid", issuer, "", "Kid@Example.com", []string{ScopeCaptureWrite}); err != nil {
+		t.Fatalf("LinkIdentity by email: %v", err)
+	}
+	if _, err := db.LinkIdentity("wolf", issuer, "", "kid@example.com", nil); err != ErrIdentityExists {
+		t.Errorf("duplicate email link error = %v, want ErrIdentityExists", err)
+	}
+
+	// Email links need a verified email and are bound to the subject on first login
+	if id, _ := db.ResolveIdentity(issuer, "sub-kid", ""); id != nil {
+		t.Errorf("resolved an email link without a verified email: %+v", id)
+	}
+	kid, err := db.ResolveIdentity(issuer, "sub-kid", "kid@example.com")
+	if err != nil || kid == nil || kid.UserID != "kid" || kid.Subject != "sub-kid" {
+		t.Fatalf("ResolveIdentity by email = %+v, %v", kid, err)
+	}
+	if id, _ := db.ResolveIdentity(issuer, "sub-other", "kid@example.com"); id != nil {
+		t.Errorf("another subject with the same email resolved to %+v", id)
+	}
+	if id, _ := db.ResolveIdentity("https://other.example.com", "sub-wolf", ""); id != nil {
+		t.Errorf("subject from another issuer resolved to %+v", id)
+	}
+
+	// App sessions: access token plus a single-use refresh token
+	access, refresh, session, err := db.CreateSession(bySubject, SessionApp, time.Hour, 24*time.Hour)
+	if err != nil || !strings.HasPrefix(access, "brs_") || !strings.HasPrefix(refresh, "brr_") {
+		t.Fatalf("CreateSession = %q, %q, %v", access, refresh, err)
+	}
+	got, err := db.AuthenticateSession(access)
+	if err != nil || got == nil || got.ID != session.ID || got.UserID != "wolf" || !got.Token().HasScope(ScopeNotesRead) {
+		t.Fatalf("AuthenticateSession = %+v, %v", got, err)
+	}
+	if got, _ := db.AuthenticateSession(refresh); got != nil {
+		t.Error("refresh token authenticated as an access token")
+	}
+
+	newAccess, newRefresh, refreshed, err := db.RefreshSession(refresh, time.Hour, 24*time.Hour)
+	if err != nil || refreshed == nil || refreshed.ID != session.ID {
+		t.Fatalf("RefreshSession = %+v, %v", refreshed, err)
+	}
+	if _, _, again, _ := db.RefreshSession(refresh, time.Hour, 24*time.Hour); again != nil {
+		t.Error("refresh token worked twice")
+	}
+	if got, _ := db.AuthenticateSession(access); got != nil {
+		t.Error("old access token still works after refresh")
+	}
+	if got, _ := db.AuthenticateSession(newAccess); got == nil {
+		t.Error("new access token does not work")
+	}
+
+	// Expired and revoked sessions stop working
+	expired, _, _, _ := db.CreateSession(kid, SessionBrowser, -time.Minute, 0)
+	if got, _ := db.AuthenticateSession(expired); got != nil {
+		t.Error("expired session authenticated")
+	}
+	if err := db.RevokeSession(session.ID); err != nil {
+		t.Fatalf("RevokeSession: %v", err)
+	}
+	if got, _ := db.AuthenticateSession(newAccess); got != nil {
+		t.Error("revoked session authenticated")
+	}
+	if _, _, got, _ := db.RefreshSession(newRefresh, time.Hour, time.Hour); got != nil {
+		t.Error("revoked session refreshed")
+	}
+
+	// Unlinking an identity ends its sessions; disabled users can't log in
+	browser, _, _, _ := db.CreateSession(kid, SessionBrowser, time.Hour, 0)
+	if ok, err := db.UnlinkIdentity("kid", kid.ID); !ok || err != nil {
+		t.Fatalf("UnlinkIdentity = %v, %v", ok, err)
+	}
+	if got, _ := db.AuthenticateSession(browser); got != nil {
+		t.Error("session survived unlinking its identity")
+	}
+	db.DisableUser("wolf")
+	if id, _ := db.ResolveIdentity(issuer, "sub-wolf", ""); id != nil {
+		t.Errorf("disabled user's identity resolved to %+v", id)
+	}
+}
+
+func TestAuditLog(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	now := time.Now().UTC().Truncate(time.Second)
+	entries := []AuditEntry{
+		{TS: now.AddDate(0, 0, -400), Actor: "wolf", Method: "POST", Route: "/api/v1/capture", Targets: []string{"cap_old"}, Status: 200},
+		{TS: now.Add(-time.Hour), Actor: "wolf", DeviceID: "pixel", Method: "POST", Route: "/api/v1/capture", Targets: []string{"cap_1"}, Status: 200, IP: "10.0.0.2"},
+		{TS: now.Add(-time.Minute), Actor: "wife", Method: "POST", Route: "/api/v1/clarify", Targets: []string{"cap_1"}, Status: 410},
+		{TS: now, Actor: "wife", Method: "POST", Route: "/api/v1/test/daily", Status: 403},
+	}
+	for _, e := range entries {
+		e.Outcome = AuditOutcome(e.Status)
+		if err := db.LogAudit(e); err != nil {
+			t.Fatalf("logging audit entry: %v", err)
+		}
+	}
+
+	since := now.Add(-2 * time.Hour)
+	tests := []struct {
+		name  string
+		query AuditQuery
+		want  []string // routes, newest first
+	}{
+		{"all", AuditQuery{}, []string{"/api/v1/test/daily", "/api/v1/clarify", "/api/v1/capture", "/api/v1/capture"}},
+		{"actor", AuditQuery{Actor: "wife"}, []string{"/api/v1/test/daily", "/api/v1/clarify"}},
+		{"route", AuditQuery{Route: "/api/v1/clarify"}, []string{"/api/v1/clarify"}},
+		{"target", AuditQuery{Target: "cap_1"}, []string{"/api/v1/clarify", "/api/v1/capture"}},
+		{"target is a whole ID", AuditQuery{Target: "cap"}, nil},
+		{"wildcards are literal", AuditQuery{Target: "cap_%"}, nil},
+		{"since", AuditQuery{Since: &since}, []string{"/api/v1/test/daily", "/api/v1/clarify", "/api/v1/capture"}},
+		{"until", AuditQuery{Until: &since}, []string{"/api/v1/capture"}},
+		{"limit", AuditQuery{Limit: 1}, []string{"/api/v1/test/daily"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := db.QueryAudit(tt.query)
+			if err != nil {
+				t.Fatalf("querying: %v", err)
+			}
+			var routes []string
+			for _, e := range got {
+				routes = append(routes, e.Route)
+			}
+			if strings.Join(routes, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("routes = %v, want %v", routes, tt.want)
+			}
+		})
+	}
+
+	got, _ := db.QueryAudit(AuditQuery{Target: "cap_1", Route: "/api/v1/capture"})
+	if len(got) != 1 || got[0].DeviceID != "pixel" || got[0].IP != "10.0.0.2" || got[0].Outcome != AuditOK || !got[0].TS.Equal(now.Add(-time.Hour)) {
+		t.Errorf("capture entry = %+v", got)
+	}
+	if got, _ := db.QueryAudit(AuditQuery{Route: "/api/v1/test/daily"}); len(got) != 1 || got[0].Outcome != AuditDenied {
+		t.Errorf("denied entry = %+v", got)
+	}
+
+	// Entries can't be rewritten
+	if _, err := db.conn.Exec(`UPDATE audit_log SET actor = 'someone'`); err == nil {
+		t.Error("updating the audit log succeeded")
+	}
+
+	pruned, err := db.PruneAudit(now.AddDate(0, 0, -365))
+	if err != nil {
+		t.Fatalf("pruning: %v", err)
+	}
+	if pruned != 1 {
+		t.Errorf("pruned %d entries, want 1", pruned)
+	}
+	if got, _ := db.QueryAudit(AuditQuery{Target: "cap_old"}); len(got) != 0 {
+		t.Errorf("old entry survived pruning: %+v", got)
+	}
+}
+
+func TestSharing(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	for _, id := range []string{"wolf", "wife", "kid"} {
+		if _, err := db.CreateUser(id, id); err != nil {
+			t.Fatalf("CreateUser(%s): %v", id, err)
+		}
+	}
+	db.LogCapture("cap_private", "wolf", "note", "Garden shed secret budget", "Ideas", "filed", 0.9)
+	db.LogCapture("cap_house", "wolf", "note", "Garden party on Saturday", "Life", "filed", 0.9)
+	db.LogCapture("cap_wife", "wolf", "note", "Garden anniversary surprise", "Ideas", "filed", 0.9)
+	db.LogCapture("cap_kid", "kid", "note", "Garden treehouse plans", "Projects", "filed", 0.9)
+
+	if err := db.SetSharing("cap_house", "wolf", Sharing{Visibility: VisibilityHousehold}); err != nil {
+		t.Fatalf("SetSharing household: %v", err)
+	}
+	if err := db.SetSharing("cap_wife", "wolf", Sharing{With: []string{"wife", "wolf", "wife"}}); err != nil {
+		t.Fatalf("SetSharing actors: %v", err)
+	}
+	if err := db.SetSharing("cap_private", "wolf", Sharing{Visibility: VisibilityPrivate}); err != nil {
+		t.Fatalf("SetSharing private: %v", err)
+	}
+	if err := db.SetSharing("cap_kid", "kid", Sharing{With: []string{"nobody"}}); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("SetSharing with an unknown user: err = %v, want ErrUserNotFound", err)
+	}
+	if err := db.SetSharing("cap_kid", "kid", Sharing{Visibility: "public"}); err == nil {
+		t.Error("SetSharing accepted an unknown visibility")
+	}
+	// Only the owner's sharing applies
+	db.SetSharing("cap_private", "wife", Sharing{Visibility: VisibilityHousehold})
+
+	share, err := db.GetSharing("cap_wife")
+	if err != nil || share == nil {
+		t.Fatalf("GetSharing: %v, %v", share, err)
+	}
+	if share.Visibility != VisibilityActors || strings.Join(share.With, ",") != "wife" {
+		t.Errorf("GetSharing = %+v, want actors with wife", share)
+	}
+
+	tests := []struct {
+		reader string
+		want   string // visible captures, by search
+	}{
+		{"wolf", "cap_private,cap_house,cap_wife"},
+		{"wife", "cap_house,cap_wife"},
+		{"kid", "cap_house,cap_kid"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.reader, func(t *testing.T) {
+			hits, err := db.Search(SearchQuery{Text: "garden", Reader: tt.reader, Kind: DocCapture})
+			if err != nil {
+				t.Fatalf("search: %v", err)
+			}
+			var got []string
+			for _, h := range hits {
+				got = append(got, h.DocID)
+			}
+			sort.Strings(got)
+			want := strings.Split(tt.want, ",")
+			sort.Strings(want)
+			if strings.Join(got, ",") != strings.Join(want, ",") {
+				t.Errorf("search as %s = %v, want %v", tt.reader, got, want)
+			}
+
+			for _, id := range []string{"cap_private", "cap_house", "cap_wife"} {
+				visible, err := db.VisibleTo(tt.reader, "wolf", id)
+				if err != nil {
+					t.Fatalf("VisibleTo: %v", err)
+				}
+				if visible != strings.Contains(tt.want, id) {
+					t.Errorf("VisibleTo(%s, %s) = %v", tt.reader, id, visible)
+				}
+			}
+		})
+	}
+
+	shared, err := db.GetSharedCaptures("wife", time.Now().Add(-time.Hour))
+	if err != nil {
+		t.Fatalf("GetSharedCaptures: %v", err)
+	}
+	for _, c := range shared {
+		if c.CaptureID == "cap_private" {
+			t.Error("private capture shared with wife")
+		}
+	}
+	if len(shared) != 2 {
+		t.Errorf("GetSharedCaptures(wife) = %d captures, want 2", len(shared))
+	}
+
+	// since is compared in UTC whatever its zone
+	for _, since := range []struct {
+		name string
+		at   time.Time
+		want int
+	}{
+		{"an hour ago east of UTC", time.Now().Add(-time.Hour).In(time.FixedZone("UTC+5", 5*3600)), 2},
+		{"in an hour west of UTC", time.Now().Add(time.Hour).In(time.FixedZone("UTC-5", -5*3600)), 0},
+	} {
+		if shared, err := db.GetSharedCaptures("wife", since.at); err != nil || len(shared) != since.want {
+			t.Errorf("GetSharedCaptures(wife) since %s = %d captures, %v; want %d", since.name, len(shared), err, since.want)
+		}
+	}
+
+	if _, err := db.AddComment("cap_house", "wife", "I'll bring the cake"); err != nil {
+		t.Fatalf("AddComment: %v", err)
+	}
+	db.AddComment("cap_house", "wolf", "Perfect")
+	comments, err := db.GetComments("cap_house")
+	if err != nil {
+		t.Fatalf("GetComments: %v", err)
+	}
+	if len(comments) != 2 || comments[0].Actor != "wife" || comments[1].Text != "Perfect" {
+		t.Errorf("GetComments = %+v", comments)
+	}
+}
+
+func TestParseSharingRules(t *testing.T) {
+	tests := []struct {
+		in       string
+		category string
+		want     string
+		wantErr  bool
+	}{
+		{"", "Ideas", "private", false},
+		{"Ideas=household", "ideas", "household", false},
+		{"Ideas=household, Projects=wife+kid", "Projects", "actors wife,kid", false},
+		{"Health=private", "Health", "private", false},
+		{"Ideas", "", "", true},
+		{"Ideas=Wife", "", "", true},
+		{"=household", "", "", true},
+	}
+	for _, tt := range tests {
+		rules, err := ParseSharingRules(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseSharingRules(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		s := rules.For(tt.category)
+		got := s.Visibility
+		if len(s.With) > 0 {
+			got += " " + strings.Join(s.With, ",")
+		}
+		if got != tt.want {
+			t.Errorf("ParseSharingRules(%q).For(%s) = %q, want %q", tt.in, tt.category, got, tt.want)
+		}
+	}
+}
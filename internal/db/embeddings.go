@@ -0,0 +1,172 @@
+package db
+
+import (
+	"database/sql"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+// Embedding is a stored document vector with enough metadata to render a result
+type Embedding struct {
+	DocID    string
+	Kind     string
+	Actor    string
+	Category string
+	Title    string
+	Path     string
+	Created  time.Time
+	Model    string
+	Vector   []float32
+}
+
+// SaveEmbedding adds or replaces the embedding for a document; documents in
+// unindexed folders are skipped
+func (db *DB) SaveEmbedding(e Embedding) error {
+	if db.Unindexed(e.Category, e.Path) {
+		return nil
+	}
+	_, err := db.conn.Exec(`
+		INSERT INTO embeddings (doc_id, kind, actor, category, title, path, created, model, dims, vector, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(doc_id, kind) DO UPDATE SET
+			actor = excluded.actor,
+			category = excluded.category,
+			title = excluded.title,
+			path = excluded.path,
+			created = excluded.created,
+			model = excluded.model,
+			dims = excluded.dims,
+			vector = excluded.vector,
+			updated_at = excluded.updated_at
+	`, e.DocID, e.Kind, e.Actor, e.Category, e.Title, e.Path, e.Created.UTC().Format(time.RFC3339),
+		e.Model, len(e.Vector), encodeVector(e.Vector), time.Now().UTC().Format(time.RFC3339))
+	return err
+}
+
+// GetEmbedding returns the embedding for a document, or nil if not found
+func (db *DB) GetEmbedding(docID, kind string) (*Embedding, error) {
+	row := db.conn.QueryRow(`
+		SELECT doc_id, kind, actor, category, title, path, created, model, vector
+		FROM embeddings WHERE doc_id = ? AND kind = ?
+	`, docID, kind)
+	e, err := scanEmbedding(row)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return e, err
+}
+
+// GetEmbeddings returns all embeddings for an actor ("" for all) made with a model,
+// optionally restricted to some kinds
+func (db *DB) GetEmbeddings(actor, model string, kinds ...string) ([]Embedding, error) {
+	if actor == "" {
+		return db.queryEmbeddings(model, "", nil, kinds)
+	}
+	return db.queryEmbeddings(model, ` AND actor = ?`, []interface{}{actor}, kinds)
+}
+
+// GetVisibleEmbeddings returns the embeddings made with a model of documents reader
+// owns or that were shared with them, optionally restricted to some kinds
+func (db *DB) GetVisibleEmbeddings(reader, model string, kinds ...string) ([]Embedding, error) {
+	clause, args := visibleClause("actor", "doc_id", reader)
+	return db.queryEmbeddings(model, ` AND `+clause, args, kinds)
+}
+
+func (db *DB) queryEmbeddings(model, filter string, filterArgs []interface{}, kinds []string) ([]Embedding, error) {
+	query := `SELECT doc_id, kind, actor, category, title, path, created, model, vector FROM embeddings WHERE model = ?` + filter
+	args := append([]interface{}{model}, filterArgs...)
+	if len(kinds) > 0 {
+		query += ` AND kind IN (?` + strings.Repeat(`, ?`, len(kinds)-1) + `)`
+		for _, k := range kinds {
+			args = append(args, k)
+		}
+	}
+
+	rows, err := db.conn.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var result []Embedding
+	for rows.Next() {
+		e, err := scanEmbedding(rows)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, *e)
+	}
+	return result, rows.Err()
+}
+
+// GetDocsToEmbed returns indexed documents with no embedding from the given model
+// (new documents, edited ones, and everything after a model change)
+func (db *DB) GetDocsToEmbed(model string, limit int) ([]SearchDoc, error) {
+	rows, err := db.conn.Query(`
+		SELECT s.doc_id, s.kind, s.actor, s.category, s.created, s.path, s.title, s.body
+		FROM search_docs s
+		WHERE trim(s.title || s.body, ' ' || char(9) || char(10) || char(13)) != ''
+		AND NOT EXISTS (
+			SELECT 1 FROM embeddings e WHERE e.doc_id = s.doc_id AND e.kind = s.kind AND e.model = ?
+		)
+		LIMIT ?
+	`, model, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var docs []SearchDoc
+	for rows.Next() {
+		var doc SearchDoc
+		var createdStr string
+		if err := rows.Scan(&doc.DocID, &doc.Kind, &doc.Actor, &doc.Category, &createdStr, &doc.Path, &doc.Title, &doc.Body); err != nil {
+			return nil, err
+		}
+		doc.Created, _ = time.Parse(time.RFC3339, createdStr)
+		docs = append(docs, doc)
+	}
+	return docs, rows.Err()
+}
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanEmbedding(row rowScanner) (*Embedding, error) {
+	var e Embedding
+	var createdStr string
+	var blob []byte
+	if err := row.Scan(&e.DocID, &e.Kind, &e.Actor, &e.Category, &e.Title, &e.Path, &createdStr, &e.Model, &blob); err != nil {
+		return nil, err
+	}
+	e.Created, _ = time.Parse(time.RFC3339, createdStr)
+	vector, err := decodeVector(blob)
+	if err != nil {
+		return nil, fmt.Errorf("decoding vector for %s: %w", e.DocID, err)
+	}
+	e.Vector = vector
+	return &e, nil
+}
+
+func encodeVector(v []float32) []byte {
+	buf := make([]byte, 4*len(v))
+	for i, f := range v {
+		binary.LittleEndian.PutUint32(buf[i*4:], math.Float32bits(f))
+	}
+	return buf
+}
+
+func decodeVector(b []byte) ([]float32, error) {
+	if len(b)%4 != 0 {
+		return nil, fmt.Errorf("vector blob length %d is not a multiple of 4", len(b))
+	}
+	v := make([]float32, len(b)/4)
+	for i := range v {
+		v[i] = math.Float32frombits(binary.LittleEndian.Uint32(b[i*4:]))
+	}
+	return v, nil
+}
@@ -0,0 +1,133 @@
+package db
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/mrwolf/brain-server/internal/llm"
+)
+
+// LLMCacheStats summarises cached responses for one task
+type LLMCacheStats struct {
+	Task    string `json:"task"`
+	Entries int    `json:"entries"`
+	Expired int    `json:"expired"` // still stored but no longer served
+	Hits    int    `json:"hits"`
+	Bytes   int64  `json:"bytes"`
+}
+
+// GetLLMCache returns an unexpired cached response and counts the hit (implements llm.Cache)
+func (db *DB) GetLLMCache(key string) (string, bool, error) {
+	now := time.Now().UTC().Format(time.RFC3339)
+	var response string
+	err := db.conn.QueryRow(`
+		SELECT response FROM llm_cache WHERE cache_key = ? AND expires_at > ?
+	`, key, now).Scan(&response)
+	if err == sql.ErrNoRows {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+
+	if response, err = db.openText(response); err != nil {
+		return "", false, err
+	}
+
+	_, err = db.conn.Exec(`UPDATE llm_cache SET hits = hits + 1, last_hit_at = ? WHERE cache_key = ?`, now, key)
+	return response, true, err
+}
+
+// PutLLMCache stores a response to actor's request, sealed for them, replacing any
+// earlier entry for the key (implements llm.Cache)
+func (db *DB) PutLLMCache(key, actor string, task llm.Task, model, response string, ttl time.Duration) error {
+	now := time.Now().UTC()
+	response, err := db.sealText(response, actor)
+	if err != nil {
+		return err
+	}
+	_, err = db.conn.Exec(`
+		INSERT INTO llm_cache (cache_key, actor, task, model, response, created_at, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(cache_key) DO UPDATE SET
+			actor = excluded.actor,
+			response = excluded.response,
+			created_at = excluded.created_at,
+			expires_at = excluded.expires_at,
+			hits = 0,
+			last_hit_at = NULL
+	`, key, actor, string(task), model, response, now.Format(time.RFC3339), now.Add(ttl).Format(time.RFC3339))
+	return err
+}
+
+// DeleteLLMCache removes one cached response (implements llm.Cache)
+func (db *DB) DeleteLLMCache(key string) error {
+	_, err := db.conn.Exec(`DELETE FROM llm_cache WHERE cache_key = ?`, key)
+	return err
+}
+
+// GetLLMCacheStats returns cache statistics per task, ordered by task name
+func (db *DB) GetLLMCacheStats() ([]LLMCacheStats, error) {
+	rows, err := db.conn.Query(`
+		SELECT task, COUNT(*), SUM(CASE WHEN expires_at <= ? THEN 1 ELSE 0 END), SUM(hits), SUM(length(response))
+		FROM llm_cache
+		GROUP BY task
+		ORDER BY task ASC
+	`, time.Now().UTC().Format(time.RFC3339))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var stats []LLMCacheStats
+	for rows.Next() {
+		var s LLMCacheStats
+		if err := rows.Scan(&s.Task, &s.Entries, &s.Expired, &s.Hits, &s.Bytes); err != nil {
+			return nil, err
+		}
+		stats = append(stats, s)
+	}
+	return stats, rows.Err()
+}
+
+// PurgeLLMCache deletes cached responses for a task ("" for all tasks), optionally only expired ones.
+// Returns the number of entries removed.
+func (db *DB) PurgeLLMCache(task string, expiredOnly bool) (int64, error) {
+	query := `DELETE FROM llm_cache WHERE 1 = 1`
+	var args []interface{}
+	if task != "" {
+		query += ` AND task = ?`
+		args = append(args, task)
+	}
+	if expiredOnly {
+		query += ` AND expires_at <= ?`
+		args = append(args, time.Now().UTC().Format(time.RFC3339))
+	}
+	res, err := db.conn.Exec(query, args...)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// migrateLLMCacheActor adds the actor column to caches created before it existed.
+// Their entries cannot be told apart by user, so they are dropped.
+func (db *DB) migrateLLMCacheActor() error {
+	var existing string
+	if err := db.conn.QueryRow(`SELECT sql FROM sqlite_master WHERE type = 'table' AND name = 'llm_cache'`).Scan(&existing); err != nil {
+		return err
+	}
+	if strings.Contains(existing, "actor") {
+		return nil
+	}
+	for _, stmt := range []string{
+		`DELETE FROM llm_cache`,
+		`ALTER TABLE llm_cache ADD COLUMN actor TEXT NOT NULL DEFAULT ''`,
+	} {
+		if _, err := db.conn.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,129 @@
+package db
+
+import (
+	"database/sql"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/mrwolf/brain-server/internal/llm"
+)
+
+// LLMTaskStats summarises the calls for one task
+type LLMTaskStats struct {
+	Task            string   `json:"task"`
+	Calls           int      `json:"calls"`
+	Failures        int      `json:"failures"`
+	FailureRate     float64  `json:"failure_rate"`
+	Retries         int      `json:"retries"` // attempts beyond the first
+	P50Ms           int64    `json:"p50_ms"`
+	P95Ms           int64    `json:"p95_ms"`
+	AvgPromptTokens float64  `json:"avg_prompt_tokens"` // successful calls only
+	AvgEvalTokens   float64  `json:"avg_eval_tokens"`
+	Models          []string `json:"models"`
+	LastError       string   `json:"last_error,omitempty"`
+}
+
+// RecordLLMCall adds a call to the ledger (implements llm.Recorder)
+func (db *DB) RecordLLMCall(rec llm.CallRecord) error {
+	var errText sql.NullString
+	if rec.Error != "" {
+		errText = sql.NullString{String: rec.Error, Valid: true}
+	}
+	_, err := db.conn.Exec(`
+		INSERT INTO llm_calls (task, provider, model, prompt_hash, started_at, duration_ms, attempts, error,
+			prompt_eval_count, eval_count, total_duration_ms, load_duration_ms, prompt_eval_duration_ms, eval_duration_ms)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, string(rec.Task), rec.Provider, rec.Model, rec.PromptHash, rec.StartedAt.UTC().Format(time.RFC3339),
+		rec.Duration.Milliseconds(), rec.Attempts, errText,
+		rec.PromptEvalCount, rec.EvalCount, rec.TotalDuration.Milliseconds(), rec.LoadDuration.Milliseconds(),
+		rec.PromptDuration.Milliseconds(), rec.EvalDuration.Milliseconds())
+	return err
+}
+
+// GetLLMStats returns per-task latency and failure statistics for calls started since the given time,
+// ordered by task name. Percentiles are over wall time including retries.
+func (db *DB) GetLLMStats(since time.Time) ([]LLMTaskStats, error) {
+	rows, err := db.conn.Query(`
+		SELECT task, model, duration_ms, attempts, error, prompt_eval_count, eval_count
+		FROM llm_calls
+		WHERE started_at >= ?
+		ORDER BY id ASC
+	`, since.UTC().Format(time.RFC3339))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	type taskCalls struct {
+		stats     LLMTaskStats
+		durations []int64
+		models    map[string]bool
+		tokens    [2]int // prompt, eval over successful calls
+	}
+	byTask := make(map[string]*taskCalls)
+
+	for rows.Next() {
+		var task, model string
+		var durationMs int64
+		var attempts, promptTokens, evalTokens int
+		var errText sql.NullString
+		if err := rows.Scan(&task, &model, &durationMs, &attempts, &errText, &promptTokens, &evalTokens); err != nil {
+			return nil, err
+		}
+
+		tc, ok := byTask[task]
+		if !ok {
+			tc = &taskCalls{stats: LLMTaskStats{Task: task}, models: make(map[string]bool)}
+			byTask[task] = tc
+		}
+		tc.stats.Calls++
+		tc.durations = append(tc.durations, durationMs)
+		tc.models[model] = true
+		if attempts > 1 {
+			tc.stats.Retries += attempts - 1
+		}
+		if errText.Valid {
+			tc.stats.Failures++
+			tc.stats.LastError = errText.String
+		} else {
+			tc.tokens[0] += promptTokens
+			tc.tokens[1] += evalTokens
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var stats []LLMTaskStats
+	for _, tc := range byTask {
+		s := tc.stats
+		s.FailureRate = float64(s.Failures) / float64(s.Calls)
+		sort.Slice(tc.durations, func(i, j int) bool { return tc.durations[i] < tc.durations[j] })
+		s.P50Ms = percentile(tc.durations, 0.50)
+		s.P95Ms = percentile(tc.durations, 0.95)
+		if ok := s.Calls - s.Failures; ok > 0 {
+			s.AvgPromptTokens = float64(tc.tokens[0]) / float64(ok)
+			s.AvgEvalTokens = float64(tc.tokens[1]) / float64(ok)
+		}
+		for model := range tc.models {
+			s.Models = append(s.Models, model)
+		}
+		sort.Strings(s.Models)
+		stats = append(stats, s)
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Task < stats[j].Task })
+	return stats, nil
+}
+
+// percentile returns the nearest-rank percentile of sorted values
+func percentile(sorted []int64, p float64) int64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(p*float64(len(sorted)))) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	return sorted[rank]
+}
@@ -0,0 +1,144 @@
+package db
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+)
+
+// Medication is a scheduled medication or supplement for an actor
+type Medication struct {
+	MedID     string
+	Actor     string
+	Name      string
+	Dose      string
+	Times     []string // "HH:MM" slots in the server timezone
+	Active    bool
+	CreatedAt time.Time
+}
+
+// MedicationDose records a taken or missed dose for a scheduled slot
+type MedicationDose struct {
+	MedID        string
+	Actor        string
+	ScheduledFor time.Time
+	Status       string // "taken" or "missed"
+	CaptureID    string
+	RecordedAt   time.Time
+}
+
+// Dose status constants
+const (
+	DoseTaken  = "taken"
+	DoseMissed = "missed"
+)
+
+// AddMedication adds a medication schedule for an actor
+func (db *DB) AddMedication(medID, actor, name, dose string, times []string) error {
+	timesJSON, err := json.Marshal(times)
+	if err != nil {
+		return err
+	}
+	_, err = db.conn.Exec(`
+		INSERT INTO medications (med_id, actor, name, dose, times, active, created_at)
+		VALUES (?, ?, ?, ?, ?, 1, ?)
+	`, medID, actor, name, dose, string(timesJSON), time.Now().UTC().Format(time.RFC3339))
+	return err
+}
+
+// DeactivateMedication stops tracking a medication without deleting its history
+func (db *DB) DeactivateMedication(actor, medID string) (bool, error) {
+	result, err := db.conn.Exec(`
+		UPDATE medications SET active = 0 WHERE med_id = ? AND actor = ? AND active = 1
+	`, medID, actor)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	return affected > 0, err
+}
+
+// GetMedications returns active medications for an actor
+// An empty actor returns active medications for everyone (used by the scheduler)
+func (db *DB) GetMedications(actor string) ([]Medication, error) {
+	query := `SELECT med_id, actor, name, dose, times, active, created_at FROM medications WHERE active = 1`
+	var args []interface{}
+	if actor != "" {
+		query += ` AND actor = ?`
+		args = append(args, actor)
+	}
+	query += ` ORDER BY created_at ASC`
+
+	rows, err := db.conn.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var meds []Medication
+	for rows.Next() {
+		var m Medication
+		var dose sql.NullString
+		var timesJSON, createdStr string
+		var active int
+		if err := rows.Scan(&m.MedID, &m.Actor, &m.Name, &dose, &timesJSON, &active, &createdStr); err != nil {
+			return nil, err
+		}
+		m.Dose = dose.String
+		m.Active = active == 1
+		json.Unmarshal([]byte(timesJSON), &m.Times)
+		m.CreatedAt, _ = time.Parse(time.RFC3339, createdStr)
+		meds = append(meds, m)
+	}
+	return meds, rows.Err()
+}
+
+// RecordDose stores a dose event for a slot
+// A "taken" record overrides an earlier "missed" one; duplicates are otherwise ignored.
+// Returns true if a row was inserted or updated.
+func (db *DB) RecordDose(dose MedicationDose) (bool, error) {
+	result, err := db.conn.Exec(`
+		INSERT INTO medication_doses (med_id, actor, scheduled_for, status, capture_id, recorded_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT(med_id, scheduled_for) DO UPDATE SET
+			status = excluded.status,
+			capture_id = excluded.capture_id,
+			recorded_at = excluded.recorded_at
+		WHERE medication_doses.status = 'missed' AND excluded.status = 'taken'
+	`, dose.MedID, dose.Actor, dose.ScheduledFor.UTC().Format(time.RFC3339), dose.Status, dose.CaptureID,
+		time.Now().UTC().Format(time.RFC3339))
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	return affected > 0, err
+}
+
+// GetDoses returns dose events for an actor with slots in [since, until)
+func (db *DB) GetDoses(actor string, since, until time.Time) ([]MedicationDose, error) {
+	rows, err := db.conn.Query(`
+		SELECT med_id, actor, scheduled_for, status, capture_id, recorded_at
+		FROM medication_doses
+		WHERE actor = ? AND scheduled_for >= ? AND scheduled_for < ?
+		ORDER BY scheduled_for ASC
+	`, actor, since.UTC().Format(time.RFC3339), until.UTC().Format(time.RFC3339))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var doses []MedicationDose
+	for rows.Next() {
+		var d MedicationDose
+		var scheduledStr, recordedStr string
+		var captureID sql.NullString
+		if err := rows.Scan(&d.MedID, &d.Actor, &scheduledStr, &d.Status, &captureID, &recordedStr); err != nil {
+			return nil, err
+		}
+		d.CaptureID = captureID.String
+		d.ScheduledFor, _ = time.Parse(time.RFC3339, scheduledStr)
+		d.RecordedAt, _ = time.Parse(time.RFC3339, recordedStr)
+		doses = append(doses, d)
+	}
+	return doses, rows.Err()
+}
@@ -0,0 +1,117 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// MoodScore is a single mood observation for a capture
+// Valence, Energy and Rating are nil when not available.
+type MoodScore struct {
+	CaptureID string
+	Actor     string
+	Category  string
+	Valence   *float64
+	Energy    *float64
+	Rating    *int
+	CreatedAt time.Time
+}
+
+// MoodDay holds daily mood averages (nil when no observations of that kind)
+type MoodDay struct {
+	Date    string   `json:"date"`
+	Valence *float64 `json:"valence"`
+	Energy  *float64 `json:"energy"`
+	Rating  *float64 `json:"rating"`
+	Count   int      `json:"count"`
+}
+
+// SaveMoodScore records a mood observation, replacing any earlier score for the capture
+func (db *DB) SaveMoodScore(score MoodScore) error {
+	_, err := db.conn.Exec(`
+		INSERT INTO mood_scores (capture_id, actor, category, valence, energy, rating, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(capture_id) DO UPDATE SET
+			valence = excluded.valence,
+			energy = excluded.energy,
+			rating = excluded.rating
+	`, score.CaptureID, score.Actor, score.Category, score.Valence, score.Energy, score.Rating,
+		score.CreatedAt.UTC().Format(time.RFC3339))
+	return err
+}
+
+// GetMoodDaily returns per-day mood averages for an actor in [since, until), oldest
+// first, with days in loc so an evening entry counts for that evening's date
+func (db *DB) GetMoodDaily(actor string, since, until time.Time, loc *time.Location) ([]MoodDay, error) {
+	rows, err := db.conn.Query(`
+		SELECT created_at, valence, energy, rating
+		FROM mood_scores
+		WHERE actor = ? AND created_at >= ? AND created_at < ?
+		ORDER BY created_at ASC
+	`, actor, since.UTC().Format(time.RFC3339), until.UTC().Format(time.RFC3339))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	type sums struct {
+		valence, energy, rating mean
+		count                   int
+	}
+	var dates []string
+	byDate := make(map[string]*sums)
+	for rows.Next() {
+		var created string
+		var valence, energy, rating sql.NullFloat64
+		if err := rows.Scan(&created, &valence, &energy, &rating); err != nil {
+			return nil, err
+		}
+		ts, err := time.Parse(time.RFC3339, created)
+		if err != nil {
+			return nil, fmt.Errorf("parsing mood time %q: %w", created, err)
+		}
+		date := ts.In(loc).Format("2006-01-02")
+		day, ok := byDate[date]
+		if !ok {
+			day = &sums{}
+			byDate[date] = day
+			dates = append(dates, date)
+		}
+		day.valence.add(valence)
+		day.energy.add(energy)
+		day.rating.add(rating)
+		day.count++
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	days := make([]MoodDay, 0, len(dates))
+	for _, date := range dates {
+		d := byDate[date]
+		days = append(days, MoodDay{Date: date, Valence: d.valence.value(), Energy: d.energy.value(), Rating: d.rating.value(), Count: d.count})
+	}
+	return days, nil
+}
+
+// mean averages the non-null values it is given, like SQL AVG
+type mean struct {
+	sum float64
+	n   int
+}
+
+func (m *mean) add(v sql.NullFloat64) {
+	if v.Valid {
+		m.sum += v.Float64
+		m.n++
+	}
+}
+
+func (m *mean) value() *float64 {
+	if m.n == 0 {
+		return nil
+	}
+	v := m.sum / float64(m.n)
+	return &v
+}
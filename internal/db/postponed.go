@@ -0,0 +1,64 @@
+package db
+
+import (
+	"time"
+)
+
+// PostponedJob is LLM work deferred while the backend was unavailable
+type PostponedJob struct {
+	ID        int64
+	Kind      string
+	RefID     string
+	Actor     string
+	Payload   string // JSON, kind specific
+	CreatedAt time.Time
+}
+
+// PostponeJob stores a job to run once the LLM backend recovers.
+// A job with the same kind and ref ID is only stored once.
+func (db *DB) PostponeJob(kind, refID, actor, payload string) error {
+	_, err := db.conn.Exec(`
+		INSERT OR IGNORE INTO postponed_jobs (kind, ref_id, actor, payload, created_at)
+		VALUES (?, ?, ?, ?, ?)
+	`, kind, refID, actor, payload, time.Now().UTC().Format(time.RFC3339))
+	return err
+}
+
+// GetPostponedJobs returns up to limit postponed jobs, oldest first
+func (db *DB) GetPostponedJobs(limit int) ([]PostponedJob, error) {
+	rows, err := db.conn.Query(`
+		SELECT id, kind, ref_id, actor, payload, created_at
+		FROM postponed_jobs
+		ORDER BY id
+		LIMIT ?
+	`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var jobs []PostponedJob
+	for rows.Next() {
+		var job PostponedJob
+		var createdAt string
+		if err := rows.Scan(&job.ID, &job.Kind, &job.RefID, &job.Actor, &job.Payload, &createdAt); err != nil {
+			return nil, err
+		}
+		job.CreatedAt, _ = time.Parse(time.RFC3339, createdAt)
+		jobs = append(jobs, job)
+	}
+	return jobs, rows.Err()
+}
+
+// DeletePostponedJob removes a job once it has run
+func (db *DB) DeletePostponedJob(id int64) error {
+	_, err := db.conn.Exec(`DELETE FROM postponed_jobs WHERE id = ?`, id)
+	return err
+}
+
+// CountPostponedJobs returns the number of jobs waiting for the LLM backend
+func (db *DB) CountPostponedJobs() (int, error) {
+	var count int
+	err := db.conn.QueryRow(`SELECT COUNT(*) FROM postponed_jobs`).Scan(&count)
+	return count, err
+}
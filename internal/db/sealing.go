@@ -0,0 +1,95 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// Sealer encrypts text for a user before it is stored (implemented by vault.Keyring)
+type Sealer interface {
+	// SealText encrypts text for actor, or for everyone when actor is empty
+	SealText(text, actor string) (string, error)
+	// OpenText decrypts sealed text, returning other text as is
+	OpenText(text string) (string, error)
+	// IsSealedText reports whether text was sealed
+	IsSealedText(text string) bool
+}
+
+// sealedColumns hold text that is sealed for the row's actor
+var sealedColumns = []struct{ table, column string }{
+	{"capture_log", "raw_text"},
+	{"pending_clarifications", "raw_text"},
+	{"transactions", "raw_text"},
+	{"llm_cache", "response"},
+}
+
+// SetSealer stores the raw text of captures, pending clarifications and
+// transactions, and cached LLM responses, sealed with sealer (call before any
+// writes). Text stored in plaintext before is sealed now.
+func (db *DB) SetSealer(sealer Sealer) error {
+	db.sealer = sealer
+	for _, c := range sealedColumns {
+		rows, err := db.conn.Query(`SELECT rowid, actor, ` + c.column + ` FROM ` + c.table)
+		if err != nil {
+			return fmt.Errorf("reading %s: %w", c.table, err)
+		}
+		type plain struct {
+			rowid       int64
+			actor, text string
+		}
+		var todo []plain
+		for rows.Next() {
+			var p plain
+			var text sql.NullString
+			if err := rows.Scan(&p.rowid, &p.actor, &text); err != nil {
+				rows.Close()
+				return err
+			}
+			if p.text = text.String; p.text != "" && !sealer.IsSealedText(p.text) {
+				todo = append(todo, p)
+			}
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		for _, p := range todo {
+			sealed, err := db.sealText(p.text, p.actor)
+			if err != nil {
+				return err
+			}
+			if sealed == p.text {
+				continue // the actor has no key
+			}
+			if _, err := db.conn.Exec(`UPDATE `+c.table+` SET `+c.column+` = ? WHERE rowid = ?`, sealed, p.rowid); err != nil {
+				return fmt.Errorf("sealing %s: %w", c.table, err)
+			}
+		}
+	}
+	return nil
+}
+
+// sealText seals text for actor when a sealer is set
+func (db *DB) sealText(text, actor string) (string, error) {
+	if db.sealer == nil || text == "" {
+		return text, nil
+	}
+	sealed, err := db.sealer.SealText(text, actor)
+	if err != nil {
+		return "", fmt.Errorf("sealing text: %w", err)
+	}
+	return sealed, nil
+}
+
+// openText decrypts text written by sealText
+func (db *DB) openText(text string) (string, error) {
+	if db.sealer == nil {
+		return text, nil
+	}
+	plaintext, err := db.sealer.OpenText(text)
+	if err != nil {
+		return "", fmt.Errorf("opening sealed text: %w", err)
+	}
+	return plaintext, nil
+}
@@ -0,0 +1,490 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Full-text search index over captures, notes, journal and research files.
+// FTS5 is used when the sqlite driver is built with it (-tags sqlite_fts5);
+// otherwise FTS4 is used and ranking is computed from matchinfo.
+const searchSchemaFTS5 = `
+CREATE VIRTUAL TABLE IF NOT EXISTS search_docs USING fts5(
+    doc_id UNINDEXED,
+    kind UNINDEXED,
+    actor UNINDEXED,
+    category UNINDEXED,
+    created UNINDEXED,
+    path UNINDEXED,
+    title,
+    body,
+    tokenize = 'porter unicode61'
+);
+`
+
+const searchSchemaFTS4 = `
+CREATE VIRTUAL TABLE IF NOT EXISTS search_docs USING fts4(
+    doc_id, kind, actor, category, created, path, title, body,
+    notindexed=doc_id, notindexed=kind, notindexed=actor,
+    notindexed=category, notindexed=created, notindexed=path,
+    tokenize=porter
+);
+`
+
+// Search document kinds
+const (
+	DocCapture      = "capture"
+	DocNote         = "note"
+	DocJournal      = "journal"
+	DocJournalDaily = "journal_daily"
+	DocResearch     = "research"
+)
+
+// Column weights for ranking: title matches count double
+const (
+	searchTitleWeight = 2.0
+	searchBodyWeight  = 1.0
+)
+
+// SearchDoc is a document stored in the search index
+type SearchDoc struct {
+	DocID    string
+	Kind     string
+	Actor    string
+	Category string
+	Created  time.Time
+	Path     string
+	Title    string
+	Body     string
+}
+
+// SearchQuery holds search text and filters
+type SearchQuery struct {
+	Text     string
+	Actor    string
+	Reader   string // only documents this user owns or that were shared with them
+	Category string
+	Kind     string
+	Since    *time.Time
+	Until    *time.Time
+	Limit    int
+	AnyTerm  bool     // match documents containing any word rather than all of them
+	Exclude  []string // categories to leave out
+}
+
+// SearchHit is a ranked search result
+type SearchHit struct {
+	DocID    string
+	Kind     string
+	Actor    string
+	Category string
+	Created  time.Time
+	Path     string
+	Title    string
+	Snippet  string
+	Score    float64 // higher is better
+}
+
+// migrateSearch creates the search index, preferring FTS5
+func (db *DB) migrateSearch() error {
+	var existing string
+	err := db.conn.QueryRow(`SELECT sql FROM sqlite_master WHERE type = 'table' AND name = 'search_docs'`).Scan(&existing)
+	switch {
+	case err == nil && strings.Contains(strings.ToLower(existing), "fts5"):
+		db.ftsVersion = 5
+	case err == nil:
+		db.ftsVersion = 4
+	default:
+		if _, err := db.conn.Exec(searchSchemaFTS5); err == nil {
+			db.ftsVersion = 5
+		} else if !strings.Contains(err.Error(), "no such module") {
+			return fmt.Errorf("creating fts5 search index: %w", err)
+		} else if _, err := db.conn.Exec(searchSchemaFTS4); err != nil {
+			return fmt.Errorf("creating fts4 search index: %w", err)
+		} else {
+			db.ftsVersion = 4
+		}
+	}
+
+	// Backfill captures logged before the index existed
+	_, err = db.conn.Exec(`
+		INSERT INTO search_docs (doc_id, kind, actor, category, created, path, title, body)
+		SELECT c.capture_id, 'capture', c.actor, COALESCE(c.routed_to, ''), c.created_at, '', '', c.raw_text
+		FROM capture_log c
+		WHERE NOT EXISTS (SELECT 1 FROM search_docs s WHERE s.doc_id = c.capture_id AND s.kind = 'capture')
+	`)
+	if err != nil {
+		return fmt.Errorf("backfilling capture search index: %w", err)
+	}
+	return db.dropSharedNarrations()
+}
+
+// dropSharedNarrations removes narrated journal batches that were indexed once for
+// each actor with entries in them, which showed every one of them the others'
+// entries. Such copies have the same text under different actors.
+func (db *DB) dropSharedNarrations() error {
+	rows, err := db.conn.Query(`
+		SELECT DISTINCT a.doc_id
+		FROM search_docs a JOIN search_docs b ON a.body = b.body AND a.actor != b.actor
+		WHERE a.kind = ? AND b.kind = ?
+	`, DocJournalDaily, DocJournalDaily)
+	if err != nil {
+		return fmt.Errorf("finding shared narrations: %w", err)
+	}
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		if err := db.DeleteSearchDoc(id, DocJournalDaily); err != nil {
+			return fmt.Errorf("dropping shared narration %s: %w", id, err)
+		}
+	}
+	return nil
+}
+
+// SetUnindexedFolders keeps documents in the given top-level vault folders, or
+// filed to categories of the same name, out of the search index and embeddings,
+// e.g. folders encrypted at rest. Documents already indexed there are removed.
+func (db *DB) SetUnindexedFolders(folders []string) error {
+	db.unindexed = make(map[string]bool, len(folders))
+	for _, folder := range folders {
+		db.unindexed[folder] = true
+	}
+	if len(folders) == 0 {
+		return nil
+	}
+
+	for _, table := range []string{"search_docs", "embeddings"} {
+		rows, err := db.conn.Query(`SELECT doc_id, kind, category, path FROM ` + table)
+		if err != nil {
+			return fmt.Errorf("reading %s: %w", table, err)
+		}
+		var drop [][2]string
+		for rows.Next() {
+			var docID, kind, category, path string
+			if err := rows.Scan(&docID, &kind, &category, &path); err != nil {
+				rows.Close()
+				return err
+			}
+			if db.Unindexed(category, path) {
+				drop = append(drop, [2]string{docID, kind})
+			}
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		for _, doc := range drop {
+			if err := db.DeleteSearchDoc(doc[0], doc[1]); err != nil {
+				return fmt.Errorf("removing %s %s from the index: %w", doc[1], doc[0], err)
+			}
+		}
+	}
+	return nil
+}
+
+// Unindexed reports whether a document filed to category at the vault-relative
+// path is kept out of the search index
+func (db *DB) Unindexed(category, path string) bool {
+	folder, _, _ := strings.Cut(filepath.ToSlash(path), "/")
+	return db.unindexed[category] || db.unindexed[folder]
+}
+
+// IndexSearchDoc adds or replaces a document in the search index. Documents in
+// unindexed folders are removed instead (see SetUnindexedFolders).
+func (db *DB) IndexSearchDoc(doc SearchDoc) error {
+	if db.Unindexed(doc.Category, doc.Path) {
+		return db.DeleteSearchDoc(doc.DocID, doc.Kind)
+	}
+
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var title, body string
+	err = tx.QueryRow(`SELECT title, body FROM search_docs WHERE doc_id = ? AND kind = ?`, doc.DocID, doc.Kind).Scan(&title, &body)
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+	unchanged := err == nil && title == doc.Title && body == doc.Body
+
+	if _, err := tx.Exec(`DELETE FROM search_docs WHERE doc_id = ? AND kind = ?`, doc.DocID, doc.Kind); err != nil {
+		return err
+	}
+	// Changed text invalidates the embedding; the embed job picks it up again.
+	// Unchanged text (e.g. Reindex at startup) keeps it, with the new metadata.
+	if unchanged {
+		_, err = tx.Exec(`
+			UPDATE embeddings SET actor = ?, category = ?, path = ?, created = ?
+			WHERE doc_id = ? AND kind = ?
+		`, doc.Actor, doc.Category, doc.Path, doc.Created.UTC().Format(time.RFC3339), doc.DocID, doc.Kind)
+	} else {
+		_, err = tx.Exec(`DELETE FROM embeddings WHERE doc_id = ? AND kind = ?`, doc.DocID, doc.Kind)
+	}
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`
+		INSERT INTO search_docs (doc_id, kind, actor, category, created, path, title, body)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`, doc.DocID, doc.Kind, doc.Actor, doc.Category, doc.Created.UTC().Format(time.RFC3339), doc.Path, doc.Title, doc.Body); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// DeleteSearchDoc removes a document and its embedding from the search index
+func (db *DB) DeleteSearchDoc(docID, kind string) error {
+	if _, err := db.conn.Exec(`DELETE FROM search_docs WHERE doc_id = ? AND kind = ?`, docID, kind); err != nil {
+		return err
+	}
+	_, err := db.conn.Exec(`DELETE FROM embeddings WHERE doc_id = ? AND kind = ?`, docID, kind)
+	return err
+}
+
+// DeleteSearchDocsByBody removes the documents of a kind with the given text, and
+// their embeddings, whoever they are indexed for. Returns how many were removed.
+func (db *DB) DeleteSearchDocsByBody(kind, body string) (int, error) {
+	rows, err := db.conn.Query(`SELECT doc_id FROM search_docs WHERE kind = ? AND trim(body) = ?`, kind, strings.TrimSpace(body))
+	if err != nil {
+		return 0, err
+	}
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for _, id := range ids {
+		if err := db.DeleteSearchDoc(id, kind); err != nil {
+			return 0, err
+		}
+	}
+	return len(ids), nil
+}
+
+// GetSearchDoc returns an indexed document, or nil if not found
+func (db *DB) GetSearchDoc(docID, kind string) (*SearchDoc, error) {
+	var doc SearchDoc
+	var createdStr string
+	err := db.conn.QueryRow(`
+		SELECT doc_id, kind, actor, category, created, path, title, body
+		FROM search_docs WHERE doc_id = ? AND kind = ?
+	`, docID, kind).Scan(&doc.DocID, &doc.Kind, &doc.Actor, &doc.Category, &createdStr, &doc.Path, &doc.Title, &doc.Body)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	doc.Created, _ = time.Parse(time.RFC3339, createdStr)
+	return &doc, nil
+}
+
+// CountSearchDocs returns the number of indexed documents of a kind ("" for all)
+func (db *DB) CountSearchDocs(kind string) (int, error) {
+	query := `SELECT COUNT(*) FROM search_docs`
+	var args []interface{}
+	if kind != "" {
+		query += ` WHERE kind = ?`
+		args = append(args, kind)
+	}
+	var n int
+	err := db.conn.QueryRow(query, args...).Scan(&n)
+	return n, err
+}
+
+// Search runs a ranked full-text query with optional filters
+func (db *DB) Search(q SearchQuery) ([]SearchHit, error) {
+	match := BuildMatchExpression(q.Text, db.ftsVersion)
+	if q.AnyTerm {
+		match = strings.Join(strings.Split(match, " "), " OR ")
+	}
+	if match == "" {
+		return nil, nil
+	}
+	limit := q.Limit
+	if limit <= 0 {
+		limit = 20
+	}
+
+	var selectCols string
+	if db.ftsVersion == 5 {
+		selectCols = fmt.Sprintf(`doc_id, kind, actor, category, created, path, title,
+			snippet(search_docs, 7, '[', ']', '…', 12),
+			-bm25(search_docs, 0, 0, 0, 0, 0, 0, %g, %g)`, searchTitleWeight, searchBodyWeight)
+	} else {
+		selectCols = `doc_id, kind, actor, category, created, path, title,
+			snippet(search_docs, '[', ']', '…', -1, 12),
+			matchinfo(search_docs, 'pcnx')`
+	}
+
+	query := `SELECT ` + selectCols + ` FROM search_docs WHERE search_docs MATCH ?`
+	args := []interface{}{match}
+	if q.Actor != "" {
+		query += ` AND actor = ?`
+		args = append(args, q.Actor)
+	}
+	if q.Reader != "" {
+		clause, clauseArgs := visibleClause("actor", "doc_id", q.Reader)
+		query += ` AND ` + clause
+		args = append(args, clauseArgs...)
+	}
+	if q.Category != "" {
+		query += ` AND lower(category) = lower(?)`
+		args = append(args, q.Category)
+	}
+	for _, category := range q.Exclude {
+		query += ` AND lower(category) != lower(?)`
+		args = append(args, category)
+	}
+	if q.Kind != "" {
+		query += ` AND kind = ?`
+		args = append(args, q.Kind)
+	}
+	if q.Since != nil {
+		query += ` AND created >= ?`
+		args = append(args, q.Since.UTC().Format(time.RFC3339))
+	}
+	if q.Until != nil {
+		query += ` AND created < ?`
+		args = append(args, q.Until.UTC().Format(time.RFC3339))
+	}
+	if db.ftsVersion == 5 {
+		query += fmt.Sprintf(` ORDER BY bm25(search_docs, 0, 0, 0, 0, 0, 0, %g, %g) LIMIT %d`, searchTitleWeight, searchBodyWeight, limit)
+	}
+
+	rows, err := db.conn.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var hits []SearchHit
+	for rows.Next() {
+		var h SearchHit
+		var createdStr string
+		if db.ftsVersion == 5 {
+			if err := rows.Scan(&h.DocID, &h.Kind, &h.Actor, &h.Category, &createdStr, &h.Path, &h.Title, &h.Snippet, &h.Score); err != nil {
+				return nil, err
+			}
+		} else {
+			var info []byte
+			if err := rows.Scan(&h.DocID, &h.Kind, &h.Actor, &h.Category, &createdStr, &h.Path, &h.Title, &h.Snippet, &info); err != nil {
+				return nil, err
+			}
+			h.Score = scoreMatchinfo(info)
+		}
+		h.Created, _ = time.Parse(time.RFC3339, createdStr)
+		hits = append(hits, h)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if db.ftsVersion != 5 {
+		sort.SliceStable(hits, func(i, j int) bool {
+			return hits[i].Score > hits[j].Score
+		})
+		if len(hits) > limit {
+			hits = hits[:limit]
+		}
+	}
+	return hits, nil
+}
+
+// BuildMatchExpression turns free text into a safe MATCH expression:
+// every word is quoted (so operators in user input are literal) and the last word is a prefix.
+// FTS5 takes the prefix marker outside the quotes, FTS4 inside.
+func BuildMatchExpression(text string, ftsVersion int) string {
+	words := strings.FieldsFunc(text, func(r rune) bool {
+		return !(r == '\'' || r == '-' || r >= '0' && r <= '9' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r > 127)
+	})
+	var terms []string
+	for _, w := range words {
+		w = strings.Trim(w, "'-")
+		if w == "" {
+			continue
+		}
+		terms = append(terms, `"`+w+`"`)
+	}
+	if len(terms) == 0 {
+		return ""
+	}
+	last := terms[len(terms)-1]
+	if ftsVersion == 5 {
+		terms[len(terms)-1] = last + "*"
+	} else {
+		terms[len(terms)-1] = last[:len(last)-1] + `*"`
+	}
+	return strings.Join(terms, " ")
+}
+
+// scoreMatchinfo computes a tf-idf style score from FTS4 matchinfo('pcnx')
+// Layout: p, c, n, then 3 ints per (phrase, column): hits in row, hits in all rows, rows with hits.
+func scoreMatchinfo(info []byte) float64 {
+	ints := make([]uint32, len(info)/4)
+	for i := range ints {
+		b := info[i*4 : i*4+4]
+		ints[i] = uint32(b[0]) | uint32(b[1])<<8 | uint32(b[2])<<16 | uint32(b[3])<<24
+	}
+	if len(ints) < 3 {
+		return 0
+	}
+	phrases, cols, rowsTotal := int(ints[0]), int(ints[1]), float64(ints[2])
+
+	// Column weights by position: only title (6) and body (7) are indexed
+	weight := func(col int) float64 {
+		switch col {
+		case 6:
+			return searchTitleWeight
+		case 7:
+			return searchBodyWeight
+		}
+		return 0
+	}
+
+	var score float64
+	for p := 0; p < phrases; p++ {
+		for c := 0; c < cols; c++ {
+			base := 3 + 3*(p*cols+c)
+			if base+2 >= len(ints) {
+				continue
+			}
+			hitsRow := float64(ints[base])
+			docsWithHit := float64(ints[base+2])
+			if hitsRow == 0 || docsWithHit == 0 {
+				continue
+			}
+			idf := math.Log(1 + rowsTotal/docsWithHit)
+			score += weight(c) * hitsRow * idf
+		}
+	}
+	return score
+}
@@ -0,0 +1,297 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Session kinds
+const (
+	SessionBrowser = "browser" // cookie for the web UI
+	SessionApp     = "app"     // bearer access token plus a refresh token, for the phone
+)
+
+// ErrIdentityExists is returned when linking an identity that is already linked
+var ErrIdentityExists = errors.New("identity already linked")
+
+// Identity is an external OpenID Connect account that logs in as a user
+type Identity struct {
+	ID          int64      `json:"id"`
+	UserID      string     `json:"user_id"`
+	Issuer      string     `json:"issuer"`
+	Subject     string     `json:"subject,omitempty"` // empty until the first login of an email link
+	Email       string     `json:"email,omitempty"`
+	Scopes      []string   `json:"scopes"`
+	CreatedAt   time.Time  `json:"created_at"`
+	LastLoginAt *time.Time `json:"last_login_at,omitempty"`
+}
+
+// Session is a login made through an identity
+type Session struct {
+	ID               int64
+	UserID           string
+	IdentityID       int64
+	Kind             string
+	Scopes           []string
+	AccessExpiresAt  time.Time
+	RefreshExpiresAt *time.Time
+	CreatedAt        time.Time
+}
+
+// Token returns the session as an API token, so scope checks treat both alike
+func (s *Session) Token() *APIToken {
+	return &APIToken{UserID: s.UserID, Label: s.Kind + " session", Scopes: s.Scopes, CreatedAt: s.CreatedAt}
+}
+
+// LinkIdentity lets an external identity log in as a user. Give the subject if known,
+// otherwise the email, which must be verified by the provider at login.
+func (db *DB) LinkIdentity(userID, issuer, subject, email string, scopes []string) (*Identity, error) {
+	if subject == "" && email == "" {
+		return nil, fmt.Errorf("identity needs a subject or an email")
+	}
+	for _, s := range scopes {
+		if !ValidScope(s) {
+			return nil, fmt.Errorf("unknown scope %q", s)
+		}
+	}
+	user, err := db.GetUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, ErrUserNotFound
+	}
+
+	var existing int
+	err = db.conn.QueryRow(`
+		SELECT COUNT(*) FROM user_identities
+		WHERE issuer = ? AND ((? != '' AND subject = ?) OR (? != '' AND lower(email) = lower(?)))
+	`, issuer, subject, subject, email, email).Scan(&existing)
+	if err != nil {
+		return nil, err
+	}
+	if existing > 0 {
+		return nil, ErrIdentityExists
+	}
+
+	now := time.Now().UTC()
+	res, err := db.conn.Exec(`
+		INSERT INTO user_identities (user_id, issuer, subject, email, scopes, created_at) VALUES (?, ?, ?, ?, ?, ?)
+	`, userID, issuer, subject, email, strings.Join(scopes, " "), now.Format(time.RFC3339))
+	if err != nil {
+		return nil, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+	return &Identity{ID: id, UserID: userID, Issuer: issuer, Subject: subject, Email: email, Scopes: scopes, CreatedAt: now}, nil
+}
+
+// GetIdentities returns the identities linked to a user
+func (db *DB) GetIdentities(userID string) ([]Identity, error) {
+	return db.queryIdentities(`WHERE user_id = ? ORDER BY id`, userID)
+}
+
+func (db *DB) queryIdentities(where string, args ...interface{}) ([]Identity, error) {
+	rows, err := db.conn.Query(`
+		SELECT id, user_id, issuer, subject, email, scopes, created_at, last_login_at FROM user_identities `+where, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var identities []Identity
+	for rows.Next() {
+		var i Identity
+		var scopes, createdAt string
+		var lastLogin sql.NullString
+		if err := rows.Scan(&i.ID, &i.UserID, &i.Issuer, &i.Subject, &i.Email, &scopes, &createdAt, &lastLogin); err != nil {
+			return nil, err
+		}
+		i.Scopes = strings.Fields(scopes)
+		i.CreatedAt, _ = time.Parse(time.RFC3339, createdAt)
+		i.LastLoginAt = parseNullTime(lastLogin)
+		identities = append(identities, i)
+	}
+	return identities, rows.Err()
+}
+
+// UnlinkIdentity removes an identity and ends its sessions.
+// Returns false if the user has no such identity.
+func (db *DB) UnlinkIdentity(userID string, identityID int64) (bool, error) {
+	res, err := db.conn.Exec(`DELETE FROM user_identities WHERE id = ? AND user_id = ?`, identityID, userID)
+	if err != nil {
+		return false, err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return false, nil
+	}
+	_, err = db.conn.Exec(`
+		UPDATE sessions SET revoked_at = ? WHERE identity_id = ? AND revoked_at IS NULL
+	`, time.Now().UTC().Format(time.RFC3339), identityID)
+	return err == nil, err
+}
+
+// ResolveIdentity finds the identity for a login, or nil if it is not linked to an
+// active user. verifiedEmail is the login's email if the provider verified it; an
+// identity linked by that email is bound to the subject from then on.
+func (db *DB) ResolveIdentity(issuer, subject, verifiedEmail string) (*Identity, error) {
+	const active = ` AND user_id IN (SELECT id FROM users WHERE disabled_at IS NULL)`
+	found, err := db.queryIdentities(`WHERE issuer = ? AND subject = ?`+active, issuer, subject)
+	if err != nil {
+		return nil, err
+	}
+	if len(found) == 0 && verifiedEmail != "" {
+		found, err = db.queryIdentities(`WHERE issuer = ? AND subject = '' AND lower(email) = lower(?)`+active, issuer, verifiedEmail)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(found) == 0 {
+		return nil, nil
+	}
+
+	identity := found[0]
+	now := time.Now().UTC()
+	if _, err := db.conn.Exec(`
+		UPDATE user_identities SET subject = ?, last_login_at = ? WHERE id = ?
+	`, subject, now.Format(time.RFC3339), identity.ID); err != nil {
+		return nil, err
+	}
+	identity.Subject = subject
+	identity.LastLoginAt = &now
+	return &identity, nil
+}
+
+// CreateSession starts a session for an identity, returning its access token and,
+// when refreshTTL is set, a refresh token. Neither token is stored.
+func (db *DB) CreateSession(identity *Identity, kind string, accessTTL, refreshTTL time.Duration) (string, string, *Session, error) {
+	access, refresh, err := newSessionSecrets(refreshTTL)
+	if err != nil {
+		return "", "", nil, err
+	}
+
+	now := time.Now().UTC()
+	s := &Session{
+		UserID:          identity.UserID,
+		IdentityID:      identity.ID,
+		Kind:            kind,
+		Scopes:          identity.Scopes,
+		AccessExpiresAt: now.Add(accessTTL),
+		CreatedAt:       now,
+	}
+	var refreshHash, refreshExpires interface{}
+	if refresh != "" {
+		expires := now.Add(refreshTTL)
+		s.RefreshExpiresAt = &expires
+		refreshHash = HashToken(refresh)
+		refreshExpires = expires.Format(time.RFC3339)
+	}
+
+	res, err := db.conn.Exec(`
+		INSERT INTO sessions (user_id, identity_id, kind, scopes, access_hash, access_expires_at, refresh_hash, refresh_expires_at, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, s.UserID, s.IdentityID, kind, strings.Join(s.Scopes, " "), HashToken(access),
+		s.AccessExpiresAt.Format(time.RFC3339), refreshHash, refreshExpires, now.Format(time.RFC3339))
+	if err != nil {
+		return "", "", nil, err
+	}
+	if s.ID, err = res.LastInsertId(); err != nil {
+		return "", "", nil, err
+	}
+	return access, refresh, s, nil
+}
+
+// AuthenticateSession returns the session for a valid access token, or nil if it is
+// unknown, expired or revoked, or its user is disabled
+func (db *DB) AuthenticateSession(access string) (*Session, error) {
+	if access == "" {
+		return nil, nil
+	}
+	return db.querySession(`s.access_hash = ? AND s.access_expires_at > ?`, HashToken(access), time.Now().UTC().Format(time.RFC3339))
+}
+
+// RefreshSession exchanges a refresh token for new access and refresh tokens; the old
+// ones stop working. Returns a nil session if the refresh token is not valid.
+func (db *DB) RefreshSession(refresh string, accessTTL, refreshTTL time.Duration) (string, string, *Session, error) {
+	if refresh == "" {
+		return "", "", nil, nil
+	}
+	s, err := db.querySession(`s.refresh_hash = ? AND s.refresh_expires_at > ?`, HashToken(refresh), time.Now().UTC().Format(time.RFC3339))
+	if err != nil || s == nil {
+		return "", "", nil, err
+	}
+
+	access, newRefresh, err := newSessionSecrets(refreshTTL)
+	if err != nil {
+		return "", "", nil, err
+	}
+	now := time.Now().UTC()
+	s.AccessExpiresAt = now.Add(accessTTL)
+	refreshExpires := now.Add(refreshTTL)
+	s.RefreshExpiresAt = &refreshExpires
+
+	// Conditional on the old hash so a refresh token can only be used once
+	res, err := db.conn.Exec(`
+		UPDATE sessions SET access_hash = ?, access_expires_at = ?, refresh_hash = ?, refresh_expires_at = ?
+		WHERE id = ? AND refresh_hash = ?
+	`, HashToken(access), s.AccessExpiresAt.Format(time.RFC3339), HashToken(newRefresh),
+		refreshExpires.Format(time.RFC3339), s.ID, HashToken(refresh))
+	if err != nil {
+		return "", "", nil, err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return "", "", nil, nil
+	}
+	return access, newRefresh, s, nil
+}
+
+// RevokeSession ends a session
+func (db *DB) RevokeSession(id int64) error {
+	_, err := db.conn.Exec(`
+		UPDATE sessions SET revoked_at = ? WHERE id = ? AND revoked_at IS NULL
+	`, time.Now().UTC().Format(time.RFC3339), id)
+	return err
+}
+
+func (db *DB) querySession(where string, args ...interface{}) (*Session, error) {
+	var s Session
+	var scopes, accessExpires, createdAt string
+	var refreshExpires sql.NullString
+	err := db.conn.QueryRow(`
+		SELECT s.id, s.user_id, s.identity_id, s.kind, s.scopes, s.access_expires_at, s.refresh_expires_at, s.created_at
+		FROM sessions s JOIN users u ON u.id = s.user_id
+		WHERE s.revoked_at IS NULL AND u.disabled_at IS NULL AND `+where, args...,
+	).Scan(&s.ID, &s.UserID, &s.IdentityID, &s.Kind, &scopes, &accessExpires, &refreshExpires, &createdAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	s.Scopes = strings.Fields(scopes)
+	s.AccessExpiresAt, _ = time.Parse(time.RFC3339, accessExpires)
+	s.RefreshExpiresAt = parseNullTime(refreshExpires)
+	s.CreatedAt, _ = time.Parse(time.RFC3339, createdAt)
+	return &s, nil
+}
+
+// newSessionSecrets returns a new access token, and a refresh token if refreshTTL is set
+func newSessionSecrets(refreshTTL time.Duration) (string, string, error) {
+	access, err := newSecret("brs_")
+	if err != nil {
+		return "", "", err
+	}
+	if refreshTTL <= 0 {
+		return access, "", nil
+	}
+	refresh, err := newSecret("brr_")
+	if err != nil {
+		return "", "", err
+	}
+	return access, refresh, nil
+}
@@ -0,0 +1,269 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Capture visibility
+const (
+	VisibilityPrivate   = "private"   // only the owner
+	VisibilityHousehold = "household" // every user
+	VisibilityActors    = "actors"    // the owner and the users in With
+)
+
+// Sharing says who besides its owner can see a capture
+type Sharing struct {
+	Visibility string   `json:"visibility"`
+	With       []string `json:"share_with,omitempty"`
+}
+
+// Share is the sharing recorded for a capture
+type Share struct {
+	CaptureID string `json:"capture_id"`
+	Owner     string `json:"owner"`
+	Sharing
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// SharingRules give the sharing of captures filed to a category, by category
+type SharingRules map[string]Sharing
+
+// ParseSharingRules reads comma-separated rules, e.g. "Ideas=household,Projects=wife+kid,Health=private".
+// A rule is private, household, or the users to share with joined by +.
+func ParseSharingRules(s string) (SharingRules, error) {
+	rules := make(SharingRules)
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		category, value, ok := strings.Cut(part, "=")
+		category, value = strings.TrimSpace(category), strings.TrimSpace(value)
+		if !ok || category == "" || value == "" {
+			return nil, fmt.Errorf("invalid rule %q: want category=private, household or user+user", part)
+		}
+		switch value {
+		case VisibilityPrivate, VisibilityHousehold:
+			rules[category] = Sharing{Visibility: value}
+			continue
+		}
+		users := strings.Split(value, "+")
+		for _, u := range users {
+			if !ValidUserID(u) {
+				return nil, fmt.Errorf("rule for %s: invalid user ID %q", category, u)
+			}
+		}
+		rules[category] = Sharing{Visibility: VisibilityActors, With: users}
+	}
+	return rules, nil
+}
+
+// For returns the sharing for a category, private when no rule matches
+func (r SharingRules) For(category string) Sharing {
+	for c, s := range r {
+		if strings.EqualFold(c, category) {
+			return s
+		}
+	}
+	return Sharing{Visibility: VisibilityPrivate}
+}
+
+// Normalize validates the sharing and returns it with the owner and duplicates
+// removed from With; sharing with nobody else is private
+func (s Sharing) Normalize(owner string) (Sharing, error) {
+	if s.Visibility == "" && len(s.With) > 0 {
+		s.Visibility = VisibilityActors
+	}
+	switch s.Visibility {
+	case VisibilityPrivate, VisibilityHousehold:
+		return Sharing{Visibility: s.Visibility}, nil
+	case VisibilityActors:
+	default:
+		return Sharing{}, fmt.Errorf("visibility must be %s, %s or %s", VisibilityPrivate, VisibilityHousehold, VisibilityActors)
+	}
+
+	seen := map[string]bool{owner: true}
+	var with []string
+	for _, u := range s.With {
+		if !seen[u] {
+			seen[u] = true
+			with = append(with, u)
+		}
+	}
+	if len(with) == 0 {
+		return Sharing{Visibility: VisibilityPrivate}, nil
+	}
+	sort.Strings(with)
+	return Sharing{Visibility: VisibilityActors, With: with}, nil
+}
+
+// SetSharing records who can see a capture, replacing any earlier sharing.
+// Users shared with must exist.
+func (db *DB) SetSharing(captureID, owner string, s Sharing) error {
+	s, err := s.Normalize(owner)
+	if err != nil {
+		return err
+	}
+	for _, u := range s.With {
+		user, err := db.GetUser(u)
+		if err != nil {
+			return err
+		}
+		if user == nil {
+			return fmt.Errorf("%w: %s", ErrUserNotFound, u)
+		}
+	}
+
+	_, err = db.conn.Exec(`
+		INSERT INTO capture_shares (capture_id, owner, visibility, shared_with, updated_at)
+		VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT(capture_id) DO UPDATE SET
+			visibility = excluded.visibility,
+			shared_with = excluded.shared_with,
+			updated_at = excluded.updated_at
+		WHERE owner = excluded.owner
+	`, captureID, owner, s.Visibility, strings.Join(s.With, " "), time.Now().UTC().Format(time.RFC3339))
+	return err
+}
+
+// GetSharing returns the sharing recorded for a capture, or nil if there is none
+// (the capture is private)
+func (db *DB) GetSharing(captureID string) (*Share, error) {
+	var s Share
+	var with, updatedAt string
+	err := db.conn.QueryRow(`
+		SELECT capture_id, owner, visibility, shared_with, updated_at FROM capture_shares WHERE capture_id = ?
+	`, captureID).Scan(&s.CaptureID, &s.Owner, &s.Visibility, &with, &updatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	s.With = strings.Fields(with)
+	s.UpdatedAt, _ = time.Parse(time.RFC3339, updatedAt)
+	return &s, nil
+}
+
+// sharedWithReader matches capture_shares rows that let the reader given as its
+// argument see a capture
+const sharedWithReader = `(visibility = 'household' OR (visibility = 'actors' AND instr(' ' || shared_with || ' ', ?) > 0))`
+
+// VisibleTo reports whether reader can see an owner's capture
+func (db *DB) VisibleTo(reader, owner, captureID string) (bool, error) {
+	if reader == owner {
+		return true, nil
+	}
+	var n int
+	err := db.conn.QueryRow(`
+		SELECT COUNT(*) FROM capture_shares WHERE capture_id = ? AND owner = ? AND `+sharedWithReader,
+		captureID, owner, " "+reader+" ").Scan(&n)
+	return n > 0, err
+}
+
+// visibleClause restricts a query to documents reader owns or that were shared with
+// them, given the columns holding a document's owner and capture ID
+func visibleClause(ownerCol, idCol, reader string) (string, []interface{}) {
+	return `(` + ownerCol + ` = ? OR ` + idCol + ` IN (
+			SELECT capture_id FROM capture_shares WHERE owner = ` + ownerCol + ` AND ` + sharedWithReader + `
+		))`, []interface{}{reader, " " + reader + " "}
+}
+
+// GetCapture returns a capture with the category it was filed to, or nil if not found
+func (db *DB) GetCapture(captureID string) (*CaptureRecord, error) {
+	captures, err := db.queryCaptures(`c.capture_id = ?`, captureID)
+	if err != nil || len(captures) == 0 {
+		return nil, err
+	}
+	return &captures[0], nil
+}
+
+// GetSharedCaptures returns other users' captures since a given time that
+// are shared with reader, newest first. Private captures are never included.
+func (db *DB) GetSharedCaptures(reader string, since time.Time) ([]CaptureRecord, error) {
+	clause, args := visibleClause("c.actor", "c.capture_id", reader)
+	return db.queryCaptures(`c.actor != ? AND `+clause+` AND c.created_at >= ? ORDER BY c.created_at DESC LIMIT 100`,
+		append(append([]interface{}{reader}, args...), since.UTC().Format(time.RFC3339))...)
+}
+
+// queryCaptures reads capture_log rows; the category of a clarified capture is the
+// destination it was given
+func (db *DB) queryCaptures(where string, args ...interface{}) ([]CaptureRecord, error) {
+	rows, err := db.conn.Query(`
+		SELECT c.capture_id, c.actor, c.mode, c.raw_text, COALESCE(NULLIF(c.routed_to, ''), p.destination, ''),
+			COALESCE(c.confidence, 0), c.status, c.created_at
+		FROM capture_log c LEFT JOIN pending_clarifications p ON p.capture_id = c.capture_id AND p.resolved_at IS NOT NULL
+		WHERE `+where, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var captures []CaptureRecord
+	for rows.Next() {
+		var c CaptureRecord
+		var createdStr string
+		if err := rows.Scan(&c.CaptureID, &c.Actor, &c.Mode, &c.RawText, &c.RoutedTo, &c.Confidence, &c.Status, &createdStr); err != nil {
+			return nil, err
+		}
+		if c.RawText, err = db.openText(c.RawText); err != nil {
+			return nil, err
+		}
+		c.CreatedAt, _ = time.Parse(time.RFC3339, createdStr)
+		captures = append(captures, c)
+	}
+	return captures, rows.Err()
+}
+
+// Comment is a note left on a capture
+type Comment struct {
+	ID        int64     `json:"id"`
+	CaptureID string    `json:"capture_id"`
+	Actor     string    `json:"actor"`
+	Text      string    `json:"text"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// AddComment adds a comment to a capture (check the actor can see it first)
+func (db *DB) AddComment(captureID, actor, text string) (*Comment, error) {
+	now := time.Now().UTC()
+	res, err := db.conn.Exec(`
+		INSERT INTO capture_comments (capture_id, actor, text, created_at) VALUES (?, ?, ?, ?)
+	`, captureID, actor, text, now.Format(time.RFC3339))
+	if err != nil {
+		return nil, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+	return &Comment{ID: id, CaptureID: captureID, Actor: actor, Text: text, CreatedAt: now}, nil
+}
+
+// GetComments returns the comments on a capture, oldest first
+func (db *DB) GetComments(captureID string) ([]Comment, error) {
+	rows, err := db.conn.Query(`
+		SELECT id, capture_id, actor, text, created_at FROM capture_comments
+		WHERE capture_id = ? ORDER BY created_at, id
+	`, captureID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var comments []Comment
+	for rows.Next() {
+		var c Comment
+		var createdAt string
+		if err := rows.Scan(&c.ID, &c.CaptureID, &c.Actor, &c.Text, &createdAt); err != nil {
+			return nil, err
+		}
+		c.CreatedAt, _ = time.Parse(time.RFC3339, createdAt)
+		comments = append(comments, c)
+	}
+	return comments, rows.Err()
+}
@@ -0,0 +1,369 @@
+package db
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// API token scopes
+const (
+	ScopeCaptureWrite = "capture:write" // capture, clarify, pending
+	ScopeLettersRead  = "letters:read"  // daily and weekly letters
+	ScopeNotesRead    = "notes:read"    // search, related notes, ask, idea expansion
+	ScopeHealthRead   = "health:read"   // medications, adherence, mood
+	ScopeHealthWrite  = "health:write"  // medication schedules
+	ScopeJournalWrite = "journal:write" // journal narration
+	ScopeFinanceRead  = "finance:read"  // Financial notes in search and answers
+	ScopeAdmin        = "admin"         // users, tokens, LLM admin and test endpoints
+)
+
+// AllScopes lists every scope; bootstrap tokens have all of them
+var AllScopes = []string{
+	ScopeCaptureWrite, ScopeLettersRead, ScopeNotesRead, ScopeHealthRead,
+	ScopeHealthWrite, ScopeJournalWrite, ScopeFinanceRead, ScopeAdmin,
+}
+
+// ValidScope reports whether s is a known scope
+func ValidScope(s string) bool {
+	for _, scope := range AllScopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// ErrUserExists is returned when creating a user whose ID is taken
+var ErrUserExists = errors.New("user already exists")
+
+// ErrUserNotFound is returned for operations on an unknown user
+var ErrUserNotFound = errors.New("user not found")
+
+// userIDPattern restricts user IDs to names that are safe as actors in paths and frontmatter
+var userIDPattern = regexp.MustCompile(`^[a-z][a-z0-9_-]{0,31}$`)
+
+// tokenTouchInterval limits how often last_used_at is written for a busy token
+const tokenTouchInterval = time.Minute
+
+// User is a family member; the ID is the actor name used throughout the vault
+type User struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	CreatedAt  time.Time  `json:"created_at"`
+	DisabledAt *time.Time `json:"disabled_at,omitempty"`
+}
+
+// APIToken is a stored API token (the token itself is only returned when created)
+type APIToken struct {
+	ID         int64      `json:"id"`
+	UserID     string     `json:"user_id"`
+	Label      string     `json:"label"`
+	DeviceID   string     `json:"device_id,omitempty"` // captures must come from this device when set
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+}
+
+// HasScope reports whether the token grants scope
+func (t *APIToken) HasScope(scope string) bool {
+	for _, s := range t.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// HashToken returns the stored form of an API token
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// ValidUserID reports whether id can be used as a user ID
+func ValidUserID(id string) bool {
+	return userIDPattern.MatchString(id)
+}
+
+// CreateUser adds a user
+func (db *DB) CreateUser(id, name string) (*User, error) {
+	if !ValidUserID(id) {
+		return nil, fmt.Errorf("invalid user ID %q: use lowercase letters, digits, - and _", id)
+	}
+	now := time.Now().UTC()
+	res, err := db.conn.Exec(`
+		INSERT OR IGNORE INTO users (id, name, created_at) VALUES (?, ?, ?)
+	`, id, name, now.Format(time.RFC3339))
+	if err != nil {
+		return nil, err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return nil, ErrUserExists
+	}
+	return &User{ID: id, Name: name, CreatedAt: now}, nil
+}
+
+// GetUser returns a user, or nil if there is none with the ID
+func (db *DB) GetUser(id string) (*User, error) {
+	users, err := db.queryUsers(`WHERE id = ?`, id)
+	if err != nil || len(users) == 0 {
+		return nil, err
+	}
+	return &users[0], nil
+}
+
+// GetUsers returns all users, including disabled ones, by ID
+func (db *DB) GetUsers() ([]User, error) {
+	return db.queryUsers(`ORDER BY id`)
+}
+
+// GetActiveUserIDs returns the IDs of users who are not disabled
+func (db *DB) GetActiveUserIDs() ([]string, error) {
+	users, err := db.queryUsers(`WHERE disabled_at IS NULL ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]string, len(users))
+	for i, u := range users {
+		ids[i] = u.ID
+	}
+	return ids, nil
+}
+
+func (db *DB) queryUsers(where string, args ...interface{}) ([]User, error) {
+	rows, err := db.conn.Query(`SELECT id, name, created_at, disabled_at FROM users `+where, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []User
+	for rows.Next() {
+		var u User
+		var createdAt string
+		var disabledAt sql.NullString
+		if err := rows.Scan(&u.ID, &u.Name, &createdAt, &disabledAt); err != nil {
+			return nil, err
+		}
+		u.CreatedAt, _ = time.Parse(time.RFC3339, createdAt)
+		u.DisabledAt = parseNullTime(disabledAt)
+		users = append(users, u)
+	}
+	return users, rows.Err()
+}
+
+// DisableUser stops a user's tokens working and removes them from scheduled jobs.
+// Returns false if the user does not exist or is already disabled.
+func (db *DB) DisableUser(id string) (bool, error) {
+	res, err := db.conn.Exec(`
+		UPDATE users SET disabled_at = ? WHERE id = ? AND disabled_at IS NULL
+	`, time.Now().UTC().Format(time.RFC3339), id)
+	if err != nil {
+		return false, err
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
+
+// CreateAPIToken issues a new token for a user, returning the token, which is not stored.
+// deviceID binds the token to one device; empty leaves it unbound.
+func (db *DB) CreateAPIToken(userID, label, deviceID string, scopes []string) (string, *APIToken, error) {
+	for _, s := range scopes {
+		if !ValidScope(s) {
+			return "", nil, fmt.Errorf("unknown scope %q", s)
+		}
+	}
+	token, err := newSecret("brn_")
+	if err != nil {
+		return "", nil, err
+	}
+
+	stored, err := db.addAPIToken(userID, label, token, deviceID, scopes)
+	if err != nil {
+		return "", nil, err
+	}
+	return token, stored, nil
+}
+
+// EnsureUserToken creates the user if needed and registers token, with every scope and
+// no device, unless it already is. Used to seed users from the BRAIN_TOKEN_* environment variables.
+func (db *DB) EnsureUserToken(userID, label, token string) error {
+	if _, err := db.CreateUser(userID, ""); err != nil && !errors.Is(err, ErrUserExists) {
+		return err
+	}
+	var owner string
+	err := db.conn.QueryRow(`SELECT user_id FROM api_tokens WHERE token_hash = ?`, HashToken(token)).Scan(&owner)
+	if err == nil {
+		if owner != userID {
+			return fmt.Errorf("token for %s is already registered to %s", userID, owner)
+		}
+		return nil
+	}
+	if err != sql.ErrNoRows {
+		return err
+	}
+	_, err = db.addAPIToken(userID, label, token, "", AllScopes)
+	return err
+}
+
+func (db *DB) addAPIToken(userID, label, token, deviceID string, scopes []string) (*APIToken, error) {
+	user, err := db.GetUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, ErrUserNotFound
+	}
+
+	now := time.Now().UTC()
+	res, err := db.conn.Exec(`
+		INSERT INTO api_tokens (user_id, token_hash, label, created_at, device_id, scopes) VALUES (?, ?, ?, ?, ?, ?)
+	`, userID, HashToken(token), label, now.Format(time.RFC3339), deviceID, strings.Join(scopes, " "))
+	if err != nil {
+		return nil, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+	return &APIToken{ID: id, UserID: userID, Label: label, DeviceID: deviceID, Scopes: scopes, CreatedAt: now}, nil
+}
+
+// GetAPITokens returns a user's tokens, including revoked ones, oldest first
+func (db *DB) GetAPITokens(userID string) ([]APIToken, error) {
+	rows, err := db.conn.Query(`
+		SELECT id, user_id, label, device_id, scopes, created_at, last_used_at, revoked_at
+		FROM api_tokens WHERE user_id = ? ORDER BY id
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tokens []APIToken
+	for rows.Next() {
+		var t APIToken
+		var scopes, createdAt string
+		var lastUsed, revoked sql.NullString
+		if err := rows.Scan(&t.ID, &t.UserID, &t.Label, &t.DeviceID, &scopes, &createdAt, &lastUsed, &revoked); err != nil {
+			return nil, err
+		}
+		t.Scopes = strings.Fields(scopes)
+		t.CreatedAt, _ = time.Parse(time.RFC3339, createdAt)
+		t.LastUsedAt = parseNullTime(lastUsed)
+		t.RevokedAt = parseNullTime(revoked)
+		tokens = append(tokens, t)
+	}
+	return tokens, rows.Err()
+}
+
+// RevokeAPIToken stops one of a user's tokens working.
+// Returns false if the user has no such token or it is already revoked.
+func (db *DB) RevokeAPIToken(userID string, tokenID int64) (bool, error) {
+	res, err := db.conn.Exec(`
+		UPDATE api_tokens SET revoked_at = ? WHERE id = ? AND user_id = ? AND revoked_at IS NULL
+	`, time.Now().UTC().Format(time.RFC3339), tokenID, userID)
+	if err != nil {
+		return false, err
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
+
+// RevokeDeviceTokens stops all of a user's tokens for one device working, e.g. for a lost phone.
+// Returns the number of tokens revoked.
+func (db *DB) RevokeDeviceTokens(userID, deviceID string) (int, error) {
+	res, err := db.conn.Exec(`
+		UPDATE api_tokens SET revoked_at = ? WHERE user_id = ? AND device_id = ? AND device_id != '' AND revoked_at IS NULL
+	`, time.Now().UTC().Format(time.RFC3339), userID, deviceID)
+	if err != nil {
+		return 0, err
+	}
+	n, _ := res.RowsAffected()
+	return int(n), nil
+}
+
+// AuthenticateToken returns the token record for a valid token, or nil if the token
+// is unknown, revoked or belongs to a disabled user. Records when the token was used.
+func (db *DB) AuthenticateToken(token string) (*APIToken, error) {
+	if token == "" {
+		return nil, nil
+	}
+
+	var t APIToken
+	var scopes, createdAt string
+	var lastUsed sql.NullString
+	err := db.conn.QueryRow(`
+		SELECT t.id, t.user_id, t.label, t.device_id, t.scopes, t.created_at, t.last_used_at
+		FROM api_tokens t JOIN users u ON u.id = t.user_id
+		WHERE t.token_hash = ? AND t.revoked_at IS NULL AND u.disabled_at IS NULL
+	`, HashToken(token)).Scan(&t.ID, &t.UserID, &t.Label, &t.DeviceID, &scopes, &createdAt, &lastUsed)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	t.Scopes = strings.Fields(scopes)
+	t.CreatedAt, _ = time.Parse(time.RFC3339, createdAt)
+	t.LastUsedAt = parseNullTime(lastUsed)
+
+	now := time.Now().UTC()
+	if t.LastUsedAt == nil || now.Sub(*t.LastUsedAt) >= tokenTouchInterval {
+		if _, err := db.conn.Exec(`UPDATE api_tokens SET last_used_at = ? WHERE id = ?`, now.Format(time.RFC3339), t.ID); err != nil {
+			return nil, err
+		}
+		t.LastUsedAt = &now
+	}
+	return &t, nil
+}
+
+// migrateTokenScopes adds the device and scope columns to token tables created before
+// they existed; those tokens keep full access
+func (db *DB) migrateTokenScopes() error {
+	var existing string
+	if err := db.conn.QueryRow(`SELECT sql FROM sqlite_master WHERE type = 'table' AND name = 'api_tokens'`).Scan(&existing); err != nil {
+		return err
+	}
+	if strings.Contains(existing, "scopes") {
+		return nil
+	}
+	for _, stmt := range []string{
+		`ALTER TABLE api_tokens ADD COLUMN device_id TEXT NOT NULL DEFAULT ''`,
+		`ALTER TABLE api_tokens ADD COLUMN scopes TEXT NOT NULL DEFAULT ''`,
+	} {
+		if _, err := db.conn.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	_, err := db.conn.Exec(`UPDATE api_tokens SET scopes = ?`, strings.Join(AllScopes, " "))
+	return err
+}
+
+// newSecret returns a random token with the given prefix
+func newSecret(prefix string) (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("generating token: %w", err)
+	}
+	return prefix + hex.EncodeToString(buf), nil
+}
+
+func parseNullTime(s sql.NullString) *time.Time {
+	if !s.Valid {
+		return nil
+	}
+	t, err := time.Parse(time.RFC3339, s.String)
+	if err != nil {
+		return nil
+	}
+	return &t
+}
@@ -0,0 +1,215 @@
+package embeddings
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/mrwolf/brain-server/internal/db"
+	"github.com/mrwolf/brain-server/internal/llm"
+)
+
+// maxEmbedChars caps the text sent for embedding (well inside an 8k token context)
+const maxEmbedChars = 8000
+
+// MinRelatedScore is the cosine similarity a note needs to be listed as related
+const MinRelatedScore = 0.55
+
+// RelatedKinds are the document kinds that can be linked as related notes (they have vault paths)
+var RelatedKinds = []string{db.DocNote, db.DocResearch}
+
+// Match is a document ranked by cosine similarity
+type Match struct {
+	db.Embedding
+	Score float64
+}
+
+// Embedder embeds indexed documents and answers nearest-neighbour queries
+type Embedder struct {
+	llm *llm.Client
+	db  *db.DB
+}
+
+// NewEmbedder creates a new embedder
+func NewEmbedder(client *llm.Client, database *db.DB) *Embedder {
+	return &Embedder{llm: client, db: database}
+}
+
+// Model returns the embedding model in use
+func (e *Embedder) Model() string {
+	return e.llm.EmbedModel()
+}
+
+// EmbedText returns the normalised embedding for text
+func (e *Embedder) EmbedText(ctx context.Context, text string) ([]float32, error) {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return nil, fmt.Errorf("nothing to embed")
+	}
+	if len(text) > maxEmbedChars {
+		text = text[:maxEmbedChars]
+	}
+
+	vector, err := e.llm.Embed(ctx, text)
+	if err != nil {
+		return nil, fmt.Errorf("embedding text: %w", err)
+	}
+	normalize(vector)
+	return vector, nil
+}
+
+// EmbedDocument embeds an indexed document and stores the vector
+func (e *Embedder) EmbedDocument(ctx context.Context, doc db.SearchDoc) error {
+	vector, err := e.EmbedText(llm.WithActor(ctx, doc.Actor), documentText(doc))
+	if err != nil {
+		return err
+	}
+
+	return e.db.SaveEmbedding(db.Embedding{
+		DocID:    doc.DocID,
+		Kind:     doc.Kind,
+		Actor:    doc.Actor,
+		Category: doc.Category,
+		Title:    doc.Title,
+		Path:     doc.Path,
+		Created:  doc.Created,
+		Model:    e.Model(),
+		Vector:   vector,
+	})
+}
+
+// Backfill embeds up to batch documents that have no vector from the current model.
+// Run repeatedly, this re-embeds the whole index after a model change.
+func (e *Embedder) Backfill(ctx context.Context, batch int) (int, error) {
+	docs, err := e.db.GetDocsToEmbed(e.Model(), batch)
+	if err != nil {
+		return 0, fmt.Errorf("listing documents to embed: %w", err)
+	}
+
+	embedded := 0
+	for _, doc := range docs {
+		if ctx.Err() != nil {
+			return embedded, ctx.Err()
+		}
+		if err := e.EmbedDocument(ctx, doc); err != nil {
+			return embedded, fmt.Errorf("embedding %s %s: %w", doc.Kind, doc.DocID, err)
+		}
+		embedded++
+	}
+	return embedded, nil
+}
+
+// Search ranks an actor's documents ("" for all) by similarity to free text
+func (e *Embedder) Search(ctx context.Context, actor, text string, limit int, kinds ...string) ([]Match, error) {
+	vector, err := e.EmbedText(llm.WithActor(ctx, actor), text)
+	if err != nil {
+		return nil, err
+	}
+	return e.Nearest(actor, vector, limit, 0, "", kinds...)
+}
+
+// SearchVisible ranks the documents reader owns or that were shared with them by
+// similarity to free text
+func (e *Embedder) SearchVisible(ctx context.Context, reader, text string, limit int, kinds ...string) ([]Match, error) {
+	vector, err := e.EmbedText(llm.WithActor(ctx, reader), text)
+	if err != nil {
+		return nil, err
+	}
+	stored, err := e.db.GetVisibleEmbeddings(reader, e.Model(), kinds...)
+	if err != nil {
+		return nil, err
+	}
+	return rank(stored, vector, limit, 0, ""), nil
+}
+
+// Related returns notes similar to an indexed document, excluding the document itself
+func (e *Embedder) Related(ctx context.Context, actor, docID, kind string, limit int) ([]Match, error) {
+	var vector []float32
+	stored, err := e.db.GetEmbedding(docID, kind)
+	if err != nil {
+		return nil, err
+	}
+	if stored != nil && stored.Model == e.Model() {
+		vector = stored.Vector
+	} else {
+		doc, err := e.db.GetSearchDoc(docID, kind)
+		if err != nil {
+			return nil, err
+		}
+		if doc == nil {
+			return nil, nil
+		}
+		if vector, err = e.EmbedText(ctx, documentText(*doc)); err != nil {
+			return nil, err
+		}
+	}
+	return e.Nearest(actor, vector, limit, MinRelatedScore, docID, RelatedKinds...)
+}
+
+// Nearest ranks stored vectors by cosine similarity to vector.
+// Documents scoring below minScore, or with ID excludeID, are dropped.
+func (e *Embedder) Nearest(actor string, vector []float32, limit int, minScore float64, excludeID string, kinds ...string) ([]Match, error) {
+	stored, err := e.db.GetEmbeddings(actor, e.Model(), kinds...)
+	if err != nil {
+		return nil, err
+	}
+	return rank(stored, vector, limit, minScore, excludeID), nil
+}
+
+// rank orders stored vectors by cosine similarity to vector, dropping those scoring
+// below minScore or with ID excludeID
+func rank(stored []db.Embedding, vector []float32, limit int, minScore float64, excludeID string) []Match {
+	var matches []Match
+	for _, emb := range stored {
+		if emb.DocID == excludeID || len(emb.Vector) != len(vector) {
+			continue
+		}
+		score := dot(vector, emb.Vector)
+		if score < minScore {
+			continue
+		}
+		emb.Vector = nil
+		matches = append(matches, Match{Embedding: emb, Score: score})
+	}
+
+	sort.Slice(matches, func(i, j int) bool {
+		return matches[i].Score > matches[j].Score
+	})
+	if limit > 0 && len(matches) > limit {
+		matches = matches[:limit]
+	}
+	return matches
+}
+
+// documentText is what gets embedded for a document
+func documentText(doc db.SearchDoc) string {
+	if doc.Title == "" {
+		return doc.Body
+	}
+	return doc.Title + "\n\n" + doc.Body
+}
+
+// normalize scales v to unit length so cosine similarity is a dot product
+func normalize(v []float32) {
+	var sum float64
+	for _, f := range v {
+		sum += float64(f) * float64(f)
+	}
+	if sum == 0 {
+		return
+	}
+	norm := float32(math.Sqrt(sum))
+	for i := range v {
+		v[i] /= norm
+	}
+}
+
+func dot(a, b []float32) float64 {
+	var sum float64
+	for i := range a {
+		sum += float64(a[i]) * float64(b[i])
+	}
+	return sum
+}
@@ -0,0 +1,224 @@
+package embeddings
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mrwolf/brain-server/internal/db"
+	"github.com/mrwolf/brain-server/internal/llm"
+)
+
+// topics maps words onto vector dimensions so related texts land close together
+var topics = [][]string{
+	{"cardio", "exercise", "bike", "run", "gym"},
+	{"garden", "beds", "seeds", "tomato"},
+	{"budget", "money", "savings"},
+}
+
+func setupTestDB(t *testing.T) (*db.DB, func()) {
+	t.Helper()
+
+	tmpFile, err := os.CreateTemp("", "brain-embed-test-*.db")
+	if err != nil {
+		t.Fatalf("creating temp file: %v", err)
+	}
+	tmpFile.Close()
+
+	database, err := db.Open(tmpFile.Name())
+	if err != nil {
+		os.Remove(tmpFile.Name())
+		t.Fatalf("opening database: %v", err)
+	}
+
+	cleanup := func() {
+		database.Close()
+		os.Remove(tmpFile.Name())
+	}
+
+	return database, cleanup
+}
+
+// stubOllama embeds text as topic word counts, plus a small constant so no vector is zero
+func stubOllama(t *testing.T, calls *int) *httptest.Server {
+	t.Helper()
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/embeddings" {
+			http.NotFound(w, r)
+			return
+		}
+		var req llm.EmbeddingRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		*calls++
+
+		vector := make([]float64, len(topics)+1)
+		vector[len(topics)] = 0.1
+		for _, word := range strings.Fields(strings.ToLower(req.Prompt)) {
+			for i, topic := range topics {
+				for _, w := range topic {
+					if word == w {
+						vector[i]++
+					}
+				}
+			}
+		}
+		json.NewEncoder(w).Encode(llm.EmbeddingResponse{Embedding: vector})
+	}))
+}
+
+func TestBackfillAndSearch(t *testing.T) {
+	database, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	calls := 0
+	server := stubOllama(t, &calls)
+	defer server.Close()
+
+	now := time.Now()
+	docs := []db.SearchDoc{
+		{DocID: "cap_1", Kind: db.DocNote, Actor: "wolf", Title: "New exercise bike", Path: "Health/bike.md", Created: now},
+		{DocID: "cap_2", Kind: db.DocNote, Actor: "wolf", Title: "Raised garden beds", Path: "Ideas/beds.md", Created: now},
+		{DocID: "cap_3", Kind: db.DocNote, Actor: "wife", Title: "Gym membership", Path: "Health/gym.md", Created: now},
+	}
+	for _, doc := range docs {
+		if err := database.IndexSearchDoc(doc); err != nil {
+			t.Fatalf("indexing %s: %v", doc.DocID, err)
+		}
+	}
+
+	client := llm.NewClient(server.URL, "test", "test")
+	embedder := NewEmbedder(client, database)
+
+	n, err := embedder.Backfill(context.Background(), 10)
+	if err != nil {
+		t.Fatalf("backfill: %v", err)
+	}
+	if n != 3 {
+		t.Fatalf("expected 3 documents embedded, got %d", n)
+	}
+
+	// Nothing left to do on the second pass
+	if n, _ := embedder.Backfill(context.Background(), 10); n != 0 {
+		t.Errorf("expected nothing to embed, got %d", n)
+	}
+
+	// "cardio" shares no keyword with "exercise bike" but lands in the same topic
+	matches, err := embedder.Search(context.Background(), "wolf", "cardio", 5)
+	if err != nil {
+		t.Fatalf("search: %v", err)
+	}
+	if len(matches) == 0 || matches[0].DocID != "cap_1" {
+		t.Fatalf("expected cap_1 first, got %+v", matches)
+	}
+	for _, m := range matches {
+		if m.Actor != "wolf" {
+			t.Errorf("search leaked %s's document %s", m.Actor, m.DocID)
+		}
+	}
+
+	// Related never includes the document itself, and drops dissimilar notes
+	related, err := embedder.Related(context.Background(), "wolf", "cap_1", db.DocNote, 5)
+	if err != nil {
+		t.Fatalf("related: %v", err)
+	}
+	for _, m := range related {
+		if m.DocID == "cap_1" || m.DocID == "cap_2" {
+			t.Errorf("unexpected related document %s (score %.2f)", m.DocID, m.Score)
+		}
+	}
+
+	// A model change makes every document due again
+	client.SetEmbedModel("other-model")
+	if n, _ := embedder.Backfill(context.Background(), 10); n != 3 {
+		t.Errorf("expected 3 documents re-embedded after model change, got %d", n)
+	}
+}
+
+func TestReindexInvalidatesEmbedding(t *testing.T) {
+	database, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	calls := 0
+	server := stubOllama(t, &calls)
+	defer server.Close()
+
+	embedder := NewEmbedder(llm.NewClient(server.URL, "test", "test"), database)
+	doc := db.SearchDoc{DocID: "cap_1", Kind: db.DocNote, Actor: "wolf", Title: "Savings plan", Created: time.Now()}
+	database.IndexSearchDoc(doc)
+	if err := embedder.EmbedDocument(context.Background(), doc); err != nil {
+		t.Fatalf("embedding: %v", err)
+	}
+
+	// Re-indexing unchanged text, as Reindex does at every start, keeps the vector
+	doc.Path = "Financial/2024-01-15-savings-plan.md"
+	database.IndexSearchDoc(doc)
+	emb, _ := database.GetEmbedding("cap_1", db.DocNote)
+	if emb == nil || emb.Path != doc.Path {
+		t.Errorf("embedding after unchanged re-index = %+v, want kept with the new path", emb)
+	}
+	if n, _ := database.GetDocsToEmbed(embedder.Model(), 10); len(n) != 0 {
+		t.Errorf("documents to embed = %d, want none", len(n))
+	}
+
+	// Editing the document drops its vector so the job re-embeds it
+	doc.Body = "moved money into the budget"
+	database.IndexSearchDoc(doc)
+	if emb, _ := database.GetEmbedding("cap_1", db.DocNote); emb != nil {
+		t.Error("expected embedding to be invalidated by re-index")
+	}
+}
+
+func TestUnindexedFolders(t *testing.T) {
+	database, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	calls := 0
+	server := stubOllama(t, &calls)
+	defer server.Close()
+
+	embedder := NewEmbedder(llm.NewClient(server.URL, "test", "test"), database)
+	docs := []db.SearchDoc{
+		{DocID: "cap_1", Kind: db.DocNote, Actor: "wolf", Category: "Health", Path: "Health/2024-01-15-blood-pressure.md", Title: "Blood pressure", Body: "120/80"},
+		{DocID: "cap_1", Kind: db.DocCapture, Actor: "wolf", Category: "Health", Body: "blood pressure 120/80"},
+		{DocID: "cap_2", Kind: db.DocNote, Actor: "wolf", Category: "Ideas", Path: "Ideas/2024-01-15-rain-clock.md", Title: "Rain clock", Body: "a clock"},
+	}
+	for _, doc := range docs {
+		doc.Created = time.Now()
+		database.IndexSearchDoc(doc)
+		if err := embedder.EmbedDocument(context.Background(), doc); err != nil {
+			t.Fatalf("embedding: %v", err)
+		}
+	}
+
+	// Turning it on drops what was indexed there, and later writes stay out
+	if err := database.SetUnindexedFolders([]string{"Health"}); err != nil {
+		t.Fatalf("SetUnindexedFolders: %v", err)
+	}
+	health := db.SearchDoc{DocID: "cap_3", Kind: db.DocNote, Actor: "wolf", Category: "Health", Path: "Health/2024-01-16-cold.md", Title: "Cold", Body: "sniffles", Created: time.Now()}
+	database.IndexSearchDoc(health)
+	if err := embedder.EmbedDocument(context.Background(), health); err != nil {
+		t.Fatalf("embedding: %v", err)
+	}
+
+	tests := []struct {
+		docID, kind string
+		indexed     bool
+	}{
+		{"cap_1", db.DocNote, false},
+		{"cap_1", db.DocCapture, false},
+		{"cap_2", db.DocNote, true},
+		{"cap_3", db.DocNote, false},
+	}
+	for _, tt := range tests {
+		doc, _ := database.GetSearchDoc(tt.docID, tt.kind)
+		emb, _ := database.GetEmbedding(tt.docID, tt.kind)
+		if (doc != nil) != tt.indexed || (emb != nil) != tt.indexed {
+			t.Errorf("%s %s: document %v, embedding %v, want indexed %v", tt.kind, tt.docID, doc != nil, emb != nil, tt.indexed)
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package llm
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned without contacting the provider while the breaker is open
+var ErrCircuitOpen = errors.New("LLM backend unavailable (circuit open)")
+
+// BreakerState is the state of a circuit breaker
+type BreakerState string
+
+// Breaker states
+const (
+	BreakerClosed   BreakerState = "closed"    // calls go through
+	BreakerOpen     BreakerState = "open"      // calls fail fast until the cooldown passes
+	BreakerHalfOpen BreakerState = "half_open" // one probe call is allowed through
+)
+
+// Breaker stops calls to a failing backend. It opens after threshold consecutive
+// failures (or a failed health check), fails calls fast for cooldown, then lets a
+// single probe through: success closes it, failure re-opens it.
+type Breaker struct {
+	mu        sync.Mutex
+	threshold int
+	cooldown  time.Duration
+	state     BreakerState
+	failures  int
+	openedAt  time.Time
+	lastError string
+	probing   bool
+	now       func() time.Time
+}
+
+// BreakerStats is a snapshot of the breaker
+type BreakerStats struct {
+	State     BreakerState `json:"state"`
+	Failures  int          `json:"consecutive_failures"`
+	OpenedAt  *time.Time   `json:"opened_at,omitempty"`
+	LastError string       `json:"last_error,omitempty"`
+}
+
+// NewBreaker creates a closed breaker (threshold at least 1)
+func NewBreaker(threshold int, cooldown time.Duration) *Breaker {
+	if threshold < 1 {
+		threshold = 1
+	}
+	return &Breaker{
+		threshold: threshold,
+		cooldown:  cooldown,
+		state:     BreakerClosed,
+		now:       time.Now,
+	}
+}
+
+// Allow reports whether a call may go ahead, claiming the probe when half open.
+// Every allowed call must be followed by Report or Abandon.
+func (b *Breaker) Allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case BreakerClosed:
+		return nil
+	case BreakerOpen:
+		if b.now().Sub(b.openedAt) < b.cooldown {
+			return ErrCircuitOpen
+		}
+		b.state = BreakerHalfOpen
+	}
+	if b.probing {
+		return ErrCircuitOpen
+	}
+	b.probing = true
+	return nil
+}
+
+// Ready reports whether Allow would currently let a call through, without claiming the probe
+func (b *Breaker) Ready() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case BreakerClosed:
+		return true
+	case BreakerOpen:
+		return b.now().Sub(b.openedAt) >= b.cooldown
+	}
+	return !b.probing
+}
+
+// Report records the outcome of an allowed call
+func (b *Breaker) Report(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probing = false
+	if err == nil {
+		b.state = BreakerClosed
+		b.failures = 0
+		return
+	}
+
+	b.failures++
+	b.lastError = err.Error()
+	if b.state == BreakerHalfOpen || b.failures >= b.threshold {
+		b.openLocked()
+	}
+}
+
+// Abandon releases an allowed call that ended without saying anything about the backend,
+// e.g. because the caller gave up
+func (b *Breaker) Abandon() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+}
+
+// Trip opens the breaker immediately, e.g. after a failed health check
+func (b *Breaker) Trip(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures++
+	b.lastError = err.Error()
+	b.openLocked()
+}
+
+// State returns the current state
+func (b *Breaker) State() BreakerState {
+	return b.Stats().State
+}
+
+// Stats returns a snapshot of the breaker
+func (b *Breaker) Stats() BreakerStats {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	stats := BreakerStats{
+		State:     b.state,
+		Failures:  b.failures,
+		LastError: b.lastError,
+	}
+	if b.state != BreakerClosed {
+		openedAt := b.openedAt
+		stats.OpenedAt = &openedAt
+	}
+	return stats
+}
+
+func (b *Breaker) openLocked() {
+	b.state = BreakerOpen
+	b.openedAt = b.now()
+}
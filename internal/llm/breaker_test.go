@@ -0,0 +1,112 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestBreaker(t *testing.T) {
+	now := time.Now()
+	b := NewBreaker(2, time.Minute)
+	b.now = func() time.Time { return now }
+	fail := errors.New("connection refused")
+
+	steps := []struct {
+		name    string
+		do      func()
+		want    BreakerState
+		allowed bool
+	}{
+		{"starts closed", func() {}, BreakerClosed, true},
+		{"one failure stays closed", func() { b.Report(fail) }, BreakerClosed, true},
+		{"success resets the count", func() { b.Report(nil); b.Report(fail) }, BreakerClosed, true},
+		{"threshold opens", func() { b.Report(fail) }, BreakerOpen, false},
+		{"still open within cooldown", func() { now = now.Add(30 * time.Second) }, BreakerOpen, false},
+		{"cooldown allows a probe", func() { now = now.Add(31 * time.Second) }, BreakerOpen, true},
+		{"failed probe reopens", func() { b.Allow(); b.Report(fail) }, BreakerOpen, false},
+		{"successful probe closes", func() { now = now.Add(time.Minute); b.Allow(); b.Report(nil) }, BreakerClosed, true},
+		{"trip opens immediately", func() { b.Trip(fail) }, BreakerOpen, false},
+		{"health success closes", func() { b.Report(nil) }, BreakerClosed, true},
+	}
+
+	for _, step := range steps {
+		step.do()
+		if got := b.State(); got != step.want {
+			t.Errorf("%s: state = %s, want %s", step.name, got, step.want)
+		}
+		if got := b.Ready(); got != step.allowed {
+			t.Errorf("%s: ready = %v, want %v", step.name, got, step.allowed)
+		}
+	}
+}
+
+func TestBreakerSingleProbe(t *testing.T) {
+	now := time.Now()
+	b := NewBreaker(1, time.Minute)
+	b.now = func() time.Time { return now }
+	b.Report(errors.New("down"))
+	now = now.Add(2 * time.Minute)
+
+	if err := b.Allow(); err != nil {
+		t.Fatalf("first call after cooldown: %v", err)
+	}
+	if err := b.Allow(); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("second call during probe = %v, want ErrCircuitOpen", err)
+	}
+	b.Abandon()
+	if err := b.Allow(); err != nil {
+		t.Errorf("call after abandoned probe: %v", err)
+	}
+}
+
+func TestClientBreakerFailsFast(t *testing.T) {
+	var calls atomic.Int32
+	var healthy atomic.Bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		if !healthy.Load() {
+			http.Error(w, "model runner crashed", http.StatusInternalServerError)
+			return
+		}
+		if r.URL.Path == "/api/tags" {
+			w.Write([]byte(`{"models": []}`))
+			return
+		}
+		json.NewEncoder(w).Encode(GenerateResponse{Response: "ok", Done: true})
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, "test", "test")
+	client.SetRoutes(Routes{TaskMood: {MaxAttempts: 3, Backoff: time.Millisecond}})
+	client.SetBreaker(NewBreaker(3, time.Hour))
+
+	if _, err := client.GenerateText(context.Background(), TaskMood, "hi"); err == nil {
+		t.Fatal("expected error from failing backend")
+	}
+	if _, err := client.GenerateText(context.Background(), TaskMood, "hi"); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("second call error = %v, want ErrCircuitOpen", err)
+	}
+	if calls.Load() != 3 {
+		t.Errorf("provider calls = %d, want 3 (none once open)", calls.Load())
+	}
+	if client.Available() {
+		t.Error("Available() = true with an open breaker")
+	}
+
+	healthy.Store(true)
+	if err := client.HealthCheck(context.Background()); err != nil {
+		t.Fatalf("HealthCheck: %v", err)
+	}
+	if !client.Available() || client.BreakerStats().State != BreakerClosed {
+		t.Errorf("breaker = %+v after a healthy check, want closed", client.BreakerStats())
+	}
+	if _, err := client.GenerateText(context.Background(), TaskMood, "hi"); err != nil {
+		t.Errorf("call after recovery: %v", err)
+	}
+}
@@ -0,0 +1,29 @@
+package llm
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"time"
+)
+
+// Cache stores responses for tasks that opt in with a CacheTTL
+type Cache interface {
+	// GetLLMCache returns an unexpired response for key
+	GetLLMCache(key string) (response string, ok bool, err error)
+	// PutLLMCache stores the response to actor's request
+	PutLLMCache(key, actor string, task Task, model, response string, ttl time.Duration) error
+	DeleteLLMCache(key string) error
+}
+
+// CacheKey identifies a request by provider, model, prompt and every option that changes the output
+func CacheKey(provider string, req CompletionRequest) string {
+	temperature := "default"
+	if req.Temperature != nil {
+		temperature = fmt.Sprintf("%g", *req.Temperature)
+	}
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\x00%s\x00%s\x00%s\x00%t\x00%s\x00%s\x00%d",
+		provider, req.Model, req.System, req.Prompt, req.JSON, compactSchema(req.Schema), temperature, req.NumCtx)
+	return hex.EncodeToString(h.Sum(nil))
+}
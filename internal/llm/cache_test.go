@@ -0,0 +1,121 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type cacheStub struct {
+	entries map[string]string
+	actors  map[string]string
+}
+
+func (c *cacheStub) GetLLMCache(key string) (string, bool, error) {
+	response, ok := c.entries[key]
+	return response, ok, nil
+}
+
+func (c *cacheStub) PutLLMCache(key, actor string, task Task, model, response string, ttl time.Duration) error {
+	c.entries[key] = response
+	c.actors[key] = actor
+	return nil
+}
+
+func (c *cacheStub) DeleteLLMCache(key string) error {
+	delete(c.entries, key)
+	return nil
+}
+
+func TestClientCache(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		json.NewEncoder(w).Encode(GenerateResponse{Response: `{"label": "a", "score": 0.5}`, Done: true})
+	}))
+	defer server.Close()
+
+	cache := &cacheStub{entries: make(map[string]string), actors: make(map[string]string)}
+	client := NewClient(server.URL, "light", "heavy")
+	client.SetCache(cache)
+	client.SetRoutes(Routes{TaskClassify: {CacheTTL: time.Hour}})
+	ctx := WithActor(context.Background(), "wolf")
+
+	for i := 0; i < 2; i++ {
+		if _, err := client.Generate(ctx, TaskClassify, "same prompt"); err != nil {
+			t.Fatalf("Generate: %v", err)
+		}
+	}
+	if calls.Load() != 1 {
+		t.Errorf("cached task calls = %d, want 1", calls.Load())
+	}
+
+	client.Generate(ctx, TaskClassify, "another prompt")
+	if calls.Load() != 2 {
+		t.Errorf("calls after new prompt = %d, want 2", calls.Load())
+	}
+
+	// Tasks without a TTL always reach the model
+	client.Generate(ctx, TaskMood, "same prompt")
+	client.Generate(ctx, TaskMood, "same prompt")
+	if calls.Load() != 4 {
+		t.Errorf("calls for uncached task = %d, want 4", calls.Load())
+	}
+	if len(cache.entries) != 2 {
+		t.Errorf("cache entries = %d, want 2", len(cache.entries))
+	}
+	for key, actor := range cache.actors {
+		if actor != "wolf" {
+			t.Errorf("cache entry %s stored for %q, want wolf", key, actor)
+		}
+	}
+}
+
+func TestCacheKeyIncludesOptions(t *testing.T) {
+	cold, warm := 0.0, 0.7
+	base := CompletionRequest{Model: "m", Prompt: "p", Temperature: &cold}
+	variants := []CompletionRequest{
+		{Model: "other", Prompt: "p", Temperature: &cold},
+		{Model: "m", Prompt: "p2", Temperature: &cold},
+		{Model: "m", Prompt: "p", Temperature: &warm},
+		{Model: "m", Prompt: "p", Temperature: &cold, NumCtx: 8192},
+		{Model: "m", Prompt: "p", Temperature: &cold, JSON: true},
+		{Model: "m", System: "s", Prompt: "p", Temperature: &cold},
+	}
+	key := CacheKey(ProviderOllama, base)
+	if key != CacheKey(ProviderOllama, base) {
+		t.Error("CacheKey is not deterministic")
+	}
+	if key == CacheKey(ProviderOpenAI, base) {
+		t.Error("provider should change the key")
+	}
+	for i, v := range variants {
+		if CacheKey(ProviderOllama, v) == key {
+			t.Errorf("variant %d has the same key as the base request", i)
+		}
+	}
+}
+
+func TestGenerateJSONDoesNotCacheInvalidOutput(t *testing.T) {
+	server, _ := stubStructured(t, `{"label": "c", "score": 0.5}`, `{"label": "a", "score": 0.5}`)
+	defer server.Close()
+
+	cache := &cacheStub{entries: make(map[string]string), actors: make(map[string]string)}
+	client := NewClient(server.URL, "light", "heavy")
+	client.SetCache(cache)
+	client.SetRoutes(Routes{TaskClassify: {CacheTTL: time.Hour}})
+
+	var out testResult
+	if err := client.GenerateJSON(context.Background(), TaskClassify, "", "label this", json.RawMessage(testSchema), &out); err != nil {
+		t.Fatalf("GenerateJSON: %v", err)
+	}
+	for _, response := range cache.entries {
+		if response == `{"label": "c", "score": 0.5}` {
+			t.Error("invalid response left in the cache")
+		}
+	}
+}
@@ -0,0 +1,416 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+// DefaultEmbedModel is the embedding model used unless SetEmbedModel is called
+const DefaultEmbedModel = "nomic-embed-text"
+
+// Client is the LLM entry point used across the server.
+// Every call names a task; the routing table picks the model, options and retry policy.
+type Client struct {
+	provider   Provider
+	model      string
+	modelHeavy string
+	embedModel string
+	routes     Routes
+	recorder   Recorder
+	cache      Cache
+	queue      *Queue
+	breaker    *Breaker
+	redaction  RedactionPolicy
+}
+
+// NewClient creates a new client backed by Ollama
+func NewClient(baseURL, model, modelHeavy string) *Client {
+	return NewClientWithProvider(NewOllamaProvider(baseURL), model, modelHeavy)
+}
+
+// NewClientWithProvider creates a new client backed by any provider
+func NewClientWithProvider(provider Provider, model, modelHeavy string) *Client {
+	return &Client{
+		provider:   provider,
+		model:      model,
+		modelHeavy: modelHeavy,
+		embedModel: DefaultEmbedModel,
+		routes:     DefaultRoutes(model, modelHeavy),
+	}
+}
+
+// ProviderName returns the name of the backing provider
+func (c *Client) ProviderName() string {
+	return c.provider.Name()
+}
+
+// SetRoutes overlays task settings onto the default routing table
+func (c *Client) SetRoutes(overrides Routes) {
+	c.routes = DefaultRoutes(c.model, c.modelHeavy).Merge(overrides)
+}
+
+// SetRecorder sets where every call is recorded (nil disables recording)
+func (c *Client) SetRecorder(r Recorder) {
+	c.recorder = r
+}
+
+// SetCache sets the response cache used by tasks with a CacheTTL (nil disables caching)
+func (c *Client) SetCache(cache Cache) {
+	c.cache = cache
+}
+
+// SetConcurrency limits concurrent provider calls, queueing the rest by priority
+// (limit < 1 removes the limit)
+func (c *Client) SetConcurrency(limit int) {
+	if limit < 1 {
+		c.queue = nil
+		return
+	}
+	c.queue = NewQueue(limit)
+}
+
+// QueueStats returns queue depth and wait metrics (zero when calls are not limited)
+func (c *Client) QueueStats() QueueStats {
+	if c.queue == nil {
+		return QueueStats{Priorities: map[string]PriorityStats{}}
+	}
+	return c.queue.Stats()
+}
+
+// SetBreaker sets the circuit breaker that fails calls fast while the backend is down
+// (nil disables it)
+func (c *Client) SetBreaker(b *Breaker) {
+	c.breaker = b
+}
+
+// SetRedaction sets what is redacted from text before it is sent, by user (see WithActor)
+func (c *Client) SetRedaction(p RedactionPolicy) {
+	c.redaction = p
+}
+
+// Available reports whether calls would currently reach the provider.
+// False while the circuit breaker is open; callers should defer LLM work.
+func (c *Client) Available() bool {
+	return c.breaker == nil || c.breaker.Ready()
+}
+
+// BreakerStats returns the circuit breaker state (always closed when there is no breaker)
+func (c *Client) BreakerStats() BreakerStats {
+	if c.breaker == nil {
+		return BreakerStats{State: BreakerClosed}
+	}
+	return c.breaker.Stats()
+}
+
+// Route returns the settings used for a task
+// Unknown tasks get the light model with default policy.
+func (c *Client) Route(task Task) TaskSettings {
+	if s, ok := c.routes[task]; ok {
+		return s
+	}
+	return TaskSettings{Model: c.model, Timeout: defaultTimeout, MaxAttempts: defaultMaxAttempts, Backoff: defaultBackoff, Priority: PriorityNormal}
+}
+
+// Generate sends a prompt for a task and returns the response, constrained to JSON
+// Retries per the task's policy with exponential backoff
+func (c *Client) Generate(ctx context.Context, task Task, prompt string) (string, error) {
+	return c.complete(ctx, task, CompletionRequest{Prompt: prompt, JSON: true})
+}
+
+// GenerateText sends a prompt for a task without JSON format requirement
+// Retries per the task's policy with exponential backoff
+func (c *Client) GenerateText(ctx context.Context, task Task, prompt string) (string, error) {
+	return c.complete(ctx, task, CompletionRequest{Prompt: prompt})
+}
+
+// GenerateTextStream is GenerateText that passes text to onChunk as it is generated,
+// returning the full response at the end. A failed attempt is retried only if nothing
+// was streamed yet; an error from onChunk (e.g. the listener went away) stops generation.
+// A nil onChunk behaves like GenerateText.
+func (c *Client) GenerateTextStream(ctx context.Context, task Task, prompt string, onChunk func(string) error) (string, error) {
+	if onChunk == nil {
+		return c.GenerateText(ctx, task, prompt)
+	}
+
+	req := CompletionRequest{Prompt: prompt}
+	c.redaction.Redact(actorFor(ctx), &req.Prompt)
+
+	settings, req := c.prepare(task, req)
+	rec := CallRecord{Task: task, Model: req.Model, PromptHash: PromptHash(req.System, req.Prompt), StartedAt: time.Now()}
+	streamed := false
+	var completion Completion
+	attempts, err := retry(ctx, settings, c.admit(settings.Priority), func(ctx context.Context) error {
+		var err error
+		completion, err = c.provider.Stream(ctx, req, func(chunk string) error {
+			streamed = true
+			if err := onChunk(chunk); err != nil {
+				return &permanentError{err}
+			}
+			return nil
+		})
+		if err != nil && streamed {
+			return &permanentError{err}
+		}
+		return err
+	})
+	if err == nil {
+		rec.setUsage(completion)
+	}
+	c.record(rec, attempts, err)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", task, err)
+	}
+	return completion.Text, nil
+}
+
+// GenerateWithSystem sends a plain-text prompt with a separate system prompt
+// Retries per the task's policy with exponential backoff
+func (c *Client) GenerateWithSystem(ctx context.Context, task Task, system, prompt string) (string, error) {
+	return c.complete(ctx, task, CompletionRequest{System: system, Prompt: prompt})
+}
+
+// GenerateJSON sends a prompt constrained to a JSON schema and decodes the response into out.
+// Output that fails the schema, the struct or its Validate method gets one repair prompt;
+// if the repaired output is still invalid a *SchemaError is returned.
+func (c *Client) GenerateJSON(ctx context.Context, task Task, system, prompt string, schema json.RawMessage, out interface{}) error {
+	req := CompletionRequest{System: system, Prompt: prompt, JSON: true, Schema: schema}
+	response, err := c.complete(ctx, task, req)
+	if err != nil {
+		return err
+	}
+	invalid := DecodeStrict(response, schema, out)
+	if invalid == nil {
+		return nil
+	}
+	c.evict(ctx, task, req) // never serve invalid output from the cache
+
+	log.Printf("%s: invalid structured output, sending repair prompt: %v", task, invalid)
+	req.Prompt = fmt.Sprintf(repairPrompt, prompt, response, invalid)
+	response, err = c.complete(ctx, task, req)
+	if err != nil {
+		return err
+	}
+	if invalid := DecodeStrict(response, schema, out); invalid != nil {
+		return &SchemaError{Task: task, Response: response, Err: invalid}
+	}
+	return nil
+}
+
+// SetEmbedModel sets the model used for embeddings
+func (c *Client) SetEmbedModel(model string) {
+	if model != "" {
+		c.embedModel = model
+	}
+}
+
+// EmbedModel returns the model used for embeddings
+func (c *Client) EmbedModel() string {
+	return c.embedModel
+}
+
+// Embed returns the embedding vector for text
+// Includes retry logic with exponential backoff (up to 3 attempts)
+func (c *Client) Embed(ctx context.Context, text string) ([]float32, error) {
+	policy := TaskSettings{Timeout: defaultTimeout, MaxAttempts: defaultMaxAttempts, Backoff: defaultBackoff, Priority: PriorityBackground}
+
+	c.redaction.Redact(actorFor(ctx), &text)
+	rec := CallRecord{Task: TaskEmbed, Model: c.embedModel, PromptHash: PromptHash("", text), StartedAt: time.Now()}
+	var vector []float32
+	attempts, err := retry(ctx, policy, c.admit(policy.Priority), func(ctx context.Context) error {
+		var err error
+		vector, err = c.provider.Embed(ctx, c.embedModel, text)
+		return err
+	})
+	c.record(rec, attempts, err)
+	return vector, err
+}
+
+// HealthCheck checks if the provider is reachable
+// The result feeds the circuit breaker: a failure opens it, a success closes it.
+func (c *Client) HealthCheck(ctx context.Context) error {
+	err := c.provider.HealthCheck(ctx)
+	if c.breaker != nil {
+		if err != nil {
+			c.breaker.Trip(err)
+		} else {
+			c.breaker.Report(nil)
+		}
+	}
+	return err
+}
+
+// prepare applies the task's route to a request
+func (c *Client) prepare(task Task, req CompletionRequest) (TaskSettings, CompletionRequest) {
+	settings := c.Route(task)
+	req.Model = settings.Model
+	req.Temperature = settings.Temperature
+	req.NumCtx = settings.NumCtx
+	return settings, req
+}
+
+// complete redacts the request for the user on ctx, runs it (or serves it from the
+// cache) and restores redacted values in the response fields set by WithRestore
+func (c *Client) complete(ctx context.Context, task Task, req CompletionRequest) (string, error) {
+	redaction := c.redaction.Redact(actorFor(ctx), &req.System, &req.Prompt)
+	settings, req := c.prepare(task, req)
+
+	var cacheKey string
+	if c.cache != nil && settings.CacheTTL > 0 {
+		cacheKey = CacheKey(c.provider.Name(), req)
+		if response, ok, err := c.cache.GetLLMCache(cacheKey); err != nil {
+			log.Printf("Failed to read %s cache: %v", task, err)
+		} else if ok {
+			return redaction.RestoreFields(response, restoreFor(ctx)), nil
+		}
+	}
+
+	rec := CallRecord{Task: task, Model: req.Model, PromptHash: PromptHash(req.System, req.Prompt), StartedAt: time.Now()}
+	var completion Completion
+	attempts, err := retry(ctx, settings, c.admit(settings.Priority), func(ctx context.Context) error {
+		var err error
+		completion, err = c.provider.Complete(ctx, req)
+		return err
+	})
+	if err == nil {
+		rec.setUsage(completion)
+	}
+	c.record(rec, attempts, err)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", task, err)
+	}
+
+	if cacheKey != "" {
+		if err := c.cache.PutLLMCache(cacheKey, actorFor(ctx), task, req.Model, completion.Text, settings.CacheTTL); err != nil {
+			log.Printf("Failed to write %s cache: %v", task, err)
+		}
+	}
+	return redaction.RestoreFields(completion.Text, restoreFor(ctx)), nil
+}
+
+// evict drops a cached response for a request, if the task is cached
+func (c *Client) evict(ctx context.Context, task Task, req CompletionRequest) {
+	c.redaction.Redact(actorFor(ctx), &req.System, &req.Prompt)
+	settings, req := c.prepare(task, req)
+	if c.cache == nil || settings.CacheTTL <= 0 {
+		return
+	}
+	if err := c.cache.DeleteLLMCache(CacheKey(c.provider.Name(), req)); err != nil {
+		log.Printf("Failed to evict %s cache entry: %v", task, err)
+	}
+}
+
+// record completes rec and hands it to the recorder; failures are logged, never returned
+func (c *Client) record(rec CallRecord, attempts int, err error) {
+	if c.recorder == nil {
+		return
+	}
+	rec.Provider = c.provider.Name()
+	rec.Duration = time.Since(rec.StartedAt)
+	rec.Attempts = attempts
+	if err != nil {
+		rec.Error = err.Error()
+	}
+	if recErr := c.recorder.RecordLLMCall(rec); recErr != nil {
+		log.Printf("Failed to record %s call: %v", rec.Task, recErr)
+	}
+}
+
+// admit returns the admission check run before each attempt: a queue slot, then the
+// circuit breaker. The returned done func frees the slot and reports the attempt's
+// outcome to the breaker. The priority set on the call's context, if any, overrides the task's.
+func (c *Client) admit(priority Priority) func(ctx context.Context) (func(error), error) {
+	if c.queue == nil && c.breaker == nil {
+		return nil
+	}
+	return func(ctx context.Context) (func(error), error) {
+		release := func() {}
+		if c.queue != nil {
+			var err error
+			if release, err = c.queue.Acquire(ctx, priorityFor(ctx, priority)); err != nil {
+				return nil, err
+			}
+		}
+		if c.breaker == nil {
+			return func(error) { release() }, nil
+		}
+		if err := c.breaker.Allow(); err != nil {
+			release()
+			return nil, err
+		}
+		return func(err error) {
+			release()
+			if err != nil && ctx.Err() != nil {
+				// The caller gave up; that says nothing about the backend
+				c.breaker.Abandon()
+				return
+			}
+			c.breaker.Report(err)
+		}, nil
+	}
+}
+
+// retry runs fn up to policy.MaxAttempts times, each under policy.Timeout,
+// waiting policy.Backoff before the first retry and doubling after that.
+// If admit is set each attempt first waits for it (outside the attempt timeout) and
+// reports its outcome afterwards; an admission error ends the call without further
+// attempts. Returns the number of attempts made.
+func retry(ctx context.Context, policy TaskSettings, admit func(ctx context.Context) (func(error), error), fn func(ctx context.Context) error) (int, error) {
+	attempts := policy.MaxAttempts
+	if attempts < 1 {
+		attempts = 1
+	}
+
+	var lastErr error
+	for attempt := 0; attempt < attempts; attempt++ {
+		if attempt > 0 {
+			backoff := policy.Backoff * time.Duration(1<<uint(attempt-1))
+			select {
+			case <-ctx.Done():
+				return attempt, ctx.Err()
+			case <-time.After(backoff):
+			}
+		}
+
+		done := func(error) {}
+		if admit != nil {
+			var err error
+			if done, err = admit(ctx); err != nil {
+				return attempt, err
+			}
+		}
+
+		attemptCtx, cancel := ctx, context.CancelFunc(func() {})
+		if policy.Timeout > 0 {
+			attemptCtx, cancel = context.WithTimeout(ctx, policy.Timeout)
+		}
+		lastErr = fn(attemptCtx)
+		cancel()
+		done(lastErr)
+		if lastErr == nil {
+			return attempt + 1, nil
+		}
+		var perm *permanentError
+		if errors.As(lastErr, &perm) {
+			return attempt + 1, perm.err
+		}
+	}
+
+	return attempts, fmt.Errorf("after %d attempts: %w", attempts, lastErr)
+}
+
+// permanentError stops retry without further attempts
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e *permanentError) Unwrap() error {
+	return e.err
+}
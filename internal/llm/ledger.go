@@ -0,0 +1,51 @@
+package llm
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+)
+
+// TaskEmbed labels embedding calls in the ledger; embeddings are not routed
+const TaskEmbed Task = "embed"
+
+// CallRecord describes one Client call, including all of its retries
+type CallRecord struct {
+	Task       Task
+	Provider   string
+	Model      string
+	PromptHash string // sha256 of system + prompt, so repeated prompts can be grouped without storing text
+	StartedAt  time.Time
+	Duration   time.Duration // wall time across all attempts and backoff
+	Attempts   int
+	Error      string // empty on success
+
+	// Usage from the successful attempt, as reported by the provider
+	PromptEvalCount int
+	EvalCount       int
+	TotalDuration   time.Duration
+	LoadDuration    time.Duration
+	PromptDuration  time.Duration
+	EvalDuration    time.Duration
+}
+
+// setUsage copies the provider's usage figures into the record
+func (rec *CallRecord) setUsage(c Completion) {
+	rec.PromptEvalCount = c.PromptEvalCount
+	rec.EvalCount = c.EvalCount
+	rec.TotalDuration = c.TotalDuration
+	rec.LoadDuration = c.LoadDuration
+	rec.PromptDuration = c.PromptDuration
+	rec.EvalDuration = c.EvalDuration
+}
+
+// Recorder stores call records
+type Recorder interface {
+	RecordLLMCall(rec CallRecord) error
+}
+
+// PromptHash returns the hash recorded for a prompt
+func PromptHash(system, prompt string) string {
+	sum := sha256.Sum256([]byte(system + "\x00" + prompt))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,67 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type recorderStub struct {
+	records []CallRecord
+}
+
+func (r *recorderStub) RecordLLMCall(rec CallRecord) error {
+	r.records = append(r.records, rec)
+	return nil
+}
+
+func TestClientRecordsCalls(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req GenerateRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		if req.Prompt == "fail" {
+			http.Error(w, "model crashed", http.StatusInternalServerError)
+			return
+		}
+		json.NewEncoder(w).Encode(GenerateResponse{
+			Response:        "ok",
+			Done:            true,
+			TotalDuration:   int64(2 * time.Second),
+			PromptEvalCount: 42,
+			EvalCount:       7,
+		})
+	}))
+	defer server.Close()
+
+	recorder := &recorderStub{}
+	client := NewClient(server.URL, "light", "heavy")
+	client.SetRecorder(recorder)
+	client.SetRoutes(Routes{TaskDailyLetter: {MaxAttempts: 2, Backoff: time.Millisecond}})
+
+	if _, err := client.GenerateText(context.Background(), TaskClassify, "hello"); err != nil {
+		t.Fatalf("GenerateText: %v", err)
+	}
+	if _, err := client.GenerateText(context.Background(), TaskDailyLetter, "fail"); err == nil {
+		t.Fatal("expected error from failing call")
+	}
+
+	if len(recorder.records) != 2 {
+		t.Fatalf("records = %d, want 2", len(recorder.records))
+	}
+	ok, failed := recorder.records[0], recorder.records[1]
+	if ok.Task != TaskClassify || ok.Model != "light" || ok.Provider != ProviderOllama || ok.Attempts != 1 || ok.Error != "" {
+		t.Errorf("unexpected success record: %+v", ok)
+	}
+	if ok.PromptEvalCount != 42 || ok.EvalCount != 7 || ok.TotalDuration != 2*time.Second {
+		t.Errorf("usage not recorded: %+v", ok)
+	}
+	if ok.PromptHash != PromptHash("", "hello") {
+		t.Errorf("prompt hash = %q", ok.PromptHash)
+	}
+	if failed.Task != TaskDailyLetter || failed.Attempts != 2 || failed.Error == "" {
+		t.Errorf("unexpected failure record: %+v", failed)
+	}
+}
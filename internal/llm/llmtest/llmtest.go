@@ -0,0 +1,243 @@
+// Package llmtest provides a scripted fake LLM backend for tests.
+//
+// Server is an httptest server speaking the subset of the Ollama API that
+// llm.OllamaProvider uses (generate, streaming generate, embeddings and tags),
+// so tests exercise the real client, retry and decoding paths. Responses are
+// canned and matched by prompt pattern:
+//
+//	fake := llmtest.NewServer(t)
+//	fake.On(`personal note classifier`, `{"category": "Ideas", ...}`)
+//	client := fake.LLM()
+package llmtest
+
+import (
+	"encoding/json"
+	"hash/fnv"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/mrwolf/brain-server/internal/llm"
+)
+
+// EmbeddingDims is the length of the vectors returned by the fake embeddings endpoint
+const EmbeddingDims = 64
+
+// Call is one generate request received by the fake
+type Call struct {
+	Model    string
+	System   string
+	Prompt   string
+	JSON     bool // a format (plain JSON or a schema) was requested
+	Stream   bool
+	Response string // empty when no rule matched
+}
+
+type rule struct {
+	pattern *regexp.Regexp
+	respond func(Call) string
+}
+
+// Server is a scripted Ollama API
+type Server struct {
+	*httptest.Server
+	t testing.TB
+
+	mu    sync.Mutex
+	rules []rule
+	calls []Call
+	down  bool
+}
+
+// NewServer starts a fake backend that is closed when the test ends
+func NewServer(t testing.TB) *Server {
+	t.Helper()
+	s := &Server{t: t}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/generate", s.generate)
+	mux.HandleFunc("/api/embeddings", s.embeddings)
+	mux.HandleFunc("/api/tags", s.tags)
+	s.Server = httptest.NewServer(mux)
+	t.Cleanup(s.Close)
+	return s
+}
+
+// On responds with response to prompts matching pattern, a regular expression
+// matched against the system prompt and prompt joined by a newline.
+// Rules are tried in the order they were added; the first match wins.
+func (s *Server) On(pattern, response string) *Server {
+	return s.OnFunc(pattern, func(Call) string { return response })
+}
+
+// OnFunc is On with a response computed from the call
+func (s *Server) OnFunc(pattern string, respond func(Call) string) *Server {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rules = append(s.rules, rule{pattern: regexp.MustCompile(pattern), respond: respond})
+	return s
+}
+
+// SetDown makes every endpoint fail with a server error, as a crashed backend would
+func (s *Server) SetDown(down bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.down = down
+}
+
+// LLM returns a client for the fake, with "fake" and "fake-heavy" as its models
+func (s *Server) LLM() *llm.Client {
+	return llm.NewClient(s.URL, "fake", "fake-heavy")
+}
+
+// Calls returns the generate requests received so far
+func (s *Server) Calls() []Call {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Call(nil), s.calls...)
+}
+
+// CallsMatching returns the generate requests whose prompt matches pattern
+func (s *Server) CallsMatching(pattern string) []Call {
+	re := regexp.MustCompile(pattern)
+	var matched []Call
+	for _, c := range s.Calls() {
+		if re.MatchString(c.System + "\n" + c.Prompt) {
+			matched = append(matched, c)
+		}
+	}
+	return matched
+}
+
+func (s *Server) isDown(w http.ResponseWriter) bool {
+	s.mu.Lock()
+	down := s.down
+	s.mu.Unlock()
+	if down {
+		http.Error(w, `{"error": "llmtest: backend down"}`, http.StatusInternalServerError)
+	}
+	return down
+}
+
+func (s *Server) generate(w http.ResponseWriter, r *http.Request) {
+	if s.isDown(w) {
+		return
+	}
+	var req llm.GenerateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, `{"error": "invalid request"}`, http.StatusBadRequest)
+		return
+	}
+
+	call := Call{
+		Model:  req.Model,
+		System: req.System,
+		Prompt: req.Prompt,
+		JSON:   req.Format != nil,
+		Stream: req.Stream,
+	}
+	response, ok := s.match(call)
+	call.Response = response
+	s.mu.Lock()
+	s.calls = append(s.calls, call)
+	s.mu.Unlock()
+
+	if !ok {
+		s.t.Logf("llmtest: no scripted response for prompt: %.120s", strings.TrimSpace(req.Prompt))
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "llmtest: no scripted response"})
+		return
+	}
+
+	if !req.Stream {
+		json.NewEncoder(w).Encode(llm.GenerateResponse{Model: req.Model, Response: response, Done: true, EvalCount: len(response)})
+		return
+	}
+
+	// Stream word by word as NDJSON, as Ollama does
+	enc := json.NewEncoder(w)
+	flusher, _ := w.(http.Flusher)
+	for _, chunk := range splitWords(response) {
+		enc.Encode(llm.GenerateResponse{Model: req.Model, Response: chunk})
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+	enc.Encode(llm.GenerateResponse{Model: req.Model, Done: true, EvalCount: len(response)})
+}
+
+func (s *Server) match(call Call) (string, bool) {
+	s.mu.Lock()
+	rules := append([]rule(nil), s.rules...)
+	s.mu.Unlock()
+
+	text := call.System + "\n" + call.Prompt
+	for _, rl := range rules {
+		if rl.pattern.MatchString(text) {
+			return rl.respond(call), true
+		}
+	}
+	return "", false
+}
+
+func (s *Server) embeddings(w http.ResponseWriter, r *http.Request) {
+	if s.isDown(w) {
+		return
+	}
+	var req llm.EmbeddingRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, `{"error": "invalid request"}`, http.StatusBadRequest)
+		return
+	}
+	json.NewEncoder(w).Encode(llm.EmbeddingResponse{Embedding: Embed(req.Prompt)})
+}
+
+func (s *Server) tags(w http.ResponseWriter, r *http.Request) {
+	if s.isDown(w) {
+		return
+	}
+	w.Write([]byte(`{"models": [{"name": "fake"}, {"name": "fake-heavy"}]}`))
+}
+
+// Embed returns the fake embedding for text: a normalised bag of hashed words,
+// so texts sharing words are similar
+func Embed(text string) []float64 {
+	vec := make([]float64, EmbeddingDims)
+	for _, word := range strings.Fields(strings.ToLower(text)) {
+		word = strings.Trim(word, ".,;:!?\"'()")
+		if word == "" {
+			continue
+		}
+		h := fnv.New32a()
+		h.Write([]byte(word))
+		vec[h.Sum32()%EmbeddingDims]++
+	}
+
+	var norm float64
+	for _, v := range vec {
+		norm += v * v
+	}
+	if norm > 0 {
+		norm = math.Sqrt(norm)
+		for i := range vec {
+			vec[i] /= norm
+		}
+	}
+	return vec
+}
+
+// splitWords splits s into chunks that concatenate back to s
+func splitWords(s string) []string {
+	var chunks []string
+	start := 0
+	for i := 1; i < len(s); i++ {
+		if s[i] == ' ' {
+			chunks = append(chunks, s[start:i])
+			start = i
+		}
+	}
+	return append(chunks, s[start:])
+}
@@ -0,0 +1,90 @@
+package llmtest
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/mrwolf/brain-server/internal/llm"
+)
+
+func TestServer(t *testing.T) {
+	fake := NewServer(t).
+		On(`(?i)classify.*urgent`, `{"label": "urgent"}`).
+		On(`classify`, `{"label": "other"}`).
+		On(`write`, "one two three")
+	client := fake.LLM()
+	client.SetRoutes(llm.Routes{llm.TaskMood: {MaxAttempts: 1}})
+	ctx := context.Background()
+
+	tests := []struct {
+		prompt string
+		want   string
+	}{
+		{"classify this URGENT note", `{"label": "urgent"}`},
+		{"classify this note", `{"label": "other"}`},
+	}
+	for _, tt := range tests {
+		got, err := client.Generate(ctx, llm.TaskClassify, tt.prompt)
+		if err != nil {
+			t.Fatalf("Generate(%q): %v", tt.prompt, err)
+		}
+		if got != tt.want {
+			t.Errorf("Generate(%q) = %s, want %s", tt.prompt, got, tt.want)
+		}
+	}
+
+	var chunks []string
+	text, err := client.GenerateTextStream(ctx, llm.TaskDailyLetter, "write something", func(chunk string) error {
+		chunks = append(chunks, chunk)
+		return nil
+	})
+	if err != nil || text != "one two three" || strings.Join(chunks, "") != text || len(chunks) != 3 {
+		t.Errorf("stream = %q in %q (err %v), want three chunks of one two three", text, chunks, err)
+	}
+
+	if _, err := client.Generate(ctx, llm.TaskMood, "unscripted"); err == nil {
+		t.Error("expected error for an unscripted prompt")
+	}
+	if n := len(fake.CallsMatching(`classify`)); n != 2 {
+		t.Errorf("classify calls = %d, want 2", n)
+	}
+	if calls := fake.Calls(); len(calls) != 4 || !calls[0].JSON || calls[2].JSON {
+		t.Errorf("calls = %+v, want 4 with JSON format only on Generate", calls)
+	}
+}
+
+func TestServerDown(t *testing.T) {
+	fake := NewServer(t).On(`.`, "ok")
+	client := fake.LLM()
+
+	fake.SetDown(true)
+	if err := client.HealthCheck(context.Background()); err == nil {
+		t.Error("HealthCheck succeeded while down")
+	}
+	fake.SetDown(false)
+	if err := client.HealthCheck(context.Background()); err != nil {
+		t.Errorf("HealthCheck after recovery: %v", err)
+	}
+}
+
+func TestEmbed(t *testing.T) {
+	dot := func(a, b []float64) float64 {
+		var sum float64
+		for i := range a {
+			sum += a[i] * b[i]
+		}
+		return sum
+	}
+
+	bike := Embed("solar bike lights")
+	if len(bike) != EmbeddingDims {
+		t.Fatalf("dims = %d, want %d", len(bike), EmbeddingDims)
+	}
+	if got := dot(bike, Embed("Solar bike lights!")); got < 0.999 {
+		t.Errorf("same words similarity = %v, want 1", got)
+	}
+	if dot(bike, Embed("bike lights at night")) <= dot(bike, Embed("quarterly tax return")) {
+		t.Error("overlapping text is not more similar than unrelated text")
+	}
+}
@@ -7,35 +7,43 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"strings"
 	"time"
 )
 
-// Client wraps the Ollama API
-type Client struct {
-	baseURL    string
-	model      string
-	modelHeavy string
-	httpClient *http.Client
+// OllamaProvider talks to Ollama's native API
+type OllamaProvider struct {
+	baseURL      string
+	httpClient   *http.Client
+	streamClient *http.Client // no overall timeout; streams are bounded by the request context
 }
 
-// NewClient creates a new Ollama client
-func NewClient(baseURL, model, modelHeavy string) *Client {
-	return &Client{
-		baseURL:    baseURL,
-		model:      model,
-		modelHeavy: modelHeavy,
+// NewOllamaProvider creates a new Ollama provider
+func NewOllamaProvider(baseURL string) *OllamaProvider {
+	return &OllamaProvider{
+		baseURL: baseURL,
 		httpClient: &http.Client{
 			Timeout: 120 * time.Second,
 		},
+		streamClient: &http.Client{},
 	}
 }
 
 // GenerateRequest is the request body for /api/generate
 type GenerateRequest struct {
-	Model  string `json:"model"`
-	Prompt string `json:"prompt"`
-	Stream bool   `json:"stream"`
-	Format string `json:"format,omitempty"` // "json" for JSON output
+	Model  string      `json:"model"`
+	Prompt string      `json:"prompt"`
+	System string      `json:"system,omitempty"`
+	Stream bool        `json:"stream"`
+	Format interface{} `json:"format,omitempty"` // "json", or a JSON schema object for structured output
+
+	Options *GenerateOptions `json:"options,omitempty"`
+}
+
+// GenerateOptions are per-request model options for /api/generate
+type GenerateOptions struct {
+	Temperature *float64 `json:"temperature,omitempty"`
+	NumCtx      int      `json:"num_ctx,omitempty"`
 }
 
 // GenerateResponse is the response from /api/generate
@@ -44,133 +52,177 @@ type GenerateResponse struct {
 	Response  string `json:"response"`
 	Done      bool   `json:"done"`
 	CreatedAt string `json:"created_at"`
+	Error     string `json:"error,omitempty"` // set on a failed stream
+
+	// Usage, durations in nanoseconds
+	TotalDuration      int64 `json:"total_duration"`
+	LoadDuration       int64 `json:"load_duration"`
+	PromptEvalCount    int   `json:"prompt_eval_count"`
+	PromptEvalDuration int64 `json:"prompt_eval_duration"`
+	EvalCount          int   `json:"eval_count"`
+	EvalDuration       int64 `json:"eval_duration"`
 }
 
-// Generate sends a prompt to Ollama and returns the response
-// Includes retry logic with exponential backoff (up to 3 attempts)
-func (c *Client) Generate(ctx context.Context, prompt string, useHeavy bool) (string, error) {
-	model := c.model
-	if useHeavy {
-		model = c.modelHeavy
-	}
+// EmbeddingRequest is the request body for /api/embeddings
+type EmbeddingRequest struct {
+	Model  string `json:"model"`
+	Prompt string `json:"prompt"`
+}
+
+// EmbeddingResponse is the response from /api/embeddings
+type EmbeddingResponse struct {
+	Embedding []float64 `json:"embedding"`
+}
+
+// Name implements Provider
+func (p *OllamaProvider) Name() string {
+	return ProviderOllama
+}
 
-	req := GenerateRequest{
-		Model:  model,
-		Prompt: prompt,
-		Stream: false,
-		Format: "json",
+// Complete implements Provider using /api/generate
+func (p *OllamaProvider) Complete(ctx context.Context, req CompletionRequest) (Completion, error) {
+	var genResp GenerateResponse
+	if err := p.post(ctx, "/api/generate", generateRequest(req, false), &genResp); err != nil {
+		return Completion{}, err
 	}
+	return genResp.completion(genResp.Response), nil
+}
 
-	body, err := json.Marshal(req)
+// Stream implements Provider using /api/generate with newline-delimited JSON chunks
+func (p *OllamaProvider) Stream(ctx context.Context, req CompletionRequest, onChunk func(string) error) (Completion, error) {
+	resp, err := p.open(ctx, p.streamClient, "/api/generate", generateRequest(req, true))
 	if err != nil {
-		return "", fmt.Errorf("marshaling request: %w", err)
-	}
-
-	var lastErr error
-	for attempt := 0; attempt < 3; attempt++ {
-		if attempt > 0 {
-			// Exponential backoff: 1s, 2s
-			backoff := time.Duration(1<<uint(attempt-1)) * time.Second
-			select {
-			case <-ctx.Done():
-				return "", ctx.Err()
-			case <-time.After(backoff):
+		return Completion{}, err
+	}
+	defer resp.Body.Close()
+
+	var text strings.Builder
+	dec := json.NewDecoder(resp.Body)
+	for {
+		var chunk GenerateResponse
+		if err := dec.Decode(&chunk); err == io.EOF {
+			return Completion{}, fmt.Errorf("stream ended before completion")
+		} else if err != nil {
+			return Completion{}, fmt.Errorf("decoding stream: %w", err)
+		}
+		if chunk.Error != "" {
+			return Completion{}, fmt.Errorf("ollama: %s", chunk.Error)
+		}
+		if chunk.Response != "" {
+			text.WriteString(chunk.Response)
+			if err := onChunk(chunk.Response); err != nil {
+				return Completion{}, err
 			}
 		}
-
-		response, err := c.doGenerate(ctx, body)
-		if err == nil {
-			return response, nil
+		if chunk.Done {
+			return chunk.completion(text.String()), nil
 		}
-		lastErr = err
 	}
+}
 
-	return "", fmt.Errorf("after 3 attempts: %w", lastErr)
+func generateRequest(req CompletionRequest, stream bool) GenerateRequest {
+	genReq := GenerateRequest{
+		Model:  req.Model,
+		Prompt: req.Prompt,
+		System: req.System,
+		Stream: stream,
+	}
+	if len(req.Schema) > 0 {
+		genReq.Format = compactSchema(req.Schema)
+	} else if req.JSON {
+		genReq.Format = "json"
+	}
+	if req.Temperature != nil || req.NumCtx > 0 {
+		genReq.Options = &GenerateOptions{Temperature: req.Temperature, NumCtx: req.NumCtx}
+	}
+	return genReq
+}
+
+// completion converts a final response and its usage figures
+func (r GenerateResponse) completion(text string) Completion {
+	return Completion{
+		Text:            text,
+		PromptEvalCount: r.PromptEvalCount,
+		EvalCount:       r.EvalCount,
+		TotalDuration:   time.Duration(r.TotalDuration),
+		LoadDuration:    time.Duration(r.LoadDuration),
+		PromptDuration:  time.Duration(r.PromptEvalDuration),
+		EvalDuration:    time.Duration(r.EvalDuration),
+	}
 }
 
-func (c *Client) doGenerate(ctx context.Context, body []byte) (string, error) {
-	httpReq, err := http.NewRequestWithContext(ctx, "POST", c.baseURL+"/api/generate", bytes.NewReader(body))
+// Embed implements Provider using /api/embeddings
+func (p *OllamaProvider) Embed(ctx context.Context, model, text string) ([]float32, error) {
+	var embResp EmbeddingResponse
+	if err := p.post(ctx, "/api/embeddings", EmbeddingRequest{Model: model, Prompt: text}, &embResp); err != nil {
+		return nil, err
+	}
+	if len(embResp.Embedding) == 0 {
+		return nil, fmt.Errorf("empty embedding from model %s", model)
+	}
+
+	vector := make([]float32, len(embResp.Embedding))
+	for i, v := range embResp.Embedding {
+		vector[i] = float32(v)
+	}
+	return vector, nil
+}
+
+// HealthCheck implements Provider
+func (p *OllamaProvider) HealthCheck(ctx context.Context) error {
+	httpReq, err := http.NewRequestWithContext(ctx, "GET", p.baseURL+"/api/tags", nil)
 	if err != nil {
-		return "", fmt.Errorf("creating request: %w", err)
+		return fmt.Errorf("creating request: %w", err)
 	}
-	httpReq.Header.Set("Content-Type", "application/json")
 
-	resp, err := c.httpClient.Do(httpReq)
+	resp, err := p.httpClient.Do(httpReq)
 	if err != nil {
-		return "", fmt.Errorf("sending request: %w", err)
+		return fmt.Errorf("connecting to ollama: %w", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		bodyBytes, _ := io.ReadAll(resp.Body)
-		return "", fmt.Errorf("ollama returned status %d: %s", resp.StatusCode, string(bodyBytes))
-	}
-
-	var genResp GenerateResponse
-	if err := json.NewDecoder(resp.Body).Decode(&genResp); err != nil {
-		return "", fmt.Errorf("decoding response: %w", err)
+		return fmt.Errorf("ollama returned status %d", resp.StatusCode)
 	}
 
-	return genResp.Response, nil
+	return nil
 }
 
-// GenerateText sends a prompt without JSON format requirement
-// Includes retry logic with exponential backoff (up to 3 attempts)
-func (c *Client) GenerateText(ctx context.Context, prompt string, useHeavy bool) (string, error) {
-	model := c.model
-	if useHeavy {
-		model = c.modelHeavy
+func (p *OllamaProvider) post(ctx context.Context, path string, in, out interface{}) error {
+	resp, err := p.open(ctx, p.httpClient, path, in)
+	if err != nil {
+		return err
 	}
+	defer resp.Body.Close()
 
-	req := GenerateRequest{
-		Model:  model,
-		Prompt: prompt,
-		Stream: false,
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("decoding response: %w", err)
 	}
+	return nil
+}
 
-	body, err := json.Marshal(req)
+// open sends a POST and returns the response once the status is OK; the caller closes the body
+func (p *OllamaProvider) open(ctx context.Context, client *http.Client, path string, in interface{}) (*http.Response, error) {
+	body, err := json.Marshal(in)
 	if err != nil {
-		return "", fmt.Errorf("marshaling request: %w", err)
-	}
-
-	var lastErr error
-	for attempt := 0; attempt < 3; attempt++ {
-		if attempt > 0 {
-			// Exponential backoff: 1s, 2s
-			backoff := time.Duration(1<<uint(attempt-1)) * time.Second
-			select {
-			case <-ctx.Done():
-				return "", ctx.Err()
-			case <-time.After(backoff):
-			}
-		}
-
-		response, err := c.doGenerate(ctx, body)
-		if err == nil {
-			return response, nil
-		}
-		lastErr = err
+		return nil, fmt.Errorf("marshaling request: %w", err)
 	}
 
-	return "", fmt.Errorf("after 3 attempts: %w", lastErr)
-}
-
-// HealthCheck checks if Ollama is reachable
-func (c *Client) HealthCheck(ctx context.Context) error {
-	httpReq, err := http.NewRequestWithContext(ctx, "GET", c.baseURL+"/api/tags", nil)
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", p.baseURL+path, bytes.NewReader(body))
 	if err != nil {
-		return fmt.Errorf("creating request: %w", err)
+		return nil, fmt.Errorf("creating request: %w", err)
 	}
+	httpReq.Header.Set("Content-Type", "application/json")
 
-	resp, err := c.httpClient.Do(httpReq)
+	resp, err := client.Do(httpReq)
 	if err != nil {
-		return fmt.Errorf("connecting to ollama: %w", err)
+		return nil, fmt.Errorf("sending request: %w", err)
 	}
-	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("ollama returned status %d", resp.StatusCode)
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		return nil, fmt.Errorf("ollama returned status %d: %s", resp.StatusCode, string(bodyBytes))
 	}
-
-	return nil
+	return resp, nil
 }
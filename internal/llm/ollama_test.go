@@ -1,6 +1,10 @@
 package llm
 
 import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 )
 
@@ -11,8 +15,13 @@ func TestNewClient(t *testing.T) {
 		t.Fatal("NewClient() returned nil")
 	}
 
-	if client.baseURL != "http://localhost:11434" {
-		t.Errorf("baseURL = %q, want %q", client.baseURL, "http://localhost:11434")
+	provider, ok := client.provider.(*OllamaProvider)
+	if !ok {
+		t.Fatalf("provider = %T, want *OllamaProvider", client.provider)
+	}
+
+	if provider.baseURL != "http://localhost:11434" {
+		t.Errorf("baseURL = %q, want %q", provider.baseURL, "http://localhost:11434")
 	}
 
 	if client.model != "llama2" {
@@ -23,7 +32,7 @@ func TestNewClient(t *testing.T) {
 		t.Errorf("modelHeavy = %q, want %q", client.modelHeavy, "llama2:70b")
 	}
 
-	if client.httpClient == nil {
+	if provider.httpClient == nil {
 		t.Error("httpClient should not be nil")
 	}
 }
@@ -73,3 +82,30 @@ func TestGenerateResponse(t *testing.T) {
 		t.Error("Done should be true")
 	}
 }
+
+func TestEmbed(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req EmbeddingRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		if r.URL.Path != "/api/embeddings" || req.Model != "test-embed" || req.Prompt != "hello" {
+			http.Error(w, "unexpected request", http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(EmbeddingResponse{Embedding: []float64{0.5, -0.25}})
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, "llama2", "llama2")
+	if client.EmbedModel() != DefaultEmbedModel {
+		t.Errorf("EmbedModel() = %q, want default %q", client.EmbedModel(), DefaultEmbedModel)
+	}
+	client.SetEmbedModel("test-embed")
+
+	vector, err := client.Embed(context.Background(), "hello")
+	if err != nil {
+		t.Fatalf("Embed() error: %v", err)
+	}
+	if len(vector) != 2 || vector[0] != 0.5 || vector[1] != -0.25 {
+		t.Errorf("Embed() = %v, want [0.5 -0.25]", vector)
+	}
+}
@@ -0,0 +1,259 @@
+package llm
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// OpenAIProvider talks to an OpenAI-compatible API (llama.cpp server, vLLM, LM Studio).
+// baseURL includes the version prefix, e.g. http://localhost:8000/v1
+type OpenAIProvider struct {
+	baseURL      string
+	apiKey       string
+	httpClient   *http.Client
+	streamClient *http.Client // no overall timeout; streams are bounded by the request context
+}
+
+// NewOpenAIProvider creates a new OpenAI-compatible provider; apiKey may be empty
+func NewOpenAIProvider(baseURL, apiKey string) *OpenAIProvider {
+	return &OpenAIProvider{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		apiKey:  apiKey,
+		httpClient: &http.Client{
+			Timeout: 120 * time.Second,
+		},
+		streamClient: &http.Client{},
+	}
+}
+
+// ChatMessage is a single message in a chat completion
+type ChatMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// ChatRequest is the request body for /chat/completions
+type ChatRequest struct {
+	Model          string          `json:"model"`
+	Messages       []ChatMessage   `json:"messages"`
+	Stream         bool            `json:"stream"`
+	Temperature    *float64        `json:"temperature,omitempty"`
+	ResponseFormat *ResponseFormat `json:"response_format,omitempty"`
+	StreamOptions  *StreamOptions  `json:"stream_options,omitempty"`
+}
+
+// StreamOptions asks for a final usage chunk on streamed completions
+type StreamOptions struct {
+	IncludeUsage bool `json:"include_usage"`
+}
+
+// ResponseFormat constrains chat output ("json_object" for JSON, "json_schema" for a schema)
+type ResponseFormat struct {
+	Type       string      `json:"type"`
+	JSONSchema *JSONSchema `json:"json_schema,omitempty"`
+}
+
+// JSONSchema names the schema for a "json_schema" response format
+type JSONSchema struct {
+	Name   string          `json:"name"`
+	Schema json.RawMessage `json:"schema"`
+}
+
+// ChatResponse is the response from /chat/completions
+type ChatResponse struct {
+	Choices []struct {
+		Message ChatMessage `json:"message"`
+	} `json:"choices"`
+	Usage struct {
+		PromptTokens     int `json:"prompt_tokens"`
+		CompletionTokens int `json:"completion_tokens"`
+	} `json:"usage"`
+}
+
+// ChatStreamChunk is one server-sent event from a streamed /chat/completions
+type ChatStreamChunk struct {
+	Choices []struct {
+		Delta ChatMessage `json:"delta"`
+	} `json:"choices"`
+	Usage *struct {
+		PromptTokens     int `json:"prompt_tokens"`
+		CompletionTokens int `json:"completion_tokens"`
+	} `json:"usage"`
+}
+
+// OpenAIEmbeddingRequest is the request body for /embeddings
+type OpenAIEmbeddingRequest struct {
+	Model string `json:"model"`
+	Input string `json:"input"`
+}
+
+// OpenAIEmbeddingResponse is the response from /embeddings
+type OpenAIEmbeddingResponse struct {
+	Data []struct {
+		Embedding []float64 `json:"embedding"`
+	} `json:"data"`
+}
+
+// Name implements Provider
+func (p *OpenAIProvider) Name() string {
+	return ProviderOpenAI
+}
+
+// Complete implements Provider using /chat/completions
+func (p *OpenAIProvider) Complete(ctx context.Context, req CompletionRequest) (Completion, error) {
+	var chatResp ChatResponse
+	if err := p.do(ctx, "POST", "/chat/completions", chatRequest(req, false), &chatResp); err != nil {
+		return Completion{}, err
+	}
+	if len(chatResp.Choices) == 0 {
+		return Completion{}, fmt.Errorf("no choices in response")
+	}
+	return Completion{
+		Text:            chatResp.Choices[0].Message.Content,
+		PromptEvalCount: chatResp.Usage.PromptTokens,
+		EvalCount:       chatResp.Usage.CompletionTokens,
+	}, nil
+}
+
+// Stream implements Provider using /chat/completions with server-sent events
+func (p *OpenAIProvider) Stream(ctx context.Context, req CompletionRequest, onChunk func(string) error) (Completion, error) {
+	resp, err := p.open(ctx, p.streamClient, "POST", "/chat/completions", chatRequest(req, true))
+	if err != nil {
+		return Completion{}, err
+	}
+	defer resp.Body.Close()
+
+	var completion Completion
+	var text strings.Builder
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data:")
+		if !ok {
+			continue // blank separators and comments
+		}
+		data = strings.TrimSpace(data)
+		if data == "[DONE]" {
+			completion.Text = text.String()
+			return completion, nil
+		}
+
+		var chunk ChatStreamChunk
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			return Completion{}, fmt.Errorf("decoding stream: %w", err)
+		}
+		if chunk.Usage != nil {
+			completion.PromptEvalCount = chunk.Usage.PromptTokens
+			completion.EvalCount = chunk.Usage.CompletionTokens
+		}
+		if len(chunk.Choices) > 0 && chunk.Choices[0].Delta.Content != "" {
+			text.WriteString(chunk.Choices[0].Delta.Content)
+			if err := onChunk(chunk.Choices[0].Delta.Content); err != nil {
+				return Completion{}, err
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return Completion{}, fmt.Errorf("reading stream: %w", err)
+	}
+	return Completion{}, fmt.Errorf("stream ended before completion")
+}
+
+func chatRequest(req CompletionRequest, stream bool) ChatRequest {
+	chatReq := ChatRequest{
+		Model:       req.Model,
+		Stream:      stream,
+		Temperature: req.Temperature,
+	}
+	if stream {
+		chatReq.StreamOptions = &StreamOptions{IncludeUsage: true}
+	}
+	if req.System != "" {
+		chatReq.Messages = append(chatReq.Messages, ChatMessage{Role: "system", Content: req.System})
+	}
+	chatReq.Messages = append(chatReq.Messages, ChatMessage{Role: "user", Content: req.Prompt})
+	if len(req.Schema) > 0 {
+		chatReq.ResponseFormat = &ResponseFormat{Type: "json_schema", JSONSchema: &JSONSchema{Name: "response", Schema: compactSchema(req.Schema)}}
+	} else if req.JSON {
+		chatReq.ResponseFormat = &ResponseFormat{Type: "json_object"}
+	}
+	return chatReq
+}
+
+// Embed implements Provider using /embeddings
+func (p *OpenAIProvider) Embed(ctx context.Context, model, text string) ([]float32, error) {
+	var embResp OpenAIEmbeddingResponse
+	if err := p.do(ctx, "POST", "/embeddings", OpenAIEmbeddingRequest{Model: model, Input: text}, &embResp); err != nil {
+		return nil, err
+	}
+	if len(embResp.Data) == 0 || len(embResp.Data[0].Embedding) == 0 {
+		return nil, fmt.Errorf("empty embedding from model %s", model)
+	}
+
+	vector := make([]float32, len(embResp.Data[0].Embedding))
+	for i, v := range embResp.Data[0].Embedding {
+		vector[i] = float32(v)
+	}
+	return vector, nil
+}
+
+// HealthCheck implements Provider using /models
+func (p *OpenAIProvider) HealthCheck(ctx context.Context) error {
+	var models struct{}
+	return p.do(ctx, "GET", "/models", nil, &models)
+}
+
+func (p *OpenAIProvider) do(ctx context.Context, method, path string, in, out interface{}) error {
+	resp, err := p.open(ctx, p.httpClient, method, path, in)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("decoding response: %w", err)
+	}
+	return nil
+}
+
+// open sends a request and returns the response once the status is OK; the caller closes the body
+func (p *OpenAIProvider) open(ctx context.Context, client *http.Client, method, path string, in interface{}) (*http.Response, error) {
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return nil, fmt.Errorf("marshaling request: %w", err)
+		}
+		body = bytes.NewReader(data)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, method, p.baseURL+path, body)
+	if err != nil {
+		return nil, fmt.Errorf("creating request: %w", err)
+	}
+	if in != nil {
+		httpReq.Header.Set("Content-Type", "application/json")
+	}
+	if p.apiKey != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+p.apiKey)
+	}
+
+	resp, err := client.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("sending request: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		return nil, fmt.Errorf("%s returned status %d: %s", p.baseURL, resp.StatusCode, string(bodyBytes))
+	}
+	return resp, nil
+}
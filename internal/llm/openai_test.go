@@ -0,0 +1,121 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func newOpenAIStub(t *testing.T) *httptest.Server {
+	t.Helper()
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer sk-test" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		switch r.URL.Path {
+		case "/v1/chat/completions":
+			var req ChatRequest
+			json.NewDecoder(r.Body).Decode(&req)
+			content := "plain"
+			if req.ResponseFormat != nil && req.ResponseFormat.Type == "json_object" {
+				content = `{"ok": true}`
+			}
+			if len(req.Messages) == 2 && req.Messages[0].Role == "system" {
+				content += " +system"
+			}
+			resp := ChatResponse{}
+			resp.Choices = append(resp.Choices, struct {
+				Message ChatMessage `json:"message"`
+			}{Message: ChatMessage{Role: "assistant", Content: content}})
+			resp.Usage.PromptTokens = 5
+			resp.Usage.CompletionTokens = 2
+			json.NewEncoder(w).Encode(resp)
+		case "/v1/embeddings":
+			var req OpenAIEmbeddingRequest
+			json.NewDecoder(r.Body).Decode(&req)
+			if req.Input == "" {
+				http.Error(w, "missing input", http.StatusBadRequest)
+				return
+			}
+			w.Write([]byte(`{"data": [{"embedding": [1, 0.5]}]}`))
+		case "/v1/models":
+			w.Write([]byte(`{"data": []}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+}
+
+func TestOpenAIProvider(t *testing.T) {
+	server := newOpenAIStub(t)
+	defer server.Close()
+
+	provider, err := NewProvider(ProviderOpenAI, server.URL+"/v1/", "sk-test")
+	if err != nil {
+		t.Fatalf("NewProvider() error: %v", err)
+	}
+	client := NewClientWithProvider(provider, "small", "large")
+	ctx := context.Background()
+
+	if got, err := client.Generate(ctx, TaskClassify, "hi"); err != nil || got != `{"ok": true}` {
+		t.Errorf("Generate() = %q, %v; want JSON response", got, err)
+	}
+	if got, err := client.GenerateText(ctx, TaskDailyLetter, "hi"); err != nil || got != "plain" {
+		t.Errorf("GenerateText() = %q, %v; want plain response", got, err)
+	}
+	if got, err := provider.Complete(ctx, CompletionRequest{Model: "small", System: "be brief", Prompt: "hi"}); err != nil || got.Text != "plain +system" {
+		t.Errorf("Complete() with system = %q, %v; want system message sent", got.Text, err)
+	} else if got.PromptEvalCount != 5 || got.EvalCount != 2 {
+		t.Errorf("Complete() usage = %d/%d, want 5/2", got.PromptEvalCount, got.EvalCount)
+	}
+
+	vector, err := client.Embed(ctx, "hello")
+	if err != nil || len(vector) != 2 || vector[1] != 0.5 {
+		t.Errorf("Embed() = %v, %v; want [1 0.5]", vector, err)
+	}
+
+	if err := client.HealthCheck(ctx); err != nil {
+		t.Errorf("HealthCheck() error: %v", err)
+	}
+	if client.ProviderName() != ProviderOpenAI {
+		t.Errorf("ProviderName() = %q, want %q", client.ProviderName(), ProviderOpenAI)
+	}
+}
+
+func TestOpenAIProviderRejectsBadKey(t *testing.T) {
+	server := newOpenAIStub(t)
+	defer server.Close()
+
+	provider := NewOpenAIProvider(server.URL+"/v1", "wrong")
+	if err := provider.HealthCheck(context.Background()); err == nil {
+		t.Error("expected health check to fail with a bad key")
+	}
+}
+
+func TestNewProvider(t *testing.T) {
+	tests := []struct {
+		kind    string
+		want    string
+		wantErr bool
+	}{
+		{"", ProviderOllama, false},
+		{ProviderOllama, ProviderOllama, false},
+		{ProviderOpenAI, ProviderOpenAI, false},
+		{"anthropic", "", true},
+	}
+
+	for _, tt := range tests {
+		provider, err := NewProvider(tt.kind, "http://localhost", "")
+		if (err != nil) != tt.wantErr {
+			t.Errorf("NewProvider(%q) error = %v, wantErr %v", tt.kind, err, tt.wantErr)
+			continue
+		}
+		if err == nil && provider.Name() != tt.want {
+			t.Errorf("NewProvider(%q).Name() = %q, want %q", tt.kind, provider.Name(), tt.want)
+		}
+	}
+}
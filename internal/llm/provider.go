@@ -0,0 +1,60 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Provider kinds accepted by NewProvider
+const (
+	ProviderOllama = "ollama"
+	ProviderOpenAI = "openai" // any OpenAI-compatible server: llama.cpp, vLLM, LM Studio
+)
+
+// CompletionRequest is a single prompt for a provider
+type CompletionRequest struct {
+	Model  string
+	System string // optional system prompt
+	Prompt string
+	JSON   bool            // constrain output to a JSON object
+	Schema json.RawMessage // optional JSON schema the object must match (implies JSON)
+
+	Temperature *float64 // nil for the model default
+	NumCtx      int      // context window, 0 for the model default (Ollama only)
+}
+
+// Completion is a provider's response with whatever usage figures it reports
+// (zero when the backend does not report them)
+type Completion struct {
+	Text            string
+	PromptEvalCount int           // prompt tokens
+	EvalCount       int           // generated tokens
+	TotalDuration   time.Duration // as measured by the backend
+	LoadDuration    time.Duration // model load time (Ollama only)
+	PromptDuration  time.Duration // prompt evaluation (Ollama only)
+	EvalDuration    time.Duration // generation (Ollama only)
+}
+
+// Provider is an LLM backend. Implementations make a single attempt per call;
+// retries and model selection live in Client.
+type Provider interface {
+	Name() string
+	Complete(ctx context.Context, req CompletionRequest) (Completion, error)
+	// Stream passes text to onChunk as it is generated; an error from onChunk aborts the call
+	Stream(ctx context.Context, req CompletionRequest, onChunk func(string) error) (Completion, error)
+	Embed(ctx context.Context, model, text string) ([]float32, error)
+	HealthCheck(ctx context.Context) error
+}
+
+// NewProvider creates a provider by kind
+func NewProvider(kind, baseURL, apiKey string) (Provider, error) {
+	switch kind {
+	case ProviderOllama, "":
+		return NewOllamaProvider(baseURL), nil
+	case ProviderOpenAI:
+		return NewOpenAIProvider(baseURL, apiKey), nil
+	}
+	return nil, fmt.Errorf("unknown llm provider %q (want %s or %s)", kind, ProviderOllama, ProviderOpenAI)
+}
@@ -0,0 +1,241 @@
+package llm
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Priority orders queued calls when the parallelism limit is reached
+type Priority int
+
+// Priorities, highest first
+const (
+	PriorityInteractive Priority = iota + 1 // a person is waiting on the response
+	PriorityNormal
+	PriorityBackground // scheduled and fire-and-forget work
+)
+
+var priorityNames = map[Priority]string{
+	PriorityInteractive: "interactive",
+	PriorityNormal:      "normal",
+	PriorityBackground:  "background",
+}
+
+func (p Priority) String() string {
+	if name, ok := priorityNames[p]; ok {
+		return name
+	}
+	return fmt.Sprintf("priority(%d)", int(p))
+}
+
+// ParsePriority parses "interactive", "normal" or "background"
+func ParsePriority(s string) (Priority, error) {
+	for p, name := range priorityNames {
+		if strings.EqualFold(s, name) {
+			return p, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown priority %q (want interactive, normal or background)", s)
+}
+
+type priorityKey struct{}
+
+// WithPriority overrides the task's priority for calls made with ctx,
+// e.g. an on-demand letter the user is watching stream in
+func WithPriority(ctx context.Context, p Priority) context.Context {
+	return context.WithValue(ctx, priorityKey{}, p)
+}
+
+// priorityFor returns the priority set on ctx, or fallback
+func priorityFor(ctx context.Context, fallback Priority) Priority {
+	if p, ok := ctx.Value(priorityKey{}).(Priority); ok {
+		return p
+	}
+	return fallback
+}
+
+// Queue bounds concurrent provider calls. When all slots are busy, callers wait
+// and are admitted highest priority first, FIFO within a priority.
+type Queue struct {
+	mu      sync.Mutex
+	limit   int
+	active  int
+	waiting map[Priority][]*queueWaiter
+	stats   map[Priority]*priorityStats
+	peak    int
+}
+
+type queueWaiter struct {
+	ready    chan struct{}
+	admitted bool
+}
+
+type priorityStats struct {
+	admitted int
+	canceled int
+	waited   time.Duration
+	maxWait  time.Duration
+}
+
+// QueueStats is a snapshot of queue activity since startup
+type QueueStats struct {
+	Limit      int                      `json:"limit"`
+	Active     int                      `json:"active"`
+	Queued     int                      `json:"queued"`
+	PeakQueued int                      `json:"peak_queued"`
+	Priorities map[string]PriorityStats `json:"priorities"`
+}
+
+// PriorityStats describes admissions at one priority
+type PriorityStats struct {
+	Queued    int   `json:"queued"`
+	Admitted  int   `json:"admitted"`
+	Canceled  int   `json:"canceled"` // gave up while waiting
+	AvgWaitMs int64 `json:"avg_wait_ms"`
+	MaxWaitMs int64 `json:"max_wait_ms"`
+}
+
+// NewQueue creates a queue allowing limit concurrent calls (at least 1)
+func NewQueue(limit int) *Queue {
+	if limit < 1 {
+		limit = 1
+	}
+	q := &Queue{
+		limit:   limit,
+		waiting: make(map[Priority][]*queueWaiter),
+		stats:   make(map[Priority]*priorityStats),
+	}
+	for p := range priorityNames {
+		q.stats[p] = &priorityStats{}
+	}
+	return q
+}
+
+// Acquire waits for a slot and returns the function that frees it
+func (q *Queue) Acquire(ctx context.Context, p Priority) (func(), error) {
+	if _, ok := priorityNames[p]; !ok {
+		p = PriorityNormal
+	}
+	start := time.Now()
+
+	q.mu.Lock()
+	if q.active < q.limit && q.queuedLocked() == 0 {
+		q.active++
+		q.admitLocked(p, 0)
+		q.mu.Unlock()
+		return q.release, nil
+	}
+	w := &queueWaiter{ready: make(chan struct{})}
+	q.waiting[p] = append(q.waiting[p], w)
+	if n := q.queuedLocked(); n > q.peak {
+		q.peak = n
+	}
+	q.mu.Unlock()
+
+	select {
+	case <-w.ready:
+		q.mu.Lock()
+		q.admitLocked(p, time.Since(start))
+		q.mu.Unlock()
+		return q.release, nil
+	case <-ctx.Done():
+		q.mu.Lock()
+		defer q.mu.Unlock()
+		if w.admitted {
+			// Granted a slot just as the caller gave up: pass it on
+			q.active--
+			q.grantLocked()
+		} else {
+			q.removeLocked(p, w)
+		}
+		q.stats[p].canceled++
+		return nil, ctx.Err()
+	}
+}
+
+// Stats returns a snapshot of queue depth and admissions
+func (q *Queue) Stats() QueueStats {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	stats := QueueStats{
+		Limit:      q.limit,
+		Active:     q.active,
+		Queued:     q.queuedLocked(),
+		PeakQueued: q.peak,
+		Priorities: make(map[string]PriorityStats),
+	}
+	for p, s := range q.stats {
+		ps := PriorityStats{
+			Queued:    len(q.waiting[p]),
+			Admitted:  s.admitted,
+			Canceled:  s.canceled,
+			MaxWaitMs: s.maxWait.Milliseconds(),
+		}
+		if s.admitted > 0 {
+			ps.AvgWaitMs = (s.waited / time.Duration(s.admitted)).Milliseconds()
+		}
+		stats.Priorities[p.String()] = ps
+	}
+	return stats
+}
+
+func (q *Queue) release() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.active--
+	q.grantLocked()
+}
+
+// grantLocked hands free slots to the highest priority waiters
+func (q *Queue) grantLocked() {
+	for q.active < q.limit {
+		w := q.nextLocked()
+		if w == nil {
+			return
+		}
+		w.admitted = true
+		q.active++
+		close(w.ready)
+	}
+}
+
+func (q *Queue) nextLocked() *queueWaiter {
+	for _, p := range []Priority{PriorityInteractive, PriorityNormal, PriorityBackground} {
+		if ws := q.waiting[p]; len(ws) > 0 {
+			q.waiting[p] = ws[1:]
+			return ws[0]
+		}
+	}
+	return nil
+}
+
+func (q *Queue) removeLocked(p Priority, w *queueWaiter) {
+	ws := q.waiting[p]
+	for i := range ws {
+		if ws[i] == w {
+			q.waiting[p] = append(ws[:i], ws[i+1:]...)
+			return
+		}
+	}
+}
+
+func (q *Queue) admitLocked(p Priority, waited time.Duration) {
+	s := q.stats[p]
+	s.admitted++
+	s.waited += waited
+	if waited > s.maxWait {
+		s.maxWait = waited
+	}
+}
+
+func (q *Queue) queuedLocked() int {
+	n := 0
+	for _, ws := range q.waiting {
+		n += len(ws)
+	}
+	return n
+}
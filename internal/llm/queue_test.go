@@ -0,0 +1,124 @@
+package llm
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+// waitQueued polls until n callers are waiting
+func waitQueued(t *testing.T, q *Queue, n int) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for q.Stats().Queued < n {
+		if time.Now().After(deadline) {
+			t.Fatalf("queued = %d, want %d", q.Stats().Queued, n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestQueuePriorityOrder(t *testing.T) {
+	q := NewQueue(1)
+	release, err := q.Acquire(context.Background(), PriorityNormal)
+	if err != nil {
+		t.Fatalf("Acquire: %v", err)
+	}
+
+	var mu sync.Mutex
+	var order []string
+	var wg sync.WaitGroup
+	enqueue := func(name string, p Priority, queued int) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			done, err := q.Acquire(context.Background(), p)
+			if err != nil {
+				t.Errorf("Acquire(%s): %v", name, err)
+				return
+			}
+			mu.Lock()
+			order = append(order, name)
+			mu.Unlock()
+			done()
+		}()
+		waitQueued(t, q, queued)
+	}
+
+	enqueue("background", PriorityBackground, 1)
+	enqueue("normal", PriorityNormal, 2)
+	enqueue("interactive-1", PriorityInteractive, 3)
+	enqueue("interactive-2", PriorityInteractive, 4)
+
+	if stats := q.Stats(); stats.PeakQueued != 4 || stats.Active != 1 {
+		t.Errorf("stats = %+v, want 4 queued behind 1 active", stats)
+	}
+
+	release()
+	wg.Wait()
+
+	want := []string{"interactive-1", "interactive-2", "normal", "background"}
+	for i := range want {
+		if i >= len(order) || order[i] != want[i] {
+			t.Fatalf("admission order = %v, want %v", order, want)
+		}
+	}
+
+	stats := q.Stats()
+	if stats.Active != 0 || stats.Queued != 0 {
+		t.Errorf("after release: active %d, queued %d, want 0", stats.Active, stats.Queued)
+	}
+	if got := stats.Priorities["interactive"].Admitted; got != 2 {
+		t.Errorf("interactive admitted = %d, want 2", got)
+	}
+	if got := stats.Priorities["normal"].Admitted; got != 2 {
+		t.Errorf("normal admitted = %d, want 2", got)
+	}
+}
+
+func TestQueueCancel(t *testing.T) {
+	q := NewQueue(1)
+	release, _ := q.Acquire(context.Background(), PriorityBackground)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errc := make(chan error, 1)
+	go func() {
+		_, err := q.Acquire(ctx, PriorityInteractive)
+		errc <- err
+	}()
+	waitQueued(t, q, 1)
+	cancel()
+
+	if err := <-errc; err != context.Canceled {
+		t.Errorf("canceled Acquire error = %v, want context.Canceled", err)
+	}
+	stats := q.Stats()
+	if stats.Queued != 0 || stats.Priorities["interactive"].Canceled != 1 {
+		t.Errorf("stats = %+v, want the canceled waiter removed and counted", stats)
+	}
+
+	// The slot is still usable once the holder releases it
+	release()
+	done, err := q.Acquire(context.Background(), PriorityNormal)
+	if err != nil {
+		t.Fatalf("Acquire after cancel: %v", err)
+	}
+	done()
+}
+
+func TestClientQueuesCalls(t *testing.T) {
+	client := NewClient("http://localhost:0", "test", "test")
+	if stats := client.QueueStats(); stats.Limit != 0 {
+		t.Errorf("unlimited client limit = %d, want 0", stats.Limit)
+	}
+
+	client.SetConcurrency(2)
+	if stats := client.QueueStats(); stats.Limit != 2 || len(stats.Priorities) != 3 {
+		t.Errorf("stats = %+v, want limit 2 with three priorities", stats)
+	}
+
+	if got := priorityFor(WithPriority(context.Background(), PriorityInteractive), PriorityBackground); got != PriorityInteractive {
+		t.Errorf("priorityFor = %v, want the context override", got)
+	}
+}
@@ -0,0 +1,334 @@
+package llm
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Built-in redaction kinds
+const (
+	RedactCard  = "card"  // payment card numbers: 13-19 digits, optionally grouped
+	RedactIBAN  = "iban"  // international bank account numbers
+	RedactPhone = "phone" // international (+44 ...), national (07700 ...) and (555) 123-4567 numbers
+	RedactEmail = "email"
+)
+
+// builtinKinds are applied in this order, so an IBAN's digits are not taken for a card
+var builtinKinds = []string{RedactEmail, RedactIBAN, RedactCard, RedactPhone}
+
+var builtinPatterns = map[string]*regexp.Regexp{
+	RedactEmail: regexp.MustCompile(`\b[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}\b`),
+	RedactIBAN:  regexp.MustCompile(`\b[A-Z]{2}\d{2}(?: ?[A-Z0-9]{4}){2,7}(?: ?[A-Z0-9]{1,4})?\b`),
+	RedactCard:  regexp.MustCompile(`\b(?:\d[ -]?){12,18}\d\b`),
+	RedactPhone: regexp.MustCompile(`\+\d{1,3}[ .-]?(?:\(\d{1,4}\)[ .-]?)?\d(?:[ .-]?\d){5,12}\b|\b0\d(?:[ .-]?\d){7,11}\b|\(\d{2,4}\)[ .-]?\d{3}[ .-]?\d{4}\b`),
+}
+
+// builtinChecks reject pattern matches that are not what they look like, such as
+// millisecond timestamps taken for card numbers
+var builtinChecks = map[string]func(string) bool{
+	RedactCard: validLuhn,
+	RedactIBAN: validIBAN,
+}
+
+// validLuhn reports whether the digits of s pass the Luhn check card numbers carry
+func validLuhn(s string) bool {
+	sum, double := 0, false
+	for i := len(s) - 1; i >= 0; i-- {
+		if s[i] < '0' || s[i] > '9' {
+			continue
+		}
+		d := int(s[i] - '0')
+		if double {
+			if d *= 2; d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		double = !double
+	}
+	return sum%10 == 0
+}
+
+// validIBAN reports whether s passes the ISO 13616 mod-97 check
+func validIBAN(s string) bool {
+	s = strings.ReplaceAll(s, " ", "")
+	rem := 0
+	for _, c := range s[4:] + s[:4] {
+		switch {
+		case c >= '0' && c <= '9':
+			rem = (rem*10 + int(c-'0')) % 97
+		case c >= 'A' && c <= 'Z':
+			rem = (rem*100 + int(c-'A') + 10) % 97
+		default:
+			return false
+		}
+	}
+	return rem == 1
+}
+
+// RedactionOff in a list of kinds redacts nothing
+const RedactionOff = "off"
+
+// RedactionPolicy says what is replaced with placeholders such as [CARD_1] in text
+// sent to the LLM. The values never leave the server. Placeholders the model
+// repeats are replaced with the original values only in output fields named with
+// WithRestore, such as a classified note's cleaned text. The zero policy redacts
+// nothing.
+type RedactionPolicy struct {
+	Kinds    []string                  // redacted for every user without their own list
+	Actors   map[string][]string       // per-user lists, replacing Kinds
+	Patterns map[string]*regexp.Regexp // custom kinds by name, usable in the lists
+}
+
+// ParseRedactKinds reads a comma-separated list of kinds, e.g. "card,iban,phone"
+// ("off" for none)
+func ParseRedactKinds(s string) []string {
+	var kinds []string
+	for _, k := range strings.Split(s, ",") {
+		if k = strings.TrimSpace(k); k != "" && k != RedactionOff {
+			kinds = append(kinds, k)
+		}
+	}
+	return kinds
+}
+
+// ParseRedactActors reads per-user kinds, e.g. "wife=card+iban,kid=card+iban+phone+email,guest=off"
+func ParseRedactActors(s string) (map[string][]string, error) {
+	actors := make(map[string][]string)
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		actor, value, ok := strings.Cut(part, "=")
+		actor, value = strings.TrimSpace(actor), strings.TrimSpace(value)
+		if !ok || actor == "" || value == "" {
+			return nil, fmt.Errorf("invalid entry %q: want user=kind+kind or user=off", part)
+		}
+		actors[actor] = ParseRedactKinds(strings.ReplaceAll(value, "+", ","))
+	}
+	return actors, nil
+}
+
+// LoadRedactPatterns reads custom kinds from a file with one name=regexp per line,
+// e.g. "plate=\b[A-Z]{2}\d{2} ?[A-Z]{3}\b"; blank lines and lines starting with #
+// are ignored
+func LoadRedactPatterns(path string) (map[string]*regexp.Regexp, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading redaction patterns: %w", err)
+	}
+	patterns := make(map[string]*regexp.Regexp)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		name, expr, ok := strings.Cut(line, "=")
+		name, expr = strings.TrimSpace(name), strings.TrimSpace(expr)
+		if !ok || name == "" || expr == "" {
+			return nil, fmt.Errorf("line %d: want name=regexp", n)
+		}
+		if _, builtin := builtinPatterns[name]; builtin || name == RedactionOff {
+			return nil, fmt.Errorf("line %d: %q is a built-in kind", n, name)
+		}
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", n, err)
+		}
+		patterns[name] = re
+	}
+	return patterns, scanner.Err()
+}
+
+// Validate checks that every kind in the lists is built in or a custom pattern
+func (p RedactionPolicy) Validate() error {
+	check := func(who string, kinds []string) error {
+		for _, k := range kinds {
+			if _, ok := p.pattern(k); !ok {
+				return fmt.Errorf("%s: unknown kind %q (want %s or a custom pattern)", who, k, strings.Join(builtinKinds, ", "))
+			}
+		}
+		return nil
+	}
+	if err := check("default", p.Kinds); err != nil {
+		return err
+	}
+	for actor, kinds := range p.Actors {
+		if err := check(actor, kinds); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p RedactionPolicy) pattern(kind string) (*regexp.Regexp, bool) {
+	if re, ok := builtinPatterns[kind]; ok {
+		return re, true
+	}
+	re, ok := p.Patterns[kind]
+	return re, ok
+}
+
+// kindsFor returns the kinds redacted for a user in the order they are applied.
+// Text without a known user (e.g. a journal day mixing everyone's entries) gets
+// every user's kinds.
+func (p RedactionPolicy) kindsFor(actor string) []string {
+	selected := make(map[string]bool)
+	if kinds, ok := p.Actors[actor]; ok && actor != "" {
+		for _, k := range kinds {
+			selected[k] = true
+		}
+	} else {
+		for _, k := range p.Kinds {
+			selected[k] = true
+		}
+		if actor == "" {
+			for _, kinds := range p.Actors {
+				for _, k := range kinds {
+					selected[k] = true
+				}
+			}
+		}
+	}
+
+	var ordered []string
+	for _, k := range builtinKinds {
+		if selected[k] {
+			ordered = append(ordered, k)
+			delete(selected, k)
+		}
+	}
+	custom := make([]string, 0, len(selected))
+	for k := range selected {
+		custom = append(custom, k)
+	}
+	sort.Strings(custom)
+	return append(ordered, custom...)
+}
+
+// Redact replaces the user's redacted kinds in each of texts, returning what was
+// replaced (nil if nothing was)
+func (p RedactionPolicy) Redact(actor string, texts ...*string) *Redaction {
+	kinds := p.kindsFor(actor)
+	if len(kinds) == 0 {
+		return nil
+	}
+	r := &Redaction{values: make(map[string]string), placeholders: make(map[string]string), counts: make(map[string]int)}
+	for _, text := range texts {
+		for _, kind := range kinds {
+			re, _ := p.pattern(kind)
+			check := builtinChecks[kind]
+			*text = re.ReplaceAllStringFunc(*text, func(value string) string {
+				if check != nil && !check(value) {
+					return value
+				}
+				return r.placeholder(kind, value)
+			})
+		}
+	}
+	if len(r.values) == 0 {
+		return nil
+	}
+	return r
+}
+
+// Redaction maps the placeholders put in a request back to the values they replaced
+type Redaction struct {
+	values       map[string]string // value by placeholder
+	placeholders map[string]string // placeholder by value, so a repeated value gets the same one
+	counts       map[string]int    // placeholders by kind
+}
+
+func (r *Redaction) placeholder(kind, value string) string {
+	if ph, ok := r.placeholders[value]; ok {
+		return ph
+	}
+	r.counts[kind]++
+	ph := fmt.Sprintf("[%s_%d]", strings.ToUpper(kind), r.counts[kind])
+	r.placeholders[value] = ph
+	r.values[ph] = value
+	return ph
+}
+
+// Len returns how many values were redacted
+func (r *Redaction) Len() int {
+	if r == nil {
+		return 0
+	}
+	return len(r.values)
+}
+
+// Restore puts the original values back in place of placeholders in text
+func (r *Redaction) Restore(text string) string {
+	if r == nil {
+		return text
+	}
+	pairs := make([]string, 0, 2*len(r.values))
+	for ph, value := range r.values {
+		pairs = append(pairs, ph, value)
+	}
+	return strings.NewReplacer(pairs...).Replace(text)
+}
+
+// RestoreFields puts the original values back in the named string fields of a JSON
+// object, leaving placeholders everywhere else
+func (r *Redaction) RestoreFields(text string, fields []string) string {
+	if r == nil || len(fields) == 0 {
+		return text
+	}
+	var object map[string]json.RawMessage
+	if json.Unmarshal([]byte(text), &object) != nil {
+		return text
+	}
+	for _, field := range fields {
+		var value string
+		if json.Unmarshal(object[field], &value) != nil {
+			continue
+		}
+		object[field], _ = json.Marshal(r.Restore(value))
+	}
+	out, err := json.Marshal(object)
+	if err != nil {
+		return text
+	}
+	return string(out)
+}
+
+type restoreKey struct{}
+
+// WithRestore has calls made with ctx put redacted values back in the named fields
+// of their JSON output, for text filed in the user's own notes such as a capture's
+// cleaned_text. All other output keeps the placeholders, so letters, research,
+// narration, answers and cached responses never hold the values.
+func WithRestore(ctx context.Context, fields ...string) context.Context {
+	return context.WithValue(ctx, restoreKey{}, fields)
+}
+
+// restoreFor returns the fields set on ctx to restore
+func restoreFor(ctx context.Context) []string {
+	fields, _ := ctx.Value(restoreKey{}).([]string)
+	return fields
+}
+
+type actorKey struct{}
+
+// WithActor names the user whose text calls made with ctx carry, selecting the
+// redaction applied to them
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// actorFor returns the user set on ctx, or "" if there is none
+func actorFor(ctx context.Context) string {
+	actor, _ := ctx.Value(actorKey{}).(string)
+	return actor
+}
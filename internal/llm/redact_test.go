@@ -0,0 +1,187 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestRedact(t *testing.T) {
+	all := RedactionPolicy{Kinds: builtinKinds}
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{"card", "paid with 4111 1111 1111 1111 today", "paid with [CARD_1] today"},
+		{"card with dashes", "card 5500-0000-0000-0004", "card [CARD_1]"},
+		{"iban", "send to GB82 WEST 1234 5698 7654 32 please", "send to [IBAN_1] please"},
+		{"iban without spaces", "DE89370400440532013000", "[IBAN_1]"},
+		{"international phone", "call +44 7700 900123", "call [PHONE_1]"},
+		{"national phone", "call 07700 900123", "call [PHONE_1]"},
+		{"us phone", "call (555) 123-4567", "call [PHONE_1]"},
+		{"email", "mail jo.bloggs+tax@example.co.uk now", "mail [EMAIL_1] now"},
+		{"repeated value", "a@b.com then a@b.com and c@d.org", "[EMAIL_1] then [EMAIL_1] and [EMAIL_2]"},
+		{"date", "on 2024-01-15 at 09:30", "on 2024-01-15 at 09:30"},
+		{"amount", "spent £1,234.56 and 12.50", "spent £1,234.56 and 12.50"},
+		{"timestamp failing luhn", "id 1700000000001", "id 1700000000001"},
+		{"capitals failing mod 97", "GB12 ABCD EFGH IJKL", "GB12 ABCD EFGH IJKL"},
+		{"mood rating", "mood 7/10", "mood 7/10"},
+	}
+	for _, tt := range tests {
+		text := tt.text
+		r := all.Redact("wolf", &text)
+		if text != tt.want {
+			t.Errorf("%s: redacted = %q, want %q", tt.name, text, tt.want)
+		}
+		if got := r.Restore(text); got != tt.text {
+			t.Errorf("%s: restored = %q, want %q", tt.name, got, tt.text)
+		}
+	}
+}
+
+func TestRedactionPolicyActors(t *testing.T) {
+	actors, err := ParseRedactActors("wife=email+plate, guest=off")
+	if err != nil {
+		t.Fatalf("ParseRedactActors: %v", err)
+	}
+	policy := RedactionPolicy{
+		Kinds:    ParseRedactKinds("card"),
+		Actors:   actors,
+		Patterns: map[string]*regexp.Regexp{"plate": regexp.MustCompile(`\b[A-Z]{2}\d{2} ?[A-Z]{3}\b`)},
+	}
+	if err := policy.Validate(); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+
+	const text = "4111111111111111 a@b.com AB12 CDE"
+	tests := []struct {
+		actor string
+		want  string
+	}{
+		{"wolf", "[CARD_1] a@b.com AB12 CDE"},            // the default
+		{"wife", "4111111111111111 [EMAIL_1] [PLATE_1]"}, // their own list
+		{"guest", text},
+		{"", "[CARD_1] [EMAIL_1] [PLATE_1]"}, // no user: everyone's kinds
+	}
+	for _, tt := range tests {
+		got := text
+		r := policy.Redact(tt.actor, &got)
+		if got != tt.want {
+			t.Errorf("%q: redacted = %q, want %q", tt.actor, got, tt.want)
+		}
+		if (r == nil) != (got == text) {
+			t.Errorf("%q: redaction = %v for %q", tt.actor, r, got)
+		}
+	}
+
+	bad := []string{"wife", "wife=", "=card"}
+	for _, s := range bad {
+		if _, err := ParseRedactActors(s); err == nil {
+			t.Errorf("ParseRedactActors(%q) succeeded, want an error", s)
+		}
+	}
+	if err := (RedactionPolicy{Kinds: []string{"passport"}}).Validate(); err == nil {
+		t.Error("Validate accepted an unknown kind")
+	}
+}
+
+func TestLoadRedactPatterns(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		name    string
+		content string
+		want    int
+		wantErr bool
+	}{
+		{"patterns", "# plates\nplate=\\b[A-Z]{2}\\d{2} ?[A-Z]{3}\\b\n\nnhs = \\b\\d{3} \\d{3} \\d{4}\\b\n", 2, false},
+		{"built-in name", "card=\\d+\n", 0, true},
+		{"missing regexp", "plate=\n", 0, true},
+		{"invalid regexp", "plate=[A-Z\n", 0, true},
+	}
+	for _, tt := range tests {
+		path := filepath.Join(dir, "patterns.txt")
+		os.WriteFile(path, []byte(tt.content), 0600)
+		patterns, err := LoadRedactPatterns(path)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: error = %v, wantErr %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if len(patterns) != tt.want {
+			t.Errorf("%s: %d patterns, want %d", tt.name, len(patterns), tt.want)
+		}
+	}
+}
+
+func TestRestoreFields(t *testing.T) {
+	policy := RedactionPolicy{Patterns: map[string]*regexp.Regexp{"quote": regexp.MustCompile(`"[a-z]+"`)}, Kinds: []string{"quote"}}
+	text := `he said "hello"`
+	r := policy.Redact("wolf", &text)
+	got := r.RestoreFields(`{"cleaned_text": "he said [QUOTE_1]", "title": "Said [QUOTE_1]"}`, []string{"cleaned_text"})
+	var out struct {
+		CleanedText string `json:"cleaned_text"`
+		Title       string `json:"title"`
+	}
+	if err := json.Unmarshal([]byte(got), &out); err != nil || out.CleanedText != `he said "hello"` || out.Title != "Said [QUOTE_1]" {
+		t.Errorf("restored JSON = %s (%v)", got, err)
+	}
+	if got := r.RestoreFields("he said [QUOTE_1]", []string{"cleaned_text"}); got != "he said [QUOTE_1]" {
+		t.Errorf("restored prose = %q, want the placeholder kept", got)
+	}
+}
+
+func TestClientRedacts(t *testing.T) {
+	var sent []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req GenerateRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		sent = append(sent, req.Prompt)
+		json.NewEncoder(w).Encode(GenerateResponse{Response: `{"cleaned_text": "Pay [IBAN_1] by card [CARD_1]", "title": "Pay [IBAN_1]"}`, Done: true})
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, "light", "heavy")
+	client.SetRedaction(RedactionPolicy{Kinds: []string{RedactCard}, Actors: map[string][]string{"wife": {RedactCard, RedactIBAN}}})
+
+	prompt := "pay GB82 WEST 1234 5698 7654 32 by card 4111 1111 1111 1111"
+	var out struct {
+		CleanedText string `json:"cleaned_text"`
+		Title       string `json:"title"`
+	}
+	ctx := WithRestore(WithActor(context.Background(), "wife"), "cleaned_text")
+	if err := client.GenerateJSON(ctx, TaskClassify, "", prompt, nil, &out); err != nil {
+		t.Fatalf("GenerateJSON: %v", err)
+	}
+	if len(sent) != 1 || strings.Contains(sent[0], "4111") || strings.Contains(sent[0], "GB82") {
+		t.Errorf("provider saw %q", sent)
+	}
+	if want := "Pay GB82 WEST 1234 5698 7654 32 by card 4111 1111 1111 1111"; out.CleanedText != want {
+		t.Errorf("cleaned_text = %q, want %q", out.CleanedText, want)
+	}
+	if out.Title != "Pay [IBAN_1]" {
+		t.Errorf("title = %q, want the placeholder kept", out.Title)
+	}
+
+	// Generated prose keeps the placeholders
+	letter, err := client.GenerateText(WithActor(context.Background(), "wife"), TaskDailyLetter, prompt)
+	if err != nil || strings.Contains(letter, "4111") || !strings.Contains(letter, "[CARD_1]") {
+		t.Errorf("letter = %q, %v; want placeholders", letter, err)
+	}
+	streamed, err := client.GenerateTextStream(WithActor(context.Background(), "wife"), TaskDailyLetter, prompt, func(string) error { return nil })
+	if err != nil || strings.Contains(streamed, "4111") {
+		t.Errorf("streamed letter = %q, %v; want placeholders", streamed, err)
+	}
+
+	// Wolf's default list leaves the IBAN alone
+	sent = sent[:1]
+	client.Generate(WithActor(context.Background(), "wolf"), TaskClassify, prompt)
+	if len(sent) != 2 || !strings.Contains(sent[1], "GB82") || strings.Contains(sent[1], "4111") {
+		t.Errorf("provider saw %q for wolf", sent[1:])
+	}
+}
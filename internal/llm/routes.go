@@ -0,0 +1,194 @@
+package llm
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+)
+
+// Task names a kind of LLM call; each task is routed to its own model and settings
+type Task string
+
+// Tasks routed through the client
+const (
+	TaskClassify         Task = "classify"
+	TaskParseTransaction Task = "parse_transaction"
+	TaskDailyLetter      Task = "daily_letter"
+	TaskWeeklyLetter     Task = "weekly_letter"
+	TaskIdeaExpand       Task = "idea_expand"
+	TaskNarrateExtract   Task = "narrate_extract"
+	TaskNarrate          Task = "narrate"
+	TaskVerify           Task = "verify"
+	TaskMood             Task = "mood"
+	TaskAsk              Task = "ask"
+)
+
+// TaskSettings is the model and call policy for a task
+type TaskSettings struct {
+	Model       string
+	Temperature *float64      // nil leaves the model default
+	NumCtx      int           // context window in tokens, 0 for the model default (Ollama only)
+	Timeout     time.Duration // per attempt
+	MaxAttempts int
+	Backoff     time.Duration // first retry delay, doubled on each further retry
+	CacheTTL    time.Duration // how long identical requests are answered from the cache, 0 to never cache
+	Priority    Priority      // queue order when the parallelism limit is reached
+}
+
+// Routes maps each task to its settings
+type Routes map[Task]TaskSettings
+
+// Defaults for tasks without explicit settings
+const (
+	defaultTimeout     = 2 * time.Minute
+	defaultMaxAttempts = 3
+	defaultBackoff     = time.Second
+)
+
+// DefaultRoutes sends quick structured tasks to the light model and writing and
+// reasoning tasks to the heavy one. Capture-time tasks are interactive, questions
+// are normal, and everything that runs in the background yields to both.
+func DefaultRoutes(model, modelHeavy string) Routes {
+	light := TaskSettings{Model: model, Timeout: defaultTimeout, MaxAttempts: defaultMaxAttempts, Backoff: defaultBackoff}
+	heavy := TaskSettings{Model: modelHeavy, Timeout: defaultTimeout, MaxAttempts: defaultMaxAttempts, Backoff: defaultBackoff}
+	with := func(s TaskSettings, p Priority) TaskSettings {
+		s.Priority = p
+		return s
+	}
+
+	return Routes{
+		TaskClassify:         with(light, PriorityInteractive),
+		TaskParseTransaction: with(light, PriorityInteractive),
+		TaskMood:             with(light, PriorityBackground),
+		TaskDailyLetter:      with(heavy, PriorityBackground),
+		TaskWeeklyLetter:     with(heavy, PriorityBackground),
+		TaskIdeaExpand:       with(heavy, PriorityBackground),
+		TaskNarrateExtract:   with(heavy, PriorityBackground),
+		TaskNarrate:          with(heavy, PriorityBackground),
+		TaskVerify:           with(heavy, PriorityBackground),
+		TaskAsk:              with(heavy, PriorityNormal),
+	}
+}
+
+// Merge overlays other onto r field by field; zero values in other keep r's settings
+func (r Routes) Merge(other Routes) Routes {
+	merged := make(Routes, len(r))
+	for task, settings := range r {
+		merged[task] = settings
+	}
+	for task, o := range other {
+		s := merged[task]
+		if o.Model != "" {
+			s.Model = o.Model
+		}
+		if o.Temperature != nil {
+			s.Temperature = o.Temperature
+		}
+		if o.NumCtx != 0 {
+			s.NumCtx = o.NumCtx
+		}
+		if o.Timeout != 0 {
+			s.Timeout = o.Timeout
+		}
+		if o.MaxAttempts != 0 {
+			s.MaxAttempts = o.MaxAttempts
+		}
+		if o.Backoff != 0 {
+			s.Backoff = o.Backoff
+		}
+		if o.CacheTTL != 0 {
+			s.CacheTTL = o.CacheTTL
+		}
+		if o.Priority != 0 {
+			s.Priority = o.Priority
+		}
+		merged[task] = s
+	}
+	return merged
+}
+
+// routeFile is the JSON form of one task's settings
+type routeFile struct {
+	Model       string   `json:"model"`
+	Temperature *float64 `json:"temperature"`
+	NumCtx      int      `json:"num_ctx"`
+	Timeout     string   `json:"timeout"` // Go duration, e.g. "45s"
+	MaxAttempts int      `json:"max_attempts"`
+	Backoff     string   `json:"backoff"`
+	CacheTTL    string   `json:"cache_ttl"` // e.g. "24h"; only for deterministic tasks
+	Priority    string   `json:"priority"`  // interactive, normal or background
+}
+
+// LoadRoutes reads a JSON routing table keyed by task name, e.g.
+//
+//	{"classify": {"model": "qwen2.5:7b-instruct", "temperature": 0.1, "timeout": "30s"}}
+//
+// Omitted fields keep their defaults.
+func LoadRoutes(path string) (Routes, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading routes: %w", err)
+	}
+	return ParseRoutes(data)
+}
+
+// ParseRoutes parses a JSON routing table (see LoadRoutes)
+func ParseRoutes(data []byte) (Routes, error) {
+	var raw map[string]routeFile
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("parsing routes: %w", err)
+	}
+
+	known := DefaultRoutes("", "")
+	routes := make(Routes, len(raw))
+	var err error
+	for name, rf := range raw {
+		task := Task(name)
+		if _, ok := known[task]; !ok {
+			return nil, fmt.Errorf("unknown task %q (known: %v)", name, known.taskNames())
+		}
+
+		s := TaskSettings{
+			Model:       rf.Model,
+			Temperature: rf.Temperature,
+			NumCtx:      rf.NumCtx,
+			MaxAttempts: rf.MaxAttempts,
+		}
+		if rf.Timeout != "" {
+			if s.Timeout, err = time.ParseDuration(rf.Timeout); err != nil {
+				return nil, fmt.Errorf("task %s: invalid timeout: %w", name, err)
+			}
+		}
+		if rf.Backoff != "" {
+			if s.Backoff, err = time.ParseDuration(rf.Backoff); err != nil {
+				return nil, fmt.Errorf("task %s: invalid backoff: %w", name, err)
+			}
+		}
+		if rf.CacheTTL != "" {
+			if s.CacheTTL, err = time.ParseDuration(rf.CacheTTL); err != nil {
+				return nil, fmt.Errorf("task %s: invalid cache_ttl: %w", name, err)
+			}
+		}
+		if rf.Priority != "" {
+			if s.Priority, err = ParsePriority(rf.Priority); err != nil {
+				return nil, fmt.Errorf("task %s: %w", name, err)
+			}
+		}
+		if s.MaxAttempts < 0 || s.NumCtx < 0 || s.Timeout < 0 || s.Backoff < 0 || s.CacheTTL < 0 {
+			return nil, fmt.Errorf("task %s: negative settings are not allowed", name)
+		}
+		routes[task] = s
+	}
+	return routes, nil
+}
+
+func (r Routes) taskNames() []string {
+	var names []string
+	for task := range r {
+		names = append(names, string(task))
+	}
+	sort.Strings(names)
+	return names
+}
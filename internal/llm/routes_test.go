@@ -0,0 +1,125 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestParseRoutes(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		wantErr bool
+	}{
+		{"valid", `{"classify": {"model": "small", "temperature": 0.1, "num_ctx": 4096, "timeout": "30s", "max_attempts": 2, "backoff": "500ms"}}`, false},
+		{"empty", `{}`, false},
+		{"unknown task", `{"summarize": {"model": "small"}}`, true},
+		{"bad duration", `{"narrate": {"timeout": "soon"}}`, true},
+		{"negative attempts", `{"verify": {"max_attempts": -1}}`, true},
+		{"cache ttl", `{"narrate_extract": {"cache_ttl": "72h"}}`, false},
+		{"bad cache ttl", `{"classify": {"cache_ttl": "forever"}}`, true},
+		{"priority", `{"narrate": {"priority": "interactive"}}`, false},
+		{"bad priority", `{"narrate": {"priority": "urgent"}}`, true},
+		{"invalid json", `{"classify":`, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseRoutes([]byte(tt.data))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseRoutes() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	routes, err := ParseRoutes([]byte(`{"classify": {"model": "small", "temperature": 0.1, "timeout": "30s", "backoff": "500ms"}}`))
+	if err != nil {
+		t.Fatalf("ParseRoutes: %v", err)
+	}
+	got := routes[TaskClassify]
+	if got.Model != "small" || got.Timeout != 30*time.Second || got.Backoff != 500*time.Millisecond {
+		t.Errorf("classify = %+v", got)
+	}
+	if got.Temperature == nil || *got.Temperature != 0.1 {
+		t.Errorf("temperature = %v, want 0.1", got.Temperature)
+	}
+}
+
+func TestRoutesMerge(t *testing.T) {
+	temp := 0.2
+	base := DefaultRoutes("light", "heavy")
+	merged := base.Merge(Routes{
+		TaskNarrate:  {Temperature: &temp},
+		TaskClassify: {Model: "tiny", MaxAttempts: 1},
+	})
+
+	narrate := merged[TaskNarrate]
+	if narrate.Model != "heavy" {
+		t.Errorf("narrate model = %q, want default heavy model", narrate.Model)
+	}
+	if narrate.Temperature == nil || *narrate.Temperature != temp {
+		t.Errorf("narrate temperature = %v, want %v", narrate.Temperature, temp)
+	}
+
+	classify := merged[TaskClassify]
+	if classify.Model != "tiny" || classify.MaxAttempts != 1 {
+		t.Errorf("classify = %+v, want model tiny with 1 attempt", classify)
+	}
+	if classify.Timeout != defaultTimeout {
+		t.Errorf("classify timeout = %v, want default %v", classify.Timeout, defaultTimeout)
+	}
+
+	if classify.Priority != PriorityInteractive || narrate.Priority != PriorityBackground {
+		t.Errorf("priorities = %v/%v, want default interactive/background", classify.Priority, narrate.Priority)
+	}
+
+	if base[TaskClassify].Model != "light" {
+		t.Error("Merge modified the receiver")
+	}
+}
+
+func TestClientRoutesTasks(t *testing.T) {
+	var calls atomic.Int32
+	var last GenerateRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := calls.Add(1)
+		json.NewDecoder(r.Body).Decode(&last)
+		if n == 1 {
+			http.Error(w, "busy", http.StatusServiceUnavailable)
+			return
+		}
+		json.NewEncoder(w).Encode(GenerateResponse{Response: `{"ok": true}`, Done: true})
+	}))
+	defer server.Close()
+
+	temp := 0.3
+	client := NewClient(server.URL, "light", "heavy")
+	client.SetRoutes(Routes{
+		TaskVerify: {Model: "checker", Temperature: &temp, NumCtx: 8192, MaxAttempts: 2, Backoff: time.Millisecond},
+	})
+
+	if _, err := client.Generate(context.Background(), TaskVerify, "check this"); err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+	if calls.Load() != 2 {
+		t.Errorf("calls = %d, want 2 (one retry)", calls.Load())
+	}
+	if last.Model != "checker" {
+		t.Errorf("model = %q, want checker", last.Model)
+	}
+	if last.Options == nil || last.Options.NumCtx != 8192 || last.Options.Temperature == nil || *last.Options.Temperature != temp {
+		t.Errorf("options = %+v, want num_ctx 8192 and temperature %v", last.Options, temp)
+	}
+
+	if got := client.Route(TaskClassify).Model; got != "light" {
+		t.Errorf("classify model = %q, want light", got)
+	}
+	if got := client.Route(TaskNarrate).Model; got != "heavy" {
+		t.Errorf("narrate model = %q, want heavy", got)
+	}
+}
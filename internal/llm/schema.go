@@ -0,0 +1,168 @@
+package llm
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// Validator is implemented by response structs with rules the schema cannot express
+type Validator interface {
+	Validate() error
+}
+
+// SchemaError is returned when a structured response is still invalid after the repair prompt
+type SchemaError struct {
+	Task     Task
+	Response string // the last response received
+	Err      error
+}
+
+func (e *SchemaError) Error() string {
+	return fmt.Sprintf("%s: invalid structured output: %v (response: %s)", e.Task, e.Err, truncateResponse(e.Response, 200))
+}
+
+func (e *SchemaError) Unwrap() error {
+	return e.Err
+}
+
+const repairPrompt = `%s
+
+Your previous response was not valid for the required JSON schema.
+
+PREVIOUS RESPONSE:
+%s
+
+PROBLEM: %v
+
+Respond again with only a JSON object that matches the schema.`
+
+// DecodeStrict validates a JSON response against schema, then decodes it into out
+// rejecting unknown fields, then runs out's Validate method if it has one.
+// out must be a pointer; it is reset before decoding.
+func DecodeStrict(response string, schema json.RawMessage, out interface{}) error {
+	var value interface{}
+	if err := json.Unmarshal([]byte(response), &value); err != nil {
+		return fmt.Errorf("not JSON: %w", err)
+	}
+	if len(schema) > 0 {
+		var s jsonSchema
+		if err := json.Unmarshal(schema, &s); err != nil {
+			return fmt.Errorf("invalid schema: %w", err)
+		}
+		if err := s.validate("$", value); err != nil {
+			return err
+		}
+	}
+
+	target := reflect.ValueOf(out)
+	if target.Kind() != reflect.Ptr || target.IsNil() {
+		return fmt.Errorf("decode target must be a non-nil pointer, got %T", out)
+	}
+	target.Elem().Set(reflect.Zero(target.Elem().Type()))
+
+	dec := json.NewDecoder(strings.NewReader(response))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(out); err != nil {
+		return err
+	}
+	if v, ok := out.(Validator); ok {
+		return v.Validate()
+	}
+	return nil
+}
+
+// jsonSchema is the subset of JSON Schema used for structured outputs
+type jsonSchema struct {
+	Type       string                 `json:"type"`
+	Properties map[string]*jsonSchema `json:"properties"`
+	Required   []string               `json:"required"`
+	Items      *jsonSchema            `json:"items"`
+	Enum       []interface{}          `json:"enum"`
+	Minimum    *float64               `json:"minimum"`
+	Maximum    *float64               `json:"maximum"`
+}
+
+func (s *jsonSchema) validate(path string, value interface{}) error {
+	switch s.Type {
+	case "object":
+		obj, ok := value.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("%s: expected object", path)
+		}
+		for _, name := range s.Required {
+			if _, ok := obj[name]; !ok {
+				return fmt.Errorf("%s: missing required field %q", path, name)
+			}
+		}
+		for name, v := range obj {
+			if prop, ok := s.Properties[name]; ok && v != nil {
+				if err := prop.validate(path+"."+name, v); err != nil {
+					return err
+				}
+			}
+		}
+	case "array":
+		arr, ok := value.([]interface{})
+		if !ok {
+			return fmt.Errorf("%s: expected array", path)
+		}
+		if s.Items != nil {
+			for i, v := range arr {
+				if err := s.Items.validate(fmt.Sprintf("%s[%d]", path, i), v); err != nil {
+					return err
+				}
+			}
+		}
+	case "string":
+		if _, ok := value.(string); !ok {
+			return fmt.Errorf("%s: expected string", path)
+		}
+	case "number", "integer":
+		n, ok := value.(float64)
+		if !ok {
+			return fmt.Errorf("%s: expected %s", path, s.Type)
+		}
+		if s.Type == "integer" && n != float64(int64(n)) {
+			return fmt.Errorf("%s: expected integer", path)
+		}
+		if s.Minimum != nil && n < *s.Minimum {
+			return fmt.Errorf("%s: %v is below minimum %v", path, n, *s.Minimum)
+		}
+		if s.Maximum != nil && n > *s.Maximum {
+			return fmt.Errorf("%s: %v is above maximum %v", path, n, *s.Maximum)
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			return fmt.Errorf("%s: expected boolean", path)
+		}
+	}
+
+	if len(s.Enum) > 0 {
+		for _, allowed := range s.Enum {
+			if reflect.DeepEqual(allowed, value) {
+				return nil
+			}
+		}
+		return fmt.Errorf("%s: %v is not one of %v", path, value, s.Enum)
+	}
+	return nil
+}
+
+// compactSchema strips whitespace so schemas written as readable constants are sent compactly
+func compactSchema(schema json.RawMessage) json.RawMessage {
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, schema); err != nil {
+		return schema
+	}
+	return buf.Bytes()
+}
+
+func truncateResponse(s string, maxLen int) string {
+	if len(s) <= maxLen {
+		return s
+	}
+	return s[:maxLen] + "..."
+}
@@ -0,0 +1,118 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+const testSchema = `{
+  "type": "object",
+  "properties": {
+    "label": {"type": "string", "enum": ["a", "b"]},
+    "score": {"type": "number", "minimum": 0, "maximum": 1},
+    "tags": {"type": "array", "items": {"type": "string"}}
+  },
+  "required": ["label", "score"]
+}`
+
+type testResult struct {
+	Label string   `json:"label"`
+	Score float64  `json:"score"`
+	Tags  []string `json:"tags"`
+}
+
+func (r *testResult) Validate() error {
+	if r.Label == "b" && r.Score < 0.5 {
+		return fmt.Errorf("label b needs score of at least 0.5")
+	}
+	return nil
+}
+
+func TestDecodeStrict(t *testing.T) {
+	tests := []struct {
+		name     string
+		response string
+		wantErr  bool
+	}{
+		{"valid", `{"label": "a", "score": 0.9, "tags": ["x"]}`, false},
+		{"optional omitted", `{"label": "a", "score": 0.1}`, false},
+		{"not json", `label: a`, true},
+		{"missing required", `{"label": "a"}`, true},
+		{"wrong type", `{"label": "a", "score": "high"}`, true},
+		{"not in enum", `{"label": "c", "score": 0.5}`, true},
+		{"above maximum", `{"label": "a", "score": 3}`, true},
+		{"bad item", `{"label": "a", "score": 0.5, "tags": [1]}`, true},
+		{"unknown field", `{"label": "a", "score": 0.5, "extra": true}`, true},
+		{"fails Validate", `{"label": "b", "score": 0.2}`, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out testResult
+			err := DecodeStrict(tt.response, json.RawMessage(testSchema), &out)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("DecodeStrict(%s) error = %v, wantErr %v", tt.response, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// stubStructured serves responses in order and records whether the schema was sent
+func stubStructured(t *testing.T, responses ...string) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req GenerateRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		if _, ok := req.Format.(map[string]interface{}); !ok {
+			t.Errorf("format = %v, want a schema object", req.Format)
+		}
+		n := int(calls.Add(1))
+		if n > 1 && !strings.Contains(req.Prompt, "PREVIOUS RESPONSE") {
+			t.Errorf("second call is not a repair prompt: %.80s", req.Prompt)
+		}
+		json.NewEncoder(w).Encode(GenerateResponse{Response: responses[(n-1)%len(responses)], Done: true})
+	}))
+	return server, &calls
+}
+
+func TestGenerateJSONRepairs(t *testing.T) {
+	server, calls := stubStructured(t, `{"label": "c", "score": 0.5}`, `{"label": "a", "score": 0.5}`)
+	defer server.Close()
+
+	client := NewClient(server.URL, "test", "test")
+	var out testResult
+	if err := client.GenerateJSON(context.Background(), TaskClassify, "", "label this", json.RawMessage(testSchema), &out); err != nil {
+		t.Fatalf("GenerateJSON: %v", err)
+	}
+	if out.Label != "a" {
+		t.Errorf("label = %q, want repaired value a", out.Label)
+	}
+	if calls.Load() != 2 {
+		t.Errorf("calls = %d, want 2", calls.Load())
+	}
+}
+
+func TestGenerateJSONSchemaError(t *testing.T) {
+	server, calls := stubStructured(t, `{"label": "c", "score": 0.5}`)
+	defer server.Close()
+
+	client := NewClient(server.URL, "test", "test")
+	var out testResult
+	err := client.GenerateJSON(context.Background(), TaskClassify, "", "label this", json.RawMessage(testSchema), &out)
+
+	var schemaErr *SchemaError
+	if !errors.As(err, &schemaErr) {
+		t.Fatalf("error = %v, want *SchemaError", err)
+	}
+	if calls.Load() != 2 {
+		t.Errorf("calls = %d, want exactly one repair attempt", calls.Load())
+	}
+}
@@ -0,0 +1,117 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestGenerateTextStreamOllama(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req GenerateRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		if !req.Stream {
+			t.Error("expected stream: true")
+		}
+		enc := json.NewEncoder(w)
+		for _, piece := range []string{"Dear ", "you, ", "hello."} {
+			enc.Encode(GenerateResponse{Response: piece})
+			w.(http.Flusher).Flush()
+		}
+		enc.Encode(GenerateResponse{Done: true, EvalCount: 3, PromptEvalCount: 10})
+	}))
+	defer server.Close()
+
+	recorder := &recorderStub{}
+	client := NewClient(server.URL, "light", "heavy")
+	client.SetRecorder(recorder)
+
+	var chunks []string
+	text, err := client.GenerateTextStream(context.Background(), TaskDailyLetter, "write", func(chunk string) error {
+		chunks = append(chunks, chunk)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("GenerateTextStream: %v", err)
+	}
+	if text != "Dear you, hello." {
+		t.Errorf("text = %q", text)
+	}
+	if len(chunks) != 3 {
+		t.Errorf("chunks = %q, want 3", chunks)
+	}
+	if len(recorder.records) != 1 || recorder.records[0].EvalCount != 3 || recorder.records[0].Model != "heavy" {
+		t.Errorf("unexpected ledger records: %+v", recorder.records)
+	}
+}
+
+func TestGenerateTextStreamStopsOnListenerError(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		enc := json.NewEncoder(w)
+		for i := 0; i < 50; i++ {
+			if err := enc.Encode(GenerateResponse{Response: fmt.Sprintf("word%d ", i)}); err != nil {
+				return
+			}
+			w.(http.Flusher).Flush()
+			time.Sleep(time.Millisecond)
+		}
+		enc.Encode(GenerateResponse{Done: true})
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, "light", "heavy")
+	gone := errors.New("client disconnected")
+	received := 0
+	_, err := client.GenerateTextStream(context.Background(), TaskIdeaExpand, "expand", func(string) error {
+		received++
+		if received == 2 {
+			return gone
+		}
+		return nil
+	})
+	if !errors.Is(err, gone) {
+		t.Fatalf("error = %v, want listener error", err)
+	}
+	if calls.Load() != 1 {
+		t.Errorf("calls = %d, want no retry after text was streamed", calls.Load())
+	}
+}
+
+func TestGenerateTextStreamOpenAI(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req ChatRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		if !req.Stream {
+			t.Error("expected stream: true")
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, piece := range []string{"Hel", "lo"} {
+			fmt.Fprintf(w, "data: {\"choices\": [{\"delta\": {\"content\": %q}}]}\n\n", piece)
+		}
+		fmt.Fprint(w, "data: {\"choices\": [], \"usage\": {\"prompt_tokens\": 4, \"completion_tokens\": 2}}\n\n")
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+	defer server.Close()
+
+	client := NewClientWithProvider(NewOpenAIProvider(server.URL, ""), "small", "large")
+	var sb strings.Builder
+	text, err := client.GenerateTextStream(context.Background(), TaskIdeaExpand, "hi", func(chunk string) error {
+		sb.WriteString(chunk)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("GenerateTextStream: %v", err)
+	}
+	if text != "Hello" || sb.String() != "Hello" {
+		t.Errorf("text = %q, streamed = %q, want Hello", text, sb.String())
+	}
+}
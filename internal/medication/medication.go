@@ -0,0 +1,356 @@
+package medication
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mrwolf/brain-server/internal/db"
+)
+
+// DefaultGrace is how long after a slot a dose can still be taken before it counts as missed
+const DefaultGrace = 2 * time.Hour
+
+// EarlyWindow is how long before a slot a dose still counts for it rather than the previous one
+const EarlyWindow = time.Hour
+
+// Phrases that mark a dose as missed ("forgot antihistamine")
+var missedPattern = regexp.MustCompile(`\b(forgot|forgotten|forget|missed|skipped|skip|didn'?t take|did not take|ran out of|out of)\b`)
+
+// Phrases that mark a dose as taken ("took my vitamin D"); intentions such as
+// "need to take" and generic verbs such as "had" or "done" do not
+var takenPattern = regexp.MustCompile(`\b(took|taken|swallowed|popped)\b`)
+
+// Clause boundaries used to attribute a status to the right medication
+var clauseSplit = regexp.MustCompile(`[.;,!?]|\bbut\b|\bthen\b`)
+
+var slotPattern = regexp.MustCompile(`^([01]\d|2[0-3]):[0-5]\d$`)
+
+// Match is a medication mentioned in a capture with the dose status it implies
+type Match struct {
+	Medication db.Medication
+	Status     string // db.DoseTaken or db.DoseMissed
+}
+
+// Tracker matches Health captures against medication schedules and computes adherence
+type Tracker struct {
+	db       *db.DB
+	location *time.Location
+	grace    time.Duration
+}
+
+// NewTracker creates a tracker that interprets schedule slots in the given timezone
+func NewTracker(database *db.DB, loc *time.Location) *Tracker {
+	if loc == nil {
+		loc = time.UTC
+	}
+	return &Tracker{
+		db:       database,
+		location: loc,
+		grace:    DefaultGrace,
+	}
+}
+
+// ValidateTimes checks that every slot is a 24h "HH:MM" string
+func ValidateTimes(times []string) error {
+	if len(times) == 0 {
+		return fmt.Errorf("at least one time is required")
+	}
+	for _, t := range times {
+		if !slotPattern.MatchString(t) {
+			return fmt.Errorf("invalid time %q, use HH:MM", t)
+		}
+	}
+	return nil
+}
+
+// MatchText finds medications mentioned in text along with taken/missed status
+// Status is decided per clause so "took vitamin D but forgot antihistamine" records both.
+// A clause naming a medication without a taken or missed phrase continues the list
+// of the clause before it ("took vitamin D, antihistamine") if that one also names
+// a medication; other mentions are ignored, so "took a walk, vitamin D later" records nothing.
+func MatchText(text string, meds []db.Medication) []Match {
+	lower := strings.ToLower(text)
+	patterns := make([]*regexp.Regexp, len(meds))
+	for i, m := range meds {
+		if name := strings.ToLower(strings.TrimSpace(m.Name)); name != "" {
+			patterns[i] = regexp.MustCompile(`\b` + regexp.QuoteMeta(name) + `\b`)
+		}
+	}
+
+	statuses := make(map[int]string)
+	carried := ""
+	for _, clause := range clauseSplit.Split(lower, -1) {
+		var named []int
+		for i, p := range patterns {
+			if p != nil && p.MatchString(clause) {
+				named = append(named, i)
+			}
+		}
+		if len(named) == 0 {
+			carried = ""
+			continue
+		}
+		status := doseStatus(clause)
+		if status == "" {
+			status = carried
+		}
+		carried = status
+		for _, i := range named {
+			if _, ok := statuses[i]; !ok && status != "" {
+				statuses[i] = status
+			}
+		}
+	}
+
+	var matches []Match
+	for i, m := range meds {
+		if status, ok := statuses[i]; ok {
+			matches = append(matches, Match{Medication: m, Status: status})
+		}
+	}
+	return matches
+}
+
+// doseStatus returns the dose status implied by a piece of text, or "" if none
+func doseStatus(text string) string {
+	if missedPattern.MatchString(text) {
+		return db.DoseMissed
+	}
+	if takenPattern.MatchString(text) {
+		return db.DoseTaken
+	}
+	return ""
+}
+
+// RecordCapture matches a Health capture against the actor's schedule and records doses
+// Returns the matches that were recorded.
+func (t *Tracker) RecordCapture(actor, captureID, text string, ts time.Time) ([]Match, error) {
+	meds, err := t.db.GetMedications(actor)
+	if err != nil {
+		return nil, fmt.Errorf("loading medications: %w", err)
+	}
+
+	var recorded []Match
+	for _, m := range MatchText(text, meds) {
+		slot, ok := t.doseSlot(m.Medication.Times, ts)
+		if !ok {
+			continue
+		}
+		_, err := t.db.RecordDose(db.MedicationDose{
+			MedID:        m.Medication.MedID,
+			Actor:        actor,
+			ScheduledFor: slot,
+			Status:       m.Status,
+			CaptureID:    captureID,
+		})
+		if err != nil {
+			return recorded, fmt.Errorf("recording dose for %s: %w", m.Medication.Name, err)
+		}
+		recorded = append(recorded, m)
+	}
+	return recorded, nil
+}
+
+// CheckMissed marks every past slot (today and yesterday) without a dose as missed
+// Returns the newly missed doses.
+func (t *Tracker) CheckMissed(now time.Time) ([]db.MedicationDose, error) {
+	meds, err := t.db.GetMedications("")
+	if err != nil {
+		return nil, fmt.Errorf("loading medications: %w", err)
+	}
+
+	local := now.In(t.location)
+	today := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, t.location)
+
+	var missed []db.MedicationDose
+	for _, m := range meds {
+		for _, day := range []time.Time{today.AddDate(0, 0, -1), today} {
+			for _, slot := range slotsOn(day, m.Times) {
+				if slot.Before(m.CreatedAt) || slot.Add(t.grace).After(now) {
+					continue
+				}
+				dose := db.MedicationDose{
+					MedID:        m.MedID,
+					Actor:        m.Actor,
+					ScheduledFor: slot,
+					Status:       db.DoseMissed,
+				}
+				inserted, err := t.db.RecordDose(dose)
+				if err != nil {
+					return missed, fmt.Errorf("recording missed dose for %s: %w", m.Name, err)
+				}
+				if inserted {
+					missed = append(missed, dose)
+				}
+			}
+		}
+	}
+	return missed, nil
+}
+
+// MedicationAdherence is the adherence for one medication over one week
+type MedicationAdherence struct {
+	MedID    string  `json:"med_id"`
+	Name     string  `json:"name"`
+	Expected int     `json:"expected"`
+	Taken    int     `json:"taken"`
+	Missed   int     `json:"missed"`
+	Percent  float64 `json:"percent"`
+}
+
+// WeekAdherence is the adherence for all medications over one ISO week
+type WeekAdherence struct {
+	Week        string                `json:"week"` // "2026-W42"
+	Start       string                `json:"start"`
+	Percent     float64               `json:"percent"`
+	Medications []MedicationAdherence `json:"medications"`
+}
+
+// Adherence returns weekly adherence for an actor, most recent week first
+// Only slots that have already passed count towards the expected total.
+func (t *Tracker) Adherence(actor string, weeks int, now time.Time) ([]WeekAdherence, error) {
+	meds, err := t.db.GetMedications(actor)
+	if err != nil {
+		return nil, fmt.Errorf("loading medications: %w", err)
+	}
+
+	local := now.In(t.location)
+	weekday := (int(local.Weekday()) + 6) % 7 // Monday = 0
+	thisWeek := time.Date(local.Year(), local.Month(), local.Day()-weekday, 0, 0, 0, 0, t.location)
+
+	var result []WeekAdherence
+	for i := 0; i < weeks; i++ {
+		start := thisWeek.AddDate(0, 0, -7*i)
+		end := start.AddDate(0, 0, 7)
+
+		doses, err := t.db.GetDoses(actor, start, end)
+		if err != nil {
+			return nil, fmt.Errorf("loading doses: %w", err)
+		}
+		taken := make(map[string]int)
+		missed := make(map[string]int)
+		for _, d := range doses {
+			switch d.Status {
+			case db.DoseTaken:
+				taken[d.MedID]++
+			case db.DoseMissed:
+				missed[d.MedID]++
+			}
+		}
+
+		year, wk := start.ISOWeek()
+		week := WeekAdherence{
+			Week:        fmt.Sprintf("%d-W%02d", year, wk),
+			Start:       start.Format("2006-01-02"),
+			Medications: []MedicationAdherence{},
+		}
+
+		var totalExpected, totalTaken int
+		for _, m := range meds {
+			expected := 0
+			for day := start; day.Before(end); day = day.AddDate(0, 0, 1) {
+				for _, slot := range slotsOn(day, m.Times) {
+					if !slot.Before(m.CreatedAt) && !slot.After(now) {
+						expected++
+					}
+				}
+			}
+			if expected == 0 && taken[m.MedID] == 0 {
+				continue
+			}
+			if taken[m.MedID] > expected {
+				expected = taken[m.MedID]
+			}
+			week.Medications = append(week.Medications, MedicationAdherence{
+				MedID:    m.MedID,
+				Name:     m.Name,
+				Expected: expected,
+				Taken:    taken[m.MedID],
+				Missed:   missed[m.MedID],
+				Percent:  percent(taken[m.MedID], expected),
+			})
+			totalExpected += expected
+			totalTaken += taken[m.MedID]
+		}
+		week.Percent = percent(totalTaken, totalExpected)
+		result = append(result, week)
+	}
+	return result, nil
+}
+
+// FormatMissedContext summarises missed doses for the daily letter prompt
+func FormatMissedContext(doses []db.MedicationDose, meds []db.Medication, loc *time.Location) string {
+	var missed []db.MedicationDose
+	for _, d := range doses {
+		if d.Status == db.DoseMissed {
+			missed = append(missed, d)
+		}
+	}
+	if len(missed) == 0 {
+		return ""
+	}
+
+	names := make(map[string]string)
+	for _, m := range meds {
+		names[m.MedID] = m.Name
+	}
+	sort.Slice(missed, func(i, j int) bool {
+		return missed[i].ScheduledFor.Before(missed[j].ScheduledFor)
+	})
+
+	var sb strings.Builder
+	sb.WriteString("\nMISSED DOSES (last 24h):\n")
+	for _, d := range missed {
+		name := names[d.MedID]
+		if name == "" {
+			name = d.MedID
+		}
+		sb.WriteString(fmt.Sprintf("  - %s at %s\n", name, d.ScheduledFor.In(loc).Format("Mon 15:04")))
+	}
+	return sb.String()
+}
+
+// doseSlot returns the slot a dose taken at ts is for: the latest slot in the day
+// before ts, or one due within EarlyWindow after it. A late evening dose of a
+// morning medication is that morning's, never the next day's.
+func (t *Tracker) doseSlot(times []string, ts time.Time) (time.Time, bool) {
+	local := ts.In(t.location)
+	day := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, t.location)
+
+	var best time.Time
+	found := false
+	for _, d := range []time.Time{day.AddDate(0, 0, -1), day, day.AddDate(0, 0, 1)} {
+		for _, slot := range slotsOn(d, times) {
+			if slot.After(ts.Add(EarlyWindow)) || !slot.After(ts.Add(-24*time.Hour)) {
+				continue
+			}
+			if !found || slot.After(best) {
+				best, found = slot, true
+			}
+		}
+	}
+	return best, found
+}
+
+// slotsOn expands "HH:MM" slots onto a given day
+func slotsOn(day time.Time, times []string) []time.Time {
+	var slots []time.Time
+	for _, t := range times {
+		parsed, err := time.Parse("15:04", t)
+		if err != nil {
+			continue
+		}
+		slots = append(slots, time.Date(day.Year(), day.Month(), day.Day(), parsed.Hour(), parsed.Minute(), 0, 0, day.Location()))
+	}
+	return slots
+}
+
+func percent(n, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(int(float64(n)/float64(total)*1000+0.5)) / 10
+}
@@ -0,0 +1,209 @@
+package medication
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/mrwolf/brain-server/internal/db"
+)
+
+func setupTestDB(t *testing.T) (*db.DB, func()) {
+	t.Helper()
+
+	tmpFile, err := os.CreateTemp("", "brain-meds-test-*.db")
+	if err != nil {
+		t.Fatalf("creating temp file: %v", err)
+	}
+	tmpFile.Close()
+
+	database, err := db.Open(tmpFile.Name())
+	if err != nil {
+		os.Remove(tmpFile.Name())
+		t.Fatalf("opening database: %v", err)
+	}
+
+	cleanup := func() {
+		database.Close()
+		os.Remove(tmpFile.Name())
+	}
+
+	return database, cleanup
+}
+
+func TestMatchText(t *testing.T) {
+	meds := []db.Medication{
+		{MedID: "med_d", Name: "Vitamin D"},
+		{MedID: "med_a", Name: "antihistamine"},
+	}
+
+	tests := []struct {
+		text string
+		want map[string]string
+	}{
+		{"took my vitamin D", map[string]string{"med_d": db.DoseTaken}},
+		{"forgot antihistamine", map[string]string{"med_a": db.DoseMissed}},
+		{"Took vitamin d but forgot the antihistamine", map[string]string{"med_d": db.DoseTaken, "med_a": db.DoseMissed}},
+		{"should I buy more vitamin D", map[string]string{}},
+		{"took a walk", map[string]string{}},
+		{"need to take my vitamin D", map[string]string{}},
+		{"had lunch, done with work, vitamin D", map[string]string{}},
+		{"took a walk, vitamin D later", map[string]string{}},
+		{"took vitamin D, antihistamine", map[string]string{"med_d": db.DoseTaken, "med_a": db.DoseTaken}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			got := make(map[string]string)
+			for _, m := range MatchText(tt.text, meds) {
+				got[m.Medication.MedID] = m.Status
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("MatchText(%q) = %v, want %v", tt.text, got, tt.want)
+			}
+			for id, status := range tt.want {
+				if got[id] != status {
+					t.Errorf("MatchText(%q)[%s] = %q, want %q", tt.text, id, got[id], status)
+				}
+			}
+		})
+	}
+}
+
+func TestValidateTimes(t *testing.T) {
+	if err := ValidateTimes([]string{"08:00", "20:30"}); err != nil {
+		t.Errorf("expected valid times, got %v", err)
+	}
+	for _, bad := range [][]string{nil, {"8am"}, {"24:00"}, {"08:60"}} {
+		if err := ValidateTimes(bad); err == nil {
+			t.Errorf("expected error for %v", bad)
+		}
+	}
+}
+
+func TestRecordCaptureAndAdherence(t *testing.T) {
+	database, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	if err := database.AddMedication("med_d", "wolf", "Vitamin D", "1000IU", []string{"08:00"}); err != nil {
+		t.Fatalf("adding medication: %v", err)
+	}
+
+	tracker := NewTracker(database, time.UTC)
+	now := time.Now().UTC()
+	morning := time.Date(now.Year(), now.Month(), now.Day(), 8, 10, 0, 0, time.UTC)
+	if morning.After(now) {
+		// Before 08:10 today - use yesterday's slot instead
+		morning = morning.AddDate(0, 0, -1)
+	}
+
+	matches, err := tracker.RecordCapture("wolf", "cap_1", "took my vitamin D", morning)
+	if err != nil {
+		t.Fatalf("recording capture: %v", err)
+	}
+	if len(matches) != 1 {
+		t.Fatalf("expected 1 match, got %d", len(matches))
+	}
+
+	doses, err := database.GetDoses("wolf", morning.Add(-time.Hour), morning.Add(time.Hour))
+	if err != nil {
+		t.Fatalf("getting doses: %v", err)
+	}
+	if len(doses) != 1 || doses[0].Status != db.DoseTaken {
+		t.Fatalf("expected one taken dose, got %+v", doses)
+	}
+
+	// A taken slot must not be overwritten as missed
+	if _, err := tracker.CheckMissed(now.Add(48 * time.Hour)); err != nil {
+		t.Fatalf("checking missed: %v", err)
+	}
+	doses, _ = database.GetDoses("wolf", morning.Add(-time.Hour), morning.Add(time.Hour))
+	if len(doses) != 1 || doses[0].Status != db.DoseTaken {
+		t.Errorf("taken dose was overwritten: %+v", doses)
+	}
+
+	weeks, err := tracker.Adherence("wolf", 2, now)
+	if err != nil {
+		t.Fatalf("computing adherence: %v", err)
+	}
+	if len(weeks) != 2 {
+		t.Fatalf("expected 2 weeks, got %d", len(weeks))
+	}
+}
+
+func TestCheckMissed(t *testing.T) {
+	database, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	if err := database.AddMedication("med_a", "wife", "antihistamine", "", []string{"09:00", "21:00"}); err != nil {
+		t.Fatalf("adding medication: %v", err)
+	}
+
+	tracker := NewTracker(database, time.UTC)
+
+	// Two days on, both of yesterday's slots are past their grace window
+	missed, err := tracker.CheckMissed(time.Now().UTC().Add(48 * time.Hour))
+	if err != nil {
+		t.Fatalf("checking missed: %v", err)
+	}
+	if len(missed) < 2 {
+		t.Errorf("expected at least 2 missed doses, got %d", len(missed))
+	}
+
+	// Running again must not report the same doses twice
+	again, err := tracker.CheckMissed(time.Now().UTC().Add(48 * time.Hour))
+	if err != nil {
+		t.Fatalf("checking missed: %v", err)
+	}
+	if len(again) != 0 {
+		t.Errorf("expected no new missed doses, got %d", len(again))
+	}
+}
+
+func TestDoseSlot(t *testing.T) {
+	tracker := NewTracker(nil, time.UTC)
+	day := func(d, h, m int) time.Time { return time.Date(2024, 3, d, h, m, 0, 0, time.UTC) }
+
+	tests := []struct {
+		name  string
+		times []string
+		ts    time.Time
+		want  time.Time
+	}{
+		{"late evening dose is the morning's", []string{"08:00"}, day(10, 21, 0), day(10, 8, 0)},
+		{"just after midnight is yesterday's", []string{"08:00"}, day(11, 0, 30), day(10, 8, 0)},
+		{"a little early counts for the slot", []string{"08:00"}, day(10, 7, 30), day(10, 8, 0)},
+		{"between slots is the earlier one", []string{"08:00", "20:00"}, day(10, 18, 0), day(10, 8, 0)},
+		{"early for the evening slot", []string{"08:00", "20:00"}, day(10, 19, 30), day(10, 20, 0)},
+	}
+	for _, tt := range tests {
+		got, ok := tracker.doseSlot(tt.times, tt.ts)
+		if !ok || !got.Equal(tt.want) {
+			t.Errorf("%s: slot = %v (%v), want %v", tt.name, got, ok, tt.want)
+		}
+	}
+}
+
+func TestEveningDoseNotMissed(t *testing.T) {
+	database, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	if err := database.AddMedication("med_d", "wolf", "Vitamin D", "", []string{"08:00"}); err != nil {
+		t.Fatalf("adding medication: %v", err)
+	}
+	tracker := NewTracker(database, time.UTC)
+	now := time.Now().UTC()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	evening := today.Add(21 * time.Hour)
+
+	if _, err := tracker.RecordCapture("wolf", "cap_1", "took my vitamin D", evening); err != nil {
+		t.Fatalf("recording capture: %v", err)
+	}
+	doses, err := database.GetDoses("wolf", today, today.AddDate(0, 0, 2))
+	if err != nil {
+		t.Fatalf("getting doses: %v", err)
+	}
+	if len(doses) != 1 || !doses[0].ScheduledFor.Equal(today.Add(8*time.Hour)) || doses[0].Status != db.DoseTaken {
+		t.Errorf("doses = %+v, want today's 08:00 slot taken", doses)
+	}
+}
@@ -9,6 +9,11 @@ type Capture struct {
 	DeviceID string `json:"device_id"`
 	Mode     string `json:"mode"` // "note" or "purchase"
 	Version  string `json:"version"`
+
+	// Who else may see the capture: "private", "household" or "actors" with ShareWith.
+	// When unset, the sharing rule for the category it is filed to applies.
+	Visibility string   `json:"visibility,omitempty"`
+	ShareWith  []string `json:"share_with,omitempty"`
 }
 
 // CaptureResponse is returned after receiving a capture
@@ -65,10 +70,13 @@ type LettersResponse struct {
 
 // HealthResponse is returned by the health endpoint
 type HealthResponse struct {
-	Status  string `json:"status"`
-	Ollama  string `json:"ollama"`
-	Vault   string `json:"vault"`
-	Version string `json:"version"`
+	Status        string `json:"status"` // "ok", or "degraded" while the LLM circuit breaker is open
+	Ollama        string `json:"ollama"` // LLM provider status; key kept for existing clients
+	LLMProvider   string `json:"llm_provider"`
+	LLMCircuit    string `json:"llm_circuit,omitempty"` // "closed", "open" or "half_open"
+	PostponedJobs int    `json:"postponed_jobs"`        // LLM work waiting for the backend to recover
+	Vault         string `json:"vault"`
+	Version       string `json:"version"`
 }
 
 // CaptureLog represents a logged capture
@@ -140,3 +148,128 @@ const (
 	StatusPendingClassification = "pending_classification"
 	StatusParseError           = "parse_error"
 )
+
+// MedicationRequest creates a medication schedule
+type MedicationRequest struct {
+	Name  string   `json:"name"`
+	Dose  string   `json:"dose"`
+	Times []string `json:"times"` // "HH:MM" slots, e.g. ["08:00", "20:00"]
+}
+
+// Medication is a scheduled medication or supplement
+type Medication struct {
+	MedID     string   `json:"med_id"`
+	Name      string   `json:"name"`
+	Dose      string   `json:"dose,omitempty"`
+	Times     []string `json:"times"`
+	CreatedTS string   `json:"created_ts"`
+}
+
+// MedicationsResponse is returned by the medications endpoint
+type MedicationsResponse struct {
+	Medications []Medication `json:"medications"`
+}
+
+// SearchResult is a ranked full-text or semantic search hit
+type SearchResult struct {
+	DocID     string  `json:"doc_id"`
+	Kind      string  `json:"kind"`
+	Actor     string  `json:"actor"`
+	Category  string  `json:"category,omitempty"`
+	Title     string  `json:"title,omitempty"`
+	Snippet   string  `json:"snippet,omitempty"`
+	Path      string  `json:"path,omitempty"`
+	CreatedTS string  `json:"created_ts"`
+	Score     float64 `json:"score"`
+}
+
+// SearchResponse is returned by the search endpoint
+type SearchResponse struct {
+	Query   string         `json:"query"`
+	Results []SearchResult `json:"results"`
+}
+
+// RelatedResponse is returned by the related-notes endpoint
+type RelatedResponse struct {
+	CaptureID string         `json:"capture_id"`
+	Related   []SearchResult `json:"related"`
+}
+
+// StreamChunk is a "chunk" server-sent event: the next piece of generated text
+type StreamChunk struct {
+	Text string `json:"text"`
+}
+
+// StreamDone is the final "done" server-sent event with the finished text
+type StreamDone struct {
+	Text string `json:"text"`           // cleaned result; may differ from the concatenated chunks
+	Path string `json:"path,omitempty"` // vault file written, if any
+}
+
+// AskRequest asks a question about the vault
+type AskRequest struct {
+	Question string `json:"question"`
+}
+
+// AskCitation is a source cited in an answer
+type AskCitation struct {
+	ID        string   `json:"id"` // capture ID, or daily_<date>_<capture ID> for narrated journal days
+	Kind      string   `json:"kind"`
+	Category  string   `json:"category,omitempty"`
+	Title     string   `json:"title,omitempty"`
+	Path      string   `json:"path,omitempty"`
+	CreatedTS string   `json:"created_ts"`
+	Quotes    []string `json:"quotes,omitempty"`
+}
+
+// AskResponse is a grounded answer with citations
+type AskResponse struct {
+	Question  string        `json:"question"`
+	Answer    string        `json:"answer"`
+	Verified  bool          `json:"verified"`
+	Citations []AskCitation `json:"citations"`
+}
+
+// CreateUserRequest adds a user (admin)
+type CreateUserRequest struct {
+	ID   string `json:"id"`   // actor name, e.g. "kid"
+	Name string `json:"name"` // display name
+}
+
+// LinkIdentityRequest links an OpenID Connect account to a user (admin)
+type LinkIdentityRequest struct {
+	Subject string   `json:"subject"` // the provider's user ID, if known
+	Email   string   `json:"email"`   // otherwise the account's verified email
+	Scopes  []string `json:"scopes"`  // granted to its login sessions
+}
+
+// RefreshRequest exchanges an app refresh token for new tokens
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// TokenResponse is returned by /auth/refresh
+type TokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"` // seconds until the access token expires
+}
+
+// CreateTokenRequest issues an API token for a user (admin)
+type CreateTokenRequest struct {
+	Label    string   `json:"label"`     // e.g. "Pixel 8"
+	DeviceID string   `json:"device_id"` // optional, binds the token to one device
+	Scopes   []string `json:"scopes"`    // e.g. ["capture:write", "letters:read"]
+}
+
+// SharingRequest changes who may see a capture
+type SharingRequest struct {
+	Visibility string   `json:"visibility"` // "private", "household" or "actors"
+	ShareWith  []string `json:"share_with"` // user IDs, for "actors"
+}
+
+// CommentRequest adds a comment to a capture
+type CommentRequest struct {
+	Text string `json:"text"`
+}
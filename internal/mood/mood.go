@@ -0,0 +1,124 @@
+package mood
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/mrwolf/brain-server/internal/db"
+	"github.com/mrwolf/brain-server/internal/llm"
+)
+
+const moodPrompt = `Score the mood expressed in this personal capture.
+
+Capture: "%s"
+
+Scales:
+- valence: 1 = very negative, 5 = neutral, 10 = very positive
+- energy: 1 = exhausted or drained, 5 = normal, 10 = highly energised
+
+Score only what the text expresses. If the text carries no emotional signal, use 5 for both.
+
+Respond in JSON:
+{
+  "valence": 1-10,
+  "energy": 1-10
+}`
+
+// ratingPattern matches explicit ratings like "mood 7", "mood: 6/10", "mood is 8"
+var ratingPattern = regexp.MustCompile(`(?i)\bmood\s*(?:is|was|:|=|of|at)?\s*(10|[1-9])(?:\s*/\s*10)?\b`)
+
+// Score is the LLM mood assessment of a capture
+type Score struct {
+	Valence float64 `json:"valence"`
+	Energy  float64 `json:"energy"`
+}
+
+// Scorer scores Life and Journal captures for valence and energy
+type Scorer struct {
+	llm *llm.Client
+	db  *db.DB
+}
+
+// NewScorer creates a new mood scorer
+func NewScorer(client *llm.Client, database *db.DB) *Scorer {
+	return &Scorer{llm: client, db: database}
+}
+
+// ParseRating extracts an explicit 1-10 mood rating from text
+func ParseRating(text string) (int, bool) {
+	m := ratingPattern.FindStringSubmatch(text)
+	if m == nil {
+		return 0, false
+	}
+	n, err := strconv.Atoi(m[1])
+	if err != nil {
+		return 0, false
+	}
+	return n, true
+}
+
+// Score asks the LLM for valence and energy, clamped to 1-10
+func (s *Scorer) Score(ctx context.Context, text string) (*Score, error) {
+	prompt := fmt.Sprintf(moodPrompt, text)
+
+	response, err := s.llm.Generate(ctx, llm.TaskMood, prompt)
+	if err != nil {
+		return nil, fmt.Errorf("generating mood score: %w", err)
+	}
+
+	var score Score
+	if err := json.Unmarshal([]byte(response), &score); err != nil {
+		return nil, fmt.Errorf("parsing mood response: %w (response: %s)", err, response)
+	}
+	if score.Valence == 0 || score.Energy == 0 {
+		return nil, fmt.Errorf("mood response missing scores: %s", response)
+	}
+
+	score.Valence = clamp(score.Valence)
+	score.Energy = clamp(score.Energy)
+	return &score, nil
+}
+
+// Record scores a capture and stores it in the mood time series
+// An explicit rating is stored even when LLM scoring fails.
+func (s *Scorer) Record(ctx context.Context, captureID, actor, category, text string, ts time.Time) error {
+	entry := db.MoodScore{
+		CaptureID: captureID,
+		Actor:     actor,
+		Category:  category,
+		CreatedAt: ts,
+	}
+
+	if rating, ok := ParseRating(text); ok {
+		entry.Rating = &rating
+	}
+
+	score, scoreErr := s.Score(llm.WithActor(ctx, actor), text)
+	if scoreErr == nil {
+		entry.Valence = &score.Valence
+		entry.Energy = &score.Energy
+	}
+
+	if entry.Rating == nil && entry.Valence == nil {
+		return scoreErr
+	}
+
+	if err := s.db.SaveMoodScore(entry); err != nil {
+		return fmt.Errorf("saving mood score: %w", err)
+	}
+	return scoreErr
+}
+
+func clamp(v float64) float64 {
+	if v < 1 {
+		return 1
+	}
+	if v > 10 {
+		return 10
+	}
+	return v
+}
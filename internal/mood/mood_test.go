@@ -0,0 +1,58 @@
+package mood
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mrwolf/brain-server/internal/llm"
+)
+
+func TestParseRating(t *testing.T) {
+	tests := []struct {
+		text   string
+		want   int
+		wantOK bool
+	}{
+		{"mood 7", 7, true},
+		{"Mood: 6/10 after the walk", 6, true},
+		{"mood is 10 today", 10, true},
+		{"my mood was 3", 3, true},
+		{"mood 0", 0, false},
+		{"felt moody", 0, false},
+		{"slept 7 hours", 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			got, ok := ParseRating(tt.text)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("ParseRating(%q) = (%d, %v), want (%d, %v)", tt.text, got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestScoreClampsValues(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(llm.GenerateResponse{
+			Response: `{"valence": 12, "energy": 4}`,
+			Done:     true,
+		})
+	}))
+	defer server.Close()
+
+	scorer := NewScorer(llm.NewClient(server.URL, "test", "test"), nil)
+	score, err := scorer.Score(context.Background(), "great day, tired though")
+	if err != nil {
+		t.Fatalf("scoring: %v", err)
+	}
+	if score.Valence != 10 {
+		t.Errorf("valence = %v, want clamped to 10", score.Valence)
+	}
+	if score.Energy != 4 {
+		t.Errorf("energy = %v, want 4", score.Energy)
+	}
+}
@@ -2,7 +2,7 @@ package narrator
 
 import (
 	"context"
-	"fmt"
+	"encoding/json"
 
 	"github.com/mrwolf/brain-server/internal/llm"
 )
@@ -18,15 +18,13 @@ func NewBrainServerAdapter(client *llm.Client) *BrainServerAdapter {
 }
 
 // Generate implements LLMClient interface
-// Combines system and prompt since the brain-server client doesn't have separate system support
-func (a *BrainServerAdapter) Generate(ctx context.Context, model, system, prompt string) (string, error) {
-	// Combine system prompt with user prompt
-	// The model parameter is ignored since brain-server client uses configured models
-	fullPrompt := prompt
-	if system != "" {
-		fullPrompt = fmt.Sprintf("%s\n\n%s", system, prompt)
-	}
+// The model comes from the client's routing table for the task
+func (a *BrainServerAdapter) Generate(ctx context.Context, task llm.Task, system, prompt string) (string, error) {
+	return a.client.GenerateWithSystem(ctx, task, system, prompt)
+}
 
-	// Use heavy model (14b) for narrator tasks since they need good reasoning
-	return a.client.GenerateText(ctx, fullPrompt, true)
+// GenerateJSON implements LLMClient interface
+// Output is validated against schema with one repair attempt
+func (a *BrainServerAdapter) GenerateJSON(ctx context.Context, task llm.Task, system, prompt string, schema json.RawMessage, out interface{}) error {
+	return a.client.GenerateJSON(ctx, task, system, prompt, schema, out)
 }
@@ -6,6 +6,8 @@ import (
 	"log"
 	"path/filepath"
 	"time"
+
+	"github.com/mrwolf/brain-server/internal/vault"
 )
 
 // Narrator orchestrates the journal narration process
@@ -15,6 +17,7 @@ type Narrator struct {
 	scanner  *Scanner
 	pipeline *Pipeline
 	writer   *Writer
+	indexer  vault.Indexer
 }
 
 // New creates a new Narrator instance
@@ -27,11 +30,16 @@ func New(llm LLMClient, config NarrationConfig) (*Narrator, error) {
 		return nil, fmt.Errorf("failed to ensure directories: %w", err)
 	}
 
+	pipeline := NewPipeline(llm, config.MaxRetries)
+	if config.Prompts != nil {
+		pipeline.SetPrompts(config.Prompts)
+	}
+
 	return &Narrator{
 		config:   config,
 		state:    stateMgr,
 		scanner:  NewScanner(journalPath),
-		pipeline: NewPipeline(llm, config.Model, config.MaxRetries),
+		pipeline: pipeline,
 		writer:   NewWriter(journalPath),
 	}, nil
 }
@@ -114,9 +122,10 @@ func (n *Narrator) processBatch(ctx context.Context, date string, entries []RawE
 	}
 
 	// Append to daily file
-	if err := n.writer.AppendToDaily(date, pipelineResult.NarratedText); err != nil {
+	if err := n.writer.AppendToDaily(date, pipelineResult.NarratedText, pipelineResult.Prompts); err != nil {
 		return fmt.Errorf("failed to write to daily file: %w", err)
 	}
+	n.indexNarration(date, entries, pipelineResult.NarratedText)
 
 	// Log the mapping for audit trail
 	mapping := NarrationMapping{
@@ -125,6 +134,7 @@ func (n *Narrator) processBatch(ctx context.Context, date string, entries []RawE
 		RawFiles:       pipelineResult.RawFiles,
 		Model:          n.config.Model,
 		VerifierPassed: pipelineResult.Verified,
+		Prompts:        pipelineResult.Prompts,
 	}
 	if err := n.state.AppendMapping(mapping); err != nil {
 		log.Printf("narrator: warning - failed to append mapping: %v", err)
@@ -139,6 +149,48 @@ func (n *Narrator) processBatch(ctx context.Context, date string, entries []RawE
 	return nil
 }
 
+// SetIndexer sets the search indexer for narrated daily text
+func (n *Narrator) SetIndexer(indexer vault.Indexer) {
+	n.indexer = indexer
+}
+
+// SetFiles sets how raw and daily journal files are read and written, e.g. the
+// vault, so they are encrypted at rest
+func (n *Narrator) SetFiles(files Files) {
+	n.scanner.files = files
+	n.writer.files = files
+}
+
+// indexNarration indexes a narrated batch for the actor whose entries it was
+// written from. A batch mixing several actors' entries is left out of the index:
+// its text would show each of them the others' entries, and everyone's raw
+// entries are indexed on their own.
+func (n *Narrator) indexNarration(date string, entries []RawEntry, narrated string) {
+	if n.indexer == nil {
+		return
+	}
+	first := entries[0]
+	for _, e := range entries[1:] {
+		if e.Actor != first.Actor {
+			return
+		}
+	}
+
+	doc := vault.Document{
+		ID:       fmt.Sprintf("daily_%s_%s", date, first.ID),
+		Kind:     "journal_daily",
+		Actor:    first.Actor,
+		Category: "Journal",
+		Path:     filepath.Join(n.config.JournalPath, "Daily", date+".md"),
+		Title:    date,
+		Body:     narrated,
+		Created:  first.Created,
+	}
+	if err := n.indexer.IndexDocument(doc); err != nil {
+		log.Printf("narrator: warning - failed to index %s: %v", doc.ID, err)
+	}
+}
+
 // NightlyClose is called by the nightly job to close the current day
 func (n *Narrator) NightlyClose(ctx context.Context) error {
 	// Get current date in configured timezone
@@ -0,0 +1,107 @@
+package narrator
+
+import (
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mrwolf/brain-server/internal/db"
+	"github.com/mrwolf/brain-server/internal/llm"
+	"github.com/mrwolf/brain-server/internal/search"
+	"github.com/mrwolf/brain-server/internal/vault"
+)
+
+// stubLLM narrates every batch into the same text and passes verification
+type stubLLM struct {
+	narrated string
+}
+
+func (s *stubLLM) Generate(ctx context.Context, task llm.Task, system, prompt string) (string, error) {
+	return s.narrated, nil
+}
+
+func (s *stubLLM) GenerateJSON(ctx context.Context, task llm.Task, system, prompt string, schema json.RawMessage, out interface{}) error {
+	response := `{"passed": true}`
+	if task == llm.TaskNarrateExtract {
+		response = `{"claims": [{"fact": "A day", "quote": "a day"}]}`
+	}
+	return json.Unmarshal([]byte(response), out)
+}
+
+func TestIndexNarrationKeepsActorsApart(t *testing.T) {
+	tmpDir := t.TempDir()
+	database, err := db.Open(filepath.Join(tmpDir, "test.db"))
+	if err != nil {
+		t.Fatalf("opening database: %v", err)
+	}
+	defer database.Close()
+
+	vaultPath := filepath.Join(tmpDir, "vault")
+	index := search.NewIndex(database)
+	v := vault.NewVault(vaultPath)
+	v.SetIndexer(index)
+
+	llmStub := &stubLLM{}
+	narr, err := New(llmStub, DefaultConfig(vaultPath))
+	if err != nil {
+		t.Fatalf("creating narrator: %v", err)
+	}
+	narr.SetIndexer(index)
+
+	write := func(id, actor, content string, created time.Time) {
+		t.Helper()
+		if _, err := v.WriteRawJournalCapture(vault.Note{ID: id, Actor: actor, Content: content, Created: created}); err != nil {
+			t.Fatalf("writing raw entry: %v", err)
+		}
+	}
+
+	// One batch with both actors' entries
+	day := time.Date(2024, 1, 16, 9, 0, 0, 0, time.Local)
+	write("cap_wolf", "wolf", "Watched the herons by the river", day)
+	write("cap_wife", "wife", "Baked sourdough bread", day.Add(time.Hour))
+	llmStub.narrated = "I watched the herons by the river and baked sourdough bread."
+	if _, err := narr.Update(context.Background()); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+
+	// A later batch with only wolf's entry
+	write("cap_wolf2", "wolf", "Fixed the fence", day.Add(3*time.Hour))
+	llmStub.narrated = "I fixed the fence in the afternoon."
+	if _, err := narr.Update(context.Background()); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+
+	tests := []struct {
+		actor string
+		text  string
+		kinds []string // kinds of the documents found, in any order
+	}{
+		{"wolf", "herons", []string{db.DocJournal}},
+		{"wolf", "sourdough", nil},
+		{"wife", "sourdough", []string{db.DocJournal}},
+		{"wife", "herons", nil},
+		{"wife", "fence", nil},
+		{"wolf", "fence", []string{db.DocJournal, db.DocJournalDaily}},
+	}
+	for _, tt := range tests {
+		hits, err := database.Search(db.SearchQuery{Text: tt.text, Actor: tt.actor})
+		if err != nil {
+			t.Fatalf("Search: %v", err)
+		}
+		kinds := make(map[string]bool)
+		for _, hit := range hits {
+			kinds[hit.Kind] = true
+		}
+		if len(hits) != len(tt.kinds) {
+			t.Errorf("%s searching %q found %+v, want kinds %v", tt.actor, tt.text, hits, tt.kinds)
+			continue
+		}
+		for _, kind := range tt.kinds {
+			if !kinds[kind] {
+				t.Errorf("%s searching %q found %+v, want kinds %v", tt.actor, tt.text, hits, tt.kinds)
+			}
+		}
+	}
+}
@@ -5,30 +5,40 @@ import (
 	"encoding/json"
 	"fmt"
 	"strings"
+
+	"github.com/mrwolf/brain-server/internal/llm"
+	"github.com/mrwolf/brain-server/internal/prompts"
 )
 
 // LLMClient interface for LLM interactions
-// Implement this to connect to your actual LLM service
+// Implement this to connect to your actual LLM service; the task selects the model.
+// GenerateJSON decodes schema-constrained output into out (see llm.Client.GenerateJSON).
 type LLMClient interface {
-	Generate(ctx context.Context, model, system, prompt string) (string, error)
+	Generate(ctx context.Context, task llm.Task, system, prompt string) (string, error)
+	GenerateJSON(ctx context.Context, task llm.Task, system, prompt string, schema json.RawMessage, out interface{}) error
 }
 
 // Pipeline handles the 3-step narration process
 type Pipeline struct {
 	llm        LLMClient
-	model      string
 	maxRetries int
+	prompts    *prompts.Store
 }
 
 // NewPipeline creates a new narration pipeline
-func NewPipeline(llm LLMClient, model string, maxRetries int) *Pipeline {
+func NewPipeline(client LLMClient, maxRetries int) *Pipeline {
 	return &Pipeline{
-		llm:        llm,
-		model:      model,
+		llm:        client,
 		maxRetries: maxRetries,
+		prompts:    prompts.Defaults(),
 	}
 }
 
+// SetPrompts sets where prompt templates are loaded from (the embedded defaults until set)
+func (p *Pipeline) SetPrompts(store *prompts.Store) {
+	p.prompts = store
+}
+
 // NarrationResult holds the output of the full pipeline
 type NarrationResult struct {
 	NarratedText   string
@@ -36,6 +46,7 @@ type NarrationResult struct {
 	Verified       bool
 	Attempts       int
 	RawFiles       []string
+	Prompts        []string // refs of the prompt templates used, in order of first use
 }
 
 // Process runs the full 3-step pipeline on a batch of entries
@@ -50,8 +61,19 @@ func (p *Pipeline) Process(ctx context.Context, entries []RawEntry) (*NarrationR
 		filenames = append(filenames, e.Filename)
 	}
 
+	// Record each prompt template used, for the daily file and audit trail
+	var used []string
+	record := func(prompt prompts.Prompt) {
+		for _, ref := range used {
+			if ref == prompt.Ref() {
+				return
+			}
+		}
+		used = append(used, prompt.Ref())
+	}
+
 	// Step 1: Extract claims
-	claims, err := p.extractClaims(ctx, entries)
+	claims, err := p.extractClaims(ctx, entries, record)
 	if err != nil {
 		return nil, fmt.Errorf("claim extraction failed: %w", err)
 	}
@@ -71,16 +93,16 @@ func (p *Pipeline) Process(ctx context.Context, entries []RawEntry) (*NarrationR
 
 		// Step 2: Generate narration
 		if attempts == 1 {
-			narrated, err = p.narrate(ctx, claims)
+			narrated, err = p.narrate(ctx, claims, record)
 		} else {
-			narrated, err = p.narrateStrict(ctx, claims, feedback)
+			narrated, err = p.narrateStrict(ctx, claims, feedback, record)
 		}
 		if err != nil {
 			return nil, fmt.Errorf("narration failed (attempt %d): %w", attempts, err)
 		}
 
 		// Step 3: Verify
-		result, err := p.verify(ctx, claims, narrated)
+		result, err := p.verify(ctx, claims, narrated, record)
 		if err != nil {
 			return nil, fmt.Errorf("verification failed (attempt %d): %w", attempts, err)
 		}
@@ -103,22 +125,21 @@ func (p *Pipeline) Process(ctx context.Context, entries []RawEntry) (*NarrationR
 		Verified:     verified,
 		Attempts:     attempts,
 		RawFiles:     filenames,
+		Prompts:      used,
 	}, nil
 }
 
 // extractClaims runs Step 1: claim extraction
-func (p *Pipeline) extractClaims(ctx context.Context, entries []RawEntry) (ClaimSet, error) {
-	prompt := BuildClaimExtractionPrompt(entries)
-
-	response, err := p.llm.Generate(ctx, p.model, SystemPrompt, prompt)
+func (p *Pipeline) extractClaims(ctx context.Context, entries []RawEntry, record func(prompts.Prompt)) (ClaimSet, error) {
+	prompt, err := BuildClaimExtractionPrompt(p.prompts, entries)
 	if err != nil {
 		return ClaimSet{}, err
 	}
+	record(prompt)
 
-	// Parse JSON response
-	claims, err := parseClaimsResponse(response)
-	if err != nil {
-		return ClaimSet{}, fmt.Errorf("failed to parse claims response: %w", err)
+	var claims ClaimSet
+	if err := p.llm.GenerateJSON(ctx, llm.TaskNarrateExtract, SystemPrompt, prompt.Text, json.RawMessage(ClaimsSchema), &claims); err != nil {
+		return ClaimSet{}, err
 	}
 
 	// Set date from first entry
@@ -130,22 +151,14 @@ func (p *Pipeline) extractClaims(ctx context.Context, entries []RawEntry) (Claim
 }
 
 // narrate runs Step 2: first-person narration
-func (p *Pipeline) narrate(ctx context.Context, claims ClaimSet) (string, error) {
-	prompt := BuildNarrationPrompt(claims)
-
-	response, err := p.llm.Generate(ctx, p.model, SystemPrompt, prompt)
+func (p *Pipeline) narrate(ctx context.Context, claims ClaimSet, record func(prompts.Prompt)) (string, error) {
+	prompt, err := BuildNarrationPrompt(p.prompts, claims)
 	if err != nil {
 		return "", err
 	}
+	record(prompt)
 
-	return strings.TrimSpace(response), nil
-}
-
-// narrateStrict runs Step 2 with stricter constraints for retries
-func (p *Pipeline) narrateStrict(ctx context.Context, claims ClaimSet, feedback string) (string, error) {
-	prompt := BuildStrictNarrationPrompt(claims, feedback)
-
-	response, err := p.llm.Generate(ctx, p.model, SystemPrompt, prompt)
+	response, err := p.llm.Generate(ctx, llm.TaskNarrate, SystemPrompt, prompt.Text)
 	if err != nil {
 		return "", err
 	}
@@ -153,72 +166,39 @@ func (p *Pipeline) narrateStrict(ctx context.Context, claims ClaimSet, feedback
 	return strings.TrimSpace(response), nil
 }
 
-// verify runs Step 3: verification
-func (p *Pipeline) verify(ctx context.Context, claims ClaimSet, narrated string) (*VerificationResult, error) {
-	prompt := BuildVerificationPrompt(claims, narrated)
-
-	response, err := p.llm.Generate(ctx, p.model, SystemPrompt, prompt)
+// narrateStrict runs Step 2 with stricter constraints for retries
+func (p *Pipeline) narrateStrict(ctx context.Context, claims ClaimSet, feedback string, record func(prompts.Prompt)) (string, error) {
+	prompt, err := BuildStrictNarrationPrompt(p.prompts, claims, feedback)
 	if err != nil {
-		return nil, err
+		return "", err
 	}
+	record(prompt)
 
-	result, err := parseVerificationResponse(response)
+	response, err := p.llm.Generate(ctx, llm.TaskNarrate, SystemPrompt, prompt.Text)
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse verification response: %w", err)
+		return "", err
 	}
 
-	return result, nil
+	return strings.TrimSpace(response), nil
 }
 
-// parseClaimsResponse extracts ClaimSet from LLM JSON response
-func parseClaimsResponse(response string) (ClaimSet, error) {
-	// Try to extract JSON from response (LLM might include extra text)
-	jsonStr := extractJSON(response)
-
-	var claims ClaimSet
-	if err := json.Unmarshal([]byte(jsonStr), &claims); err != nil {
-		// Try parsing as just the claims array
-		var wrapper struct {
-			Claims []Claim `json:"claims"`
-		}
-		if err2 := json.Unmarshal([]byte(jsonStr), &wrapper); err2 != nil {
-			return ClaimSet{}, fmt.Errorf("json parse error: %w (response: %s)", err, truncate(response, 200))
-		}
-		claims.Claims = wrapper.Claims
-	}
-
-	return claims, nil
+// Verify runs Step 3: checks text against the claims it must be grounded in
+// Also used outside narration to reject unsupported statements in generated answers.
+func (p *Pipeline) Verify(ctx context.Context, claims ClaimSet, narrated string) (*VerificationResult, error) {
+	return p.verify(ctx, claims, narrated, func(prompts.Prompt) {})
 }
 
-// parseVerificationResponse extracts VerificationResult from LLM JSON response
-func parseVerificationResponse(response string) (*VerificationResult, error) {
-	jsonStr := extractJSON(response)
+func (p *Pipeline) verify(ctx context.Context, claims ClaimSet, narrated string, record func(prompts.Prompt)) (*VerificationResult, error) {
+	prompt, err := BuildVerificationPrompt(p.prompts, claims, narrated)
+	if err != nil {
+		return nil, err
+	}
+	record(prompt)
 
 	var result VerificationResult
-	if err := json.Unmarshal([]byte(jsonStr), &result); err != nil {
-		return nil, fmt.Errorf("json parse error: %w (response: %s)", err, truncate(response, 200))
+	if err := p.llm.GenerateJSON(ctx, llm.TaskVerify, SystemPrompt, prompt.Text, json.RawMessage(verificationSchema), &result); err != nil {
+		return nil, err
 	}
 
 	return &result, nil
 }
-
-// extractJSON attempts to find and extract JSON from a response that may contain extra text
-func extractJSON(s string) string {
-	// Find first { and last }
-	start := strings.Index(s, "{")
-	end := strings.LastIndex(s, "}")
-
-	if start >= 0 && end > start {
-		return s[start : end+1]
-	}
-
-	return s
-}
-
-// truncate limits string length for error messages
-func truncate(s string, maxLen int) string {
-	if len(s) <= maxLen {
-		return s
-	}
-	return s[:maxLen] + "..."
-}
@@ -2,6 +2,7 @@ package narrator
 
 import (
 	"bufio"
+	"bytes"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -14,12 +15,14 @@ import (
 // Scanner finds and parses raw journal files
 type Scanner struct {
 	rawPath string
+	files   Files
 }
 
 // NewScanner creates a scanner for the given raw journal path
 func NewScanner(journalPath string) *Scanner {
 	return &Scanner{
 		rawPath: filepath.Join(journalPath, "Raw"),
+		files:   plainFiles{},
 	}
 }
 
@@ -160,15 +163,14 @@ func (s *Scanner) parseRawFile(filename string) (RawEntry, error) {
 
 // readFileWithFrontmatter reads a markdown file and separates frontmatter from content
 func (s *Scanner) readFileWithFrontmatter(path string) (content string, frontmatter map[string]string, err error) {
-	file, err := os.Open(path)
+	data, err := s.files.ReadFile(path)
 	if err != nil {
 		return "", nil, err
 	}
-	defer file.Close()
 
 	frontmatter = make(map[string]string)
 	var contentBuilder strings.Builder
-	scanner := bufio.NewScanner(file)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
 
 	// Check for frontmatter delimiter
 	inFrontmatter := false
@@ -1,6 +1,10 @@
 package narrator
 
-import "time"
+import (
+	"time"
+
+	"github.com/mrwolf/brain-server/internal/prompts"
+)
 
 // JournalState tracks the processing state for journal narration
 type JournalState struct {
@@ -30,12 +34,14 @@ type NarrationMapping struct {
 	RawFiles       []string `json:"raw_files"`
 	Model          string   `json:"model"`
 	VerifierPassed bool     `json:"verifier_passed"`
+	Prompts        []string `json:"prompts,omitempty"` // prompt template refs, e.g. "narration@3"
 }
 
 // Claim represents an extracted fact from raw journal text
 type Claim struct {
-	Fact  string `json:"fact"`
-	Quote string `json:"quote"` // Supporting quote from source
+	Fact   string `json:"fact"`
+	Quote  string `json:"quote"`            // Supporting quote from source
+	Source string `json:"source,omitempty"` // Source document ID, when claims span several documents
 }
 
 // ClaimSet holds extracted claims for a batch of entries
@@ -56,9 +62,10 @@ type NarrationConfig struct {
 	VaultPath    string         // Path to the vault root
 	JournalPath  string         // Relative path to Journal folder within vault
 	Timezone     *time.Location // Local timezone for day boundaries
-	Model        string         // LLM model to use (e.g., "qwen2.5:14b")
+	Model        string         // Narration model, recorded in the audit trail (routing picks the model used)
 	MaxRetries   int            // Max verification retries before giving up
 	BatchSize    int            // Max raw entries to process in one batch
+	Prompts      *prompts.Store // Prompt templates (nil for the embedded defaults)
 }
 
 // DefaultConfig returns sensible defaults
@@ -68,8 +75,14 @@ func DefaultConfig(vaultPath string) NarrationConfig {
 		VaultPath:   vaultPath,
 		JournalPath: "Journal",
 		Timezone:    loc,
-		Model:       "qwen2.5:14b",
 		MaxRetries:  2,
 		BatchSize:   10,
 	}
 }
+
+// Files reads and writes journal files. The vault implements it to encrypt them
+// at rest; by default they are plain files.
+type Files interface {
+	ReadFile(path string) ([]byte, error)
+	WriteFile(path string, content []byte, actors ...string) error // no actors means everyone's
+}
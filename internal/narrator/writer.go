@@ -2,6 +2,7 @@ package narrator
 
 import (
 	"bufio"
+	"bytes"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -12,97 +13,82 @@ import (
 // Writer handles writing narrated content to daily files
 type Writer struct {
 	dailyPath string
+	files     Files
 }
 
 // NewWriter creates a writer for the given journal path
 func NewWriter(journalPath string) *Writer {
 	return &Writer{
 		dailyPath: filepath.Join(journalPath, "Daily"),
+		files:     plainFiles{},
 	}
 }
 
 // DailyFrontmatter represents the YAML frontmatter in daily files
 type DailyFrontmatter struct {
-	Date      string `yaml:"date"`
-	Status    string `yaml:"status"`
-	UpdatedAt string `yaml:"updated_at"`
+	Date      string   `yaml:"date"`
+	Status    string   `yaml:"status"`
+	UpdatedAt string   `yaml:"updated_at"`
+	Prompts   []string `yaml:"prompts"` // prompt templates of the latest narration
 }
 
 // AppendToDaily appends narrated text to the daily file for the given date
 // Creates the file with frontmatter if it doesn't exist
-func (w *Writer) AppendToDaily(date string, narratedText string) error {
+// The frontmatter's prompts field records the templates of the latest narration.
+func (w *Writer) AppendToDaily(date string, narratedText string, promptRefs []string) error {
 	filePath := filepath.Join(w.dailyPath, date+".md")
+	promptsValue := "[" + strings.Join(promptRefs, ", ") + "]"
 
 	// Check if file exists
 	exists := fileExists(filePath)
 
 	if !exists {
 		// Create new file with frontmatter
-		return w.createDailyFile(filePath, date, narratedText)
+		return w.createDailyFile(filePath, date, narratedText, promptsValue)
 	}
 
 	// Append to existing file
-	return w.appendToDailyFile(filePath, narratedText)
+	return w.appendToDailyFile(filePath, narratedText, promptsValue)
 }
 
 // createDailyFile creates a new daily file with frontmatter and initial content
-func (w *Writer) createDailyFile(filePath, date, content string) error {
-	// Ensure directory exists
-	if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
-		return fmt.Errorf("failed to create directory: %w", err)
-	}
-
-	f, err := os.Create(filePath)
-	if err != nil {
-		return fmt.Errorf("failed to create daily file: %w", err)
-	}
-	defer f.Close()
-
-	// Write frontmatter
+// Daily files mix everyone's entries, so they are written for all actors.
+func (w *Writer) createDailyFile(filePath, date, content, promptsValue string) error {
 	now := time.Now().Format(time.RFC3339)
 	frontmatter := fmt.Sprintf(`---
 date: %s
 status: open
 updated_at: %s
+prompts: %s
 ---
 
-`, date, now)
-
-	if _, err := f.WriteString(frontmatter); err != nil {
-		return fmt.Errorf("failed to write frontmatter: %w", err)
-	}
+`, date, now, promptsValue)
 
-	// Write content
-	if _, err := f.WriteString(content + "\n"); err != nil {
-		return fmt.Errorf("failed to write content: %w", err)
+	if err := w.files.WriteFile(filePath, []byte(frontmatter+content+"\n")); err != nil {
+		return fmt.Errorf("failed to create daily file: %w", err)
 	}
 
 	return nil
 }
 
 // appendToDailyFile appends content to an existing daily file and updates the frontmatter
-func (w *Writer) appendToDailyFile(filePath, content string) error {
+func (w *Writer) appendToDailyFile(filePath, content, promptsValue string) error {
 	// Read existing file
-	existingContent, err := os.ReadFile(filePath)
+	existingContent, err := w.files.ReadFile(filePath)
 	if err != nil {
 		return fmt.Errorf("failed to read existing file: %w", err)
 	}
 
 	// Update frontmatter timestamp
 	updatedContent := updateFrontmatterTimestamp(string(existingContent))
+	updatedContent = updateFrontmatterField(updatedContent, "prompts", promptsValue)
 
 	// Append new content with separator
 	updatedContent = strings.TrimRight(updatedContent, "\n") + "\n\n---\n\n" + content + "\n"
 
 	// Write back atomically
-	tempPath := filePath + ".tmp"
-	if err := os.WriteFile(tempPath, []byte(updatedContent), 0644); err != nil {
-		return fmt.Errorf("failed to write temp file: %w", err)
-	}
-
-	if err := os.Rename(tempPath, filePath); err != nil {
-		os.Remove(tempPath)
-		return fmt.Errorf("failed to rename temp file: %w", err)
+	if err := w.files.WriteFile(filePath, []byte(updatedContent)); err != nil {
+		return fmt.Errorf("failed to write daily file: %w", err)
 	}
 
 	return nil
@@ -116,7 +102,7 @@ func (w *Writer) CloseDay(date string) error {
 		return nil // Nothing to close
 	}
 
-	content, err := os.ReadFile(filePath)
+	content, err := w.files.ReadFile(filePath)
 	if err != nil {
 		return fmt.Errorf("failed to read daily file: %w", err)
 	}
@@ -126,14 +112,8 @@ func (w *Writer) CloseDay(date string) error {
 	updatedContent = updateFrontmatterTimestamp(updatedContent)
 
 	// Write back atomically
-	tempPath := filePath + ".tmp"
-	if err := os.WriteFile(tempPath, []byte(updatedContent), 0644); err != nil {
-		return fmt.Errorf("failed to write temp file: %w", err)
-	}
-
-	if err := os.Rename(tempPath, filePath); err != nil {
-		os.Remove(tempPath)
-		return fmt.Errorf("failed to rename temp file: %w", err)
+	if err := w.files.WriteFile(filePath, []byte(updatedContent)); err != nil {
+		return fmt.Errorf("failed to write daily file: %w", err)
 	}
 
 	return nil
@@ -188,13 +168,12 @@ func (w *Writer) GetDailyStatus(date string) (string, error) {
 		return "", nil
 	}
 
-	file, err := os.Open(filePath)
+	data, err := w.files.ReadFile(filePath)
 	if err != nil {
 		return "", err
 	}
-	defer file.Close()
 
-	scanner := bufio.NewScanner(file)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
 	inFrontmatter := false
 
 	for scanner.Scan() {
@@ -221,3 +200,26 @@ func fileExists(path string) bool {
 	_, err := os.Stat(path)
 	return err == nil
 }
+
+// plainFiles reads and writes journal files unencrypted
+type plainFiles struct{}
+
+func (plainFiles) ReadFile(path string) ([]byte, error) {
+	return os.ReadFile(path)
+}
+
+// WriteFile writes via a temp file and rename so readers never see a partial file
+func (plainFiles) WriteFile(path string, content []byte, actors ...string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+	tempPath := path + ".tmp"
+	if err := os.WriteFile(tempPath, content, 0644); err != nil {
+		return fmt.Errorf("failed to write temp file: %w", err)
+	}
+	if err := os.Rename(tempPath, path); err != nil {
+		os.Remove(tempPath)
+		return fmt.Errorf("failed to rename temp file: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,125 @@
+package oidc
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mrwolf/brain-server/internal/oidc/oidctest"
+)
+
+func newTestProvider(issuer *oidctest.Server) *Provider {
+	return NewProvider(Config{
+		Issuer:       issuer.URL,
+		ClientID:     oidctest.ClientID,
+		ClientSecret: oidctest.ClientSecret,
+		RedirectURL:  "http://brain.test/auth/callback",
+	})
+}
+
+func TestCodeFlow(t *testing.T) {
+	issuer := oidctest.NewServer(t)
+	issuer.Login("sub-123", "wolf@example.com")
+	p := newTestProvider(issuer)
+	ctx := context.Background()
+
+	verifier, nonce := RandomString(), RandomString()
+	authURL, err := p.AuthCodeURL(ctx, "state-1", nonce, verifier)
+	if err != nil {
+		t.Fatalf("AuthCodeURL: %v", err)
+	}
+
+	// The issuer redirects straight back with a code
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	resp, err := client.Get(authURL)
+	if err != nil {
+		t.Fatalf("authorize: %v", err)
+	}
+	resp.Body.Close()
+	back, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil || back.Query().Get("state") != "state-1" || back.Query().Get("code") == "" {
+		t.Fatalf("authorize redirected to %q", resp.Header.Get("Location"))
+	}
+	code := back.Query().Get("code")
+
+	if _, err := p.Exchange(ctx, code, "wrong-verifier", nonce); err == nil {
+		t.Error("Exchange succeeded with the wrong PKCE verifier")
+	}
+	// Codes are single use, so get another
+	resp, _ = client.Get(authURL)
+	resp.Body.Close()
+	back, _ = url.Parse(resp.Header.Get("Location"))
+
+	claims, err := p.Exchange(ctx, back.Query().Get("code"), verifier, nonce)
+	if err != nil {
+		t.Fatalf("Exchange: %v", err)
+	}
+	if claims.Subject != "sub-123" || claims.Email != "wolf@example.com" || !claims.EmailVerified {
+		t.Errorf("claims = %+v", claims)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	issuer := oidctest.NewServer(t)
+	p := newTestProvider(issuer)
+	ctx := context.Background()
+
+	tests := []struct {
+		name   string
+		modify func(map[string]interface{})
+		token  func(string) string
+		ok     bool
+	}{
+		{name: "valid", ok: true},
+		{name: "audience list", modify: func(c map[string]interface{}) { c["aud"] = []string{"other", oidctest.ClientID} }, ok: true},
+		{name: "wrong audience", modify: func(c map[string]interface{}) { c["aud"] = "other" }},
+		{name: "wrong issuer", modify: func(c map[string]interface{}) { c["iss"] = "https://evil.example" }},
+		{name: "expired", modify: func(c map[string]interface{}) { c["exp"] = time.Now().Add(-time.Hour).Unix() }},
+		{name: "wrong nonce", modify: func(c map[string]interface{}) { c["nonce"] = "other" }},
+		{name: "no subject", modify: func(c map[string]interface{}) { c["sub"] = "" }},
+		{name: "tampered", token: func(tok string) string {
+			parts := strings.Split(tok, ".")
+			return parts[0] + "." + parts[1] + "x." + parts[2]
+		}},
+		{name: "unsigned", token: func(tok string) string {
+			parts := strings.Split(tok, ".")
+			return "eyJhbGciOiJub25lIn0." + parts[1] + "."
+		}},
+		{name: "malformed", token: func(string) string { return "not-a-jwt" }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := issuer.Claims("sub-123", "nonce-1")
+			if tt.modify != nil {
+				tt.modify(claims)
+			}
+			tok := issuer.Sign(claims)
+			if tt.token != nil {
+				tok = tt.token(tok)
+			}
+
+			got, err := p.Verify(ctx, tok, "nonce-1")
+			if tt.ok {
+				if err != nil || got.Subject != "sub-123" {
+					t.Errorf("Verify = %+v, %v; want sub-123", got, err)
+				}
+				return
+			}
+			if !errors.Is(err, ErrInvalidToken) {
+				t.Errorf("Verify error = %v, want ErrInvalidToken", err)
+			}
+		})
+	}
+}
+
+func TestDiscoveryFailure(t *testing.T) {
+	p := NewProvider(Config{Issuer: "http://127.0.0.1:1", ClientID: "x"})
+	if _, err := p.AuthCodeURL(context.Background(), "s", "n", "v"); err == nil {
+		t.Error("AuthCodeURL succeeded with an unreachable issuer")
+	}
+}
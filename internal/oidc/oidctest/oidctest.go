@@ -0,0 +1,191 @@
+// Package oidctest provides a local OpenID Connect issuer for tests.
+//
+// Server is an httptest server with discovery, authorize, token and JWKS
+// endpoints. Authorize logs in whoever was last set with Login and redirects
+// straight back with a code, so a test HTTP client that follows redirects
+// walks the whole code flow:
+//
+//	issuer := oidctest.NewServer(t)
+//	issuer.Login("sub-123", "wolf@example.com")
+//	// GET /auth/login on the server under test
+package oidctest
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+)
+
+// ClientID and ClientSecret are the credentials the issuer accepts
+const (
+	ClientID     = "brain-test"
+	ClientSecret = "brain-test-secret"
+)
+
+// keyID identifies the issuer's signing key in the JWKS
+const keyID = "test-key"
+
+type grant struct {
+	claims    map[string]interface{}
+	challenge string
+	redirect  string
+}
+
+// Server is a local OpenID Connect issuer
+type Server struct {
+	*httptest.Server
+	t   testing.TB
+	key *rsa.PrivateKey
+
+	mu      sync.Mutex
+	subject string
+	email   string
+	codes   map[string]grant
+}
+
+// NewServer starts an issuer that is closed when the test ends
+func NewServer(t testing.TB) *Server {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("oidctest: generating key: %v", err)
+	}
+	s := &Server{t: t, key: key, codes: make(map[string]grant)}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", s.discovery)
+	mux.HandleFunc("/authorize", s.authorize)
+	mux.HandleFunc("/token", s.token)
+	mux.HandleFunc("/jwks", s.jwks)
+	s.Server = httptest.NewServer(mux)
+	t.Cleanup(s.Close)
+	return s
+}
+
+// Login sets the identity the next authorization logs in as.
+// The email is reported as verified; leave it empty for none.
+func (s *Server) Login(subject, email string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.subject = subject
+	s.email = email
+}
+
+// Claims returns valid ID token claims for subject, issued now for ClientID
+func (s *Server) Claims(subject, nonce string) map[string]interface{} {
+	now := time.Now()
+	return map[string]interface{}{
+		"iss":   s.URL,
+		"sub":   subject,
+		"aud":   ClientID,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+		"nonce": nonce,
+	}
+}
+
+// Sign returns claims as an ID token signed with the issuer's key
+func (s *Server) Sign(claims map[string]interface{}) string {
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT", "kid": keyID})
+	payload, _ := json.Marshal(claims)
+	signed := enc(header) + "." + enc(payload)
+	digest := sha256.Sum256([]byte(signed))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, s.key, crypto.SHA256, digest[:])
+	if err != nil {
+		s.t.Fatalf("oidctest: signing: %v", err)
+	}
+	return signed + "." + enc(sig)
+}
+
+func (s *Server) discovery(w http.ResponseWriter, r *http.Request) {
+	json.NewEncoder(w).Encode(map[string]string{
+		"issuer":                 s.URL,
+		"authorization_endpoint": s.URL + "/authorize",
+		"token_endpoint":         s.URL + "/token",
+		"jwks_uri":               s.URL + "/jwks",
+	})
+}
+
+func (s *Server) authorize(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	redirect, err := url.Parse(q.Get("redirect_uri"))
+	if err != nil || q.Get("client_id") != ClientID || q.Get("response_type") != "code" ||
+		q.Get("code_challenge_method") != "S256" || q.Get("code_challenge") == "" {
+		http.Error(w, "oidctest: bad authorization request", http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	claims := s.Claims(s.subject, q.Get("nonce"))
+	if s.email != "" {
+		claims["email"] = s.email
+		claims["email_verified"] = true
+	}
+	buf := make([]byte, 16)
+	rand.Read(buf)
+	code := enc(buf)
+	s.codes[code] = grant{claims: claims, challenge: q.Get("code_challenge"), redirect: q.Get("redirect_uri")}
+	s.mu.Unlock()
+
+	back := redirect.Query()
+	back.Set("code", code)
+	back.Set("state", q.Get("state"))
+	redirect.RawQuery = back.Encode()
+	http.Redirect(w, r, redirect.String(), http.StatusFound)
+}
+
+func (s *Server) token(w http.ResponseWriter, r *http.Request) {
+	clientID, secret, _ := r.BasicAuth()
+	clientID, _ = url.QueryUnescape(clientID)
+	secret, _ = url.QueryUnescape(secret)
+	if clientID != ClientID || secret != ClientSecret {
+		http.Error(w, `{"error": "invalid_client"}`, http.StatusUnauthorized)
+		return
+	}
+	r.ParseForm()
+
+	s.mu.Lock()
+	g, ok := s.codes[r.Form.Get("code")]
+	delete(s.codes, r.Form.Get("code"))
+	s.mu.Unlock()
+
+	sum := sha256.Sum256([]byte(r.Form.Get("code_verifier")))
+	if !ok || r.Form.Get("grant_type") != "authorization_code" || r.Form.Get("redirect_uri") != g.redirect ||
+		enc(sum[:]) != g.challenge {
+		http.Error(w, `{"error": "invalid_grant"}`, http.StatusBadRequest)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]string{
+		"access_token": "oidctest-access",
+		"token_type":   "Bearer",
+		"id_token":     s.Sign(g.claims),
+	})
+}
+
+func (s *Server) jwks(w http.ResponseWriter, r *http.Request) {
+	pub := s.key.PublicKey
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": keyID,
+			"use": "sig",
+			"alg": "RS256",
+			"n":   enc(pub.N.Bytes()),
+			"e":   enc(big.NewInt(int64(pub.E)).Bytes()),
+		}},
+	})
+}
+
+func enc(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
@@ -0,0 +1,339 @@
+// Package prompts loads the LLM prompt templates. Each prompt can be overridden
+// by a text/template file in the vault's _System/Prompts/ folder; the embedded
+// defaults are used when there is no override or the override is invalid.
+package prompts
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+)
+
+// Dir is the vault folder holding prompt overrides, one <name>.md file per prompt
+const Dir = "_System/Prompts"
+
+// Prompt names
+const (
+	Classifier      = "classifier"
+	Transaction     = "transaction"
+	DailyReport     = "daily_report"
+	WeeklyReport    = "weekly_report"
+	IdeaExpander    = "idea_expander"
+	ClaimExtraction = "claim_extraction"
+	Narration       = "narration"
+	StrictNarration = "strict_narration"
+	Verification    = "verification"
+)
+
+// ClassifierData is the data for the classifier prompt
+type ClassifierData struct {
+	Text      string
+	Actor     string
+	Timestamp string // RFC 3339
+}
+
+// TransactionData is the data for the transaction parsing prompt
+type TransactionData struct {
+	Text  string
+	Actor string
+}
+
+// ReportData is the data for the daily and weekly report prompts
+type ReportData struct {
+	Context string // formatted trend data
+}
+
+// IdeaData is the data for the idea expansion prompt
+type IdeaData struct {
+	Idea     string
+	Category string // category context, e.g. "Ideas (tags: a, b)"
+}
+
+// ClaimExtractionData is the data for the claim extraction prompt
+type ClaimExtractionData struct {
+	Entries string // raw entries, each under a "--- Entry N ---" header
+}
+
+// NarrationData is the data for the narration prompts
+type NarrationData struct {
+	Claims   string // numbered claims
+	Feedback string // verifier feedback (strict narration only)
+}
+
+// VerificationData is the data for the verification prompt
+type VerificationData struct {
+	Claims   string // numbered claims with quotes
+	Narrated string
+}
+
+// spec describes the data a prompt is rendered with and the fields it must use
+type spec struct {
+	data     interface{}
+	required []string
+}
+
+var specs = map[string]spec{
+	Classifier:      {ClassifierData{}, []string{"Text"}},
+	Transaction:     {TransactionData{}, []string{"Text"}},
+	DailyReport:     {ReportData{}, []string{"Context"}},
+	WeeklyReport:    {ReportData{}, []string{"Context"}},
+	IdeaExpander:    {IdeaData{}, []string{"Idea"}},
+	ClaimExtraction: {ClaimExtractionData{}, []string{"Entries"}},
+	Narration:       {NarrationData{}, []string{"Claims"}},
+	StrictNarration: {NarrationData{}, []string{"Claims", "Feedback"}},
+	Verification:    {VerificationData{}, []string{"Claims", "Narrated"}},
+}
+
+//go:embed defaults/*.md
+var defaultFiles embed.FS
+
+// Prompt is a rendered prompt
+type Prompt struct {
+	Name    string
+	Text    string
+	Version string
+}
+
+// Ref identifies the template a prompt was rendered from, e.g. "classifier@3",
+// for recording in the frontmatter of whatever the prompt produced
+func (p Prompt) Ref() string {
+	return p.Name + "@" + p.Version
+}
+
+// Info describes the template currently in use for a prompt
+type Info struct {
+	Name    string `json:"name"`
+	Source  string `json:"source"` // "vault" or "default"
+	Version string `json:"version"`
+	Path    string `json:"path,omitempty"`  // vault-relative override path
+	Error   string `json:"error,omitempty"` // why the override was rejected
+}
+
+type compiled struct {
+	tmpl    *template.Template
+	version string
+}
+
+type override struct {
+	modTime time.Time
+	size    int64
+	tmpl    *compiled // nil when the file is invalid
+	err     error
+}
+
+// Store renders prompts, reloading vault overrides when their files change
+type Store struct {
+	dir string // empty for defaults only
+
+	mu        sync.Mutex
+	defaults  map[string]*compiled
+	overrides map[string]*override
+}
+
+// NewStore creates a store reading overrides from the vault's _System/Prompts folder
+func NewStore(vaultPath string) *Store {
+	s := Defaults()
+	s.dir = filepath.Join(vaultPath, Dir)
+	return s
+}
+
+// Defaults creates a store that only uses the embedded defaults
+func Defaults() *Store {
+	s := &Store{
+		defaults:  make(map[string]*compiled),
+		overrides: make(map[string]*override),
+	}
+	for name := range specs {
+		data, err := defaultFiles.ReadFile("defaults/" + name + ".md")
+		if err != nil {
+			panic(fmt.Sprintf("prompts: missing default %s: %v", name, err))
+		}
+		t, err := parse(name, string(data))
+		if err != nil {
+			panic(fmt.Sprintf("prompts: invalid default %s: %v", name, err))
+		}
+		t.version = "default-" + t.version
+		s.defaults[name] = t
+	}
+	return s
+}
+
+// Names returns the prompt names in order
+func Names() []string {
+	names := make([]string, 0, len(specs))
+	for name := range specs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Load checks every override now rather than on first use.
+// Returns the invalid overrides, which fall back to the defaults.
+func (s *Store) Load() []Info {
+	var invalid []Info
+	for _, info := range s.List() {
+		if info.Error != "" {
+			invalid = append(invalid, info)
+		}
+	}
+	return invalid
+}
+
+// List describes the template in use for every prompt
+func (s *Store) List() []Info {
+	var infos []Info
+	for _, name := range Names() {
+		infos = append(infos, s.info(name))
+	}
+	return infos
+}
+
+// Render executes a prompt's template with data, which must be the prompt's data type
+func (s *Store) Render(name string, data interface{}) (Prompt, error) {
+	sp, ok := specs[name]
+	if !ok {
+		return Prompt{}, fmt.Errorf("unknown prompt %q", name)
+	}
+	if reflect.TypeOf(data) != reflect.TypeOf(sp.data) {
+		return Prompt{}, fmt.Errorf("prompt %s takes %T, got %T", name, sp.data, data)
+	}
+
+	t := s.template(name)
+	var buf bytes.Buffer
+	if err := t.tmpl.Execute(&buf, data); err != nil {
+		return Prompt{}, fmt.Errorf("rendering prompt %s: %w", name, err)
+	}
+	return Prompt{Name: name, Text: buf.String(), Version: t.version}, nil
+}
+
+func (s *Store) template(name string) *compiled {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if o := s.overrideLocked(name); o != nil && o.tmpl != nil {
+		return o.tmpl
+	}
+	return s.defaults[name]
+}
+
+func (s *Store) info(name string) Info {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	info := Info{Name: name, Source: "default", Version: s.defaults[name].version}
+	o := s.overrideLocked(name)
+	if o == nil {
+		return info
+	}
+	info.Path = filepath.Join(Dir, name+".md")
+	if o.err != nil {
+		info.Error = o.err.Error()
+		return info
+	}
+	info.Source = "vault"
+	info.Version = o.tmpl.version
+	return info
+}
+
+// overrideLocked returns the vault override for name, re-reading the file when
+// its size or modification time has changed. Nil when there is no file.
+func (s *Store) overrideLocked(name string) *override {
+	if s.dir == "" {
+		return nil
+	}
+	path := filepath.Join(s.dir, name+".md")
+	fi, err := os.Stat(path)
+	if err != nil {
+		delete(s.overrides, name)
+		return nil
+	}
+
+	o := s.overrides[name]
+	if o != nil && o.modTime.Equal(fi.ModTime()) && o.size == fi.Size() {
+		return o
+	}
+
+	o = &override{modTime: fi.ModTime(), size: fi.Size()}
+	data, err := os.ReadFile(path)
+	if err == nil {
+		o.tmpl, err = parse(name, string(data))
+	}
+	if err != nil {
+		o.err = err
+		log.Printf("Prompt override %s is invalid, using the default: %v", path, err)
+	} else {
+		log.Printf("Loaded prompt override %s (version %s)", path, o.tmpl.version)
+	}
+	s.overrides[name] = o
+	return o
+}
+
+// parse reads a prompt file: optional frontmatter with a version, then the template.
+// The template is checked by rendering it with placeholder data: it may only use
+// the prompt's fields and must use the required ones.
+func parse(name, content string) (*compiled, error) {
+	version, body := splitFrontmatter(strings.ReplaceAll(content, "\r\n", "\n"))
+	body = strings.TrimSpace(body)
+
+	tmpl, err := template.New(name).Option("missingkey=error").Parse(body)
+	if err != nil {
+		return nil, err
+	}
+
+	sp := specs[name]
+	sample := reflect.New(reflect.TypeOf(sp.data)).Elem()
+	for i := 0; i < sample.NumField(); i++ {
+		sample.Field(i).SetString(placeholder(sample.Type().Field(i).Name))
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, sample.Interface()); err != nil {
+		return nil, err
+	}
+	for _, field := range sp.required {
+		if !strings.Contains(buf.String(), placeholder(field)) {
+			return nil, fmt.Errorf("template must use {{.%s}}", field)
+		}
+	}
+
+	if version == "" {
+		sum := sha256.Sum256([]byte(body))
+		version = hex.EncodeToString(sum[:4])
+	}
+	return &compiled{tmpl: tmpl, version: version}, nil
+}
+
+func placeholder(field string) string {
+	return "\x00" + field + "\x00"
+}
+
+// splitFrontmatter returns the version from YAML frontmatter, if any, and the rest of the file
+func splitFrontmatter(content string) (string, string) {
+	if !strings.HasPrefix(content, "---\n") {
+		return "", content
+	}
+	end := strings.Index(content[4:], "\n---")
+	if end < 0 {
+		return "", content
+	}
+	front, rest := content[4:4+end], content[4+end+4:]
+
+	var version string
+	for _, line := range strings.Split(front, "\n") {
+		key, value, ok := strings.Cut(line, ":")
+		if ok && strings.TrimSpace(key) == "version" {
+			version = strings.Trim(strings.TrimSpace(value), `"'`)
+		}
+	}
+	return version, rest
+}
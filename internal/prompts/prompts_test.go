@@ -0,0 +1,185 @@
+package prompts
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeOverride(t *testing.T, vaultPath, name, content string) {
+	t.Helper()
+	dir := filepath.Join(vaultPath, Dir)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatalf("creating prompts dir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, name+".md"), []byte(content), 0644); err != nil {
+		t.Fatalf("writing override: %v", err)
+	}
+}
+
+func TestDefaults(t *testing.T) {
+	s := Defaults()
+
+	p, err := s.Render(Classifier, ClassifierData{Text: "buy milk", Actor: "wolf", Timestamp: "2024-01-15T09:30:00Z"})
+	if err != nil {
+		t.Fatalf("Render: %v", err)
+	}
+	if !strings.HasPrefix(p.Text, "You are a personal note classifier.") {
+		t.Errorf("classifier prompt starts %.40q", p.Text)
+	}
+	for _, want := range []string{`"buy milk"`, "Actor: wolf", "Timestamp: 2024-01-15T09:30:00Z"} {
+		if !strings.Contains(p.Text, want) {
+			t.Errorf("classifier prompt missing %q", want)
+		}
+	}
+	if !strings.HasPrefix(p.Version, "default-") {
+		t.Errorf("Version = %q, want a default- version", p.Version)
+	}
+	if p.Ref() != "classifier@"+p.Version {
+		t.Errorf("Ref = %q", p.Ref())
+	}
+
+	// Every default parses and renders with its data type
+	for _, info := range s.List() {
+		if info.Source != "default" || info.Error != "" {
+			t.Errorf("%s: source %q, error %q", info.Name, info.Source, info.Error)
+		}
+	}
+	if len(s.List()) != len(specs) {
+		t.Errorf("List has %d prompts, want %d", len(s.List()), len(specs))
+	}
+}
+
+func TestRenderWrongData(t *testing.T) {
+	s := Defaults()
+	if _, err := s.Render(Classifier, TransactionData{Text: "x"}); err == nil {
+		t.Error("rendering the classifier with TransactionData succeeded")
+	}
+	if _, err := s.Render("nope", ReportData{}); err == nil {
+		t.Error("rendering an unknown prompt succeeded")
+	}
+}
+
+func TestOverride(t *testing.T) {
+	vaultPath := t.TempDir()
+	writeOverride(t, vaultPath, DailyReport, "---\nversion: 3\n---\nReport on:\n{{.Context}}\n")
+	s := NewStore(vaultPath)
+
+	if invalid := s.Load(); len(invalid) != 0 {
+		t.Fatalf("Load rejected %v", invalid)
+	}
+
+	p, err := s.Render(DailyReport, ReportData{Context: "7 ideas"})
+	if err != nil {
+		t.Fatalf("Render: %v", err)
+	}
+	if p.Text != "Report on:\n7 ideas" {
+		t.Errorf("Text = %q", p.Text)
+	}
+	if p.Ref() != "daily_report@3" {
+		t.Errorf("Ref = %q, want daily_report@3", p.Ref())
+	}
+
+	// Prompts without an override still use the defaults
+	weekly, err := s.Render(WeeklyReport, ReportData{Context: "x"})
+	if err != nil {
+		t.Fatalf("Render weekly: %v", err)
+	}
+	if !strings.HasPrefix(weekly.Version, "default-") {
+		t.Errorf("weekly Version = %q, want the default", weekly.Version)
+	}
+}
+
+func TestOverrideWithoutVersion(t *testing.T) {
+	vaultPath := t.TempDir()
+	writeOverride(t, vaultPath, IdeaExpander, "Expand {{.Idea}}")
+	s := NewStore(vaultPath)
+
+	p, err := s.Render(IdeaExpander, IdeaData{Idea: "solar bike lights"})
+	if err != nil {
+		t.Fatalf("Render: %v", err)
+	}
+	if len(p.Version) != 8 || strings.HasPrefix(p.Version, "default-") {
+		t.Errorf("Version = %q, want a content hash", p.Version)
+	}
+}
+
+func TestInvalidOverrideFallsBack(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantErr string
+	}{
+		{"parse error", "Classify {{.Text", "unclosed action"},
+		{"unknown field", "Classify {{.Text}} for {{.User}}", "User"},
+		{"missing required field", "Classify this", "{{.Text}}"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vaultPath := t.TempDir()
+			writeOverride(t, vaultPath, Classifier, tt.content)
+			s := NewStore(vaultPath)
+
+			invalid := s.Load()
+			if len(invalid) != 1 || invalid[0].Name != Classifier {
+				t.Fatalf("Load = %v, want the classifier rejected", invalid)
+			}
+			if !strings.Contains(invalid[0].Error, tt.wantErr) {
+				t.Errorf("Error = %q, want it to mention %q", invalid[0].Error, tt.wantErr)
+			}
+			if invalid[0].Path != filepath.Join(Dir, "classifier.md") {
+				t.Errorf("Path = %q", invalid[0].Path)
+			}
+
+			p, err := s.Render(Classifier, ClassifierData{Text: "x"})
+			if err != nil {
+				t.Fatalf("Render: %v", err)
+			}
+			if !strings.HasPrefix(p.Version, "default-") {
+				t.Errorf("Version = %q, want the default", p.Version)
+			}
+		})
+	}
+}
+
+func TestReloadOnChange(t *testing.T) {
+	vaultPath := t.TempDir()
+	writeOverride(t, vaultPath, Narration, "---\nversion: 1\n---\nNarrate {{.Claims}}")
+	s := NewStore(vaultPath)
+
+	p, _ := s.Render(Narration, NarrationData{Claims: "1. walked"})
+	if p.Ref() != "narration@1" {
+		t.Fatalf("Ref = %q, want narration@1", p.Ref())
+	}
+
+	// Same size, so only the modification time gives the change away
+	writeOverride(t, vaultPath, Narration, "---\nversion: 2\n---\nNarrate {{.Claims}}")
+	path := filepath.Join(vaultPath, Dir, "narration.md")
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(path, later, later); err != nil {
+		t.Fatalf("Chtimes: %v", err)
+	}
+	p, _ = s.Render(Narration, NarrationData{Claims: "1. walked"})
+	if p.Ref() != "narration@2" {
+		t.Errorf("Ref after edit = %q, want narration@2", p.Ref())
+	}
+
+	// A broken edit falls back to the default rather than the last good version
+	writeOverride(t, vaultPath, Narration, "Narrate nothing")
+	p, _ = s.Render(Narration, NarrationData{Claims: "1. walked"})
+	if !strings.HasPrefix(p.Version, "default-") {
+		t.Errorf("Version after broken edit = %q, want the default", p.Version)
+	}
+
+	// Removing the override goes back to the default
+	os.Remove(path)
+	info := s.List()
+	for _, i := range info {
+		if i.Name == Narration && i.Source != "default" {
+			t.Errorf("after removal source = %q, want default", i.Source)
+		}
+	}
+}
@@ -0,0 +1,240 @@
+// Package ratelimit implements per-key token buckets with named budgets.
+//
+// Each route group has a budget, e.g. "default" for ordinary API calls and "llm"
+// for routes that run the heavy model. A budget can be overridden for one actor
+// with "group@actor". Buckets are keyed by group and actor, refill continuously,
+// and are dropped once idle long enough to be full again.
+package ratelimit
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Budget groups used by the API
+const (
+	GroupClient  = "client"  // every API request before authentication, keyed by client address
+	GroupDefault = "default" // every authenticated request
+	GroupLLM     = "llm"     // on top of default for routes that generate with the heavy model
+	GroupAuth    = "auth"    // login and refresh, keyed by client address
+)
+
+// sweepInterval is how often full buckets are evicted
+const sweepInterval = time.Minute
+
+// Budget allows Limit requests per Per, in bursts of up to Limit.
+// A zero Limit means unlimited.
+type Budget struct {
+	Limit int
+	Per   time.Duration
+}
+
+// String formats the budget as it is configured, e.g. "20/h"
+func (b Budget) String() string {
+	if b.Limit == 0 {
+		return "off"
+	}
+	unit := map[time.Duration]string{time.Second: "s", time.Minute: "m", time.Hour: "h", 24 * time.Hour: "d"}[b.Per]
+	if unit == "" {
+		unit = b.Per.String()
+	}
+	return fmt.Sprintf("%d/%s", b.Limit, unit)
+}
+
+// Limits maps a group, or "group@actor", to its budget
+type Limits map[string]Budget
+
+// DefaultLimits keep ordinary use unconstrained while stopping a runaway client
+// from queueing hours of heavy-model work or guessing tokens. The client budget is
+// shared by everyone behind one address, so it is larger than a user's.
+func DefaultLimits() Limits {
+	return Limits{
+		GroupClient:  {Limit: 300, Per: time.Minute},
+		GroupDefault: {Limit: 120, Per: time.Minute},
+		GroupLLM:     {Limit: 20, Per: time.Hour},
+		GroupAuth:    {Limit: 20, Per: time.Minute},
+	}
+}
+
+// Merge overlays other onto l
+func (l Limits) Merge(other Limits) Limits {
+	merged := make(Limits, len(l)+len(other))
+	for k, b := range l {
+		merged[k] = b
+	}
+	for k, b := range other {
+		merged[k] = b
+	}
+	return merged
+}
+
+// String formats the limits as ParseLimits reads them, sorted by key
+func (l Limits) String() string {
+	keys := make([]string, 0, len(l))
+	for k := range l {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	parts := make([]string, len(keys))
+	for i, k := range keys {
+		parts[i] = k + "=" + l[k].String()
+	}
+	return strings.Join(parts, ",")
+}
+
+// ParseLimits reads comma-separated budgets, e.g. "default=120/m,llm=20/h,llm@kid=5/h".
+// Periods are s, m, h or d; "off" removes the limit.
+func ParseLimits(s string) (Limits, error) {
+	limits := make(Limits)
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(part, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" || strings.HasPrefix(key, "@") || strings.HasSuffix(key, "@") {
+			return nil, fmt.Errorf("invalid budget %q: want group=N/period", part)
+		}
+		budget, err := ParseBudget(strings.TrimSpace(value))
+		if err != nil {
+			return nil, fmt.Errorf("budget for %s: %w", key, err)
+		}
+		limits[key] = budget
+	}
+	return limits, nil
+}
+
+// ParseBudget reads a budget such as "120/m" or "off"
+func ParseBudget(s string) (Budget, error) {
+	if s == "off" {
+		return Budget{}, nil
+	}
+	count, period, ok := strings.Cut(s, "/")
+	n, err := strconv.Atoi(count)
+	if !ok || err != nil || n < 1 {
+		return Budget{}, fmt.Errorf("invalid budget %q: want N/period with N > 0, or off", s)
+	}
+	per, ok := map[string]time.Duration{"s": time.Second, "m": time.Minute, "h": time.Hour, "d": 24 * time.Hour}[period]
+	if !ok {
+		return Budget{}, fmt.Errorf("invalid period in %q: use s, m, h or d", s)
+	}
+	return Budget{Limit: n, Per: per}, nil
+}
+
+// Decision is the outcome of a request against a budget
+type Decision struct {
+	Allowed    bool
+	Limit      int           // bucket size; 0 when unlimited
+	Remaining  int           // whole requests left after this one
+	Reset      time.Duration // until the bucket is full again
+	RetryAfter time.Duration // until the next request would be allowed (when refused)
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+	budget Budget
+}
+
+// Limiter holds a token bucket per group and actor
+type Limiter struct {
+	mu        sync.Mutex
+	limits    Limits
+	buckets   map[string]*bucket
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+// New creates a limiter with the given budgets; groups without one are unlimited
+func New(limits Limits) *Limiter {
+	return &Limiter{
+		limits:  limits,
+		buckets: make(map[string]*bucket),
+		now:     time.Now,
+	}
+}
+
+// Budget returns the budget that applies to actor in group
+func (l *Limiter) Budget(group, actor string) Budget {
+	if b, ok := l.limits[group+"@"+actor]; ok {
+		return b
+	}
+	return l.limits[group]
+}
+
+// Allow takes a token for actor (or a client address) from the group's bucket
+func (l *Limiter) Allow(group, actor string) Decision {
+	budget := l.Budget(group, actor)
+	if budget.Limit == 0 {
+		return Decision{Allowed: true}
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.sweep(now)
+
+	key := group + "\x00" + actor
+	b, ok := l.buckets[key]
+	if !ok || b.budget != budget {
+		b = &bucket{tokens: float64(budget.Limit), last: now, budget: budget}
+		l.buckets[key] = b
+	}
+	b.refill(now)
+
+	d := Decision{Limit: budget.Limit}
+	if b.tokens >= 1 {
+		b.tokens--
+		d.Allowed = true
+	} else {
+		d.RetryAfter = b.until(1)
+	}
+	d.Remaining = int(math.Floor(b.tokens))
+	d.Reset = b.until(float64(budget.Limit))
+	return d
+}
+
+// Len returns the number of buckets held
+func (l *Limiter) Len() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.buckets)
+}
+
+// sweep drops buckets that have refilled completely, which are
+// indistinguishable from new ones (call with mu held)
+func (l *Limiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < sweepInterval {
+		return
+	}
+	l.lastSweep = now
+	for key, b := range l.buckets {
+		b.refill(now)
+		if b.tokens >= float64(b.budget.Limit) {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+func (b *bucket) refill(now time.Time) {
+	if elapsed := now.Sub(b.last); elapsed > 0 {
+		added := float64(elapsed) * float64(b.budget.Limit) / float64(b.budget.Per)
+		b.tokens = math.Min(float64(b.budget.Limit), b.tokens+added)
+		b.last = now
+	}
+}
+
+// until returns how long until the bucket holds n tokens
+func (b *bucket) until(n float64) time.Duration {
+	if b.tokens >= n {
+		return 0
+	}
+	return time.Duration((n - b.tokens) * float64(b.budget.Per) / float64(b.budget.Limit))
+}
@@ -0,0 +1,102 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseLimits(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{"", "", false},
+		{"default=120/m", "default=120/m", false},
+		{" llm = 5/h , llm@kid=1/d, auth=off", "auth=off,llm=5/h,llm@kid=1/d", false},
+		{"llm=10/s", "llm=10/s", false},
+		{"llm", "", true},
+		{"llm=0/m", "", true},
+		{"llm=5/w", "", true},
+		{"llm=five/m", "", true},
+		{"=5/m", "", true},
+		{"llm@=5/m", "", true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseLimits(tt.in)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("ParseLimits(%q) = %v, want error", tt.in, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseLimits(%q): %v", tt.in, err)
+			continue
+		}
+		if got.String() != tt.want {
+			t.Errorf("ParseLimits(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestTokenBucket(t *testing.T) {
+	now := time.Date(2024, 1, 15, 9, 0, 0, 0, time.UTC)
+	l := New(Limits{GroupLLM: {Limit: 3, Per: time.Hour}, GroupLLM + "@kid": {Limit: 1, Per: time.Hour}})
+	l.now = func() time.Time { return now }
+
+	// The full burst is available at once, then requests are refused
+	for i := 2; i >= 0; i-- {
+		d := l.Allow(GroupLLM, "wolf")
+		if !d.Allowed || d.Remaining != i || d.Limit != 3 {
+			t.Fatalf("request %d: %+v, want allowed with %d remaining", 3-i, d, i)
+		}
+	}
+	d := l.Allow(GroupLLM, "wolf")
+	if d.Allowed || d.RetryAfter != 20*time.Minute || d.Reset != time.Hour {
+		t.Errorf("over budget: %+v, want refused, retry in 20m, full in 1h", d)
+	}
+
+	// Tokens refill continuously: one every 20 minutes
+	now = now.Add(20 * time.Minute)
+	if d := l.Allow(GroupLLM, "wolf"); !d.Allowed || d.Remaining != 0 {
+		t.Errorf("after 20m: %+v, want one request allowed", d)
+	}
+
+	// Actors have separate buckets, and overrides apply per actor
+	if d := l.Allow(GroupLLM, "wife"); !d.Allowed || d.Limit != 3 {
+		t.Errorf("wife: %+v, want her own bucket of 3", d)
+	}
+	l.Allow(GroupLLM, "kid")
+	if d := l.Allow(GroupLLM, "kid"); d.Allowed || d.Limit != 1 {
+		t.Errorf("kid: %+v, want refused with the 1/h override", d)
+	}
+
+	// Groups without a budget are unlimited
+	if d := l.Allow(GroupDefault, "wolf"); !d.Allowed || d.Limit != 0 {
+		t.Errorf("unbudgeted group: %+v, want allowed and unlimited", d)
+	}
+}
+
+func TestIdleBucketsEvicted(t *testing.T) {
+	now := time.Date(2024, 1, 15, 9, 0, 0, 0, time.UTC)
+	l := New(Limits{GroupDefault: {Limit: 60, Per: time.Minute}})
+	l.now = func() time.Time { return now }
+
+	for _, actor := range []string{"wolf", "wife", "10.0.0.1", "10.0.0.2"} {
+		l.Allow(GroupDefault, actor)
+	}
+	if n := l.Len(); n != 4 {
+		t.Fatalf("Len = %d, want 4", n)
+	}
+
+	// Once refilled, idle buckets go at the next sweep; the active one stays
+	now = now.Add(2 * time.Minute)
+	for i := 0; i < 30; i++ {
+		l.Allow(GroupDefault, "wolf")
+	}
+	if n := l.Len(); n != 1 {
+		t.Errorf("Len after sweep = %d, want only wolf's bucket", n)
+	}
+}
@@ -8,71 +8,113 @@ import (
 	"time"
 
 	"github.com/mrwolf/brain-server/internal/llm"
+	"github.com/mrwolf/brain-server/internal/prompts"
 	"github.com/mrwolf/brain-server/internal/vault"
 )
 
-const ideaExpanderPrompt = `Expand on this idea with questions and angles to explore.
-
-Idea: "%s"
-Category context: %s
-
-Generate:
-- 3-5 probing questions about this idea
-- 2-3 potential applications or directions
-- 1-2 potential challenges or considerations
-
-Do NOT search the web. Use only reasoning.
-Output as markdown with headers.`
-
 // IdeaExpander generates research files for new ideas
 type IdeaExpander struct {
-	llm   *llm.Client
-	vault *vault.Vault
+	llm     *llm.Client
+	vault   *vault.Vault
+	prompts *prompts.Store
 }
 
 // NewIdeaExpander creates a new idea expander
 func NewIdeaExpander(client *llm.Client, v *vault.Vault) *IdeaExpander {
 	return &IdeaExpander{
-		llm:   client,
-		vault: v,
+		llm:     client,
+		vault:   v,
+		prompts: prompts.Defaults(),
 	}
 }
 
+// SetPrompts sets where prompt templates are loaded from (the embedded defaults until set)
+func (e *IdeaExpander) SetPrompts(store *prompts.Store) {
+	e.prompts = store
+}
+
 // ExpandIdea generates research content for an idea
-func (e *IdeaExpander) ExpandIdea(ctx context.Context, ideaText, title, category string) (string, error) {
-	prompt := fmt.Sprintf(ideaExpanderPrompt, ideaText, category)
+func (e *IdeaExpander) ExpandIdea(ctx context.Context, ideaText, title, category string) (Generated, error) {
+	return e.StreamExpandIdea(ctx, ideaText, title, category, nil)
+}
+
+// StreamExpandIdea generates research content, passing text to onChunk as it is generated
+func (e *IdeaExpander) StreamExpandIdea(ctx context.Context, ideaText, title, category string, onChunk func(string) error) (Generated, error) {
+	prompt, err := e.prompts.Render(prompts.IdeaExpander, prompts.IdeaData{Idea: ideaText, Category: category})
+	if err != nil {
+		return Generated{}, err
+	}
+
+	response, err := e.llm.GenerateTextStream(ctx, llm.TaskIdeaExpand, prompt.Text, onChunk)
+	if err != nil {
+		return Generated{}, fmt.Errorf("generating idea expansion: %w", err)
+	}
+
+	return Generated{Text: response, Prompt: prompt.Ref()}, nil
+}
 
-	response, err := e.llm.GenerateText(ctx, prompt, true) // Use heavy model
+// ExpandAndSave expands an idea and writes its research file, returning the vault path
+func (e *IdeaExpander) ExpandAndSave(ctx context.Context, ideaID, actor, title, content string, tags []string) (string, error) {
+	// Build context from tags and category
+	categoryContext := "Ideas"
+	if len(tags) > 0 {
+		categoryContext = fmt.Sprintf("Ideas (tags: %s)", strings.Join(tags, ", "))
+	}
+
+	research, err := e.ExpandIdea(llm.WithActor(ctx, actor), content, title, categoryContext)
 	if err != nil {
-		return "", fmt.Errorf("generating idea expansion: %w", err)
+		return "", err
 	}
 
-	return response, nil
+	path, err := e.WriteResearchFile(ideaID, actor, title, research)
+	if err != nil {
+		return "", fmt.Errorf("writing research: %w", err)
+	}
+	return path, nil
 }
 
 // WriteResearchFile writes the expanded research to the vault
-func (e *IdeaExpander) WriteResearchFile(ideaID, title, content string) (string, error) {
+func (e *IdeaExpander) WriteResearchFile(ideaID, actor, title string, research Generated) (string, error) {
+	content := research.Text
+
 	// Path: Research/Ideas/{date}-{title}-research.md
-	dateStr := time.Now().Format("2006-01-02")
+	now := time.Now()
+	dateStr := now.Format("2006-01-02")
 	slug := slugifyTitle(title)
 	filename := fmt.Sprintf("%s-%s-research.md", dateStr, slug)
 	relPath := filepath.Join("Research", "Ideas", filename)
 
+	var prompt string
+	if research.Prompt != "" {
+		prompt = fmt.Sprintf("prompt: %s\n", research.Prompt)
+	}
+
 	fullContent := fmt.Sprintf(`---
 id: %s_research
 source_idea: %s
 created: %s
----
+%s---
 
 # Research: %s
 
 %s
-`, ideaID, ideaID, time.Now().UTC().Format(time.RFC3339), title, content)
+`, ideaID, ideaID, now.UTC().Format(time.RFC3339), prompt, title, content)
 
-	if err := vault.WriteFileAtomic(filepath.Join(e.vault.BasePath(), relPath), []byte(fullContent)); err != nil {
+	if err := e.vault.WriteFile(filepath.Join(e.vault.BasePath(), relPath), []byte(fullContent), actor); err != nil {
 		return "", err
 	}
 
+	e.vault.Index(vault.Document{
+		ID:       ideaID + "_research",
+		Kind:     "research",
+		Actor:    actor,
+		Category: "Ideas",
+		Path:     relPath,
+		Title:    "Research: " + title,
+		Body:     content,
+		Created:  now,
+	})
+
 	return relPath, nil
 }
 
@@ -8,103 +8,52 @@ import (
 
 	"github.com/mrwolf/brain-server/internal/db"
 	"github.com/mrwolf/brain-server/internal/llm"
+	"github.com/mrwolf/brain-server/internal/medication"
+	"github.com/mrwolf/brain-server/internal/prompts"
 	"github.com/mrwolf/brain-server/internal/signals"
 )
 
-// Enhanced daily report prompt - includes actual content and 7-day trends
-const dailyReportPrompt = `You are generating a brief daily report for a personal life capture system.
-
-%s
-
-YOUR TASK:
-Look at the actual captures and trends above. Identify ONE meaningful pattern or direction that the person should be aware of. This could be:
-- Something they keep coming back to (recurring themes)
-- A shift in focus they may not have noticed
-- An imbalance worth addressing
-- Something that went quiet that might need attention
-
-CONSTRAINTS:
-- Be specific - reference actual captures/themes you see above
-- Be honest - if there's no clear pattern, say so briefly
-- NEVER mention: money amounts, spending, budgets, prices, purchases, dollars
-- NEVER use: "journey", "growth mindset", "self-care", "boundaries", "embrace", "space for"
-- No greeting or signoff
-- No generic advice like "take time to reflect"
-
-OUTPUT FORMAT (exactly this structure):
-INSIGHT: [One sentence describing the pattern or direction you notice - be specific]
-ACTION: [One concrete, specific thing to do today - not vague advice]
-
-Generate the report now:`
-
-// Weekly report prompt - mental landscape focus
-const weeklyReportPrompt = `You are generating a weekly mental landscape report. This summarizes how someone's mind was working over the past week based on their captured thoughts.
-
-%s
-
-YOUR TASK:
-Analyze the week's mental activity. Focus on:
-- What ideas emerged and whether any connect
-- Which projects got attention (or didn't)
-- Health/Life/Spirituality signals (body and mind indicators)
-- Patterns in thinking or focus shifts
-
-VOICE REQUIREMENTS (CRITICAL):
-- STRICTLY THIRD PERSON: Write as an observer describing someone else
-- Use phrases like: "The mind was occupied with...", "Attention went to...", "There was focus on..."
-- NEVER use: "you", "your", "yourself", "I", "we", "our"
-- NEVER give advice phrased as commands: "Continue doing X", "Try to Y", "Focus on Z"
-- NEXT WEEK section should be an observation/suggestion, not a directive
-
-ACCURACY REQUIREMENTS:
-- ONLY reference what's explicitly in the data above
-- Quote or closely paraphrase actual captures when citing evidence
-- If a pattern isn't clearly supported by the data, don't mention it
-- Note absent categories (e.g., "No Life captures this week")
-
-FORBIDDEN:
-- Money, spending, budgets, financial matters
-- Words: "journey", "growth mindset", "self-care", "boundaries", "embrace"
-- Inventing or extrapolating beyond what's captured
-- Second-person advice or directives
-
-OUTPUT FORMAT (exactly this structure):
-THIS WEEK: [2-3 sentences on what dominated mental activity - third person]
-
-PATTERNS:
-- [Pattern 1 with specific evidence from captures]
-- [Pattern 2 with specific evidence from captures]
-- [Pattern 3 if clearly supported]
-
-SHIFTS: [What changed mid-week, or "No significant shifts detected"]
-
-NEXT WEEK: [One observation about what might warrant attention - phrased as "X could be worth revisiting" not "revisit X"]
-
-Generate the report now:`
-
 // Silence messages
 const (
 	silenceDaily  = "INSIGHT: No clear patterns yet.\nACTION: Capture a few thoughts today and check back tomorrow."
 	silenceWeekly = "THIS WEEK: Quiet week with minimal mental capture activity.\n\nPATTERNS:\n- Insufficient data for pattern detection\n\nSHIFTS: No shifts detected.\n\nNEXT WEEK: Resume capturing thoughts to build a clearer picture."
 )
 
+// Generated is LLM output together with the prompt it was generated from
+type Generated struct {
+	Text   string
+	Prompt string // prompts.Prompt.Ref, empty for canned text
+}
+
 // LetterGenerator generates daily and weekly reports using trend analysis
 type LetterGenerator struct {
 	llm      *llm.Client
 	database *db.DB
+	prompts  *prompts.Store
 }
 
 // NewLetterGenerator creates a new letter generator
 func NewLetterGenerator(client *llm.Client, database *db.DB) *LetterGenerator {
-	return &LetterGenerator{llm: client, database: database}
+	return &LetterGenerator{llm: client, database: database, prompts: prompts.Defaults()}
+}
+
+// SetPrompts sets where prompt templates are loaded from (the embedded defaults until set)
+func (g *LetterGenerator) SetPrompts(store *prompts.Store) {
+	g.prompts = store
 }
 
 // GenerateDailyLetter generates an enhanced daily report using 7-day trend data
-func (g *LetterGenerator) GenerateDailyLetter(ctx context.Context, actor string, date time.Time) (string, error) {
+func (g *LetterGenerator) GenerateDailyLetter(ctx context.Context, actor string, date time.Time) (Generated, error) {
+	return g.StreamDailyLetter(ctx, actor, date, nil)
+}
+
+// StreamDailyLetter generates the daily report, passing raw text to onChunk as it is generated.
+// The returned letter is the cleaned version. Canned short-data letters arrive as a single chunk.
+func (g *LetterGenerator) StreamDailyLetter(ctx context.Context, actor string, date time.Time, onChunk func(string) error) (Generated, error) {
 	// 1. Build trend data from last 7 days (all categories for daily)
 	trend, err := signals.BuildTrendData(g.database, actor, date)
 	if err != nil {
-		return "", fmt.Errorf("building trend data: %w", err)
+		return Generated{}, fmt.Errorf("building trend data: %w", err)
 	}
 
 	// 2. Check if there's enough data
@@ -114,35 +63,39 @@ func (g *LetterGenerator) GenerateDailyLetter(ctx context.Context, actor string,
 	}
 
 	if totalCaptures == 0 {
-		return silenceDaily, nil
+		return cannedLetter(silenceDaily, onChunk)
 	}
 
 	if totalCaptures < 3 {
-		return "INSIGHT: Light week so far - not enough data for patterns.\nACTION: Keep capturing thoughts and check back in a day or two.", nil
+		return cannedLetter("INSIGHT: Light week so far - not enough data for patterns.\nACTION: Keep capturing thoughts and check back in a day or two.", onChunk)
 	}
 
 	// 3. Format context for LLM
 	trendContext := signals.FormatTrendContext(trend)
-	prompt := fmt.Sprintf(dailyReportPrompt, trendContext)
+	trendContext += g.missedDosesContext(actor, date)
+	prompt, err := g.prompts.Render(prompts.DailyReport, prompts.ReportData{Context: trendContext})
+	if err != nil {
+		return Generated{}, err
+	}
 
 	// 4. Generate report
-	response, err := g.llm.GenerateText(ctx, prompt, true)
+	response, err := g.llm.GenerateTextStream(letterContext(ctx, actor, trend), llm.TaskDailyLetter, prompt.Text, onChunk)
 	if err != nil {
-		return "", fmt.Errorf("generating daily report: %w", err)
+		return Generated{}, fmt.Errorf("generating daily report: %w", err)
 	}
 
 	// 5. Validate and clean response
 	response = cleanDailyResponse(response)
 
-	return response, nil
+	return Generated{Text: response, Prompt: prompt.Ref()}, nil
 }
 
 // GenerateWeeklyLetter generates a weekly mental landscape report
-func (g *LetterGenerator) GenerateWeeklyLetter(ctx context.Context, actor string, weekStart time.Time) (string, error) {
+func (g *LetterGenerator) GenerateWeeklyLetter(ctx context.Context, actor string, weekStart time.Time) (Generated, error) {
 	// 1. Build trend data EXCLUDING Financial, Tasks, Journal
 	trend, err := signals.BuildWeeklyTrendData(g.database, actor, weekStart)
 	if err != nil {
-		return "", fmt.Errorf("building weekly trend data: %w", err)
+		return Generated{}, fmt.Errorf("building weekly trend data: %w", err)
 	}
 
 	// 2. Check eligibility
@@ -152,23 +105,58 @@ func (g *LetterGenerator) GenerateWeeklyLetter(ctx context.Context, actor string
 	}
 
 	if totalCaptures < 3 {
-		return silenceWeekly, nil
+		return Generated{Text: silenceWeekly}, nil
 	}
 
 	// 3. Format context for LLM (weekly-specific format)
 	trendContext := signals.FormatWeeklyContext(trend)
-	prompt := fmt.Sprintf(weeklyReportPrompt, trendContext)
+	prompt, err := g.prompts.Render(prompts.WeeklyReport, prompts.ReportData{Context: trendContext})
+	if err != nil {
+		return Generated{}, err
+	}
 
 	// 4. Generate report
-	response, err := g.llm.GenerateText(ctx, prompt, true)
+	response, err := g.llm.GenerateText(letterContext(ctx, actor, trend), llm.TaskWeeklyLetter, prompt.Text)
 	if err != nil {
-		return "", fmt.Errorf("generating weekly report: %w", err)
+		return Generated{}, fmt.Errorf("generating weekly report: %w", err)
 	}
 
 	// 5. Clean response
 	response = cleanWeeklyResponse(response)
 
-	return response, nil
+	return Generated{Text: response, Prompt: prompt.Ref()}, nil
+}
+
+// letterContext selects the redaction for a letter's prompt: the actor's, or every
+// user's if it quotes captures other users shared with them
+func letterContext(ctx context.Context, actor string, trend *signals.TrendData) context.Context {
+	if len(trend.Shared) > 0 {
+		return llm.WithActor(ctx, "")
+	}
+	return llm.WithActor(ctx, actor)
+}
+
+// cannedLetter returns a fixed letter, streaming it as one chunk when requested
+func cannedLetter(text string, onChunk func(string) error) (Generated, error) {
+	if onChunk != nil {
+		if err := onChunk(text); err != nil {
+			return Generated{}, err
+		}
+	}
+	return Generated{Text: text}, nil
+}
+
+// missedDosesContext surfaces doses missed in the last 24h (empty if none or on error)
+func (g *LetterGenerator) missedDosesContext(actor string, date time.Time) string {
+	doses, err := g.database.GetDoses(actor, date.Add(-24*time.Hour), date)
+	if err != nil || len(doses) == 0 {
+		return ""
+	}
+	meds, err := g.database.GetMedications(actor)
+	if err != nil {
+		return ""
+	}
+	return medication.FormatMissedContext(doses, meds, date.Location())
 }
 
 // cleanDailyResponse ensures the daily response follows the expected format
@@ -0,0 +1,97 @@
+package scheduler
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+
+	"github.com/mrwolf/brain-server/internal/db"
+)
+
+// Kinds of LLM work postponed while the backend is unavailable
+const (
+	JobIdeaExpand = "idea_expand"
+	JobNarrate    = "narrate"
+)
+
+// narrateRefID keys the single pending narration: one Update catches up on every entry
+const narrateRefID = "journal"
+
+// ideaJob is the payload of a postponed idea expansion
+type ideaJob struct {
+	Title   string   `json:"title"`
+	Content string   `json:"content"`
+	Tags    []string `json:"tags,omitempty"`
+}
+
+// PostponeIdeaExpansion stores an idea expansion to run once the LLM backend recovers
+func PostponeIdeaExpansion(database *db.DB, ideaID, actor, title, content string, tags []string) error {
+	payload, err := json.Marshal(ideaJob{Title: title, Content: content, Tags: tags})
+	if err != nil {
+		return err
+	}
+	return database.PostponeJob(JobIdeaExpand, ideaID, actor, string(payload))
+}
+
+// PostponeNarration records that journal narration should run once the LLM backend recovers
+func PostponeNarration(database *db.DB) error {
+	return database.PostponeJob(JobNarrate, narrateRefID, "", "{}")
+}
+
+// resumePostponed runs work postponed while the LLM backend was unavailable.
+// Stops at the first failure, leaving the rest for the next health check.
+func (s *Scheduler) resumePostponed(ctx context.Context) {
+	jobs, err := s.db.GetPostponedJobs(50)
+	if err != nil {
+		log.Printf("Error loading postponed jobs: %v", err)
+		return
+	}
+	if len(jobs) == 0 {
+		return
+	}
+
+	log.Printf("LLM backend available, resuming %d postponed jobs", len(jobs))
+	for _, job := range jobs {
+		if !s.llm.Available() {
+			return
+		}
+		if err := s.runPostponed(ctx, job); err != nil {
+			log.Printf("Postponed %s job %s failed: %v", job.Kind, job.RefID, err)
+			return
+		}
+		if err := s.db.DeletePostponedJob(job.ID); err != nil {
+			log.Printf("Error removing postponed job %d: %v", job.ID, err)
+		}
+	}
+}
+
+func (s *Scheduler) runPostponed(ctx context.Context, job db.PostponedJob) error {
+	switch job.Kind {
+	case JobIdeaExpand:
+		var idea ideaJob
+		if err := json.Unmarshal([]byte(job.Payload), &idea); err != nil {
+			log.Printf("Dropping postponed idea %s with invalid payload: %v", job.RefID, err)
+			return nil
+		}
+		path, err := s.ideas.ExpandAndSave(ctx, job.RefID, job.Actor, idea.Title, idea.Content, idea.Tags)
+		if err != nil {
+			return err
+		}
+		log.Printf("Generated research for postponed idea %s: %s", job.RefID, path)
+		return nil
+
+	case JobNarrate:
+		if s.narrator == nil {
+			return nil
+		}
+		result, err := s.narrator.Update(ctx)
+		if err != nil {
+			return err
+		}
+		log.Printf("Postponed journal narration: processed %d entries", result.ProcessedCount)
+		return nil
+	}
+
+	log.Printf("Dropping postponed job %d of unknown kind %q", job.ID, job.Kind)
+	return nil
+}
@@ -0,0 +1,67 @@
+package scheduler
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mrwolf/brain-server/internal/db"
+	"github.com/mrwolf/brain-server/internal/llm"
+	"github.com/mrwolf/brain-server/internal/llm/llmtest"
+	"github.com/mrwolf/brain-server/internal/vault"
+)
+
+func TestResumePostponed(t *testing.T) {
+	fake := llmtest.NewServer(t).On(`Expand on this idea`, "## Questions\n\n- Who would use it?")
+	fake.SetDown(true)
+
+	tmpDir := t.TempDir()
+	database, err := db.Open(filepath.Join(tmpDir, "test.db"))
+	if err != nil {
+		t.Fatalf("opening database: %v", err)
+	}
+	defer database.Close()
+
+	client := fake.LLM()
+	client.SetBreaker(llm.NewBreaker(1, time.Hour))
+	s, err := New(database, vault.NewVault(filepath.Join(tmpDir, "vault")), client, Config{Timezone: "UTC"})
+	if err != nil {
+		t.Fatalf("creating scheduler: %v", err)
+	}
+
+	if err := PostponeIdeaExpansion(database, "cap_idea", "wolf", "Rain-powered clock", "A clock that runs on rain", []string{"gadgets"}); err != nil {
+		t.Fatalf("PostponeIdeaExpansion: %v", err)
+	}
+
+	// Backend down: the health check opens the breaker and the job waits
+	s.healthCheck()
+	if client.Available() {
+		t.Fatal("breaker still closed after a failed health check")
+	}
+	if n, _ := database.CountPostponedJobs(); n != 1 {
+		t.Fatalf("postponed jobs = %d, want 1", n)
+	}
+
+	// Backend back: the next health check runs the job
+	fake.SetDown(false)
+	s.healthCheck()
+	if n, _ := database.CountPostponedJobs(); n != 0 {
+		t.Errorf("postponed jobs after recovery = %d, want 0", n)
+	}
+
+	matches, _ := filepath.Glob(filepath.Join(tmpDir, "vault", "Research", "Ideas", "*-research.md"))
+	if len(matches) != 1 {
+		t.Fatalf("research files = %v, want 1", matches)
+	}
+	data, _ := os.ReadFile(matches[0])
+	if got := string(data); !strings.Contains(got, "Who would use it?") || !strings.Contains(got, "cap_idea") {
+		t.Errorf("research file:\n%s", got)
+	}
+
+	calls := fake.CallsMatching(`tags: gadgets`)
+	if len(calls) != 1 {
+		t.Errorf("expansion prompts with the idea's tags = %d, want 1", len(calls))
+	}
+}
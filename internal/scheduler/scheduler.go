@@ -8,11 +8,14 @@ import (
 
 	"github.com/go-co-op/gocron/v2"
 	"github.com/mrwolf/brain-server/internal/db"
+	"github.com/mrwolf/brain-server/internal/embeddings"
 	"github.com/mrwolf/brain-server/internal/llm"
+	"github.com/mrwolf/brain-server/internal/medication"
 	"github.com/mrwolf/brain-server/internal/models"
 	"github.com/mrwolf/brain-server/internal/signals"
 	"github.com/mrwolf/brain-server/internal/vault"
 	"github.com/mrwolf/brain-server/internal/narrator"
+	"github.com/mrwolf/brain-server/internal/prompts"
 )
 
 // Scheduler manages scheduled jobs
@@ -23,14 +26,17 @@ type Scheduler struct {
 	llm       *llm.Client
 	letterGen *LetterGenerator
 	timezone  *time.Location
-	actors    []string
 	narrator  *narrator.Narrator
+	meds      *medication.Tracker
+	embedder  *embeddings.Embedder
+	ideas     *IdeaExpander
+	auditDays int
 }
 
 // Config holds scheduler configuration
 type Config struct {
-	Timezone string
-	Actors   []string
+	Timezone           string
+	AuditRetentionDays int // 0 keeps the audit log forever
 }
 
 // New creates a new scheduler
@@ -52,7 +58,10 @@ func New(database *db.DB, v *vault.Vault, llmClient *llm.Client, cfg Config) (*S
 		llm:       llmClient,
 		letterGen: NewLetterGenerator(llmClient, database),
 		timezone:  tz,
-		actors:    cfg.Actors,
+		meds:      medication.NewTracker(database, tz),
+		embedder:  embeddings.NewEmbedder(llmClient, database),
+		ideas:     NewIdeaExpander(llmClient, v),
+		auditDays: cfg.AuditRetentionDays,
 	}, nil
 }
 
@@ -98,7 +107,28 @@ func (s *Scheduler) Start() error {
 		return err
 	}
 
-	// Health check Ollama every 5 minutes
+	// Mark missed medication doses every 30 minutes
+	_, err = s.scheduler.NewJob(
+		gocron.DurationJob(30*time.Minute),
+		gocron.NewTask(s.checkMissedDoses),
+		gocron.WithName("medication-check"),
+	)
+	if err != nil {
+		return err
+	}
+
+	// Embed new documents, and re-embed everything after a model change, every 15 minutes
+	_, err = s.scheduler.NewJob(
+		gocron.DurationJob(15*time.Minute),
+		gocron.NewTask(s.embedDocuments),
+		gocron.WithName("embed-index"),
+		gocron.WithSingletonMode(gocron.LimitModeReschedule),
+	)
+	if err != nil {
+		return err
+	}
+
+	// Health check the LLM provider every 5 minutes, resuming postponed work once it is up
 	_, err = s.scheduler.NewJob(
 		gocron.DurationJob(5*time.Minute),
 		gocron.NewTask(s.healthCheck),
@@ -108,6 +138,18 @@ func (s *Scheduler) Start() error {
 		return err
 	}
 
+	// Drop audit entries past the retention period at 04:30
+	if s.auditDays > 0 {
+		_, err = s.scheduler.NewJob(
+			gocron.DailyJob(1, gocron.NewAtTimes(gocron.NewAtTime(4, 30, 0))),
+			gocron.NewTask(s.pruneAudit),
+			gocron.WithName("prune-audit"),
+		)
+		if err != nil {
+			return err
+		}
+	}
+
 	s.scheduler.Start()
 	log.Println("Scheduler started")
 	return nil
@@ -123,21 +165,50 @@ func (s *Scheduler) generateDailyLetters() {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
 	defer cancel()
 
-	for _, actor := range s.actors {
+	for _, actor := range s.activeActors() {
 		s.generateDailyLetterForActor(ctx, actor)
 	}
 }
 
+// activeActors returns the users per-actor jobs run for (none if they can't be loaded)
+func (s *Scheduler) activeActors() []string {
+	actors, err := s.db.GetActiveUserIDs()
+	if err != nil {
+		log.Printf("Error loading users: %v", err)
+		return nil
+	}
+	return actors
+}
+
 func (s *Scheduler) generateDailyLetterForActor(ctx context.Context, actor string) {
 	now := time.Now().In(s.timezone)
 
 	// Use signal-based letter generation
-	content, err := s.letterGen.GenerateDailyLetter(ctx, actor, now)
+	letter, err := s.letterGen.GenerateDailyLetter(ctx, actor, now)
 	if err != nil {
 		log.Printf("Error generating daily letter for %s: %v", actor, err)
 		return
 	}
 
+	s.saveDailyLetter(actor, now, letter)
+}
+
+// StreamDailyLetter generates today's daily letter on demand, passing text to onChunk
+// as it is generated, then saves it like the scheduled letter. Returns the saved letter.
+func (s *Scheduler) StreamDailyLetter(ctx context.Context, actor string, onChunk func(string) error) (string, error) {
+	now := time.Now().In(s.timezone)
+
+	letter, err := s.letterGen.StreamDailyLetter(ctx, actor, now, onChunk)
+	if err != nil {
+		return "", err
+	}
+	return s.saveDailyLetter(actor, now, letter), nil
+}
+
+// saveDailyLetter validates the letter and writes it to the vault and database, returning the content written
+func (s *Scheduler) saveDailyLetter(actor string, now time.Time, generated Generated) string {
+	content := generated.Text
+
 	// Validate letter content
 	validation := signals.ValidateLetter(content, true)
 	if !validation.Valid {
@@ -156,17 +227,19 @@ func (s *Scheduler) generateDailyLetterForActor(ctx context.Context, actor strin
 		ForDate: today,
 		Actor:   actor,
 		Content: content,
+		Prompt:  generated.Prompt,
 	}
 
 	path, err := s.vault.WriteLetter(letter)
 	if err != nil {
 		log.Printf("Error writing daily letter for %s: %v", actor, err)
-		return
+		return content
 	}
 
 	// Record in database
 	s.db.SaveLetter(letterID, "daily", today, path)
 	log.Printf("Generated daily letter for %s: %s", actor, path)
+	return content
 }
 
 func (s *Scheduler) generateWeeklyLetters() {
@@ -174,7 +247,7 @@ func (s *Scheduler) generateWeeklyLetters() {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
 	defer cancel()
 
-	for _, actor := range s.actors {
+	for _, actor := range s.activeActors() {
 		s.generateWeeklyLetterForActor(ctx, actor)
 	}
 }
@@ -183,11 +256,12 @@ func (s *Scheduler) generateWeeklyLetterForActor(ctx context.Context, actor stri
 	now := time.Now().In(s.timezone)
 
 	// Use signal-based letter generation
-	content, err := s.letterGen.GenerateWeeklyLetter(ctx, actor, now)
+	generated, err := s.letterGen.GenerateWeeklyLetter(ctx, actor, now)
 	if err != nil {
 		log.Printf("Error generating weekly letter for %s: %v", actor, err)
 		return
 	}
+	content := generated.Text
 
 	// Validate letter content
 	validation := signals.ValidateLetter(content, false)
@@ -207,6 +281,7 @@ func (s *Scheduler) generateWeeklyLetterForActor(ctx context.Context, actor stri
 		ForDate: weekStr,
 		Actor:   actor,
 		Content: content,
+		Prompt:  generated.Prompt,
 	}
 
 	path, err := s.vault.WriteLetter(letter)
@@ -238,13 +313,66 @@ func (s *Scheduler) expirePending() {
 	}
 }
 
+func (s *Scheduler) pruneAudit() {
+	before := time.Now().AddDate(0, 0, -s.auditDays)
+	pruned, err := s.db.PruneAudit(before)
+	if err != nil {
+		log.Printf("Error pruning audit log: %v", err)
+	}
+	vaultPruned, err := s.vault.PruneAuditLog(before)
+	if err != nil {
+		log.Printf("Error pruning vault audit log: %v", err)
+	}
+	if pruned > 0 || vaultPruned > 0 {
+		log.Printf("Pruned %d audit entries (%d from the vault) older than %d days", pruned, vaultPruned, s.auditDays)
+	}
+}
+
+func (s *Scheduler) checkMissedDoses() {
+	missed, err := s.meds.CheckMissed(time.Now())
+	if err != nil {
+		log.Printf("Error checking missed doses: %v", err)
+	}
+	for _, d := range missed {
+		log.Printf("Missed dose for %s: %s at %s", d.Actor, d.MedID, d.ScheduledFor.In(s.timezone).Format("2006-01-02 15:04"))
+	}
+}
+
+// embedDocuments works through unembedded documents in batches until done or out of time
+func (s *Scheduler) embedDocuments() {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+
+	total := 0
+	for {
+		n, err := s.embedder.Backfill(ctx, 50)
+		total += n
+		if err != nil {
+			log.Printf("Error embedding documents (%d done): %v", total, err)
+			return
+		}
+		if n == 0 {
+			break
+		}
+	}
+	if total > 0 {
+		log.Printf("Embedded %d documents with %s", total, s.embedder.Model())
+	}
+}
+
 func (s *Scheduler) healthCheck() {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
+	// The result feeds the circuit breaker, so a failure also defers LLM work until recovery
 	if err := s.llm.HealthCheck(ctx); err != nil {
-		log.Printf("Health check failed - Ollama unreachable: %v", err)
+		log.Printf("Health check failed - %s unreachable, LLM work deferred: %v", s.llm.ProviderName(), err)
+		return
 	}
+
+	resumeCtx, resumeCancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer resumeCancel()
+	s.resumePostponed(resumeCtx)
 }
 
 func (s *Scheduler) decaySignals() {
@@ -295,6 +423,12 @@ func (s *Scheduler) SetNarrator(n *narrator.Narrator) {
 	s.narrator = n
 }
 
+// SetPrompts sets where the letter and idea expansion prompt templates are loaded from
+func (s *Scheduler) SetPrompts(store *prompts.Store) {
+	s.letterGen.SetPrompts(store)
+	s.ideas.SetPrompts(store)
+}
+
 // AddNarratorJob adds the nightly journal narration job
 func (s *Scheduler) AddNarratorJob() error {
 	if s.narrator == nil {
@@ -320,6 +454,14 @@ func (s *Scheduler) narrateJournal() {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
 	defer cancel()
 
+	// The day is still closed; its remaining entries are narrated once the backend recovers
+	if !s.llm.Available() {
+		log.Println("LLM backend unavailable, postponing journal narration")
+		if err := PostponeNarration(s.db); err != nil {
+			log.Printf("Failed to postpone journal narration: %v", err)
+		}
+	}
+
 	if err := s.narrator.NightlyClose(ctx); err != nil {
 		log.Printf("Journal narrator failed: %v", err)
 	} else {
@@ -0,0 +1,217 @@
+package search
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/mrwolf/brain-server/internal/db"
+	"github.com/mrwolf/brain-server/internal/embeddings"
+	"github.com/mrwolf/brain-server/internal/models"
+	"github.com/mrwolf/brain-server/internal/vault"
+)
+
+// categoryFolders are the vault folders holding classified notes
+var categoryFolders = []string{
+	models.CategoryIdeas,
+	models.CategoryProjects,
+	models.CategoryFinancial,
+	models.CategoryHealth,
+	models.CategoryLife,
+	models.CategorySpirituality,
+	models.CategoryTasks,
+}
+
+// Index feeds vault writes into the database search index
+type Index struct {
+	db       *db.DB
+	embedder *embeddings.Embedder // optional, embeds new documents as they are written
+	readFile func(path string) ([]byte, error)
+}
+
+// NewIndex creates a new search index
+func NewIndex(database *db.DB) *Index {
+	return &Index{db: database, readFile: os.ReadFile}
+}
+
+// SetReader sets how Reindex reads vault files, e.g. vault.ReadFile to decrypt them
+func (i *Index) SetReader(readFile func(path string) ([]byte, error)) {
+	i.readFile = readFile
+}
+
+// SetEmbedder enables embedding of documents as they are indexed
+func (i *Index) SetEmbedder(embedder *embeddings.Embedder) {
+	i.embedder = embedder
+}
+
+// IndexDocument implements vault.Indexer
+// The embedding is computed asynchronously (fail closed - the embed job retries later).
+func (i *Index) IndexDocument(doc vault.Document) error {
+	searchDoc, err := i.index(doc)
+	if err != nil {
+		return err
+	}
+	if i.embedder != nil && !i.db.Unindexed(doc.Category, doc.Path) {
+		go i.embed(searchDoc)
+	}
+	return nil
+}
+
+func (i *Index) index(doc vault.Document) (db.SearchDoc, error) {
+	searchDoc := db.SearchDoc{
+		DocID:    doc.ID,
+		Kind:     doc.Kind,
+		Actor:    doc.Actor,
+		Category: doc.Category,
+		Created:  doc.Created,
+		Path:     doc.Path,
+		Title:    doc.Title,
+		Body:     doc.Body,
+	}
+	return searchDoc, i.db.IndexSearchDoc(searchDoc)
+}
+
+func (i *Index) embed(doc db.SearchDoc) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	if err := i.embedder.EmbedDocument(ctx, doc); err != nil {
+		log.Printf("Failed to embed %s %s: %v", doc.Kind, doc.DocID, err)
+	}
+}
+
+// Reindex walks the vault and indexes notes, raw journal captures and research
+// files written before the index existed. Returns the number of files indexed.
+// Embeddings are left to the embed job rather than computed inline.
+func (i *Index) Reindex(vaultPath string) (int, error) {
+	count := 0
+
+	index := func(relDir, kind, category string) error {
+		files, err := filepath.Glob(filepath.Join(vaultPath, relDir, "*.md"))
+		if err != nil {
+			return err
+		}
+		for _, path := range files {
+			doc, err := i.readDocument(vaultPath, path)
+			if err != nil {
+				return fmt.Errorf("reading %s: %w", path, err)
+			}
+			doc.Kind = kind
+			if kind == db.DocJournal {
+				doc.Title = "" // raw captures are untitled; the filename is just a timestamp
+			}
+			if doc.Category == "" {
+				doc.Category = category
+			}
+			if _, err := i.index(doc); err != nil {
+				return fmt.Errorf("indexing %s: %w", path, err)
+			}
+			count++
+		}
+		return nil
+	}
+
+	for _, category := range categoryFolders {
+		if err := index(category, db.DocNote, category); err != nil {
+			return count, err
+		}
+	}
+	if err := index(filepath.Join("Journal", "Raw"), db.DocJournal, models.CategoryJournal); err != nil {
+		return count, err
+	}
+	if err := index(filepath.Join("Research", "Ideas"), db.DocResearch, models.CategoryIdeas); err != nil {
+		return count, err
+	}
+
+	return count, nil
+}
+
+// readDocument parses a vault markdown file with YAML frontmatter
+func (i *Index) readDocument(vaultPath, path string) (vault.Document, error) {
+	data, err := i.readFile(path)
+	if err != nil {
+		return vault.Document{}, err
+	}
+
+	relPath, _ := filepath.Rel(vaultPath, path)
+	doc := vault.Document{Path: relPath}
+
+	var body strings.Builder
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	inFrontmatter := false
+	lineNum := 0
+	for scanner.Scan() {
+		line := scanner.Text()
+		lineNum++
+
+		if lineNum == 1 && line == "---" {
+			inFrontmatter = true
+			continue
+		}
+		if inFrontmatter {
+			if line == "---" {
+				inFrontmatter = false
+				continue
+			}
+			key, value, ok := strings.Cut(line, ":")
+			if !ok {
+				continue
+			}
+			value = strings.TrimSpace(value)
+			switch strings.TrimSpace(key) {
+			case "id":
+				doc.ID = value
+			case "actor":
+				doc.Actor = value
+			case "category":
+				if value != "" {
+					doc.Category = strings.ToUpper(value[:1]) + value[1:]
+				}
+			case "created":
+				doc.Created, _ = time.Parse(time.RFC3339, value)
+			}
+			continue
+		}
+
+		if doc.Title == "" && strings.HasPrefix(line, "# ") {
+			doc.Title = strings.TrimPrefix(line, "# ")
+			continue
+		}
+		body.WriteString(line)
+		body.WriteString("\n")
+	}
+	if err := scanner.Err(); err != nil {
+		return vault.Document{}, err
+	}
+
+	if doc.ID == "" {
+		doc.ID = strings.TrimSuffix(filepath.Base(path), ".md")
+	}
+	if doc.Created.IsZero() {
+		if info, err := os.Stat(path); err == nil {
+			doc.Created = info.ModTime()
+		}
+	}
+	if doc.Title == "" {
+		doc.Title = titleFromFilename(filepath.Base(path))
+	}
+	doc.Body = strings.TrimSpace(body.String())
+	return doc, nil
+}
+
+// titleFromFilename turns "2024-01-15-raised-beds.md" into "raised beds"
+func titleFromFilename(name string) string {
+	name = strings.TrimSuffix(name, ".md")
+	if len(name) > 11 && name[4] == '-' && name[7] == '-' {
+		name = name[11:]
+	}
+	name = strings.TrimSuffix(name, "-research")
+	return strings.ReplaceAll(name, "-", " ")
+}
@@ -0,0 +1,127 @@
+package search
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mrwolf/brain-server/internal/db"
+	"github.com/mrwolf/brain-server/internal/vault"
+)
+
+func setupTestDB(t *testing.T) (*db.DB, func()) {
+	t.Helper()
+
+	tmpFile, err := os.CreateTemp("", "brain-search-test-*.db")
+	if err != nil {
+		t.Fatalf("creating temp file: %v", err)
+	}
+	tmpFile.Close()
+
+	database, err := db.Open(tmpFile.Name())
+	if err != nil {
+		os.Remove(tmpFile.Name())
+		t.Fatalf("opening database: %v", err)
+	}
+
+	cleanup := func() {
+		database.Close()
+		os.Remove(tmpFile.Name())
+	}
+
+	return database, cleanup
+}
+
+func TestVaultWritesAreIndexed(t *testing.T) {
+	database, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	v := vault.NewVault(t.TempDir())
+	v.SetIndexer(NewIndex(database))
+
+	created := time.Date(2024, 5, 1, 9, 0, 0, 0, time.UTC)
+	if _, err := v.WriteNote(vault.Note{ID: "cap_n1", Created: created, Category: "Ideas", Actor: "wolf", Title: "Raised beds", Content: "Build cedar raised beds for the garden"}); err != nil {
+		t.Fatalf("writing note: %v", err)
+	}
+	if _, err := v.WriteRawJournalCapture(vault.Note{ID: "cap_j1", Created: created, Actor: "wolf", Content: "Quiet evening in the garden"}); err != nil {
+		t.Fatalf("writing journal: %v", err)
+	}
+
+	hits, err := database.Search(db.SearchQuery{Text: "garden", Actor: "wolf"})
+	if err != nil {
+		t.Fatalf("search: %v", err)
+	}
+	if len(hits) != 2 {
+		t.Fatalf("expected 2 hits, got %+v", hits)
+	}
+
+	hits, _ = database.Search(db.SearchQuery{Text: "garden", Actor: "wolf", Kind: db.DocJournal})
+	if len(hits) != 1 || hits[0].DocID != "cap_j1" {
+		t.Errorf("expected journal hit cap_j1, got %+v", hits)
+	}
+}
+
+func TestReindex(t *testing.T) {
+	database, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	// Files written without an indexer, as before search existed
+	vaultPath := t.TempDir()
+	v := vault.NewVault(vaultPath)
+	created := time.Date(2024, 5, 1, 9, 0, 0, 0, time.UTC)
+	v.WriteNote(vault.Note{ID: "cap_n1", Created: created, Category: "Health", Actor: "wife", Title: "Knee physio", Content: "Physio exercises twice daily"})
+	research := "---\nid: cap_i1_research\nsource_idea: cap_i1\ncreated: 2024-05-01T09:00:00Z\n---\n\n# Research: Solar roof\n\nPayback period questions\n"
+	os.MkdirAll(filepath.Join(vaultPath, "Research", "Ideas"), 0755)
+	os.WriteFile(filepath.Join(vaultPath, "Research", "Ideas", "2024-05-01-solar-roof-research.md"), []byte(research), 0644)
+
+	index := NewIndex(database)
+	n, err := index.Reindex(vaultPath)
+	if err != nil {
+		t.Fatalf("reindex: %v", err)
+	}
+	if n != 2 {
+		t.Errorf("expected 2 files indexed, got %d", n)
+	}
+
+	hits, _ := database.Search(db.SearchQuery{Text: "physio"})
+	if len(hits) != 1 || hits[0].Actor != "wife" || hits[0].Category != "Health" || hits[0].Title != "knee physio" {
+		t.Errorf("unexpected note hit: %+v", hits)
+	}
+
+	hits, _ = database.Search(db.SearchQuery{Text: "solar", Kind: db.DocResearch})
+	if len(hits) != 1 || hits[0].DocID != "cap_i1_research" || hits[0].Title != "Research: Solar roof" {
+		t.Errorf("unexpected research hit: %+v", hits)
+	}
+
+	// Running again replaces rather than duplicates
+	index.Reindex(vaultPath)
+	if count, _ := database.CountSearchDocs(db.DocNote); count != 1 {
+		t.Errorf("expected 1 note after second reindex, got %d", count)
+	}
+}
+
+func TestReindexEncrypted(t *testing.T) {
+	database, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	key, _ := vault.GenerateKey()
+	keys, _ := vault.ParseKeys("wife=" + key)
+	vaultPath := t.TempDir()
+	v := vault.NewVault(vaultPath)
+	v.SetEncryption(keys, []string{"Health"})
+	created := time.Date(2024, 5, 1, 9, 0, 0, 0, time.UTC)
+	if _, err := v.WriteNote(vault.Note{ID: "cap_n1", Created: created, Category: "Health", Actor: "wife", Title: "Knee physio", Content: "Physio exercises twice daily"}); err != nil {
+		t.Fatalf("writing note: %v", err)
+	}
+
+	index := NewIndex(database)
+	index.SetReader(v.ReadFile)
+	if _, err := index.Reindex(vaultPath); err != nil {
+		t.Fatalf("reindex: %v", err)
+	}
+	hits, _ := database.Search(db.SearchQuery{Text: "physio"})
+	if len(hits) != 1 || hits[0].Actor != "wife" || hits[0].Title != "knee physio" {
+		t.Errorf("unexpected hit from encrypted note: %+v", hits)
+	}
+}
@@ -2,6 +2,7 @@ package signals
 
 import (
 	"math"
+	"strings"
 	"testing"
 	"time"
 
@@ -676,3 +677,80 @@ func TestIsStopword(t *testing.T) {
 		}
 	}
 }
+
+func TestFormatMoodChart(t *testing.T) {
+	seven := 7.0
+	three := 3.0
+	days := []db.MoodDay{
+		{Date: "2026-10-12", Valence: &seven, Energy: &three, Count: 2},
+		{Date: "2026-10-13", Valence: nil, Energy: nil, Rating: &seven, Count: 1},
+	}
+
+	chart := FormatMoodChart(days)
+
+	if !strings.Contains(chart, "Mon 10-12") {
+		t.Errorf("chart missing day label: %s", chart)
+	}
+	if !strings.Contains(chart, "███████···  7.0") {
+		t.Errorf("chart missing valence bar: %s", chart)
+	}
+	if !strings.Contains(chart, "n/a") {
+		t.Errorf("chart should mark missing scores as n/a: %s", chart)
+	}
+	if !strings.Contains(chart, "rated 7.0") {
+		t.Errorf("chart missing explicit rating: %s", chart)
+	}
+}
+
+func TestBuildTrendDataSharing(t *testing.T) {
+	database, err := db.Open(t.TempDir() + "/brain.db")
+	if err != nil {
+		t.Fatalf("opening database: %v", err)
+	}
+	defer database.Close()
+	database.CreateUser("wolf", "Wolf")
+	database.CreateUser("wife", "Wife")
+
+	database.LogCapture("cap_own", "wife", "note", "Book the piano lesson", "Life", "filed", 0.9)
+	database.LogCapture("cap_shared", "wolf", "note", "Plan the garden party", "Ideas", "filed", 0.9)
+	database.LogCapture("cap_private", "wolf", "note", "Surprise gift for the anniversary", "Ideas", "filed", 0.9)
+	database.LogCapture("cap_budget", "wolf", "note", "Shared grocery budget", "Financial", "filed", 0.9)
+	database.SetSharing("cap_shared", "wolf", db.Sharing{Visibility: db.VisibilityHousehold})
+	database.SetSharing("cap_budget", "wolf", db.Sharing{With: []string{"wife"}})
+
+	tests := []struct {
+		name   string
+		build  func(*db.DB, string, time.Time) (*TrendData, error)
+		format func(*TrendData) string
+		shared int
+	}{
+		{"daily", BuildTrendData, FormatTrendContext, 2},
+		{"weekly excludes Financial", BuildWeeklyTrendData, FormatWeeklyContext, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			trend, err := tt.build(database, "wife", time.Now().Add(time.Minute))
+			if err != nil {
+				t.Fatalf("building trend data: %v", err)
+			}
+			if len(trend.Shared) != tt.shared {
+				t.Errorf("shared captures = %+v, want %d", trend.Shared, tt.shared)
+			}
+			count := 0
+			for _, day := range trend.Days {
+				count += day.CaptureCount
+			}
+			if count != 1 {
+				t.Errorf("own captures = %d, want 1 (shared ones are listed separately)", count)
+			}
+
+			context := tt.format(trend)
+			if !strings.Contains(context, "SHARED WITH YOU") || !strings.Contains(context, "garden party") {
+				t.Errorf("context is missing the shared capture:\n%s", context)
+			}
+			if strings.Contains(context, "anniversary") {
+				t.Errorf("private capture leaked into the context:\n%s", context)
+			}
+		})
+	}
+}
@@ -32,6 +32,16 @@ type TrendData struct {
 	RecurringTerms []string          // Terms appearing 3+ days
 	MomentumShifts []string          // Notable changes: "Projects went quiet since Tuesday"
 	DominantTheme  string            // Overall theme across the week
+	Mood           []db.MoodDay      // Daily mood averages, oldest first
+	Shared         []SharedCapture   // Captures other users shared with the actor, most recent first
+}
+
+// SharedCapture is another user's capture shared with the actor
+type SharedCapture struct {
+	Actor    string
+	Category string
+	Date     string
+	Text     string // truncated
 }
 
 // BuildTrendData analyzes captures over the past 7 days (all categories)
@@ -123,6 +133,32 @@ func buildTrendDataWithFilter(database *db.DB, actor string, now time.Time, excl
 	// Determine dominant theme
 	trend.DominantTheme = detectDominantTheme(trend)
 
+	// Mood time series for the same window (missing mood data doesn't fail the trend)
+	if mood, err := database.GetMoodDaily(actor, since, now.Add(time.Minute), now.Location()); err == nil {
+		trend.Mood = mood
+	}
+
+	// What others shared with the actor; their private captures are never read
+	shared, err := database.GetSharedCaptures(actor, since)
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range shared {
+		category := c.RoutedTo
+		if category == "" {
+			category = "Uncategorized"
+		}
+		if excludeCategories != nil && excludeCategories[category] {
+			continue
+		}
+		trend.Shared = append(trend.Shared, SharedCapture{
+			Actor:    c.Actor,
+			Category: category,
+			Date:     c.CreatedAt.Format("2006-01-02"),
+			Text:     truncateText(c.RawText, 60),
+		})
+	}
+
 	return trend, nil
 }
 
@@ -272,6 +308,8 @@ func FormatTrendContext(trend *TrendData) string {
 		sb.WriteString(fmt.Sprintf("\nRECURRING THEMES (3+ days): %s\n", strings.Join(terms, ", ")))
 	}
 
+	writeShared(&sb, trend.Shared, 5)
+
 	sb.WriteString(fmt.Sprintf("\nOVERALL: %s\n", trend.DominantTheme))
 
 	return sb.String()
@@ -368,6 +406,14 @@ func FormatWeeklyContext(trend *TrendData) string {
 		sb.WriteString(fmt.Sprintf("\nRECURRING TERMS: %s\n", strings.Join(terms, ", ")))
 	}
 
+	writeShared(&sb, trend.Shared, 10)
+
+	// Mood chart
+	if len(trend.Mood) > 0 {
+		sb.WriteString("\n")
+		sb.WriteString(FormatMoodChart(trend.Mood))
+	}
+
 	// Absent categories
 	var absent []string
 	for _, cat := range []string{"Ideas", "Projects", "Health", "Life", "Spirituality"} {
@@ -382,6 +428,53 @@ func FormatWeeklyContext(trend *TrendData) string {
 	return sb.String()
 }
 
+// writeShared lists up to limit captures shared by other users
+func writeShared(sb *strings.Builder, shared []SharedCapture, limit int) {
+	if len(shared) == 0 {
+		return
+	}
+	if len(shared) > limit {
+		shared = shared[:limit]
+	}
+	sb.WriteString("\nSHARED WITH YOU:\n")
+	for _, c := range shared {
+		sb.WriteString(fmt.Sprintf("  %s (%s, %s): \"%s\"\n", c.Actor, c.Category, c.Date, c.Text))
+	}
+}
+
+// FormatMoodChart renders daily mood averages as a text chart (1-10 scales)
+func FormatMoodChart(days []db.MoodDay) string {
+	var sb strings.Builder
+	sb.WriteString("MOOD OVER THE WEEK (daily averages, 1-10):\n")
+	for _, d := range days {
+		label := d.Date
+		if t, err := time.Parse("2006-01-02", d.Date); err == nil {
+			label = t.Format("Mon 01-02")
+		}
+		sb.WriteString(fmt.Sprintf("  %s  valence %s  energy %s", label, moodBar(d.Valence), moodBar(d.Energy)))
+		if d.Rating != nil {
+			sb.WriteString(fmt.Sprintf("  rated %.1f", *d.Rating))
+		}
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
+
+// moodBar draws a 10-cell bar with the value, or n/a when missing
+func moodBar(v *float64) string {
+	if v == nil {
+		return strings.Repeat("·", 10) + "  n/a"
+	}
+	filled := int(*v + 0.5)
+	if filled < 0 {
+		filled = 0
+	}
+	if filled > 10 {
+		filled = 10
+	}
+	return strings.Repeat("█", filled) + strings.Repeat("·", 10-filled) + fmt.Sprintf(" %4.1f", *v)
+}
+
 func truncateText(s string, maxLen int) string {
 	s = strings.TrimSpace(s)
 	if len(s) <= maxLen {
@@ -0,0 +1,202 @@
+package vault
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Folders with files that mix several actors' entries; they are handled by their
+// owners (the capture and audit logs, narrated journal days), not by ActorFiles
+var sharedFolders = []string{"Log", filepath.Join("Journal", "Daily"), filepath.Join("Journal", "_meta")}
+
+// ActorFiles returns the vault-relative paths of the markdown files that belong to
+// actor: notes, raw journal entries and letters with the actor in their frontmatter,
+// and research written for one of captureIDs. Encrypted files are read with the
+// keyring, so it must hold a key for each of them.
+func (v *Vault) ActorFiles(actor string, captureIDs map[string]bool) ([]string, error) {
+	var files []string
+	err := filepath.WalkDir(v.basePath, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(v.basePath, path)
+		if d.IsDir() {
+			if rel != "." && (strings.HasPrefix(d.Name(), ".") || containsPath(sharedFolders, rel)) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if filepath.Ext(path) != ".md" {
+			return nil
+		}
+
+		content, err := v.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		owner := frontmatterValue(content, "actor")
+		if owner == actor || (owner == "" && captureIDs[frontmatterValue(content, "source_idea")]) {
+			files = append(files, rel)
+		}
+		return nil
+	})
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	return files, err
+}
+
+func containsPath(paths []string, path string) bool {
+	for _, p := range paths {
+		if p == path {
+			return true
+		}
+	}
+	return false
+}
+
+// frontmatterValue returns a top-level field of a markdown file's frontmatter
+func frontmatterValue(content []byte, key string) string {
+	if !bytes.HasPrefix(content, []byte("---\n")) {
+		return ""
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(content[4:]))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "---" {
+			break
+		}
+		if value, ok := strings.CutPrefix(line, key+":"); ok {
+			return strings.TrimSpace(value)
+		}
+	}
+	return ""
+}
+
+// ByActor matches JSONL lines whose "actor" field is actor
+func ByActor(actor string) func(line []byte) bool {
+	return func(line []byte) bool {
+		var entry struct {
+			Actor string `json:"actor"`
+		}
+		return json.Unmarshal(line, &entry) == nil && entry.Actor == actor
+	}
+}
+
+// SelectLines returns the lines of a vault JSONL file that match, or nil if the file
+// does not exist
+func (v *Vault) SelectLines(relPath string, match func(line []byte) bool) ([]byte, error) {
+	path := filepath.Join(v.basePath, relPath)
+	if lock := v.lockFor(path); lock != nil {
+		lock.Lock()
+		defer lock.Unlock()
+	}
+
+	data, err := v.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var selected bytes.Buffer
+	err = eachLine(data, func(line []byte) {
+		if match(line) {
+			selected.Write(line)
+			selected.WriteByte('\n')
+		}
+	})
+	return selected.Bytes(), err
+}
+
+// RewriteLines rewrites a vault JSONL file with each line replaced by what rewrite
+// returns for it, dropping lines it returns nil for, and returns how many lines
+// changed. An encrypted file stays encrypted for the same actors.
+func (v *Vault) RewriteLines(relPath string, rewrite func(line []byte) []byte) (int, error) {
+	path := filepath.Join(v.basePath, relPath)
+	if lock := v.lockFor(path); lock != nil {
+		lock.Lock()
+		defer lock.Unlock()
+	}
+
+	raw, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	data := raw
+	if IsEncrypted(raw) {
+		if data, err = v.keys.Open(raw); err != nil {
+			return 0, fmt.Errorf("decrypting %s: %w", filepath.Base(path), err)
+		}
+	}
+
+	var kept bytes.Buffer
+	changed := 0
+	err = eachLine(data, func(line []byte) {
+		out := rewrite(line)
+		if !bytes.Equal(out, line) {
+			changed++
+		}
+		if out != nil {
+			kept.Write(out)
+			kept.WriteByte('\n')
+		}
+	})
+	if err != nil || changed == 0 {
+		return 0, err
+	}
+
+	content := kept.Bytes()
+	if IsEncrypted(raw) {
+		if content, err = v.keys.Seal(content, sealedFor(raw)...); err != nil {
+			return 0, fmt.Errorf("encrypting %s: %w", filepath.Base(path), err)
+		}
+	}
+	if err := WriteFileAtomic(path, content); err != nil {
+		return 0, err
+	}
+	return changed, nil
+}
+
+// RemoveFile deletes a vault file; a file that is already gone is not an error
+func (v *Vault) RemoveFile(relPath string) error {
+	err := os.Remove(filepath.Join(v.basePath, relPath))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// lockFor returns the lock that guards appends to a vault log, or nil for other files
+func (v *Vault) lockFor(path string) *sync.Mutex {
+	switch {
+	case path == v.auditPath():
+		return &v.auditLock
+	case path == filepath.Join(v.basePath, "Log", "captures.jsonl"):
+		return &v.logLock
+	case filepath.Dir(path) == filepath.Join(v.basePath, "Financial", "Ledger"):
+		return &v.ledgerLock
+	}
+	return nil
+}
+
+func eachLine(data []byte, fn func(line []byte)) error {
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		if line := scanner.Bytes(); len(bytes.TrimSpace(line)) > 0 {
+			fn(line)
+		}
+	}
+	return scanner.Err()
+}
@@ -0,0 +1,87 @@
+package vault
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// AuditLog is one API action in Log/audit.jsonl
+type AuditLog struct {
+	TS       string   `json:"ts"`
+	Actor    string   `json:"actor"`
+	DeviceID string   `json:"device,omitempty"`
+	Method   string   `json:"method"`
+	Route    string   `json:"route"`
+	Targets  []string `json:"targets,omitempty"`
+	Status   int      `json:"status"`
+	Outcome  string   `json:"outcome"`
+	IP       string   `json:"ip,omitempty"`
+}
+
+func (v *Vault) auditPath() string {
+	// Path: Vault/Log/audit.jsonl
+	return filepath.Join(v.basePath, "Log", "audit.jsonl")
+}
+
+// LogAudit appends an entry to the audit log
+func (v *Vault) LogAudit(entry AuditLog) error {
+	v.auditLock.Lock()
+	defer v.auditLock.Unlock()
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("marshaling audit log: %w", err)
+	}
+	if err := v.appendLine(v.auditPath(), line); err != nil {
+		return fmt.Errorf("appending audit log: %w", err)
+	}
+	return nil
+}
+
+// PruneAuditLog rewrites the audit log without entries older than before,
+// returning how many were removed. Lines that don't parse are kept.
+func (v *Vault) PruneAuditLog(before time.Time) (int, error) {
+	v.auditLock.Lock()
+	defer v.auditLock.Unlock()
+
+	data, err := v.ReadFile(v.auditPath())
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("reading audit log: %w", err)
+	}
+
+	var kept bytes.Buffer
+	removed := 0
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		var entry AuditLog
+		if json.Unmarshal(line, &entry) == nil {
+			if ts, err := time.Parse(time.RFC3339, entry.TS); err == nil && ts.Before(before) {
+				removed++
+				continue
+			}
+		}
+		kept.Write(line)
+		kept.WriteByte('\n')
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, fmt.Errorf("reading audit log: %w", err)
+	}
+	if removed == 0 {
+		return 0, nil
+	}
+
+	if err := v.WriteFile(v.auditPath(), kept.Bytes()); err != nil {
+		return 0, fmt.Errorf("rewriting audit log: %w", err)
+	}
+	return removed, nil
+}
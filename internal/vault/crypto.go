@@ -0,0 +1,474 @@
+package vault
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Encrypted files start with a text header naming who can read them, then the
+// sealed content:
+//
+//	brain-encrypted/v1
+//	-> wolf <base64 nonce and file key sealed with wolf's key>
+//	---
+//	<nonce and content sealed with the file key, binary>
+//
+// Each file has its own random key, sealed for every recipient, so shared files
+// can be read by each of their actors. Everything is AES-256-GCM and the header
+// is authenticated with the content.
+const encryptedMagic = "brain-encrypted/v1\n"
+
+// KeySize is the length of an actor key in bytes
+const KeySize = 32
+
+// ErrNoKey is returned when a file is sealed for no actor in the keyring, or
+// written for an actor without a key
+var ErrNoKey = errors.New("no vault key")
+
+// Keyring holds the vault keys by actor
+type Keyring map[string][]byte
+
+// GenerateKey returns a new random key, base64 encoded as ParseKeys reads it
+func GenerateKey() (string, error) {
+	key := make([]byte, KeySize)
+	if _, err := rand.Read(key); err != nil {
+		return "", fmt.Errorf("generating key: %w", err)
+	}
+	return base64.StdEncoding.EncodeToString(key), nil
+}
+
+// ParseKeys reads comma-separated keys, e.g. "wolf=<base64>,wife=<base64>"
+func ParseKeys(s string) (Keyring, error) {
+	keys := make(Keyring)
+	for _, part := range strings.Split(s, ",") {
+		if err := keys.add(part); err != nil {
+			return nil, err
+		}
+	}
+	return keys, nil
+}
+
+// LoadKeyFile reads keys from a file with one actor=<base64> per line; blank lines
+// and lines starting with # are ignored
+func LoadKeyFile(path string) (Keyring, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading key file: %w", err)
+	}
+	keys := make(Keyring)
+	for _, line := range strings.Split(string(data), "\n") {
+		if strings.HasPrefix(strings.TrimSpace(line), "#") {
+			continue
+		}
+		if err := keys.add(line); err != nil {
+			return nil, err
+		}
+	}
+	return keys, nil
+}
+
+func (k Keyring) add(entry string) error {
+	entry = strings.TrimSpace(entry)
+	if entry == "" {
+		return nil
+	}
+	actor, encoded, ok := strings.Cut(entry, "=")
+	actor = strings.TrimSpace(actor)
+	if !ok || actor == "" {
+		return fmt.Errorf("invalid key entry: want actor=<base64 key>")
+	}
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil || len(key) != KeySize {
+		return fmt.Errorf("key for %s must be %d bytes, base64 encoded", actor, KeySize)
+	}
+	k[actor] = key
+	return nil
+}
+
+// Merge overlays other onto k
+func (k Keyring) Merge(other Keyring) Keyring {
+	merged := make(Keyring, len(k)+len(other))
+	for actor, key := range k {
+		merged[actor] = key
+	}
+	for actor, key := range other {
+		merged[actor] = key
+	}
+	return merged
+}
+
+// Actors returns the actors with keys, sorted
+func (k Keyring) Actors() []string {
+	actors := make([]string, 0, len(k))
+	for actor := range k {
+		actors = append(actors, actor)
+	}
+	sort.Strings(actors)
+	return actors
+}
+
+// withKeys returns the actors that have a key
+func (k Keyring) withKeys(actors []string) []string {
+	var keyed []string
+	for _, actor := range actors {
+		if _, ok := k[actor]; ok {
+			keyed = append(keyed, actor)
+		}
+	}
+	return keyed
+}
+
+// IsEncrypted reports whether data was written by Seal
+func IsEncrypted(data []byte) bool {
+	return bytes.HasPrefix(data, []byte(encryptedMagic))
+}
+
+// Seal encrypts plaintext so each of actors can open it; with no actors, everyone
+// in the keyring can
+func (k Keyring) Seal(plaintext []byte, actors ...string) ([]byte, error) {
+	if len(actors) == 0 {
+		actors = k.Actors()
+	}
+	if len(actors) == 0 {
+		return nil, ErrNoKey
+	}
+
+	fileKey := make([]byte, KeySize)
+	if _, err := rand.Read(fileKey); err != nil {
+		return nil, fmt.Errorf("generating file key: %w", err)
+	}
+
+	var header bytes.Buffer
+	header.WriteString(encryptedMagic)
+	seen := make(map[string]bool)
+	for _, actor := range actors {
+		if seen[actor] {
+			continue
+		}
+		seen[actor] = true
+		key, ok := k[actor]
+		if !ok {
+			return nil, fmt.Errorf("%w for %s", ErrNoKey, actor)
+		}
+		wrapped, err := seal(key, fileKey, []byte(encryptedMagic+actor))
+		if err != nil {
+			return nil, err
+		}
+		fmt.Fprintf(&header, "-> %s %s\n", actor, base64.StdEncoding.EncodeToString(wrapped))
+	}
+	header.WriteString("---\n")
+
+	body, err := seal(fileKey, plaintext, header.Bytes())
+	if err != nil {
+		return nil, err
+	}
+	return append(header.Bytes(), body...), nil
+}
+
+// Open decrypts data written by Seal with the key of any of its recipients
+func (k Keyring) Open(data []byte) ([]byte, error) {
+	if !IsEncrypted(data) {
+		return nil, fmt.Errorf("not an encrypted file")
+	}
+	end := bytes.Index(data, []byte("\n---\n"))
+	if end < 0 {
+		return nil, fmt.Errorf("encrypted file has no end of header")
+	}
+	header, body := data[:end+5], data[end+5:]
+
+	var recipients []string
+	var lastErr error
+	lines := strings.Split(strings.TrimSuffix(string(header[len(encryptedMagic):]), "\n---\n"), "\n")
+	for _, line := range lines {
+		fields := strings.Fields(line)
+		if len(fields) != 3 || fields[0] != "->" {
+			return nil, fmt.Errorf("malformed recipient line in encrypted file")
+		}
+		actor := fields[1]
+		recipients = append(recipients, actor)
+		key, ok := k[actor]
+		if !ok {
+			continue
+		}
+		wrapped, err := base64.StdEncoding.DecodeString(fields[2])
+		if err != nil {
+			lastErr = fmt.Errorf("malformed file key for %s", actor)
+			continue
+		}
+		fileKey, err := open(key, wrapped, []byte(encryptedMagic+actor))
+		if err != nil {
+			// a stale key for one recipient must not hide a good key for another
+			lastErr = fmt.Errorf("file key for %s: wrong key or corrupted file", actor)
+			continue
+		}
+		plaintext, err := open(fileKey, body, header)
+		if err != nil {
+			return nil, fmt.Errorf("decrypting: corrupted file")
+		}
+		return plaintext, nil
+	}
+	if lastErr != nil {
+		return nil, lastErr
+	}
+	return nil, fmt.Errorf("%w for any of %s", ErrNoKey, strings.Join(recipients, ", "))
+}
+
+// sealedTextPrefix marks text sealed by SealText
+const sealedTextPrefix = "sealed:"
+
+// SealText encrypts text for actor, or for everyone with a key when actor is
+// empty, as base64 for storing in a database column. Text for an actor without a
+// key is returned as is.
+func (k Keyring) SealText(text, actor string) (string, error) {
+	var actors []string
+	if actor != "" {
+		if actors = k.withKeys([]string{actor}); len(actors) == 0 {
+			return text, nil
+		}
+	}
+	sealed, err := k.Seal([]byte(text), actors...)
+	if err != nil {
+		return "", err
+	}
+	return sealedTextPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// IsSealedText reports whether text was written by SealText
+func (Keyring) IsSealedText(text string) bool {
+	return strings.HasPrefix(text, sealedTextPrefix)
+}
+
+// OpenText decrypts text sealed by SealText. Other text is returned as is.
+func (k Keyring) OpenText(text string) (string, error) {
+	encoded, ok := strings.CutPrefix(text, sealedTextPrefix)
+	if !ok {
+		return text, nil
+	}
+	sealed, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", fmt.Errorf("malformed sealed text")
+	}
+	plaintext, err := k.Open(sealed)
+	if err != nil {
+		return "", err
+	}
+	return string(plaintext), nil
+}
+
+// sealedFor returns the actors an encrypted file was sealed for
+func sealedFor(data []byte) []string {
+	end := bytes.Index(data, []byte("\n---\n"))
+	if !IsEncrypted(data) || end < 0 {
+		return nil
+	}
+	var actors []string
+	for _, line := range strings.Split(string(data[len(encryptedMagic):end]), "\n") {
+		if fields := strings.Fields(line); len(fields) == 3 && fields[0] == "->" {
+			actors = append(actors, fields[1])
+		}
+	}
+	return actors
+}
+
+// seal encrypts with AES-256-GCM, returning the nonce followed by the ciphertext
+func seal(key, plaintext, additional []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("generating nonce: %w", err)
+	}
+	return gcm.Seal(nonce, nonce, plaintext, additional), nil
+}
+
+func open(key, sealed, additional []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return nil, fmt.Errorf("sealed data too short")
+	}
+	return gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], additional)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("creating cipher: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
+
+// fileActors returns the actors a vault file belongs to: the actor in a markdown
+// file's frontmatter, or in every line of a JSONL file. Nil means the file is
+// shared or its owner is unknown.
+func fileActors(content []byte) []string {
+	if bytes.HasPrefix(content, []byte("---\n")) {
+		scanner := bufio.NewScanner(bytes.NewReader(content[4:]))
+		for scanner.Scan() {
+			line := scanner.Text()
+			if line == "---" {
+				break
+			}
+			if value, ok := strings.CutPrefix(line, "actor:"); ok {
+				if actor := strings.TrimSpace(value); actor != "" {
+					return []string{actor}
+				}
+			}
+		}
+		return nil
+	}
+
+	actor := ""
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var line struct {
+			Actor string `json:"actor"`
+		}
+		if json.Unmarshal(scanner.Bytes(), &line) != nil || line.Actor == "" || (actor != "" && line.Actor != actor) {
+			return nil
+		}
+		actor = line.Actor
+	}
+	if actor == "" {
+		return nil
+	}
+	return []string{actor}
+}
+
+// SetEncryption encrypts files written under the given top-level vault folders,
+// e.g. "Health", with their actors' keys (call before any writes). Encrypted files
+// are decrypted on read wherever they are.
+func (v *Vault) SetEncryption(keys Keyring, folders []string) {
+	v.keys = keys
+	v.encryptedFolders = make(map[string]bool, len(folders))
+	for _, f := range folders {
+		v.encryptedFolders[f] = true
+	}
+}
+
+// Encrypted reports whether files written to path are encrypted. The capture log
+// holds the raw text of captures filed to every folder, so it is encrypted whenever
+// any folder is.
+func (v *Vault) Encrypted(path string) bool {
+	rel, err := filepath.Rel(v.basePath, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return false
+	}
+	rel = filepath.ToSlash(rel)
+	if rel == "Log/captures.jsonl" {
+		return len(v.encryptedFolders) > 0
+	}
+	folder, _, _ := strings.Cut(rel, "/")
+	return v.encryptedFolders[folder]
+}
+
+// WriteFile writes content atomically, encrypted for actors (everyone with a key
+// when none are given) if path is in an encrypted folder. Actors without a key are
+// left off; when none of them has one the file is written unencrypted.
+func (v *Vault) WriteFile(path string, content []byte, actors ...string) error {
+	if v.Encrypted(path) {
+		recipients := v.keys.withKeys(actors)
+		if len(actors) > 0 && len(recipients) == 0 {
+			log.Printf("WARNING: No vault key for %s, writing %s unencrypted", strings.Join(actors, ", "), filepath.Base(path))
+			return WriteFileAtomic(path, content)
+		}
+		sealed, err := v.keys.Seal(content, recipients...)
+		if err != nil {
+			return fmt.Errorf("encrypting %s: %w", filepath.Base(path), err)
+		}
+		content = sealed
+	}
+	return WriteFileAtomic(path, content)
+}
+
+// ReadFile reads a vault file, decrypting it if it is encrypted
+func (v *Vault) ReadFile(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil || !IsEncrypted(data) {
+		return data, err
+	}
+	plaintext, err := v.keys.Open(data)
+	if err != nil {
+		return nil, fmt.Errorf("decrypting %s: %w", filepath.Base(path), err)
+	}
+	return plaintext, nil
+}
+
+// appendLine appends a line to a vault file. Encrypted files are rewritten whole,
+// sealed for the actors given and everyone the file was already sealed for, so
+// callers must hold the lock for the file.
+func (v *Vault) appendLine(path string, line []byte, actors ...string) error {
+	if !v.Encrypted(path) {
+		return AppendLine(path, line)
+	}
+	raw, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	content := raw
+	if IsEncrypted(raw) {
+		if content, err = v.keys.Open(raw); err != nil {
+			return fmt.Errorf("decrypting %s: %w", filepath.Base(path), err)
+		}
+		if len(actors) > 0 {
+			actors = append(sealedFor(raw), actors...)
+		}
+	}
+	content = append(content, line...)
+	if !bytes.HasSuffix(line, []byte("\n")) {
+		content = append(content, '\n')
+	}
+	return v.WriteFile(path, content, actors...)
+}
+
+// EncryptFile encrypts an existing plaintext file for the actor in its frontmatter
+// or JSONL lines, or for everyone with a key if it has none. Returns false if the
+// file was already encrypted.
+func (v *Vault) EncryptFile(path string) (bool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return false, err
+	}
+	if IsEncrypted(data) {
+		return false, nil
+	}
+	sealed, err := v.keys.Seal(data, fileActors(data)...)
+	if err != nil {
+		return false, fmt.Errorf("encrypting %s: %w", filepath.Base(path), err)
+	}
+	return true, WriteFileAtomic(path, sealed)
+}
+
+// DecryptFile replaces an encrypted file with its plaintext. Returns false if the
+// file was not encrypted.
+func (v *Vault) DecryptFile(path string) (bool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return false, err
+	}
+	if !IsEncrypted(data) {
+		return false, nil
+	}
+	plaintext, err := v.keys.Open(data)
+	if err != nil {
+		return false, fmt.Errorf("decrypting %s: %w", filepath.Base(path), err)
+	}
+	return true, WriteFileAtomic(path, plaintext)
+}
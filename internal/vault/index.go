@@ -0,0 +1,38 @@
+package vault
+
+import (
+	"log"
+	"time"
+)
+
+// Document is a vault file handed to the search indexer
+type Document struct {
+	ID       string
+	Kind     string // capture, note, journal, journal_daily, research
+	Actor    string
+	Category string
+	Path     string
+	Title    string
+	Body     string
+	Created  time.Time
+}
+
+// Indexer keeps a search index in step with vault writes
+type Indexer interface {
+	IndexDocument(doc Document) error
+}
+
+// SetIndexer sets the search indexer notified on every write
+func (v *Vault) SetIndexer(indexer Indexer) {
+	v.indexer = indexer
+}
+
+// Index passes a document to the indexer, if any (fail closed - never fails the write)
+func (v *Vault) Index(doc Document) {
+	if v.indexer == nil {
+		return
+	}
+	if err := v.indexer.IndexDocument(doc); err != nil {
+		log.Printf("Failed to index %s %s: %v", doc.Kind, doc.ID, err)
+	}
+}
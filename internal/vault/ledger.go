@@ -39,7 +39,7 @@ func (v *Vault) WriteTransaction(txn Transaction) (string, error) {
 		return "", fmt.Errorf("marshaling transaction: %w", err)
 	}
 
-	if err := AppendLine(fullPath, line); err != nil {
+	if err := v.appendLine(fullPath, line, txn.Actor); err != nil {
 		return "", fmt.Errorf("appending transaction: %w", err)
 	}
 
@@ -14,6 +14,7 @@ type Letter struct {
 	ForDate string // "2024-01-15" or "2024-W03"
 	Actor   string
 	Content string
+	Prompt  string // prompt template the letter was generated from; empty for canned letters
 }
 
 // WriteLetter writes a letter to the appropriate folder
@@ -39,7 +40,7 @@ func (v *Vault) WriteLetter(letter Letter) (string, error) {
 	// Build content
 	content := v.buildLetterContent(letter)
 
-	if err := WriteFileAtomic(fullPath, []byte(content)); err != nil {
+	if err := v.WriteFile(fullPath, []byte(content), letter.Actor); err != nil {
 		return "", fmt.Errorf("writing letter: %w", err)
 	}
 
@@ -47,12 +48,17 @@ func (v *Vault) WriteLetter(letter Letter) (string, error) {
 }
 
 func (v *Vault) buildLetterContent(letter Letter) string {
-	return fmt.Sprintf("---\nid: %s\ntype: %s\nfor_date: %s\nactor: %s\ncreated: %s\n---\n\n%s\n",
+	var prompt string
+	if letter.Prompt != "" {
+		prompt = fmt.Sprintf("prompt: %s\n", letter.Prompt)
+	}
+	return fmt.Sprintf("---\nid: %s\ntype: %s\nfor_date: %s\nactor: %s\ncreated: %s\n%s---\n\n%s\n",
 		letter.ID,
 		letter.Type,
 		letter.ForDate,
 		letter.Actor,
 		time.Now().UTC().Format(time.RFC3339),
+		prompt,
 		letter.Content,
 	)
 }
@@ -71,7 +77,7 @@ func (v *Vault) ReadLetter(letterType, forDate string) (string, error) {
 
 	fullPath := filepath.Join(v.basePath, "Letters", subdir, forDate+".md")
 
-	content, err := os.ReadFile(fullPath)
+	content, err := v.ReadFile(fullPath)
 	if err != nil {
 		return "", fmt.Errorf("reading letter: %w", err)
 	}
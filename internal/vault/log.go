@@ -36,7 +36,7 @@ func (v *Vault) LogCapture(entry CaptureLog) error {
 		return fmt.Errorf("marshaling capture log: %w", err)
 	}
 
-	if err := AppendLine(fullPath, line); err != nil {
+	if err := v.appendLine(fullPath, line, entry.Actor); err != nil {
 		return fmt.Errorf("appending capture log: %w", err)
 	}
 
@@ -20,6 +20,8 @@ type Note struct {
 	Tags       []string
 	Title      string
 	Content    string
+	Related    []string // vault paths of related notes, written as wiki links
+	Prompt     string   // prompt template the note was classified with, e.g. "classifier@3"
 }
 
 // Vault handles all file operations for the vault
@@ -27,6 +29,11 @@ type Vault struct {
 	basePath   string
 	ledgerLock sync.Mutex // Protects ledger JSONL writes from race conditions
 	logLock    sync.Mutex // Protects capture log JSONL writes from race conditions
+	auditLock  sync.Mutex // Protects audit log JSONL writes and pruning
+	indexer    Indexer    // Optional search index, updated after each write
+
+	keys             Keyring         // vault keys by actor, see SetEncryption
+	encryptedFolders map[string]bool // top-level folders written encrypted
 }
 
 // NewVault creates a new Vault instance
@@ -53,10 +60,21 @@ func (v *Vault) WriteNote(note Note) (string, error) {
 	// Build content with YAML frontmatter
 	content := v.buildNoteContent(note)
 
-	if err := WriteFileAtomic(fullPath, []byte(content)); err != nil {
+	if err := v.WriteFile(fullPath, []byte(content), note.Actor); err != nil {
 		return "", fmt.Errorf("writing note: %w", err)
 	}
 
+	v.Index(Document{
+		ID:       note.ID,
+		Kind:     "note",
+		Actor:    note.Actor,
+		Category: note.Category,
+		Path:     relPath,
+		Title:    note.Title,
+		Body:     note.Content,
+		Created:  note.Created,
+	})
+
 	return relPath, nil
 }
 
@@ -71,6 +89,9 @@ func (v *Vault) buildNoteContent(note Note) string {
 	sb.WriteString(fmt.Sprintf("confidence: %.2f\n", note.Confidence))
 	sb.WriteString(fmt.Sprintf("actor: %s\n", note.Actor))
 	sb.WriteString(fmt.Sprintf("device: %s\n", note.DeviceID))
+	if note.Prompt != "" {
+		sb.WriteString(fmt.Sprintf("prompt: %s\n", note.Prompt))
+	}
 
 	if len(note.Tags) > 0 {
 		sb.WriteString("tags:\n")
@@ -81,6 +102,14 @@ func (v *Vault) buildNoteContent(note Note) string {
 		sb.WriteString("tags: []\n")
 	}
 
+	if len(note.Related) > 0 {
+		sb.WriteString("related:\n")
+		for _, path := range note.Related {
+			link := strings.TrimSuffix(filepath.ToSlash(path), ".md")
+			sb.WriteString(fmt.Sprintf("  - \"[[%s]]\"\n", link))
+		}
+	}
+
 	sb.WriteString("---\n\n")
 
 	// Content
@@ -149,10 +178,21 @@ func (v *Vault) WriteRawJournalCapture(note Note) (string, error) {
 	// Build content with YAML frontmatter (narrator format)
 	content := v.buildRawJournalContent(note)
 
-	if err := WriteFileAtomic(fullPath, []byte(content)); err != nil {
+	if err := v.WriteFile(fullPath, []byte(content), note.Actor); err != nil {
 		return "", fmt.Errorf("writing raw journal: %w", err)
 	}
 
+	v.Index(Document{
+		ID:       note.ID,
+		Kind:     "journal",
+		Actor:    note.Actor,
+		Category: "Journal",
+		Path:     relPath,
+		Title:    note.Title,
+		Body:     note.Content,
+		Created:  note.Created,
+	})
+
 	return relPath, nil
 }
 
@@ -165,6 +205,9 @@ func (v *Vault) buildRawJournalContent(note Note) string {
 	sb.WriteString(fmt.Sprintf("created: %s\n", note.Created.Format(time.RFC3339)))
 	sb.WriteString(fmt.Sprintf("actor: %s\n", note.Actor))
 	sb.WriteString(fmt.Sprintf("device: %s\n", note.DeviceID))
+	if note.Prompt != "" {
+		sb.WriteString(fmt.Sprintf("prompt: %s\n", note.Prompt))
+	}
 	sb.WriteString("---\n\n")
 
 	// Content
@@ -1,6 +1,7 @@
 package vault
 
 import (
+	"errors"
 	"os"
 	"path/filepath"
 	"strings"
@@ -176,3 +177,286 @@ func TestSlugify(t *testing.T) {
 		}
 	}
 }
+
+func TestWriteNoteRelated(t *testing.T) {
+	v := NewVault(t.TempDir())
+
+	relPath, err := v.WriteNote(Note{
+		ID:       "cap_rel",
+		Created:  time.Date(2024, 1, 15, 9, 30, 0, 0, time.UTC),
+		Category: "Health",
+		Actor:    "wolf",
+		Title:    "Cardio plan",
+		Content:  "Twenty minutes a day.",
+		Related:  []string{"Health/2024-01-02-exercise-bike.md"},
+	})
+	if err != nil {
+		t.Fatalf("writing note: %v", err)
+	}
+
+	content, _ := os.ReadFile(filepath.Join(v.BasePath(), relPath))
+	if !strings.Contains(string(content), "related:\n  - \"[[Health/2024-01-02-exercise-bike]]\"\n---") {
+		t.Errorf("missing related section in frontmatter:\n%s", content)
+	}
+}
+
+func TestAuditLogPrune(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "vault-test-*")
+	if err != nil {
+		t.Fatalf("creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	v := NewVault(tmpDir)
+
+	now := time.Now().UTC()
+	for i, age := range []time.Duration{400 * 24 * time.Hour, 2 * time.Hour, 0} {
+		entry := AuditLog{
+			TS:      now.Add(-age).Format(time.RFC3339),
+			Actor:   "wolf",
+			Method:  "POST",
+			Route:   "/api/v1/capture",
+			Targets: []string{"cap_" + string(rune('a'+i))},
+			Status:  200,
+			Outcome: "ok",
+		}
+		if err := v.LogAudit(entry); err != nil {
+			t.Fatalf("logging audit entry: %v", err)
+		}
+	}
+
+	removed, err := v.PruneAuditLog(now.AddDate(0, 0, -365))
+	if err != nil {
+		t.Fatalf("pruning: %v", err)
+	}
+	if removed != 1 {
+		t.Errorf("removed %d entries, want 1", removed)
+	}
+
+	content, err := os.ReadFile(filepath.Join(tmpDir, "Log", "audit.jsonl"))
+	if err != nil {
+		t.Fatalf("reading log: %v", err)
+	}
+	str := string(content)
+	if strings.Contains(str, `"cap_a"`) || !strings.Contains(str, `"cap_b"`) || !strings.Contains(str, `"cap_c"`) {
+		t.Errorf("audit log after pruning:\n%s", str)
+	}
+
+	// Nothing older left: the file is left alone
+	if removed, err := v.PruneAuditLog(now.AddDate(0, 0, -365)); err != nil || removed != 0 {
+		t.Errorf("second prune = %d, %v; want 0", removed, err)
+	}
+}
+
+func testKeyring(t *testing.T, actors ...string) Keyring {
+	t.Helper()
+	var entries []string
+	for _, actor := range actors {
+		key, err := GenerateKey()
+		if err != nil {
+			t.Fatalf("generating key: %v", err)
+		}
+		entries = append(entries, actor+"="+key)
+	}
+	keys, err := ParseKeys(strings.Join(entries, ","))
+	if err != nil {
+		t.Fatalf("parsing keys: %v", err)
+	}
+	return keys
+}
+
+func TestSealOpen(t *testing.T) {
+	keys := testKeyring(t, "wolf", "wife")
+	stale := testKeyring(t, "kid")
+	plaintext := []byte("---\nactor: wolf\n---\n\nblood pressure 120/80\n")
+
+	tests := []struct {
+		name    string
+		actors  []string
+		reader  Keyring
+		tamper  func([]byte) []byte
+		wantErr bool
+	}{
+		{name: "own key", actors: []string{"wolf"}, reader: Keyring{"wolf": keys["wolf"]}},
+		{name: "shared with everyone", reader: Keyring{"wife": keys["wife"]}},
+		{name: "someone else's key", actors: []string{"wolf"}, reader: Keyring{"wife": keys["wife"]}, wantErr: true},
+		{name: "wrong key", actors: []string{"wolf"}, reader: Keyring{"wolf": keys["wife"]}, wantErr: true},
+		{name: "stale key before a good one", actors: []string{"wolf", "wife"}, reader: Keyring{"wolf": stale["kid"], "wife": keys["wife"]}},
+		{name: "every key stale", actors: []string{"wolf", "wife"}, reader: Keyring{"wolf": stale["kid"], "wife": stale["kid"]}, wantErr: true},
+		{name: "tampered content", actors: []string{"wolf"}, reader: keys, wantErr: true, tamper: func(b []byte) []byte {
+			b[len(b)-1] ^= 1
+			return b
+		}},
+		{name: "recipient renamed", actors: []string{"wolf"}, reader: Keyring{"wife": keys["wolf"]}, wantErr: true, tamper: func(b []byte) []byte {
+			return []byte(strings.Replace(string(b), "-> wolf ", "-> wife ", 1))
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sealed, err := keys.Seal(plaintext, tt.actors...)
+			if err != nil {
+				t.Fatalf("sealing: %v", err)
+			}
+			if !IsEncrypted(sealed) || strings.Contains(string(sealed), "blood pressure") {
+				t.Fatalf("sealed file is not encrypted:\n%s", sealed)
+			}
+			if tt.tamper != nil {
+				sealed = tt.tamper(sealed)
+			}
+			got, err := tt.reader.Open(sealed)
+			if tt.wantErr {
+				if err == nil {
+					t.Error("opening succeeded")
+				}
+				return
+			}
+			if err != nil || string(got) != string(plaintext) {
+				t.Errorf("Open = %q, %v", got, err)
+			}
+		})
+	}
+
+	if _, err := keys.Seal(plaintext, "kid"); !errors.Is(err, ErrNoKey) {
+		t.Errorf("sealing for an actor without a key: %v, want ErrNoKey", err)
+	}
+	if _, err := ParseKeys("wolf=c2hvcnQ="); err == nil {
+		t.Error("parsed a short key")
+	}
+
+	sealed, err := keys.SealText("blood pressure 120/80", "wolf")
+	if err != nil || !keys.IsSealedText(sealed) || strings.Contains(sealed, "blood pressure") {
+		t.Fatalf("SealText = %q, %v", sealed, err)
+	}
+	if text, err := keys.OpenText(sealed); err != nil || text != "blood pressure 120/80" {
+		t.Errorf("OpenText = %q, %v", text, err)
+	}
+	if _, err := (Keyring{"wife": keys["wife"]}).OpenText(sealed); !errors.Is(err, ErrNoKey) {
+		t.Errorf("wife opening wolf's text: %v, want ErrNoKey", err)
+	}
+	if text, err := keys.SealText("no key", "kid"); err != nil || text != "no key" {
+		t.Errorf("SealText for an actor without a key = %q, %v; want it unsealed", text, err)
+	}
+}
+
+func TestEncryptedFolders(t *testing.T) {
+	tmpDir := t.TempDir()
+	v := NewVault(tmpDir)
+	keys := testKeyring(t, "wolf", "wife")
+	v.SetEncryption(keys, []string{"Health", "Financial", "Letters"})
+
+	created := time.Date(2024, 1, 15, 9, 0, 0, 0, time.UTC)
+	health, err := v.WriteNote(Note{ID: "cap_1", Created: created, Category: "Health", Actor: "wolf", Title: "Blood pressure", Content: "120/80"})
+	if err != nil {
+		t.Fatalf("writing health note: %v", err)
+	}
+	ideas, err := v.WriteNote(Note{ID: "cap_2", Created: created, Category: "Ideas", Actor: "wolf", Title: "Rain clock", Content: "a clock"})
+	if err != nil {
+		t.Fatalf("writing idea: %v", err)
+	}
+	cold, err := v.WriteNote(Note{ID: "cap_3", Created: created, Category: "Health", Actor: "kid", Title: "Cold", Content: "sniffles"})
+	if err != nil {
+		t.Fatalf("writing for a user without a key: %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := v.WriteTransaction(NewTransaction("cap_tx", "wife", "", "coffee", 3.5, "GBP", "Cafe", "food", "", 0.9)); err != nil {
+			t.Fatalf("writing transaction: %v", err)
+		}
+	}
+	if _, err := v.WriteLetter(Letter{ID: "let_1", Type: "daily", ForDate: "2024-01-15", Actor: "wolf", Content: "Good morning"}); err != nil {
+		t.Fatalf("writing letter: %v", err)
+	}
+
+	tests := []struct {
+		path      string
+		encrypted bool
+		want      string
+	}{
+		{health, true, "120/80"},
+		{ideas, false, "a clock"},
+		{cold, false, "sniffles"}, // no key for kid
+		{filepath.Join("Financial", "Ledger", "transactions_wife.jsonl"), true, `"merchant":"Cafe"`},
+		{filepath.Join("Letters", "Daily", "2024-01-15.md"), true, "Good morning"},
+	}
+	for _, tt := range tests {
+		path := filepath.Join(tmpDir, tt.path)
+		raw, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("reading %s: %v", tt.path, err)
+		}
+		if IsEncrypted(raw) != tt.encrypted || (tt.encrypted && strings.Contains(string(raw), tt.want)) {
+			t.Errorf("%s on disk: encrypted %v, want %v", tt.path, IsEncrypted(raw), tt.encrypted)
+		}
+		content, err := v.ReadFile(path)
+		if err != nil || !strings.Contains(string(content), tt.want) {
+			t.Errorf("ReadFile(%s) = %q, %v; want %q", tt.path, content, err, tt.want)
+		}
+	}
+
+	ledger, _ := v.ReadFile(filepath.Join(tmpDir, "Financial", "Ledger", "transactions_wife.jsonl"))
+	if n := strings.Count(string(ledger), "\n"); n != 2 {
+		t.Errorf("ledger has %d lines, want 2", n)
+	}
+	if letter, err := v.ReadLetter("daily", "2024-01-15"); err != nil || !strings.Contains(letter, "Good morning") {
+		t.Errorf("ReadLetter = %q, %v", letter, err)
+	}
+
+	// Converting existing files keeps each user's files theirs
+	healthPath := filepath.Join(tmpDir, health)
+	if ok, err := v.DecryptFile(healthPath); !ok || err != nil {
+		t.Fatalf("DecryptFile = %v, %v", ok, err)
+	}
+	if raw, _ := os.ReadFile(healthPath); IsEncrypted(raw) {
+		t.Error("decrypted file is still encrypted")
+	}
+	if ok, err := v.EncryptFile(healthPath); !ok || err != nil {
+		t.Fatalf("EncryptFile = %v, %v", ok, err)
+	}
+	if ok, _ := v.EncryptFile(healthPath); ok {
+		t.Error("encrypted a file twice")
+	}
+	raw, _ := os.ReadFile(healthPath)
+	if _, err := (Keyring{"wife": keys["wife"]}).Open(raw); !errors.Is(err, ErrNoKey) {
+		t.Errorf("wife opening wolf's note: %v, want ErrNoKey", err)
+	}
+}
+
+func TestRewriteLines(t *testing.T) {
+	tmpDir := t.TempDir()
+	v := NewVault(tmpDir)
+	v.SetEncryption(testKeyring(t, "wolf", "wife"), []string{"Health"})
+	for _, actor := range []string{"wolf", "wife", "wolf"} {
+		if err := v.LogCapture(NewCaptureLog("cap_"+actor, actor, "auto", actor+" text", "Ideas", "filed", "", 0.9)); err != nil {
+			t.Fatalf("logging capture: %v", err)
+		}
+	}
+	relPath := filepath.Join("Log", "captures.jsonl")
+
+	selected, err := v.SelectLines(relPath, ByActor("wolf"))
+	if err != nil || strings.Count(string(selected), "\n") != 2 || strings.Contains(string(selected), "wife") {
+		t.Errorf("SelectLines(wolf) = %q, %v; want wolf's 2 lines", selected, err)
+	}
+
+	isWolf := ByActor("wolf")
+	n, err := v.RewriteLines(relPath, func(line []byte) []byte {
+		if isWolf(line) {
+			return nil
+		}
+		return line
+	})
+	if err != nil || n != 2 {
+		t.Fatalf("RewriteLines = %d, %v; want 2 lines removed", n, err)
+	}
+
+	raw, _ := os.ReadFile(filepath.Join(tmpDir, relPath))
+	if !IsEncrypted(raw) || strings.Join(sealedFor(raw), ",") != "wolf,wife" {
+		t.Errorf("rewritten log: encrypted %v for %v, want encrypted for wolf and wife", IsEncrypted(raw), sealedFor(raw))
+	}
+	content, err := v.ReadFile(filepath.Join(tmpDir, relPath))
+	if err != nil || strings.Contains(string(content), "wolf text") || !strings.Contains(string(content), "wife text") {
+		t.Errorf("rewritten log = %q, %v; want only wife's line", content, err)
+	}
+
+	if n, err := v.RewriteLines(filepath.Join("Log", "missing.jsonl"), func(line []byte) []byte { return nil }); n != 0 || err != nil {
+		t.Errorf("RewriteLines on a missing file = %d, %v; want 0, nil", n, err)
+	}
+}